@@ -19,8 +19,10 @@
 package services
 
 import (
+	"bytes"
 	"encoding/json"
 	"github.com/kiebitz-oss/services/crypto"
+	"strings"
 	"time"
 )
 
@@ -50,6 +52,10 @@ type ConfirmProviderParams struct {
 	PublicProviderData    *SignedProviderData    `json:"publicProviderData"`
 	ConfirmedProviderData *ConfirmedProviderData `json:"confirmedProviderData"`
 	SignedKeyData         *SignedProviderKeyData `json:"signedKeyData"`
+	// the metadata hash the mediator recomputed from the decrypted provider
+	// data, required if the provider registered with an invitation bound to
+	// provider metadata
+	MetadataHash []byte `json:"metadataHash,omitempty"`
 }
 
 type ConfirmedProviderData struct {
@@ -142,8 +148,87 @@ func (k *MediatorKeyData) Sign(key *crypto.Key) (*SignedMediatorKeyData, error)
 }
 
 type MediatorKeyData struct {
-	Signing    []byte `json:"signing"`
-	Encryption []byte `json:"encryption"`
+	Signing    []byte     `json:"signing"`
+	Encryption []byte     `json:"encryption"`
+	ValidFrom  *time.Time `json:"validFrom,omitempty"`  // optional
+	ValidUntil *time.Time `json:"validUntil,omitempty"` // optional
+	// ID of the mediator key this key replaces (optional)
+	Predecessor []byte `json:"predecessor,omitempty"`
+}
+
+// IsValidAt returns whether the given time lies within the validity period
+func (k *MediatorKeyData) IsValidAt(t time.Time) bool {
+	if k.ValidFrom != nil && t.Before(*k.ValidFrom) {
+		return false
+	}
+	if k.ValidUntil != nil && !t.Before(*k.ValidUntil) {
+		return false
+	}
+	return true
+}
+
+// RevokeMediatorKey
+
+// the signed params are stored as the revocation entry
+type RevokeMediatorKeySignedParams struct {
+	JSON      string                   `json:"data" coerce:"name:json"`
+	Data      *RevokeMediatorKeyParams `json:"-" coerce:"name:data"`
+	Signature []byte                   `json:"signature"`
+	PublicKey []byte                   `json:"publicKey"`
+}
+
+type RevokeMediatorKeyParams struct {
+	Timestamp time.Time `json:"timestamp"`
+	ID        []byte    `json:"id"`
+	Reason    string    `json:"reason"`
+}
+
+// RevokeTokens
+
+type RevokeTokensSignedParams struct {
+	JSON      string              `json:"data" coerce:"name:json"`
+	Data      *RevokeTokensParams `json:"-" coerce:"name:data"`
+	Signature []byte              `json:"signature"`
+	PublicKey []byte              `json:"publicKey"`
+}
+
+type RevokeTokensParams struct {
+	Timestamp time.Time `json:"timestamp"`
+	Tokens    [][]byte  `json:"tokens"`
+	Reason    string    `json:"reason"`
+}
+
+// GetProviderKeys
+
+type GetProviderKeysSignedParams struct {
+	JSON      string                 `json:"data" coerce:"name:json"`
+	Data      *GetProviderKeysParams `json:"-" coerce:"name:data"`
+	Signature []byte                 `json:"signature"`
+	PublicKey []byte                 `json:"publicKey"`
+}
+
+type GetProviderKeysParams struct {
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// RotateMediatorKey
+
+type RotateMediatorKeySignedParams struct {
+	JSON      string                   `json:"data" coerce:"name:json"`
+	Data      *RotateMediatorKeyParams `json:"-" coerce:"name:data"`
+	Signature []byte                   `json:"signature"`
+	PublicKey []byte                   `json:"publicKey"`
+}
+
+type RotateMediatorKeyParams struct {
+	Timestamp  time.Time               `json:"timestamp"`
+	Signatures []*ProviderKeySignature `json:"signatures"`
+}
+
+// a new signature of the (unchanged) key data of a provider
+type ProviderKeySignature struct {
+	ID        []byte `json:"id"`
+	Signature []byte `json:"signature"`
 }
 
 // AddCodes
@@ -159,6 +244,61 @@ type CodesData struct {
 	Actor     string    `json:"actor"`
 	Timestamp time.Time `json:"timestamp"`
 	Codes     [][]byte  `json:"codes"`
+	// optional batch the codes belong to
+	Batch *CodeBatchData `json:"batch,omitempty"`
+}
+
+// Codes can be uploaded in several requests, the batch is created with the
+// first one.
+type CodeBatchData struct {
+	ID        []byte     `json:"id"`
+	Label     string     `json:"label"`
+	IssuedBy  string     `json:"issuedBy"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+type CodeBatch struct {
+	ID               []byte     `json:"id"`
+	Actor            string     `json:"actor"`
+	Label            string     `json:"label"`
+	IssuedBy         string     `json:"issuedBy"`
+	CreatedAt        time.Time  `json:"createdAt"`
+	ExpiresAt        *time.Time `json:"expiresAt,omitempty"`
+	RevokedAt        *time.Time `json:"revokedAt,omitempty"`
+	RevocationReason string     `json:"revocationReason,omitempty"`
+	// number of codes in the batch and number of codes used at least once
+	Codes    int64 `json:"codes"`
+	Redeemed int64 `json:"redeemed"`
+}
+
+// RevokeCodeBatch
+
+type RevokeCodeBatchSignedParams struct {
+	JSON      string                 `json:"data" coerce:"name:json"`
+	Data      *RevokeCodeBatchParams `json:"-" coerce:"name:data"`
+	Signature []byte                 `json:"signature"`
+	PublicKey []byte                 `json:"publicKey"`
+}
+
+type RevokeCodeBatchParams struct {
+	Timestamp time.Time `json:"timestamp"`
+	Actor     string    `json:"actor"`
+	ID        []byte    `json:"id"`
+	Reason    string    `json:"reason"`
+}
+
+// GetCodeBatches
+
+type GetCodeBatchesSignedParams struct {
+	JSON      string                `json:"data" coerce:"name:json"`
+	Data      *GetCodeBatchesParams `json:"-" coerce:"name:data"`
+	Signature []byte                `json:"signature"`
+	PublicKey []byte                `json:"publicKey"`
+}
+
+type GetCodeBatchesParams struct {
+	Timestamp time.Time `json:"timestamp"`
+	Actor     string    `json:"actor"`
 }
 
 // UploadDistances
@@ -191,6 +331,10 @@ type Keys struct {
 	ProviderData []byte `json:"providerData"`
 	RootKey      []byte `json:"rootKey"`
 	TokenKey     []byte `json:"tokenKey"`
+	// only present if blind tokens are enabled
+	BlindTokenKey []byte `json:"blindTokenKey,omitempty"`
+	// only present if the key log is enabled
+	LogKey []byte `json:"logKey,omitempty"`
 }
 
 type KeyLists struct {
@@ -199,11 +343,31 @@ type KeyLists struct {
 }
 
 type ActorKey struct {
-	ID        []byte        `json:"id"`
-	Data      string        `json:"data"`
-	Signature []byte        `json:"signature"`
-	PublicKey []byte        `json:"publicKey"`
-	data      *ActorKeyData `json:"-"`
+	ID        []byte `json:"id"`
+	Data      string `json:"data"`
+	Signature []byte `json:"signature"`
+	PublicKey []byte `json:"publicKey"`
+	// signatures of all mediators that approved the key data (optional)
+	Approvals []*KeyApproval `json:"approvals,omitempty"`
+	// the key that signed this key after a key rotation (optional)
+	Predecessor *ActorKey     `json:"predecessor,omitempty"`
+	data        *ActorKeyData `json:"-"`
+}
+
+// Origin returns the first key of a chain of rotated keys, which is the one
+// that has been signed by a mediator
+func (a *ActorKey) Origin() *ActorKey {
+	key := a
+	for key.Predecessor != nil {
+		key = key.Predecessor
+	}
+	return key
+}
+
+// a signature over the key data of an actor key
+type KeyApproval struct {
+	Signature []byte `json:"signature"`
+	PublicKey []byte `json:"publicKey"`
 }
 
 func (a *ActorKey) KeyData() (*ActorKeyData, error) {
@@ -229,6 +393,14 @@ func (a *ActorKey) ProviderKeyData() (*ProviderKeyData, error) {
 	return pkd, nil
 }
 
+func (a *ActorKey) MediatorKeyData() (*MediatorKeyData, error) {
+	var mkd *MediatorKeyData
+	if err := json.Unmarshal([]byte(a.Data), &mkd); err != nil {
+		return nil, err
+	}
+	return mkd, nil
+}
+
 type ActorKeyData struct {
 	Encryption []byte `json:"encryption"`
 	Signing    []byte `json:"signing"`
@@ -237,9 +409,10 @@ type ActorKeyData struct {
 // GetToken
 
 type GetTokenParams struct {
-	Hash      []byte `json:"hash"`
-	Code      []byte `json:"code"`
-	PublicKey []byte `json:"publicKey"`
+	Hash      []byte                  `json:"hash"`
+	Code      []byte                  `json:"code"`
+	PublicKey []byte                  `json:"publicKey"`
+	Challenge *TokenChallengeSolution `json:"challenge,omitempty"`
 }
 
 type SignedTokenData struct {
@@ -264,6 +437,62 @@ func (k *TokenData) Sign(key *crypto.Key) (*SignedTokenData, error) {
 	}
 }
 
+// GetBlindToken
+
+type GetBlindTokenParams struct {
+	BlindedToken []byte                  `json:"blindedToken"`
+	Code         []byte                  `json:"code"`
+	Challenge    *TokenChallengeSolution `json:"challenge,omitempty"`
+}
+
+type BlindTokenSignature struct {
+	Signature []byte `json:"signature"`
+}
+
+// A token that the user obtained via a blind signature. As the server only
+// saw the blinded data when signing it, it cannot link the token to the
+// corresponding getBlindToken call.
+type BlindToken struct {
+	JSON      string          `json:"data" coerce:"name:json"`
+	Data      *BlindTokenData `json:"-" coerce:"name:data"`
+	Signature []byte          `json:"signature"`
+}
+
+type BlindTokenData struct {
+	// random serial chosen by the user, used to prevent double spending
+	Serial []byte `json:"serial"`
+	// key the user signs requests with
+	PublicKey []byte `json:"publicKey"`
+}
+
+// GetTokenChallenge
+
+type GetTokenChallengeParams struct {
+}
+
+type TokenChallenge struct {
+	Nonce []byte `json:"nonce"`
+	// number of leading zero bits the solution hash needs to have
+	Difficulty int64     `json:"difficulty"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+// The challenge is authenticated with an HMAC using the server secret, so
+// we can verify it later without having to store it.
+type SignedTokenChallenge struct {
+	JSON      string          `json:"data" coerce:"name:json"`
+	Data      *TokenChallenge `json:"-" coerce:"name:data"`
+	Signature []byte          `json:"signature"`
+}
+
+// A solution is valid if SHA-256(nonce || hash || solution) has at least the
+// given number of leading zero bits, where the hash is the user-generated
+// hash (or the blinded token for blind tokens).
+type TokenChallengeSolution struct {
+	Challenge *SignedTokenChallenge `json:"challenge"`
+	Solution  []byte                `json:"solution"`
+}
+
 type PriorityToken struct {
 	N int64 `json:"n"`
 }
@@ -282,6 +511,8 @@ type TokenData struct {
 	PublicKey []byte         `json:"publicKey"`
 	Token     []byte         `json:"token"`
 	Hash      []byte         `json:"hash"`
+	// tokens issued before expiry was introduced do not have an expiry date
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
 }
 
 // GetAppointmentsByZipCode
@@ -297,6 +528,11 @@ type GetAppointmentsByZipCodeParams struct {
 type KeyChain struct {
 	Provider *ActorKey `json:"provider"`
 	Mediator *ActorKey `json:"mediator"`
+	// keys of all mediators that approved the provider key (optional)
+	Mediators []*ActorKey `json:"mediators,omitempty"`
+	// delegations of the keys that signed some of the appointments instead
+	// of the provider key, signed by the provider (optional)
+	Delegations []*SignedDelegationData `json:"delegations,omitempty"`
 }
 
 type ProviderAppointments struct {
@@ -428,6 +664,81 @@ type Slot struct {
 	ID []byte `json:"id"`
 }
 
+// DeleteAppointments
+
+type DeleteAppointmentsSignedParams struct {
+	JSON      string                    `json:"data" coerce:"name:json"`
+	Data      *DeleteAppointmentsParams `json:"-" coerce:"name:data"`
+	Signature []byte                    `json:"signature"`
+	PublicKey []byte                    `json:"publicKey"`
+}
+
+// either a list of IDs or a date range (or both) can be given
+type DeleteAppointmentsParams struct {
+	Timestamp time.Time  `json:"timestamp"`
+	IDs       [][]byte   `json:"ids"`
+	From      *time.Time `json:"from"`
+	To        *time.Time `json:"to"`
+}
+
+// GetDeletedAppointments
+
+type GetDeletedAppointmentsSignedParams struct {
+	JSON      string                        `json:"data" coerce:"name:json"`
+	Data      *GetDeletedAppointmentsParams `json:"-" coerce:"name:data"`
+	Signature []byte                        `json:"signature"`
+	PublicKey []byte                        `json:"publicKey"`
+}
+
+type GetDeletedAppointmentsParams struct {
+	Timestamp    time.Time  `json:"timestamp"`
+	UpdatedSince *time.Time `json:"updatedSince"`
+}
+
+// a tombstone records the deletion of an appointment, so that clients that
+// only fetch updated appointments learn about it
+type AppointmentTombstone struct {
+	ID        []byte    `json:"id"`
+	DeletedAt time.Time `json:"deletedAt"`
+}
+
+// SyncProviderAppointments
+
+type SyncProviderAppointmentsSignedParams struct {
+	JSON      string                          `json:"data" coerce:"name:json"`
+	Data      *SyncProviderAppointmentsParams `json:"-" coerce:"name:data"`
+	Signature []byte                          `json:"signature"`
+	PublicKey []byte                          `json:"publicKey"`
+}
+
+type SyncProviderAppointmentsParams struct {
+	Timestamp time.Time `json:"timestamp"`
+	Since     int64     `json:"since"`
+	Epoch     []byte    `json:"epoch,omitempty"`
+	Limit     int64     `json:"limit"`
+}
+
+// an entry in the per-provider change log of appointments
+type AppointmentChange struct {
+	Seq     int64  `json:"seq"`
+	ID      []byte `json:"id"`
+	Deleted bool   `json:"deleted"`
+}
+
+type AppointmentsSync struct {
+	// the sequence number and epoch the client should pass in the next sync
+	// request
+	Seq   int64  `json:"seq"`
+	Epoch []byte `json:"epoch"`
+	More  bool   `json:"more"`
+	// the changes since the given sequence number are no longer available,
+	// the client needs to fetch all appointments again before it continues
+	// with the returned sequence number
+	ResyncRequired bool                 `json:"resyncRequired"`
+	Upserts        []*SignedAppointment `json:"upserts"`
+	Deletions      [][]byte             `json:"deletions"`
+}
+
 // BookAppointment
 
 type BookAppointmentSignedParams struct {
@@ -441,7 +752,8 @@ type BookAppointmentParams struct {
 	ProviderID      []byte                    `json:"providerID"`
 	ID              []byte                    `json:"id"`
 	EncryptedData   *crypto.ECDHEncryptedData `json:"encryptedData"`
-	SignedTokenData *SignedTokenData          `json:"signedTokenData"`
+	SignedTokenData *SignedTokenData          `json:"signedTokenData,omitempty"`
+	BlindToken      *BlindToken               `json:"blindToken,omitempty"`
 	Timestamp       time.Time                 `json:"timestamp"`
 }
 
@@ -471,7 +783,8 @@ type CancelAppointmentSignedParams struct {
 type CancelAppointmentParams struct {
 	Timestamp       time.Time        `json:"timestamp"`
 	ProviderID      []byte           `json:"providerID"`
-	SignedTokenData *SignedTokenData `json:"signedTokenData"`
+	SignedTokenData *SignedTokenData `json:"signedTokenData,omitempty"`
+	BlindToken      *BlindToken      `json:"blindToken,omitempty"`
 	ID              []byte           `json:"id"`
 	SlotID          []byte           `json:"slotID"`
 }
@@ -489,6 +802,19 @@ type CheckProviderDataParams struct {
 	Timestamp time.Time `json:"timestamp"`
 }
 
+const (
+	ProviderDataPending   = "pending"
+	ProviderDataConfirmed = "confirmed"
+	ProviderDataRejected  = "rejected"
+)
+
+// status of the data most recently submitted by a provider
+type ProviderDataStatus struct {
+	Status        string                      `json:"status"`
+	ConfirmedData *ConfirmedProviderData      `json:"confirmedData,omitempty"`
+	Rejection     *RejectProviderSignedParams `json:"rejection,omitempty"`
+}
+
 // StoreProviderData
 
 type StoreProviderDataSignedParams struct {
@@ -502,11 +828,72 @@ type StoreProviderDataParams struct {
 	Timestamp     time.Time                 `json:"timestamp"`
 	EncryptedData *crypto.ECDHEncryptedData `json:"encryptedData"`
 	Code          []byte                    `json:"code"`
+	// required if the code is an invitation bound to provider metadata
+	MetadataHash []byte `json:"metadataHash,omitempty"`
 }
 
 type RawProviderData struct {
 	ID            []byte                    `json:"id,omitempty"`
 	EncryptedData *crypto.ECDHEncryptedData `json:"encryptedData"`
+	// version of verified provider data, starting at 1
+	Version int64 `json:"version,omitempty"`
+	// version of the verified provider data that an update replaces
+	BaseVersion int64 `json:"baseVersion,omitempty"`
+	// the invitation the provider registered with (if any)
+	Invitation *Invitation `json:"invitation,omitempty"`
+}
+
+// IssueInvitation
+
+type IssueInvitationSignedParams struct {
+	JSON      string                 `json:"data" coerce:"name:json"`
+	Data      *IssueInvitationParams `json:"-" coerce:"name:data"`
+	Signature []byte                 `json:"signature"`
+	PublicKey []byte                 `json:"publicKey"`
+}
+
+// An invitation is a provider code bound to a provider identity, either to
+// the key the provider signs its data with or to a hash of the provider
+// metadata (see ProviderMetadataHash), or both.
+type IssueInvitationParams struct {
+	Timestamp    time.Time  `json:"timestamp"`
+	Code         []byte     `json:"code"`
+	ProviderKey  []byte     `json:"providerKey,omitempty"`
+	MetadataHash []byte     `json:"metadataHash,omitempty"`
+	ExpiresAt    *time.Time `json:"expiresAt,omitempty"`
+}
+
+type Invitation struct {
+	// the hash of the code, so that the code itself is not revealed
+	ID           []byte     `json:"id"`
+	ProviderKey  []byte     `json:"providerKey,omitempty"`
+	MetadataHash []byte     `json:"metadataHash,omitempty"`
+	ExpiresAt    *time.Time `json:"expiresAt,omitempty"`
+	IssuedAt     time.Time  `json:"issuedAt"`
+	// the key of the root or mediator that issued the invitation
+	IssuedBy []byte `json:"issuedBy"`
+	// the provider that used the invitation
+	UsedBy []byte     `json:"usedBy,omitempty"`
+	UsedAt *time.Time `json:"usedAt,omitempty"`
+}
+
+// Returns the hash of the provider metadata an invitation can be bound to.
+// As the provider data is encrypted, only mediators can compare it with the
+// hash of the submitted provider data.
+func ProviderMetadataHash(name, zipCode string) []byte {
+	normalize := func(s string) string {
+		return strings.ToLower(strings.Join(strings.Fields(s), " "))
+	}
+	return crypto.Hash([]byte(normalize(name) + "\n" + normalize(zipCode)))
+}
+
+// MatchesData returns false if the invitation is bound to provider metadata
+// that does not match the given provider data
+func (i *Invitation) MatchesData(data *ProviderData) bool {
+	if i.MetadataHash == nil {
+		return true
+	}
+	return bytes.Equal(i.MetadataHash, ProviderMetadataHash(data.Name, data.ZipCode))
 }
 
 // GetPendingProviderData
@@ -521,6 +908,135 @@ type GetPendingProviderDataSignedParams struct {
 type GetPendingProviderDataParams struct {
 	Timestamp time.Time `json:"timestamp"`
 	Limit     int64     `json:"limit"`
+	Offset    int64     `json:"offset"`
+	// only return entries that are not claimed by other mediators
+	Unclaimed bool `json:"unclaimed"`
+}
+
+// provider data waiting for verification, returned in order of submission
+type PendingProviderData struct {
+	ID            []byte                    `json:"id"`
+	EncryptedData *crypto.ECDHEncryptedData `json:"encryptedData"`
+	SubmittedAt   time.Time                 `json:"submittedAt"`
+	Claim         *VerificationClaim        `json:"claim,omitempty"`
+	// for updates, the version of the verified data that the update replaces
+	BaseVersion int64 `json:"baseVersion,omitempty"`
+	// for updates, the currently verified data
+	VerifiedData *RawProviderData `json:"verifiedData,omitempty"`
+	// the invitation the provider registered with (if any)
+	Invitation *Invitation `json:"invitation,omitempty"`
+	// set if the invitation is bound to provider metadata. We can only compare
+	// the hash declared by the provider, so mediators must recompute it from
+	// the decrypted data (see MetadataMismatch) and attest it when confirming
+	// the provider.
+	MetadataCheckRequired bool `json:"metadataCheckRequired,omitempty"`
+}
+
+// MetadataMismatch returns true if the invitation is bound to provider
+// metadata that does not match the decrypted provider data. Mediators must
+// not confirm the provider in that case.
+func (p *PendingProviderData) MetadataMismatch(data *ProviderData) bool {
+	return p.Invitation != nil && !p.Invitation.MatchesData(data)
+}
+
+// RejectProvider
+
+type RejectProviderSignedParams struct {
+	JSON      string                `json:"data" coerce:"name:json"`
+	Data      *RejectProviderParams `json:"-" coerce:"name:data"`
+	Signature []byte                `json:"signature"`
+	PublicKey []byte                `json:"publicKey"`
+}
+
+// this data is accessible to the provider, the reason is encrypted for the
+// encryption key of the provider
+type RejectProviderParams struct {
+	Timestamp       time.Time                 `json:"timestamp"`
+	ID              []byte                    `json:"id"`
+	EncryptedReason *crypto.ECDHEncryptedData `json:"encryptedReason"`
+}
+
+// RejectProviderDataUpdate
+
+type RejectProviderDataUpdateSignedParams struct {
+	JSON      string                          `json:"data" coerce:"name:json"`
+	Data      *RejectProviderDataUpdateParams `json:"-" coerce:"name:data"`
+	Signature []byte                          `json:"signature"`
+	PublicKey []byte                          `json:"publicKey"`
+}
+
+type RejectProviderDataUpdateParams struct {
+	Timestamp   time.Time `json:"timestamp"`
+	ID          []byte    `json:"id"`
+	BaseVersion int64     `json:"baseVersion"`
+	Reason      string    `json:"reason"`
+}
+
+// GetProviderDataVersions
+
+type GetProviderDataVersionsSignedParams struct {
+	JSON      string                         `json:"data" coerce:"name:json"`
+	Data      *GetProviderDataVersionsParams `json:"-" coerce:"name:data"`
+	Signature []byte                         `json:"signature"`
+	PublicKey []byte                         `json:"publicKey"`
+}
+
+type GetProviderDataVersionsParams struct {
+	Timestamp time.Time `json:"timestamp"`
+	ID        []byte    `json:"id"`
+}
+
+// all verified versions of the data of a provider and all rejected updates
+type ProviderDataHistory struct {
+	Versions   []*RawProviderData                      `json:"versions"`
+	Rejections []*RejectProviderDataUpdateSignedParams `json:"rejections"`
+}
+
+// ClaimProviderData & ReleaseProviderData
+
+// a mediator claims provider data before verifying it so that other mediators
+// do not process it at the same time, claims expire after a lease timeout
+type VerificationClaim struct {
+	MediatorID []byte    `json:"mediatorID"`
+	ClaimedAt  time.Time `json:"claimedAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+func (v *VerificationClaim) IsActive(t time.Time) bool {
+	return t.Before(v.ExpiresAt)
+}
+
+type ProviderDataClaimSignedParams struct {
+	JSON      string                   `json:"data" coerce:"name:json"`
+	Data      *ProviderDataClaimParams `json:"-" coerce:"name:data"`
+	Signature []byte                   `json:"signature"`
+	PublicKey []byte                   `json:"publicKey"`
+}
+
+type ProviderDataClaimParams struct {
+	Timestamp time.Time `json:"timestamp"`
+	ID        []byte    `json:"id"`
+}
+
+// GetPendingProviderApprovals
+
+type GetPendingProviderApprovalsSignedParams struct {
+	JSON      string                             `json:"data" coerce:"name:json"`
+	Data      *GetPendingProviderApprovalsParams `json:"-" coerce:"name:data"`
+	Signature []byte                             `json:"signature"`
+	PublicKey []byte                             `json:"publicKey"`
+}
+
+type GetPendingProviderApprovalsParams struct {
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// provider key data that has not been approved by enough mediators yet
+type PendingProviderApproval struct {
+	ID        []byte         `json:"id"`
+	Data      string         `json:"data"`
+	Approvals []*KeyApproval `json:"approvals"`
+	Required  int64          `json:"required"`
 }
 
 // GetVerifiedProviderData
@@ -537,6 +1053,199 @@ type GetVerifiedProviderDataParams struct {
 	Limit     int64     `json:"limit"`
 }
 
+// RotateProviderKey
+
+type RotateProviderKeySignedParams struct {
+	JSON      string                   `json:"data" coerce:"name:json"`
+	Data      *RotateProviderKeyParams `json:"-" coerce:"name:data"`
+	Signature []byte                   `json:"signature"`
+	PublicKey []byte                   `json:"publicKey"`
+}
+
+// the new key data is signed with the current key, the proof is a signature
+// of the signed key data with the new signing key
+type RotateProviderKeyParams struct {
+	Timestamp     time.Time              `json:"timestamp"`
+	SignedKeyData *SignedProviderKeyData `json:"signedKeyData"`
+	Proof         []byte                 `json:"proof"`
+}
+
+// ReplaceProviderKey
+
+type ReplaceProviderKeySignedParams struct {
+	JSON      string                    `json:"data" coerce:"name:json"`
+	Data      *ReplaceProviderKeyParams `json:"-" coerce:"name:data"`
+	Signature []byte                    `json:"signature"`
+	PublicKey []byte                    `json:"publicKey"`
+}
+
+type ReplaceProviderKeyParams struct {
+	Timestamp     time.Time              `json:"timestamp"`
+	ID            []byte                 `json:"id"`
+	SignedKeyData *SignedProviderKeyData `json:"signedKeyData"`
+}
+
+// Delegations
+
+const (
+	// delegates with this scope can publish and delete appointments
+	DelegationScopePublish = "publish"
+	// delegates with this scope can read appointments and their bookings
+	DelegationScopeReadBookings = "read-bookings"
+)
+
+// A delegation certificate allows an additional signing key (e.g. of a staff
+// member) to act on behalf of a provider within the given scopes. It is signed
+// by the provider and identified by the hash of the delegated signing key.
+type DelegationData struct {
+	Signing    []byte    `json:"signing"`
+	Name       string    `json:"name"`
+	Scopes     []string  `json:"scopes"`
+	ValidUntil time.Time `json:"validUntil"`
+}
+
+func (d *DelegationData) HasScope(scope string) bool {
+	for _, s := range d.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *DelegationData) Sign(key *crypto.Key) (*SignedDelegationData, error) {
+	if data, err := json.Marshal(d); err != nil {
+		return nil, err
+	} else if signedData, err := key.Sign(data); err != nil {
+		return nil, err
+	} else {
+		return &SignedDelegationData{
+			JSON:      string(data),
+			Signature: signedData.Signature,
+			PublicKey: signedData.PublicKey,
+			Data:      d,
+		}, nil
+	}
+}
+
+type SignedDelegationData struct {
+	JSON      string          `json:"data" coerce:"name:json"`
+	Data      *DelegationData `json:"-" coerce:"name:data"`
+	Signature []byte          `json:"signature"`
+	PublicKey []byte          `json:"publicKey"`
+}
+
+// AddProviderDelegation
+
+type AddProviderDelegationSignedParams struct {
+	JSON      string                       `json:"data" coerce:"name:json"`
+	Data      *AddProviderDelegationParams `json:"-" coerce:"name:data"`
+	Signature []byte                       `json:"signature"`
+	PublicKey []byte                       `json:"publicKey"`
+}
+
+type AddProviderDelegationParams struct {
+	Timestamp        time.Time             `json:"timestamp"`
+	SignedDelegation *SignedDelegationData `json:"signedDelegation"`
+}
+
+// GetProviderDelegations
+
+type GetProviderDelegationsSignedParams struct {
+	JSON      string                        `json:"data" coerce:"name:json"`
+	Data      *GetProviderDelegationsParams `json:"-" coerce:"name:data"`
+	Signature []byte                        `json:"signature"`
+	PublicKey []byte                        `json:"publicKey"`
+}
+
+type GetProviderDelegationsParams struct {
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// RevokeProviderDelegation
+
+type RevokeProviderDelegationSignedParams struct {
+	JSON      string                          `json:"data" coerce:"name:json"`
+	Data      *RevokeProviderDelegationParams `json:"-" coerce:"name:data"`
+	Signature []byte                          `json:"signature"`
+	PublicKey []byte                          `json:"publicKey"`
+}
+
+type RevokeProviderDelegationParams struct {
+	Timestamp time.Time `json:"timestamp"`
+	ID        []byte    `json:"id"`
+}
+
+// SuspendProvider, ReactivateProvider & RevokeProvider
+
+const (
+	ProviderActive    = "active"
+	ProviderSuspended = "suspended"
+	ProviderRevoked   = "revoked"
+)
+
+// the signed params are stored as they are, so they serve as a record of who
+// changed the status of a provider and why
+type ProviderStatusSignedParams struct {
+	JSON      string                `json:"data" coerce:"name:json"`
+	Data      *ProviderStatusParams `json:"-" coerce:"name:data"`
+	Signature []byte                `json:"signature"`
+	PublicKey []byte                `json:"publicKey"`
+}
+
+type ProviderStatusParams struct {
+	Timestamp time.Time `json:"timestamp"`
+	ID        []byte    `json:"id"`
+	Status    string    `json:"status"`
+	Reason    string    `json:"reason"`
+}
+
+// GetAuditLog
+
+type GetAuditLogSignedParams struct {
+	JSON      string             `json:"data" coerce:"name:json"`
+	Data      *GetAuditLogParams `json:"-" coerce:"name:data"`
+	Signature []byte             `json:"signature"`
+	PublicKey []byte             `json:"publicKey"`
+}
+
+type GetAuditLogParams struct {
+	Timestamp time.Time `json:"timestamp"`
+	From      int64     `json:"from"`
+	Limit     int64     `json:"limit"`
+}
+
+// GetKeyLogHead
+
+type GetKeyLogHeadParams struct {
+}
+
+// GetKeyLogEntries
+
+type GetKeyLogEntriesParams struct {
+	From  int64 `json:"from"`
+	Limit int64 `json:"limit"`
+}
+
+// GetKeyLogInclusionProof
+
+type GetKeyLogInclusionProofParams struct {
+	// either the index of the entry or the ID of an actor key, in which case
+	// the proof for the latest entry of that key is returned
+	Index *int64 `json:"index,omitempty"`
+	ID    []byte `json:"id,omitempty"`
+	// defaults to the current size of the tree
+	TreeSize *int64 `json:"treeSize,omitempty"`
+}
+
+// GetKeyLogConsistencyProof
+
+type GetKeyLogConsistencyProofParams struct {
+	First int64 `json:"first"`
+	// defaults to the current size of the tree
+	Second *int64 `json:"second,omitempty"`
+}
+
 // GetStats
 
 type GetStatsParams struct {
@@ -550,6 +1259,39 @@ type GetStatsParams struct {
 	N      *int64                 `json:"n"`    // optional
 }
 
+// GetProviderStats
+
+type GetProviderStatsSignedParams struct {
+	JSON      string                  `json:"data" coerce:"name:json"`
+	Data      *GetProviderStatsParams `json:"-" coerce:"name:data"`
+	Signature []byte                  `json:"signature"`
+	PublicKey []byte                  `json:"publicKey"`
+}
+
+type GetProviderStatsParams struct {
+	Timestamp time.Time  `json:"timestamp"`
+	Type      string     `json:"type"`
+	Metric    string     `json:"metric"`
+	From      *time.Time `json:"from"` // optional
+	To        *time.Time `json:"to"`   // optional
+	N         *int64     `json:"n"`    // optional
+}
+
+// MarkNoShow
+
+type MarkNoShowSignedParams struct {
+	JSON      string            `json:"data" coerce:"name:json"`
+	Data      *MarkNoShowParams `json:"-" coerce:"name:data"`
+	Signature []byte            `json:"signature"`
+	PublicKey []byte            `json:"publicKey"`
+}
+
+type MarkNoShowParams struct {
+	Timestamp time.Time `json:"timestamp"`
+	ID        []byte    `json:"id"`
+	SlotID    []byte    `json:"slotID"`
+}
+
 type StatsValue struct {
 	Name  string            `json:"name"`
 	From  time.Time         `json:"from"`
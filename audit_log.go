@@ -0,0 +1,154 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/kiebitz-oss/services/crypto"
+	"time"
+)
+
+// An entry of the audit log of privileged (root and mediator) actions. Each
+// entry contains the hash of its predecessor, so entries cannot be changed or
+// removed without breaking the chain.
+type AuditLogEntry struct {
+	Index     int64     `json:"index"`
+	Timestamp time.Time `json:"timestamp"`
+	Method    string    `json:"method"`
+	// the signed request payload (as JSON)
+	Data      string `json:"data"`
+	Signature []byte `json:"signature"`
+	PublicKey []byte `json:"publicKey"`
+	PrevHash  []byte `json:"prevHash"`
+	Hash      []byte `json:"hash"`
+}
+
+// computes the hash of the entry, which covers all fields except the hash
+// itself (including the hash of the previous entry)
+func (a *AuditLogEntry) ComputeHash() ([]byte, error) {
+
+	entry := *a
+	entry.Hash = nil
+
+	if data, err := json.Marshal(&entry); err != nil {
+		return nil, err
+	} else {
+		return crypto.Hash(data), nil
+	}
+}
+
+// returns the public keys that may sign audit log entries: the given root key
+// and the signing keys of all mediators that the root key added in the log.
+// The entries should start at the beginning of the log.
+func AuditLogSigners(entries []*AuditLogEntry, rootKey []byte) [][]byte {
+
+	signers := [][]byte{rootKey}
+
+	for _, entry := range entries {
+
+		if entry.Method != "addMediatorPublicKeys" || !bytes.Equal(entry.PublicKey, rootKey) {
+			continue
+		}
+
+		params := &AddMediatorPublicKeysParams{}
+
+		// the signature is checked by VerifyAuditLog
+		if err := json.Unmarshal([]byte(entry.Data), params); err != nil || params.SignedKeyData == nil {
+			continue
+		}
+
+		keyData := &MediatorKeyData{}
+
+		if err := json.Unmarshal([]byte(params.SignedKeyData.JSON), keyData); err != nil {
+			continue
+		}
+
+		signers = append(signers, keyData.Signing)
+	}
+
+	return signers
+}
+
+// checks that the given consecutive entries form a valid chain and that all
+// requests have been signed by one of the given public keys. If the list
+// starts at the first entry of the log, the chain is checked from its
+// beginning.
+func VerifyAuditLog(entries []*AuditLogEntry, signers [][]byte) error {
+
+	for i, entry := range entries {
+
+		if i > 0 {
+			prev := entries[i-1]
+			if entry.Index != prev.Index+1 {
+				return fmt.Errorf("entry %d: expected index %d", entry.Index, prev.Index+1)
+			}
+			if !bytes.Equal(entry.PrevHash, prev.Hash) {
+				return fmt.Errorf("entry %d: previous hash does not match", entry.Index)
+			}
+		} else if entry.Index == 1 && entry.PrevHash != nil {
+			return fmt.Errorf("entry %d: first entry has a previous hash", entry.Index)
+		}
+
+		if hash, err := entry.ComputeHash(); err != nil {
+			return err
+		} else if !bytes.Equal(hash, entry.Hash) {
+			return fmt.Errorf("entry %d: hash does not match", entry.Index)
+		}
+
+		known := false
+
+		for _, signer := range signers {
+			if bytes.Equal(signer, entry.PublicKey) {
+				known = true
+				break
+			}
+		}
+
+		if !known {
+			return fmt.Errorf("entry %d: unknown signer", entry.Index)
+		}
+
+		if ok, err := crypto.VerifyWithBytes([]byte(entry.Data), entry.Signature, entry.PublicKey); err != nil {
+			return fmt.Errorf("entry %d: %w", entry.Index, err)
+		} else if !ok {
+			return fmt.Errorf("entry %d: invalid signature", entry.Index)
+		}
+	}
+
+	return nil
+}
+
+// checks that the entries contain the given (previously pinned) head, i.e. that
+// the log has been neither truncated nor rewritten since the head was pinned
+func VerifyAuditLogHead(entries []*AuditLogEntry, index int64, hash []byte) error {
+
+	for _, entry := range entries {
+		if entry.Index != index {
+			continue
+		}
+		if !bytes.Equal(entry.Hash, hash) {
+			return fmt.Errorf("entry %d: hash does not match the pinned head", index)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("pinned head %d is missing", index)
+}
@@ -28,6 +28,10 @@ var Commands = services.CommandsDefinitions{
 		Name:  "admin",
 		Maker: helpers.Admin,
 	},
+	services.CommandsDefinition{
+		Name:  "provider",
+		Maker: helpers.Provider,
+	},
 	services.CommandsDefinition{
 		Name:  "testing",
 		Maker: helpers.Testing,
@@ -19,17 +19,26 @@
 package helpers
 
 import (
+	"bytes"
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"github.com/kiebitz-oss/services"
 	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/encryptFs"
 	"github.com/kiebitz-oss/services/helpers"
 	"github.com/kiebitz-oss/services/jsonrpc"
 	"github.com/kiprotect/go-helpers/forms"
 	"github.com/urfave/cli"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
 	"time"
 )
 
@@ -95,20 +104,28 @@ func generateMediatorKeys(settings *services.Settings) func(c *cli.Context) erro
 	return func(c *cli.Context) error {
 
 		keys := map[string]string{
-			"signing":    "ecdsa",
-			"encryption": "ecdh",
+			"signing":    c.String("signing-type"),
+			"encryption": c.String("encryption-type"),
+		}
+
+		if keys["signing"] != "ecdsa" && keys["signing"] != "ed25519" {
+			services.Log.Fatal(fmt.Sprintf("invalid signing key type: %s", keys["signing"]))
+		}
+
+		if keys["encryption"] != "ecdh" && keys["encryption"] != "x25519" {
+			services.Log.Fatal(fmt.Sprintf("invalid encryption key type: %s", keys["encryption"]))
 		}
 
 		keyData := map[string]interface{}{}
 
 		for name, keyType := range keys {
-			key, err := crypto.GenerateKey()
+			key, err := crypto.GenerateWebKey(name, keyType)
 
 			if err != nil {
 				services.Log.Fatal(err)
 			}
 
-			webKey, err := crypto.AsWebKey(key, keyType)
+			webKey, err := crypto.KeyAsWebKey(key)
 
 			if err != nil {
 				services.Log.Fatal(err)
@@ -121,19 +138,8 @@ func generateMediatorKeys(settings *services.Settings) func(c *cli.Context) erro
 		// mediators get a copy of the public/private provider data key
 		for _, name := range []string{"provider"} {
 			key := settings.Admin.Signing.Key(name)
-			publicKey, err := crypto.LoadPublicKey(key.PublicKey)
-			if err != nil {
-				services.Log.Fatal(err)
-			}
 
-			privateKey, err := crypto.LoadPrivateKey(key.PrivateKey)
-			if err != nil {
-				services.Log.Fatal(err)
-			}
-
-			privateKey.PublicKey = *publicKey
-
-			webKey, err := crypto.AsWebKey(privateKey, key.Type)
+			webKey, err := crypto.KeyAsWebKey(key)
 
 			if err != nil {
 				services.Log.Fatal(err)
@@ -163,33 +169,160 @@ func exportRootPublicKey(settings *services.Settings) func(c *cli.Context) error
 	return func(c *cli.Context) error {
 		key := settings.Admin.Signing.Key("root")
 
-		publicKey, err := crypto.LoadPublicKey(key.PublicKey)
-		if err != nil {
+		// the private key may only be accessible via a signer
+		if _, err := crypto.ParsePublicKey(key.PublicKey); err != nil {
 			services.Log.Fatal(err)
 		}
 
-		privateKey, err := crypto.LoadPrivateKey(key.PrivateKey)
+		exportKeys := &ExportKeys{
+			RootPublicKey: base64.StdEncoding.EncodeToString(key.PublicKey),
+		}
+
+		jsonData, err := json.MarshalIndent(exportKeys, "", "  ")
 		if err != nil {
 			services.Log.Fatal(err)
 		}
 
-		privateKey.PublicKey = *publicKey
+		fmt.Println(string(jsonData))
+		return nil
+	}
+}
+
+// The root key can be split into shares (Shamir secret sharing), so that no
+// single admin settings file contains it. Commands that sign with the root key
+// then reconstruct it in memory from the given share files.
+var keySharesFlag = &cli.StringFlag{
+	Name:  "key-shares",
+	Usage: "comma-separated share files to reconstruct the root key from (in memory)",
+}
+
+var keySharesFlags = []cli.Flag{
+	&cli.IntFlag{
+		Name:  "shares",
+		Usage: "number of shares to split the root key into",
+	},
+	&cli.IntFlag{
+		Name:  "threshold",
+		Usage: "number of shares needed to reconstruct the root key",
+	},
+	&cli.StringFlag{
+		Name:  "output, o",
+		Value: "root-key",
+		Usage: "prefix of the share files (<prefix>.<n>.json)",
+	},
+}
+
+// A previously pinned head of the audit log, which must still be contained in
+// the log.
+var auditLogHeadFlag = &cli.StringFlag{
+	Name:  "head",
+	Usage: "pinned head of the audit log (<index>:<hash>) that must be contained in the log",
+}
+
+// returns the root key from the admin settings or, if share files were given,
+// reconstructs it in memory
+func adminRootKey(settings *services.Settings, c *cli.Context) *crypto.Key {
+
+	settingsKey := settings.Admin.Signing.Key("root")
+
+	filenames := c.String("key-shares")
+
+	if filenames == "" {
+		return settingsKey
+	}
+
+	keyShares := []*crypto.KeyShare{}
+
+	for _, filename := range strings.Split(filenames, ",") {
+
+		if filename == "" {
+			continue
+		}
+
+		jsonBytes, err := ioutil.ReadFile(filename)
 
-		webKey, err := crypto.AsWebKey(privateKey, key.Type)
 		if err != nil {
 			services.Log.Fatal(err)
 		}
 
-		exportKeys := &ExportKeys{
-			RootPublicKey: webKey.PublicKey,
+		keyShare := &crypto.KeyShare{}
+
+		if err := json.Unmarshal(jsonBytes, keyShare); err != nil {
+			services.Log.Fatal(err)
 		}
 
-		jsonData, err := json.MarshalIndent(exportKeys, "", "  ")
+		keyShares = append(keyShares, keyShare)
+	}
+
+	key, err := crypto.CombineKeyShares(keyShares)
+
+	if err != nil {
+		services.Log.Fatal(err)
+	}
+
+	if settingsKey != nil && !bytes.Equal(settingsKey.PublicKey, key.PublicKey) {
+		services.Log.Fatal("the key shares do not belong to the root key in the admin settings")
+	}
+
+	return key
+}
+
+// splits the given key into shares and writes them to individual files
+func writeKeyShares(key *crypto.Key, c *cli.Context) {
+
+	keyShares, err := crypto.SplitKey(key, c.Int("shares"), c.Int("threshold"))
+
+	if err != nil {
+		services.Log.Fatal(err)
+	}
+
+	for i, keyShare := range keyShares {
+
+		jsonData, err := json.MarshalIndent(keyShare, "", "  ")
+
 		if err != nil {
 			services.Log.Fatal(err)
 		}
 
-		fmt.Println(string(jsonData))
+		filename := fmt.Sprintf("%s.%d.json", c.String("output"), i+1)
+
+		// we never overwrite existing shares (which might belong to another key)
+		f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+
+		if err != nil {
+			services.Log.Fatal(err)
+		}
+
+		if _, err := f.Write(jsonData); err != nil {
+			f.Close()
+			services.Log.Fatal(err)
+		}
+
+		if err := f.Close(); err != nil {
+			services.Log.Fatal(err)
+		}
+	}
+
+	services.Log.Infof("Split the %s key into %d shares (%d needed to reconstruct it).", key.Name, len(keyShares), c.Int("threshold"))
+}
+
+func splitRootKey(settings *services.Settings) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+
+		if settings.Admin == nil {
+			services.Log.Fatal("admin settings missing")
+		}
+
+		key := settings.Admin.Signing.Key("root")
+
+		if key == nil || key.PrivateKey == nil {
+			services.Log.Fatal("can't find the private root key")
+		}
+
+		writeKeyShares(key, c)
+
+		services.Log.Info("Please distribute the shares and remove the private root key from the admin settings.")
+
 		return nil
 	}
 }
@@ -204,6 +337,7 @@ func setupKeys(settings *services.Settings) func(c *cli.Context) error {
 		keys := map[string]string{
 			"root":     "ecdsa",
 			"token":    "ecdsa",
+			"log":      "ecdsa",
 			"provider": "ecdh",
 		}
 
@@ -223,9 +357,9 @@ func setupKeys(settings *services.Settings) func(c *cli.Context) error {
 
 			keyCopy := *settingsKey
 
-			if name != "token" {
-				// we remove all private keys except for the 'token' key, which the backend needs
-				// to sign tokens...
+			if name != "token" && name != "log" {
+				// we remove all private keys except for the 'token' and 'log' keys, which the
+				// backend needs to sign tokens and the heads of the key log...
 				keyCopy.PrivateKey = nil
 			}
 
@@ -237,6 +371,27 @@ func setupKeys(settings *services.Settings) func(c *cli.Context) error {
 
 		}
 
+		// the blind token key is an RSA key, which the backend needs to sign
+		// blinded tokens
+		blindTokenKey, err := crypto.GenerateBlindKey("blind-token")
+
+		if err != nil {
+			services.Log.Fatal(err)
+		}
+
+		adminKeys = append(adminKeys, blindTokenKey)
+		apptKeys = append(apptKeys, blindTokenKey)
+
+		// if requested, we only store shares of the private root key
+		if c.Int("shares") > 0 {
+			for _, key := range adminKeys {
+				if key.Name == "root" {
+					writeKeyShares(key, c)
+					key.PrivateKey = nil
+				}
+			}
+		}
+
 		adminSettings := &services.Settings{
 			Admin: &services.AdminSettings{
 				Signing: &services.SigningSettings{
@@ -295,17 +450,12 @@ func setupKeys(settings *services.Settings) func(c *cli.Context) error {
 		// encrypt admin settings if flag is set
 		if c.Bool("encrypt") {
 
-			key, err := crypto.BuildKeyFromEnv()
-			if err != nil {
-				services.Log.Fatal(err)
-			}
-
-			encAdminSettings, err := crypto.Encrypt(adminJson, key)
+			passphrase, err := crypto.PassphraseFromEnv()
 			if err != nil {
 				services.Log.Fatal(err)
 			}
 
-			adminJson, err = json.MarshalIndent(encAdminSettings, "", " ")
+			adminJson, err = encryptFs.Encrypt(adminJson, passphrase, nil)
 			if err != nil {
 				services.Log.Fatal(err)
 			}
@@ -362,7 +512,7 @@ func uploadDistances(settings *services.Settings) func(c *cli.Context) error {
 
 		client := jsonrpc.MakeClient(settings.Admin.Client.AppointmentsEndpoint)
 
-		signingKey := settings.Admin.Signing.Key("root")
+		signingKey := adminRootKey(settings, c)
 
 		if signingKey == nil {
 			services.Log.Fatal("can't find signing key")
@@ -444,10 +594,35 @@ func generateCodes(settings *services.Settings) func(c *cli.Context) error {
 			codes = append(codes, hex.EncodeToString(code))
 		}
 
-		jsonData, err := json.MarshalIndent(map[string]interface{}{
+		data := map[string]interface{}{
 			"actor": actor,
 			"codes": codes,
-		}, "", "  ")
+		}
+
+		// if a label is given we put the codes into a new batch
+		if label := c.String("label"); label != "" {
+
+			id, err := crypto.RandomBytes(32)
+
+			if err != nil {
+				services.Log.Fatal(err)
+			}
+
+			batch := &services.CodeBatchData{
+				ID:       id,
+				Label:    label,
+				IssuedBy: c.String("issued-by"),
+			}
+
+			if days := c.Int("expires-in-days"); days > 0 {
+				expiresAt := time.Now().UTC().Add(time.Duration(days) * 24 * time.Hour)
+				batch.ExpiresAt = &expiresAt
+			}
+
+			data["batch"] = batch
+		}
+
+		jsonData, err := json.MarshalIndent(data, "", "  ")
 
 		if err != nil {
 			services.Log.Fatal(err)
@@ -486,9 +661,10 @@ var CodesForm = forms.Form{
 }
 
 type Codes struct {
-	Actor     string     `json:"actor"`
-	Codes     []string   `json:"codes"`
-	Timestamp *time.Time `json:"timestamp"`
+	Actor     string                  `json:"actor"`
+	Codes     []string                `json:"codes"`
+	Timestamp *time.Time              `json:"timestamp"`
+	Batch     *services.CodeBatchData `json:"batch,omitempty"`
 }
 
 func uploadCodes(settings *services.Settings) func(c *cli.Context) error {
@@ -523,9 +699,20 @@ func uploadCodes(settings *services.Settings) func(c *cli.Context) error {
 			services.Log.Fatal(err)
 		}
 
+		// the (optional) batch is uploaded together with each chunk of codes
+		batchData := &struct {
+			Batch *services.CodeBatchData `json:"batch"`
+		}{}
+
+		if err := json.Unmarshal(jsonBytes, batchData); err != nil {
+			services.Log.Fatal(err)
+		}
+
+		codes.Batch = batchData.Batch
+
 		client := jsonrpc.MakeClient(settings.Admin.Client.AppointmentsEndpoint)
 
-		signingKey := settings.Admin.Signing.Key("root")
+		signingKey := adminRootKey(settings, c)
 
 		if signingKey == nil {
 			services.Log.Fatal("can't find signing key")
@@ -690,6 +877,50 @@ type JWKPrivateKey struct {
 	Y      string   `json:"y"`
 }
 
+func loadKeyPairs(filename string) (*KeyPairs, error) {
+
+	jsonBytes, err := ioutil.ReadFile(filename)
+
+	if err != nil {
+		return nil, err
+	}
+
+	keyPairs := &KeyPairs{}
+	var rawKeyPairs map[string]interface{}
+
+	if err := json.Unmarshal(jsonBytes, &rawKeyPairs); err != nil {
+		return nil, err
+	}
+
+	if params, err := KeyPairsForm.Validate(rawKeyPairs); err != nil {
+		return nil, err
+	} else if err := KeyPairsForm.Coerce(keyPairs, params); err != nil {
+		return nil, err
+	}
+
+	return keyPairs, nil
+}
+
+// the ID of a mediator key is the hash of its public signing key
+func mediatorKeyID(filename string) ([]byte, error) {
+	if keyPairs, err := loadKeyPairs(filename); err != nil {
+		return nil, err
+	} else {
+		return crypto.Hash(keyPairs.Signing.PublicKey), nil
+	}
+}
+
+func parseOptionalTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err != nil {
+		return nil, err
+	} else {
+		return &t, nil
+	}
+}
+
 func uploadMediatorKeys(settings *services.Settings) func(c *cli.Context) error {
 	return func(c *cli.Context) error {
 
@@ -703,31 +934,32 @@ func uploadMediatorKeys(settings *services.Settings) func(c *cli.Context) error
 			services.Log.Fatal("please specify a filename")
 		}
 
-		jsonBytes, err := ioutil.ReadFile(filename)
+		keyPairs, err := loadKeyPairs(filename)
 
 		if err != nil {
 			services.Log.Fatal(err)
 		}
 
-		keyPairs := &KeyPairs{}
-		var rawKeyPairs map[string]interface{}
+		keyData := &services.MediatorKeyData{
+			Signing:    keyPairs.Signing.PublicKey,
+			Encryption: keyPairs.Encryption.PublicKey,
+		}
 
-		if err := json.Unmarshal(jsonBytes, &rawKeyPairs); err != nil {
+		if keyData.ValidFrom, err = parseOptionalTime(c.String("valid-from")); err != nil {
 			services.Log.Fatal(err)
 		}
 
-		if params, err := KeyPairsForm.Validate(rawKeyPairs); err != nil {
-			services.Log.Fatal(err)
-		} else if KeyPairsForm.Coerce(keyPairs, params); err != nil {
+		if keyData.ValidUntil, err = parseOptionalTime(c.String("valid-until")); err != nil {
 			services.Log.Fatal(err)
 		}
 
-		keyData := &services.MediatorKeyData{
-			Signing:    keyPairs.Signing.PublicKey,
-			Encryption: keyPairs.Encryption.PublicKey,
+		if predecessor := c.String("predecessor"); predecessor != "" {
+			if keyData.Predecessor, err = mediatorKeyID(predecessor); err != nil {
+				services.Log.Fatal(err)
+			}
 		}
 
-		rootKey := settings.Admin.Signing.Key("root")
+		rootKey := adminRootKey(settings, c)
 
 		signedKeyData, err := keyData.Sign(rootKey)
 		if err != nil {
@@ -751,98 +983,1017 @@ func uploadMediatorKeys(settings *services.Settings) func(c *cli.Context) error
 	}
 }
 
-func Admin(settings *services.Settings) ([]cli.Command, error) {
+func revokeMediatorKeys(settings *services.Settings) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
 
-	return []cli.Command{
-		{
-			Name:    "admin",
-			Aliases: []string{"a"},
-			Flags:   []cli.Flag{},
-			Usage:   "Administrative functions.",
-			Subcommands: []cli.Command{
-				{
-					Name:  "codes",
-					Flags: []cli.Flag{},
-					Usage: "Codes-related command.",
-					Subcommands: []cli.Command{
-						{
-							Name: "generate",
-							Flags: []cli.Flag{
-								&cli.IntFlag{
-									Name:  "n",
-									Value: 10000,
-									Usage: "number of codes to generate",
-								},
-								&cli.StringFlag{
-									Name:  "actor",
-									Value: "user",
-									Usage: "actor for which to generate codes (user or provider)",
-								},
-							},
-							Usage:  "generate codes for users or providers",
-							Action: generateCodes(settings),
-						},
-						{
-							Name:   "upload",
-							Flags:  []cli.Flag{},
-							Usage:  "upload codes from a file to the backend",
-							Action: uploadCodes(settings),
-						},
-					},
-				},
-				{
-					Name:  "keys",
-					Flags: []cli.Flag{},
-					Usage: "Keys-related command.",
-					Subcommands: []cli.Command{
-						{
-							Name: "setup",
-							Flags: []cli.Flag{
-								&cli.BoolFlag{
-									Name:  "encrypt, e",
-									Usage: "encrypt private keys file",
-								},
-							},
-							Usage:  "set up keys for the given environment",
-							Action: setupKeys(settings),
-						},
-						{
-							Name:   "mediator",
-							Flags:  []cli.Flag{},
-							Usage:  "generate a new set of mediator keys",
-							Action: generateMediatorKeys(settings),
-						},
-						{
-							Name:   "exportRootPublic",
-							Flags:  []cli.Flag{},
-							Usage:  "export the root public key",
-							Action: exportRootPublicKey(settings),
-						},
-					},
-				},
-				{
-					Name:  "distances",
-					Flags: []cli.Flag{},
-					Usage: "Distances-related command.",
-					Subcommands: []cli.Command{
-						{
-							Name:   "upload",
-							Flags:  []cli.Flag{},
-							Usage:  "upload distances from a file to the backend",
-							Action: uploadDistances(settings),
-						},
-					},
-				},
-				{
-					Name:  "mediators",
-					Flags: []cli.Flag{},
-					Usage: "Mediators-related command.",
-					Subcommands: []cli.Command{
-						{
-							Name:   "upload",
-							Flags:  []cli.Flag{},
-							Usage:  "upload signed keys data for a mediator",
-							Action: uploadMediatorKeys(settings),
+		if settings.Admin == nil {
+			services.Log.Fatal("admin settings missing")
+		}
+
+		filename := c.Args().Get(0)
+
+		if filename == "" {
+			services.Log.Fatal("please specify a filename")
+		}
+
+		reason := c.String("reason")
+
+		if reason == "" {
+			services.Log.Fatal("please specify a reason")
+		}
+
+		id, err := mediatorKeyID(filename)
+
+		if err != nil {
+			services.Log.Fatal(err)
+		}
+
+		params := &services.RevokeMediatorKeyParams{
+			Timestamp: time.Now(),
+			ID:        id,
+			Reason:    reason,
+		}
+
+		rootKey := adminRootKey(settings, c)
+
+		client := &http.Client{}
+		requester := helpers.MakeAPIClient(settings.Admin.Client.AppointmentsEndpoint, client)
+
+		if resp, err := requester("revokeMediatorKey", params, rootKey); err != nil {
+			return err
+		} else if resp.StatusCode != 200 {
+			services.Log.Fatal(fmt.Sprintf("cannot revoke mediator key (status code %d)", resp.StatusCode))
+		}
+
+		return nil
+	}
+}
+
+// revokes a batch of codes, the batch ID is given in base64 encoding as in
+// the generated codes file
+func revokeCodeBatch(settings *services.Settings) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+
+		if settings.Admin == nil {
+			services.Log.Fatal("admin settings missing")
+		}
+
+		actor := c.String("actor")
+
+		if actor != "user" && actor != "provider" {
+			services.Log.Fatal("actor should be 'user' or 'provider'")
+		}
+
+		id, err := base64.StdEncoding.DecodeString(c.Args().Get(0))
+
+		if err != nil || len(id) == 0 {
+			services.Log.Fatal("please specify a valid batch ID")
+		}
+
+		reason := c.String("reason")
+
+		if reason == "" {
+			services.Log.Fatal("please specify a reason")
+		}
+
+		rootKey := adminRootKey(settings, c)
+
+		client := &http.Client{}
+		requester := helpers.MakeAPIClient(settings.Admin.Client.AppointmentsEndpoint, client)
+
+		params := &services.RevokeCodeBatchParams{
+			Timestamp: time.Now(),
+			Actor:     actor,
+			ID:        id,
+			Reason:    reason,
+		}
+
+		if resp, err := requester("revokeCodeBatch", params, rootKey); err != nil {
+			return err
+		} else if resp.StatusCode != 200 {
+			services.Log.Fatal(fmt.Sprintf("cannot revoke code batch (status code %d)", resp.StatusCode))
+		}
+
+		return nil
+	}
+}
+
+// prints the code batches with the number of redeemed codes
+func reportCodes(settings *services.Settings) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+
+		if settings.Admin == nil {
+			services.Log.Fatal("admin settings missing")
+		}
+
+		actor := c.String("actor")
+
+		if actor != "user" && actor != "provider" {
+			services.Log.Fatal("actor should be 'user' or 'provider'")
+		}
+
+		rootKey := adminRootKey(settings, c)
+
+		client := &http.Client{}
+		requester := helpers.MakeAPIClient(settings.Admin.Client.AppointmentsEndpoint, client)
+
+		params := &services.GetCodeBatchesParams{
+			Timestamp: time.Now(),
+			Actor:     actor,
+		}
+
+		resp, err := requester("getCodeBatches", params, rootKey)
+
+		if err != nil {
+			return err
+		} else if resp.StatusCode != 200 {
+			services.Log.Fatal(fmt.Sprintf("cannot get code batches (status code %d)", resp.StatusCode))
+		}
+
+		bytes, err := resp.Bytes()
+
+		if err != nil {
+			services.Log.Fatal(err)
+		}
+
+		result := &struct {
+			Result []*services.CodeBatch `json:"result"`
+		}{}
+
+		if err := json.Unmarshal(bytes, result); err != nil {
+			services.Log.Fatal(err)
+		}
+
+		formatTime := func(t *time.Time) string {
+			if t == nil {
+				return "-"
+			}
+			return t.Format(time.RFC3339)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+		fmt.Fprintln(w, "ID\tLABEL\tISSUED BY\tCREATED\tEXPIRES\tREVOKED\tCODES\tREDEEMED")
+
+		for _, batch := range result.Result {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%d\n",
+				base64.StdEncoding.EncodeToString(batch.ID),
+				batch.Label,
+				batch.IssuedBy,
+				formatTime(&batch.CreatedAt),
+				formatTime(batch.ExpiresAt),
+				formatTime(batch.RevokedAt),
+				batch.Codes,
+				batch.Redeemed,
+			)
+		}
+
+		return w.Flush()
+	}
+}
+
+// issues an invitation bound to the given provider key and/or metadata and
+// prints the invitation code, which can then be handed to the provider
+func issueInvitation(settings *services.Settings) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+
+		if settings.Admin == nil {
+			services.Log.Fatal("admin settings missing")
+		}
+
+		code, err := crypto.RandomBytes(16)
+
+		if err != nil {
+			services.Log.Fatal(err)
+		}
+
+		params := map[string]interface{}{
+			"timestamp": time.Now(),
+			"code":      hex.EncodeToString(code),
+		}
+
+		bound := false
+
+		if providerKey := c.String("provider-key"); providerKey != "" {
+			if key, err := base64.StdEncoding.DecodeString(providerKey); err != nil {
+				services.Log.Fatal("invalid provider key")
+			} else {
+				params["providerKey"] = key
+				bound = true
+			}
+		}
+
+		if name, zipCode := c.String("name"), c.String("zip-code"); name != "" || zipCode != "" {
+			if name == "" || zipCode == "" {
+				services.Log.Fatal("please specify both the name and the zip code")
+			}
+			params["metadataHash"] = services.ProviderMetadataHash(name, zipCode)
+			bound = true
+		}
+
+		if !bound {
+			services.Log.Fatal("please specify a provider key or the name and zip code of the provider")
+		}
+
+		if days := c.Int("expires-in-days"); days > 0 {
+			params["expiresAt"] = time.Now().UTC().Add(time.Duration(days) * 24 * time.Hour)
+		}
+
+		rootKey := adminRootKey(settings, c)
+
+		client := &http.Client{}
+		requester := helpers.MakeAPIClient(settings.Admin.Client.AppointmentsEndpoint, client)
+
+		if resp, err := requester("issueInvitation", params, rootKey); err != nil {
+			return err
+		} else if resp.StatusCode != 200 {
+			services.Log.Fatal(fmt.Sprintf("cannot issue invitation (status code %d)", resp.StatusCode))
+		}
+
+		fmt.Println(hex.EncodeToString(code))
+
+		return nil
+	}
+}
+
+// revokes the tokens in the given file (a JSON list of base64-encoded tokens)
+func revokeTokens(settings *services.Settings) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+
+		if settings.Admin == nil {
+			services.Log.Fatal("admin settings missing")
+		}
+
+		filename := c.Args().Get(0)
+
+		if filename == "" {
+			services.Log.Fatal("please specify a filename")
+		}
+
+		reason := c.String("reason")
+
+		if reason == "" {
+			services.Log.Fatal("please specify a reason")
+		}
+
+		jsonBytes, err := ioutil.ReadFile(filename)
+
+		if err != nil {
+			services.Log.Fatal(err)
+		}
+
+		tokens := make([][]byte, 0)
+
+		if err := json.Unmarshal(jsonBytes, &tokens); err != nil {
+			services.Log.Fatal(err)
+		}
+
+		rootKey := adminRootKey(settings, c)
+
+		client := &http.Client{}
+		requester := helpers.MakeAPIClient(settings.Admin.Client.AppointmentsEndpoint, client)
+
+		N := 1000
+
+		for i := 0; i < len(tokens); i += N {
+
+			j := i + N
+			if j > len(tokens) {
+				j = len(tokens)
+			}
+
+			services.Log.Infof("Revoking tokens [%d, %d] from %d in total...", i, j, len(tokens))
+
+			params := &services.RevokeTokensParams{
+				Timestamp: time.Now(),
+				Tokens:    tokens[i:j],
+				Reason:    reason,
+			}
+
+			if resp, err := requester("revokeTokens", params, rootKey); err != nil {
+				return err
+			} else if resp.StatusCode != 200 {
+				services.Log.Fatal(fmt.Sprintf("cannot revoke tokens (status code %d)", resp.StatusCode))
+			}
+		}
+
+		return nil
+	}
+}
+
+// fetches all entries of the audit log, page by page
+func fetchAuditLog(settings *services.Settings, rootKey *crypto.Key) ([]*services.AuditLogEntry, error) {
+
+	if rootKey == nil {
+		return nil, fmt.Errorf("can't find signing key")
+	}
+
+	client := &http.Client{}
+	requester := helpers.MakeAPIClient(settings.Admin.Client.AppointmentsEndpoint, client)
+
+	var N int64 = 1000
+
+	entries := make([]*services.AuditLogEntry, 0)
+
+	for {
+
+		params := &services.GetAuditLogParams{
+			Timestamp: time.Now(),
+			From:      int64(len(entries)) + 1,
+			Limit:     N,
+		}
+
+		resp, err := requester("getAuditLog", params, rootKey)
+
+		if err != nil {
+			return nil, err
+		} else if resp.StatusCode != 200 {
+			return nil, fmt.Errorf("cannot fetch audit log (status code %d)", resp.StatusCode)
+		}
+
+		bytes, err := resp.Bytes()
+
+		if err != nil {
+			return nil, err
+		}
+
+		result := &struct {
+			Result []*services.AuditLogEntry `json:"result"`
+		}{}
+
+		if err := json.Unmarshal(bytes, result); err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, result.Result...)
+
+		if int64(len(result.Result)) < N {
+			return entries, nil
+		}
+	}
+}
+
+// runs a local signing agent for the admin keys, so that other processes
+// (e.g. the appointments server) can sign without holding the private keys
+func runSigningAgent(settings *services.Settings) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+
+		if settings.Admin == nil {
+			services.Log.Fatal("admin settings missing")
+		}
+
+		socket := c.String("socket")
+
+		if socket == "" {
+			services.Log.Fatal("please specify a socket")
+		}
+
+		names := map[string]bool{}
+
+		for _, name := range strings.Split(c.String("keys"), ",") {
+			if name != "" {
+				names[name] = true
+			}
+		}
+
+		keys := []*crypto.Key{}
+
+		for _, key := range settings.Admin.Signing.Keys {
+			if key.Type != "ecdsa" || (key.PrivateKey == nil && key.Signer == nil) {
+				continue
+			}
+			if len(names) > 0 && !names[key.Name] {
+				continue
+			}
+			keys = append(keys, key)
+		}
+
+		if len(keys) == 0 {
+			services.Log.Fatal("no signing keys found")
+		}
+
+		agent, err := crypto.MakeSigningAgent(keys)
+
+		if err != nil {
+			services.Log.Fatal(err)
+		}
+
+		// the socket is created with the default permissions before we can
+		// restrict them, so it must lie in a directory only we can access
+		socketDir := filepath.Dir(socket)
+
+		if err := os.MkdirAll(socketDir, 0700); err != nil {
+			services.Log.Fatal(err)
+		}
+
+		if info, err := os.Stat(socketDir); err != nil {
+			services.Log.Fatal(err)
+		} else if info.Mode().Perm()&0077 != 0 {
+			services.Log.Fatal(fmt.Sprintf("the socket directory %s must not be accessible by other users (use chmod 700)", socketDir))
+		}
+
+		// we remove a stale socket of a previous agent
+		if err := os.Remove(socket); err != nil && !os.IsNotExist(err) {
+			services.Log.Fatal(err)
+		}
+
+		listener, err := net.Listen("unix", socket)
+
+		if err != nil {
+			services.Log.Fatal(err)
+		}
+
+		if err := os.Chmod(socket, 0600); err != nil {
+			services.Log.Fatal(err)
+		}
+
+		go func() {
+			if err := agent.Serve(listener); err != nil {
+				services.Log.Debug(err)
+			}
+		}()
+
+		services.Log.Infof("Signing agent listening on %s with %d keys.", socket, len(keys))
+
+		wait()
+
+		// this also removes the socket
+		return listener.Close()
+	}
+}
+
+func exportAuditLog(settings *services.Settings) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+
+		if settings.Admin == nil {
+			services.Log.Fatal("admin settings missing")
+		}
+
+		rootKey := adminRootKey(settings, c)
+
+		entries, err := fetchAuditLog(settings, rootKey)
+
+		if err != nil {
+			services.Log.Fatal(err)
+		}
+
+		// we export the log even if the chain is broken, as the auditors
+		// may want to inspect it
+		if err := checkAuditLog(c, entries, rootKey.PublicKey); err != nil {
+			services.Log.Errorf("The audit log chain is broken: %v", err)
+		}
+
+		jsonData, err := json.MarshalIndent(entries, "", "  ")
+
+		if err != nil {
+			services.Log.Fatal(err)
+		}
+
+		if filename := c.String("output"); filename != "" {
+			if err := ioutil.WriteFile(filename, jsonData, 0644); err != nil {
+				services.Log.Fatal(err)
+			}
+			services.Log.Infof("Exported %d audit log entries to %s.", len(entries), filename)
+		} else {
+			fmt.Println(string(jsonData))
+		}
+
+		return nil
+	}
+}
+
+func verifyAuditLog(settings *services.Settings) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+
+		filename := c.Args().Get(0)
+
+		if filename == "" {
+			services.Log.Fatal("please specify a filename")
+		}
+
+		jsonBytes, err := ioutil.ReadFile(filename)
+
+		if err != nil {
+			services.Log.Fatal(err)
+		}
+
+		entries := make([]*services.AuditLogEntry, 0)
+
+		if err := json.Unmarshal(jsonBytes, &entries); err != nil {
+			services.Log.Fatal(err)
+		}
+
+		rootKey := settings.Admin.Signing.Key("root")
+
+		if rootKey == nil {
+			services.Log.Fatal("can't find root key")
+		}
+
+		if err := checkAuditLog(c, entries, rootKey.PublicKey); err != nil {
+			services.Log.Fatal(fmt.Sprintf("The audit log chain is broken: %v", err))
+		}
+
+		if len(entries) == 0 {
+			services.Log.Info("The audit log is empty.")
+			return nil
+		}
+
+		head := entries[len(entries)-1]
+
+		// the head should be pinned (e.g. by writing it down) and passed to the
+		// next verification, so that truncation and rewrites are detected
+		services.Log.Infof("The audit log chain is valid (%d entries), pin its head with --head %d:%s", len(entries), head.Index, hex.EncodeToString(head.Hash))
+
+		return nil
+	}
+}
+
+// checks the chain and signers of the complete audit log, as well as the
+// head pinned with the --head flag (if any)
+func checkAuditLog(c *cli.Context, entries []*services.AuditLogEntry, rootKey []byte) error {
+
+	if len(entries) > 0 && entries[0].Index != 1 {
+		return fmt.Errorf("the log does not start with the first entry")
+	}
+
+	if err := services.VerifyAuditLog(entries, services.AuditLogSigners(entries, rootKey)); err != nil {
+		return err
+	}
+
+	pinnedHead := c.String("head")
+
+	if pinnedHead == "" {
+		return nil
+	}
+
+	parts := strings.SplitN(pinnedHead, ":", 2)
+
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid head, expected <index>:<hash>")
+	}
+
+	index, err := strconv.ParseInt(parts[0], 10, 64)
+
+	if err != nil {
+		return fmt.Errorf("invalid head index: %w", err)
+	}
+
+	hash, err := hex.DecodeString(parts[1])
+
+	if err != nil {
+		return fmt.Errorf("invalid head hash: %w", err)
+	}
+
+	return services.VerifyAuditLogHead(entries, index, hash)
+}
+
+// writes the file via a temporary file, so that it is never left in a partially
+// written state (e.g. if the disk is full)
+func writeFileAtomically(filename string, data []byte, mode os.FileMode) error {
+
+	f, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename)+".*")
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Chmod(mode); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), filename)
+}
+
+// returns all settings files in the settings paths
+func settingsFiles() ([]string, error) {
+
+	settingsPaths, err := helpers.RealSettingsPaths()
+
+	if err != nil {
+		return nil, err
+	}
+
+	filenames := []string{}
+
+	for _, settingsPath := range settingsPaths {
+		if files, err := ioutil.ReadDir(settingsPath); err != nil {
+			return nil, err
+		} else {
+			for _, file := range files {
+				switch filepath.Ext(file.Name()) {
+				case ".json", ".yml", ".yaml":
+					if file.Mode().IsRegular() {
+						filenames = append(filenames, filepath.Join(settingsPath, file.Name()))
+					}
+				}
+			}
+		}
+	}
+
+	return filenames, nil
+}
+
+// re-encrypts settings files in the legacy format (or, if forced, files that
+// are already in the current format) with a new salt & the given parameters
+func reencryptSettings(settings *services.Settings) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+
+		passphrase, err := crypto.PassphraseFromEnv()
+
+		if err != nil {
+			services.Log.Fatal(err)
+		}
+
+		if c.Int("threads") < 1 || c.Int("threads") > 255 {
+			services.Log.Fatal("threads should be between 1 and 255")
+		}
+
+		params := &encryptFs.Params{
+			Argon2Params: crypto.Argon2Params{
+				Time:    uint32(c.Int("time")),
+				Memory:  uint32(c.Int("memory")),
+				Threads: uint8(c.Int("threads")),
+			},
+			ChunkSize: encryptFs.DefaultChunkSize,
+		}
+
+		if err := params.Validate(); err != nil {
+			services.Log.Fatal(err)
+		}
+
+		filenames := []string(c.Args())
+
+		if len(filenames) == 0 {
+			if filenames, err = settingsFiles(); err != nil {
+				services.Log.Fatal(err)
+			}
+		}
+
+		for _, filename := range filenames {
+
+			info, err := os.Stat(filename)
+
+			if err != nil {
+				services.Log.Fatal(err)
+			}
+
+			data, err := ioutil.ReadFile(filename)
+
+			if err != nil {
+				services.Log.Fatal(err)
+			}
+
+			var plainData []byte
+
+			if encryptFs.IsEncrypted(data) {
+				if !c.Bool("force") {
+					services.Log.Infof("%s is already in the current format, skipping it.", filename)
+					continue
+				}
+				plainData, err = encryptFs.Decrypt(data, passphrase)
+			} else if plainData, err = encryptFs.DecryptLegacy(data, passphrase); err == nil && plainData == nil {
+				services.Log.Infof("%s is not encrypted, skipping it.", filename)
+				continue
+			}
+
+			if err != nil {
+				services.Log.Fatal(fmt.Sprintf("%s: %v", filename, err))
+			}
+
+			encryptedData, err := encryptFs.Encrypt(plainData, passphrase, params)
+
+			if err != nil {
+				services.Log.Fatal(err)
+			}
+
+			if err := writeFileAtomically(filename, encryptedData, info.Mode().Perm()); err != nil {
+				services.Log.Fatal(err)
+			}
+
+			services.Log.Infof("Re-encrypted %s.", filename)
+		}
+
+		return nil
+	}
+}
+
+func Admin(settings *services.Settings) ([]cli.Command, error) {
+
+	return []cli.Command{
+		{
+			Name:    "admin",
+			Aliases: []string{"a"},
+			Flags:   []cli.Flag{},
+			Usage:   "Administrative functions.",
+			Subcommands: []cli.Command{
+				{
+					Name:  "codes",
+					Flags: []cli.Flag{},
+					Usage: "Codes-related command.",
+					Subcommands: []cli.Command{
+						{
+							Name: "generate",
+							Flags: []cli.Flag{
+								&cli.IntFlag{
+									Name:  "n",
+									Value: 10000,
+									Usage: "number of codes to generate",
+								},
+								&cli.StringFlag{
+									Name:  "actor",
+									Value: "user",
+									Usage: "actor for which to generate codes (user or provider)",
+								},
+								&cli.StringFlag{
+									Name:  "label",
+									Usage: "label of the batch the codes belong to (no batch if empty)",
+								},
+								&cli.StringFlag{
+									Name:  "issued-by",
+									Usage: "person or organization that issued the batch",
+								},
+								&cli.IntFlag{
+									Name:  "expires-in-days",
+									Value: 0,
+									Usage: "number of days after which the codes of the batch expire (0 = never)",
+								},
+							},
+							Usage:  "generate codes for users or providers",
+							Action: generateCodes(settings),
+						},
+						{
+							Name:   "upload",
+							Flags:  []cli.Flag{keySharesFlag},
+							Usage:  "upload codes from a file to the backend",
+							Action: uploadCodes(settings),
+						},
+						{
+							Name: "revoke",
+							Flags: []cli.Flag{
+								keySharesFlag,
+								&cli.StringFlag{
+									Name:  "actor",
+									Value: "user",
+									Usage: "actor the codes belong to (user or provider)",
+								},
+								&cli.StringFlag{
+									Name:  "reason",
+									Usage: "reason for the revocation",
+								},
+							},
+							Usage:  "revoke a batch of codes",
+							Action: revokeCodeBatch(settings),
+						},
+						{
+							Name: "report",
+							Flags: []cli.Flag{
+								keySharesFlag,
+								&cli.StringFlag{
+									Name:  "actor",
+									Value: "user",
+									Usage: "actor the codes belong to (user or provider)",
+								},
+							},
+							Usage:  "show how many codes of each batch were redeemed",
+							Action: reportCodes(settings),
+						},
+					},
+				},
+				{
+					Name:  "keys",
+					Flags: []cli.Flag{},
+					Usage: "Keys-related command.",
+					Subcommands: []cli.Command{
+						{
+							Name: "setup",
+							Flags: append([]cli.Flag{
+								&cli.BoolFlag{
+									Name:  "encrypt, e",
+									Usage: "encrypt private keys file",
+								},
+							}, keySharesFlags...),
+							Usage:  "set up keys for the given environment",
+							Action: setupKeys(settings),
+						},
+						{
+							Name: "mediator",
+							Flags: []cli.Flag{
+								&cli.StringFlag{
+									Name:  "signing-type",
+									Value: "ecdsa",
+									Usage: "signing key type (ecdsa or ed25519)",
+								},
+								&cli.StringFlag{
+									Name:  "encryption-type",
+									Value: "ecdh",
+									Usage: "encryption key type (ecdh or x25519)",
+								},
+							},
+							Usage:  "generate a new set of mediator keys",
+							Action: generateMediatorKeys(settings),
+						},
+						{
+							Name: "agent",
+							Flags: []cli.Flag{
+								&cli.StringFlag{
+									Name:  "socket",
+									Usage: "path of the Unix socket to listen on",
+								},
+								&cli.StringFlag{
+									Name:  "keys",
+									Usage: "comma-separated names of the keys to sign with (default: all signing keys)",
+								},
+							},
+							Usage:  "run a local signing agent for the admin keys",
+							Action: runSigningAgent(settings),
+						},
+						{
+							Name:   "split",
+							Flags:  keySharesFlags,
+							Usage:  "split the root key into shares",
+							Action: splitRootKey(settings),
+						},
+						{
+							Name:   "exportRootPublic",
+							Flags:  []cli.Flag{},
+							Usage:  "export the root public key",
+							Action: exportRootPublicKey(settings),
+						},
+					},
+				},
+				{
+					Name:  "distances",
+					Flags: []cli.Flag{},
+					Usage: "Distances-related command.",
+					Subcommands: []cli.Command{
+						{
+							Name:   "upload",
+							Flags:  []cli.Flag{keySharesFlag},
+							Usage:  "upload distances from a file to the backend",
+							Action: uploadDistances(settings),
+						},
+					},
+				},
+				{
+					Name:  "invitations",
+					Flags: []cli.Flag{},
+					Usage: "Invitations-related command.",
+					Subcommands: []cli.Command{
+						{
+							Name: "issue",
+							Flags: []cli.Flag{
+								keySharesFlag,
+								&cli.StringFlag{
+									Name:  "provider-key",
+									Usage: "base64-encoded public signing key of the provider",
+								},
+								&cli.StringFlag{
+									Name:  "name",
+									Usage: "name of the provider",
+								},
+								&cli.StringFlag{
+									Name:  "zip-code",
+									Usage: "zip code of the provider",
+								},
+								&cli.IntFlag{
+									Name:  "expires-in-days",
+									Value: 0,
+									Usage: "number of days after which the invitation expires (0 = never)",
+								},
+							},
+							Usage:  "issue an invitation code bound to a specific provider",
+							Action: issueInvitation(settings),
+						},
+					},
+				},
+				{
+					Name:  "tokens",
+					Flags: []cli.Flag{},
+					Usage: "Tokens-related command.",
+					Subcommands: []cli.Command{
+						{
+							Name: "revoke",
+							Flags: []cli.Flag{
+								keySharesFlag,
+								&cli.StringFlag{
+									Name:  "reason",
+									Usage: "reason for the revocation",
+								},
+							},
+							Usage:  "revoke user tokens listed in a file",
+							Action: revokeTokens(settings),
+						},
+					},
+				},
+				{
+					Name:  "settings",
+					Flags: []cli.Flag{},
+					Usage: "Settings-related command.",
+					Subcommands: []cli.Command{
+						{
+							Name: "reencrypt",
+							Flags: []cli.Flag{
+								&cli.IntFlag{
+									Name:  "time",
+									Value: int(crypto.DefaultArgon2Params.Time),
+									Usage: "Argon2id time parameter (number of passes)",
+								},
+								&cli.IntFlag{
+									Name:  "memory",
+									Value: int(crypto.DefaultArgon2Params.Memory),
+									Usage: "Argon2id memory parameter (in KiB)",
+								},
+								&cli.IntFlag{
+									Name:  "threads",
+									Value: int(crypto.DefaultArgon2Params.Threads),
+									Usage: "Argon2id threads parameter",
+								},
+								&cli.BoolFlag{
+									Name:  "force",
+									Usage: "also re-encrypt files that are already in the current format",
+								},
+							},
+							Usage:  "re-encrypt settings files in the current format (default: all settings files)",
+							Action: reencryptSettings(settings),
+						},
+					},
+				},
+				{
+					Name:  "audit",
+					Flags: []cli.Flag{},
+					Usage: "Audit log-related command.",
+					Subcommands: []cli.Command{
+						{
+							Name: "export",
+							Flags: []cli.Flag{
+								keySharesFlag,
+								&cli.StringFlag{
+									Name:  "output, o",
+									Usage: "file to write the audit log to (default: stdout)",
+								},
+								auditLogHeadFlag,
+							},
+							Usage:  "export the audit log and check its chain",
+							Action: exportAuditLog(settings),
+						},
+						{
+							Name: "verify",
+							Flags: []cli.Flag{
+								auditLogHeadFlag,
+							},
+							Usage:  "check the chain of an exported audit log",
+							Action: verifyAuditLog(settings),
+						},
+					},
+				},
+				{
+					Name:  "mediators",
+					Flags: []cli.Flag{},
+					Usage: "Mediators-related command.",
+					Subcommands: []cli.Command{
+						{
+							Name: "upload",
+							Flags: []cli.Flag{
+								keySharesFlag,
+								&cli.StringFlag{
+									Name:  "valid-from",
+									Usage: "time from which on the keys are valid (RFC 3339)",
+								},
+								&cli.StringFlag{
+									Name:  "valid-until",
+									Usage: "time until which the keys are valid (RFC 3339)",
+								},
+								&cli.StringFlag{
+									Name:  "predecessor",
+									Usage: "file with the mediator keys that the new keys replace",
+								},
+							},
+							Usage:  "upload signed keys data for a mediator",
+							Action: uploadMediatorKeys(settings),
+						},
+						{
+							Name: "revoke",
+							Flags: []cli.Flag{
+								keySharesFlag,
+								&cli.StringFlag{
+									Name:  "reason",
+									Usage: "reason for the revocation",
+								},
+							},
+							Usage:  "revoke the keys of a mediator",
+							Action: revokeMediatorKeys(settings),
 						},
 					},
 				},
@@ -0,0 +1,674 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package helpers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/forms"
+	"github.com/kiebitz-oss/services/helpers"
+	"github.com/kiebitz-oss/services/ical"
+	"github.com/urfave/cli"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Provider keys are stored in the same format that is used for mediator keys,
+// i.e. as web keys with a JWK private key.
+type ProviderKeys struct {
+	Signing    *crypto.WebKey `json:"signing"`
+	Encryption *crypto.WebKey `json:"encryption"`
+}
+
+func loadProvider(filename string) (*helpers.Provider, error) {
+
+	if filename == "" {
+		return nil, fmt.Errorf("please specify a provider keys file")
+	}
+
+	jsonBytes, err := ioutil.ReadFile(filename)
+
+	if err != nil {
+		return nil, err
+	}
+
+	providerKeys := &ProviderKeys{}
+
+	if err := json.Unmarshal(jsonBytes, providerKeys); err != nil {
+		return nil, err
+	}
+
+	if providerKeys.Signing == nil || providerKeys.Encryption == nil {
+		return nil, fmt.Errorf("signing or encryption key missing")
+	}
+
+	signingKey, err := crypto.LoadWebKey(providerKeys.Signing, "signing", "ecdsa")
+
+	if err != nil {
+		return nil, err
+	}
+
+	encryptionKey, err := crypto.LoadWebKey(providerKeys.Encryption, "encryption", "ecdh")
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &helpers.Provider{
+		Actor: &crypto.Actor{
+			Name:          "provider",
+			SigningKey:    signingKey,
+			EncryptionKey: encryptionKey,
+		},
+	}, nil
+}
+
+func appointmentsClient(settings *services.Settings) *helpers.AppointmentsClient {
+
+	if settings.Admin == nil || settings.Admin.Client == nil {
+		services.Log.Fatal("client settings missing")
+	}
+
+	return helpers.MakeAppointmentsClient(settings, &http.Client{})
+}
+
+func parseDate(value string, defaultValue time.Time) (time.Time, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// returns the result of a JSON-RPC response or an error
+func responseResult(resp *helpers.Response) (interface{}, error) {
+
+	result, err := resp.JSON()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != 200 || result["error"] != nil {
+		return nil, fmt.Errorf("request failed: %v", result["error"])
+	}
+
+	return result["result"], nil
+}
+
+func getProviderAppointments(client *helpers.AppointmentsClient, provider *helpers.Provider, from, to time.Time) ([]*services.SignedAppointment, error) {
+
+	signedAppointments := make([]*services.SignedAppointment, 0)
+
+	// the API returns at most 14 days of appointments, so we fetch them in
+	// chunks (the 'to' date is inclusive)
+	for start := from; !start.After(to); start = start.AddDate(0, 0, 14) {
+
+		end := start.AddDate(0, 0, 13)
+
+		if end.After(to) {
+			end = to
+		}
+
+		resp, err := client.GetProviderAppointments(&services.GetProviderAppointmentsParams{
+			Timestamp: time.Now(),
+			From:      start,
+			To:        end,
+		}, provider)
+
+		if err != nil {
+			return nil, err
+		}
+
+		result, err := responseResult(resp)
+
+		if err != nil {
+			return nil, err
+		}
+
+		list, ok := result.([]interface{})
+
+		if !ok {
+			return nil, fmt.Errorf("expected a list of appointments")
+		}
+
+		for _, item := range list {
+
+			mapItem, ok := item.(map[string]interface{})
+
+			if !ok {
+				return nil, fmt.Errorf("expected an appointment")
+			}
+
+			signedAppointment := &services.SignedAppointment{}
+
+			if params, err := forms.SignedAppointmentForm.Validate(mapItem); err != nil {
+				return nil, err
+			} else if err := forms.SignedAppointmentForm.Coerce(signedAppointment, params); err != nil {
+				return nil, err
+			}
+
+			signedAppointments = append(signedAppointments, signedAppointment)
+		}
+	}
+
+	return signedAppointments, nil
+}
+
+func exportAppointments(settings *services.Settings) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+
+		provider, err := loadProvider(c.String("keys"))
+
+		if err != nil {
+			services.Log.Fatal(err)
+		}
+
+		today := time.Now().UTC().Truncate(24 * time.Hour)
+
+		from, err := parseDate(c.String("from"), today)
+
+		if err != nil {
+			services.Log.Fatal(err)
+		}
+
+		to, err := parseDate(c.String("to"), from.AddDate(0, 0, 13))
+
+		if err != nil {
+			services.Log.Fatal(err)
+		}
+
+		if from.After(to) {
+			services.Log.Fatal("'from' date is after 'to' date")
+		}
+
+		signedAppointments, err := getProviderAppointments(appointmentsClient(settings), provider, from, to)
+
+		if err != nil {
+			services.Log.Fatal(err)
+		}
+
+		// we decrypt the booking data locally, so the server never sees it
+		describe := func(booking *services.Booking) (string, error) {
+			if booking.EncryptedData == nil {
+				return "", nil
+			}
+			if data, err := provider.Actor.EncryptionKey.Decrypt(booking.EncryptedData); err != nil {
+				return "", err
+			} else {
+				return string(data), nil
+			}
+		}
+
+		calendar, err := ical.MakeAppointmentsCalendar(signedAppointments, describe)
+
+		if err != nil {
+			services.Log.Fatal(err)
+		}
+
+		output := c.String("output")
+
+		if output == "" || output == "-" {
+			if _, err := os.Stdout.Write(calendar.Encode()); err != nil {
+				services.Log.Fatal(err)
+			}
+		} else if err := ioutil.WriteFile(output, calendar.Encode(), 0600); err != nil {
+			services.Log.Fatal(err)
+		} else {
+			services.Log.Infof("Exported %d appointments to %s", len(signedAppointments), output)
+		}
+
+		return nil
+	}
+}
+
+// an appointment as read from an import file, before it is signed
+type importedAppointment struct {
+	// identifies the appointment within the import file, so that importing
+	// the same file again updates the appointments instead of duplicating them
+	Key        string
+	Timestamp  time.Time
+	Duration   int64
+	Slots      int64
+	Properties map[string]interface{}
+}
+
+// reads appointments from a CSV file. The first row must contain the column
+// names: 'timestamp' (RFC 3339) is required, 'duration' (minutes) and 'slots'
+// are optional, all other columns are used as appointment properties. An 'id'
+// column can be used to identify the appointments, otherwise the content of
+// each row identifies it.
+func readCSVAppointments(data []byte, defaults *importedAppointment) ([]*importedAppointment, error) {
+
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(records) == 0 {
+		return nil, fmt.Errorf("CSV file is empty")
+	}
+
+	header := records[0]
+	hasTimestamp := false
+
+	for i, name := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(name))
+		if header[i] == "timestamp" {
+			hasTimestamp = true
+		}
+	}
+
+	if !hasTimestamp {
+		return nil, fmt.Errorf("'timestamp' column missing")
+	}
+
+	appointments := make([]*importedAppointment, 0, len(records)-1)
+
+	for i, record := range records[1:] {
+
+		appointment := defaults.copy()
+		appointment.Key = strings.Join(record, ",")
+
+		for j, value := range record {
+
+			value = strings.TrimSpace(value)
+
+			if value == "" {
+				continue
+			}
+
+			switch name := header[j]; name {
+			case "timestamp":
+				if appointment.Timestamp, err = time.Parse(time.RFC3339, value); err != nil {
+					return nil, fmt.Errorf("row %d: %w", i+2, err)
+				}
+			case "duration":
+				if appointment.Duration, err = strconv.ParseInt(value, 10, 64); err != nil {
+					return nil, fmt.Errorf("row %d: %w", i+2, err)
+				}
+			case "slots":
+				if appointment.Slots, err = strconv.ParseInt(value, 10, 64); err != nil {
+					return nil, fmt.Errorf("row %d: %w", i+2, err)
+				}
+			case "id":
+				appointment.Key = "id:" + value
+			default:
+				appointment.Properties[name] = value
+			}
+		}
+
+		if appointment.Timestamp.IsZero() {
+			return nil, fmt.Errorf("row %d: timestamp missing", i+2)
+		}
+
+		appointments = append(appointments, appointment)
+	}
+
+	return appointments, nil
+}
+
+// reads appointments from an iCalendar file. Files created by the 'export'
+// command can be imported again, as the number of slots and the properties are
+// read from the 'X-KIEBITZ-*' properties of the events. The appointments are
+// identified by the UIDs of the events.
+func readICalAppointments(data []byte, defaults *importedAppointment) ([]*importedAppointment, error) {
+
+	calendar, err := ical.Decode(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	appointments := make([]*importedAppointment, 0, len(calendar.Events))
+
+	for _, event := range calendar.Events {
+
+		appointment := defaults.copy()
+		appointment.Key = event.UID
+		appointment.Timestamp = event.Start
+
+		if appointment.Key == "" {
+			// the UID is required by RFC 5545, but not every tool sets it
+			appointment.Key = event.Start.Format(time.RFC3339)
+		}
+
+		if event.Duration > 0 {
+			appointment.Duration = int64(event.Duration / time.Minute)
+		}
+
+		for name, value := range event.Extra {
+
+			if !strings.HasPrefix(name, "kiebitz-") {
+				continue
+			}
+
+			switch name = strings.TrimPrefix(name, "kiebitz-"); name {
+			case "slots":
+				if appointment.Slots, err = strconv.ParseInt(value, 10, 64); err != nil {
+					return nil, fmt.Errorf("event %s: %w", event.UID, err)
+				}
+			case "bookings":
+				// bookings are not imported
+			default:
+				appointment.Properties[name] = value
+			}
+		}
+
+		appointments = append(appointments, appointment)
+	}
+
+	return appointments, nil
+}
+
+func (i *importedAppointment) copy() *importedAppointment {
+
+	properties := make(map[string]interface{}, len(i.Properties))
+
+	for k, v := range i.Properties {
+		properties[k] = v
+	}
+
+	return &importedAppointment{
+		Key:        i.Key,
+		Timestamp:  i.Timestamp,
+		Duration:   i.Duration,
+		Slots:      i.Slots,
+		Properties: properties,
+	}
+}
+
+// derives the appointment and slot IDs from the key of the imported
+// appointment, so that importing it again replaces the existing appointment
+// and keeps the bookings of its slots
+func setImportedAppointmentIDs(appointment *services.Appointment, key string, provider *helpers.Provider) {
+
+	id := crypto.Hash(append(append([]byte("kiebitz-import:"), provider.Actor.SigningKey.PublicKey...), key...))
+
+	appointment.ID = id
+
+	for i, slotData := range appointment.SlotData {
+		slotData.ID = crypto.Hash([]byte(fmt.Sprintf("%x:%d", id, i)))
+	}
+}
+
+// creates and signs the appointments, validating them with the same form the
+// server uses so that invalid files are rejected before anything is published
+func makeSignedAppointments(importedAppointments []*importedAppointment, provider *helpers.Provider) ([]*services.SignedAppointment, error) {
+
+	signedAppointments := make([]*services.SignedAppointment, 0, len(importedAppointments))
+
+	for i, importedAppointment := range importedAppointments {
+
+		if importedAppointment.Slots < 1 {
+			return nil, fmt.Errorf("appointment %d: at least one slot is required", i+1)
+		}
+
+		appointment, err := services.MakeAppointment(importedAppointment.Timestamp, importedAppointment.Slots, importedAppointment.Duration)
+
+		if err != nil {
+			return nil, err
+		}
+
+		setImportedAppointmentIDs(appointment, importedAppointment.Key, provider)
+
+		appointment.PublicKey = provider.Actor.EncryptionKey.PublicKey
+		appointment.Properties = importedAppointment.Properties
+
+		// we validate the appointment data via its JSON representation
+		var mapData map[string]interface{}
+
+		if jsonData, err := json.Marshal(appointment); err != nil {
+			return nil, err
+		} else if err := json.Unmarshal(jsonData, &mapData); err != nil {
+			return nil, err
+		} else if _, err := forms.AppointmentDataForm.Validate(mapData); err != nil {
+			return nil, fmt.Errorf("appointment %d (%s): %w", i+1, importedAppointment.Timestamp.Format(time.RFC3339), err)
+		}
+
+		if signedAppointment, err := appointment.Sign(provider.Actor.SigningKey); err != nil {
+			return nil, err
+		} else {
+			signedAppointments = append(signedAppointments, signedAppointment)
+		}
+	}
+
+	return signedAppointments, nil
+}
+
+func importAppointments(settings *services.Settings) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+
+		if c.NArg() != 1 {
+			services.Log.Fatal("usage: import [file]")
+		}
+
+		filename := c.Args().Get(0)
+
+		provider, err := loadProvider(c.String("keys"))
+
+		if err != nil {
+			services.Log.Fatal(err)
+		}
+
+		data, err := ioutil.ReadFile(filename)
+
+		if err != nil {
+			services.Log.Fatal(err)
+		}
+
+		format := c.String("format")
+
+		if format == "" {
+			switch strings.ToLower(filepath.Ext(filename)) {
+			case ".ics", ".ical":
+				format = "ical"
+			default:
+				format = "csv"
+			}
+		}
+
+		defaults := &importedAppointment{
+			Duration:   c.Int64("duration"),
+			Slots:      c.Int64("slots"),
+			Properties: map[string]interface{}{},
+		}
+
+		if vaccine := c.String("vaccine"); vaccine != "" {
+			defaults.Properties["vaccine"] = vaccine
+		}
+
+		var importedAppointments []*importedAppointment
+
+		switch format {
+		case "csv":
+			importedAppointments, err = readCSVAppointments(data, defaults)
+		case "ical":
+			importedAppointments, err = readICalAppointments(data, defaults)
+		default:
+			services.Log.Fatal(fmt.Sprintf("unknown format: %s", format))
+		}
+
+		if err != nil {
+			services.Log.Fatal(err)
+		}
+
+		signedAppointments, err := makeSignedAppointments(importedAppointments, provider)
+
+		if err != nil {
+			services.Log.Fatal(err)
+		}
+
+		if c.Bool("dry-run") {
+			for _, signedAppointment := range signedAppointments {
+				services.Log.Infof("%s: %d minutes, %d slots, %v",
+					signedAppointment.Data.Timestamp.Format(time.RFC3339),
+					signedAppointment.Data.Duration,
+					len(signedAppointment.Data.SlotData),
+					signedAppointment.Data.Properties,
+				)
+			}
+			services.Log.Infof("Dry run: %d appointments are valid, nothing was published", len(signedAppointments))
+			return nil
+		}
+
+		chunkSize := c.Int("chunk")
+
+		if chunkSize < 1 {
+			services.Log.Fatal("chunk size must be positive")
+		}
+
+		return publishImportedAppointments(appointmentsClient(settings), provider, signedAppointments, chunkSize)
+	}
+}
+
+// publishes the appointments in chunks. A failed chunk does not stop the
+// import, the failed chunks are reported at the end instead. As the IDs of
+// imported appointments are stable, the import can simply be run again.
+func publishImportedAppointments(client *helpers.AppointmentsClient, provider *helpers.Provider, signedAppointments []*services.SignedAppointment, chunkSize int) error {
+
+	failedChunks := make([]string, 0)
+	published := 0
+
+	for i := 0; i < len(signedAppointments); i += chunkSize {
+
+		j := i + chunkSize
+
+		if j > len(signedAppointments) {
+			j = len(signedAppointments)
+		}
+
+		services.Log.Infof("Publishing appointments [%d, %d] from %d in total...", i+1, j, len(signedAppointments))
+
+		resp, err := client.PublishAppointments(&services.PublishAppointmentsParams{
+			Timestamp:    time.Now(),
+			Appointments: signedAppointments[i:j],
+		}, provider)
+
+		if err == nil {
+			_, err = responseResult(resp)
+		}
+
+		if err != nil {
+			services.Log.Errorf("Publishing appointments [%d, %d] failed: %v", i+1, j, err)
+			failedChunks = append(failedChunks, fmt.Sprintf("[%d, %d]", i+1, j))
+			continue
+		}
+
+		published += j - i
+	}
+
+	if len(failedChunks) > 0 {
+		return fmt.Errorf("imported %d of %d appointments, publishing appointments %s failed; run the import again to retry", published, len(signedAppointments), strings.Join(failedChunks, ", "))
+	}
+
+	services.Log.Infof("Imported %d appointments", len(signedAppointments))
+
+	return nil
+}
+
+func Provider(settings *services.Settings) ([]cli.Command, error) {
+
+	keysFlag := &cli.StringFlag{
+		Name:  "keys, k",
+		Usage: "file with the signing and encryption keys of the provider",
+	}
+
+	return []cli.Command{
+		{
+			Name:    "provider",
+			Aliases: []string{"p"},
+			Flags:   []cli.Flag{},
+			Usage:   "Provider functions.",
+			Subcommands: []cli.Command{
+				{
+					Name:  "appointments",
+					Flags: []cli.Flag{},
+					Usage: "Appointments-related command.",
+					Subcommands: []cli.Command{
+						{
+							Name: "export",
+							Flags: []cli.Flag{
+								keysFlag,
+								&cli.StringFlag{
+									Name:  "from",
+									Usage: "earliest date of appointments to export (YYYY-MM-DD, default: today)",
+								},
+								&cli.StringFlag{
+									Name:  "to",
+									Usage: "latest date of appointments to export (YYYY-MM-DD, default: two weeks from 'from')",
+								},
+								&cli.StringFlag{
+									Name:  "output, o",
+									Usage: "file to write the calendar to (default: stdout)",
+								},
+							},
+							Usage:  "export appointments (including decrypted booking data) as an iCalendar file",
+							Action: exportAppointments(settings),
+						},
+						{
+							Name: "import",
+							Flags: []cli.Flag{
+								keysFlag,
+								&cli.StringFlag{
+									Name:  "format, f",
+									Usage: "format of the file, 'csv' or 'ical' (default: based on the file extension)",
+								},
+								&cli.Int64Flag{
+									Name:  "duration",
+									Value: 15,
+									Usage: "duration of appointments (in minutes) without a duration",
+								},
+								&cli.Int64Flag{
+									Name:  "slots",
+									Value: 1,
+									Usage: "number of slots of appointments without a number of slots",
+								},
+								&cli.StringFlag{
+									Name:  "vaccine",
+									Usage: "vaccine of appointments without a vaccine property",
+								},
+								&cli.IntFlag{
+									Name:  "chunk",
+									Value: 100,
+									Usage: "number of appointments to publish per request",
+								},
+								&cli.BoolFlag{
+									Name:  "dry-run",
+									Usage: "only validate the appointments, do not publish them",
+								},
+							},
+							Usage:  "import appointments from a CSV or iCalendar file",
+							Action: importAppointments(settings),
+						},
+					},
+				},
+			},
+		},
+	}, nil
+}
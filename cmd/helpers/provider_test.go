@@ -0,0 +1,278 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package helpers
+
+import (
+	"encoding/json"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/urfave/cli"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// a fake appointments endpoint that records the IDs of published appointments
+type publishRecorder struct {
+	mutex sync.Mutex
+	// the number of the request that should fail (starting at 1)
+	failRequest int
+	requests    int
+	slotIDs     map[string][]string
+}
+
+func (p *publishRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.requests++
+
+	var request struct {
+		Method string `json:"method"`
+		Params struct {
+			Data string `json:"data"`
+		} `json:"params"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Method != "publishAppointments" || p.requests == p.failRequest {
+		w.WriteHeader(500)
+		w.Write([]byte(`{"jsonrpc": "2.0", "error": {"code": 500, "message": "internal error"}}`))
+		return
+	}
+
+	params := &services.PublishAppointmentsParams{}
+
+	if err := json.Unmarshal([]byte(request.Params.Data), params); err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(`{"jsonrpc": "2.0", "error": {"code": 400, "message": "invalid params"}}`))
+		return
+	}
+
+	for _, signedAppointment := range params.Appointments {
+		appointment := &services.Appointment{}
+		if err := json.Unmarshal([]byte(signedAppointment.JSON), appointment); err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(`{"jsonrpc": "2.0", "error": {"code": 400, "message": "invalid appointment"}}`))
+			return
+		}
+		slotIDs := make([]string, 0, len(appointment.SlotData))
+		for _, slot := range appointment.SlotData {
+			slotIDs = append(slotIDs, string(slot.ID))
+		}
+		p.slotIDs[string(appointment.ID)] = slotIDs
+	}
+
+	w.Write([]byte(`{"jsonrpc": "2.0", "result": "ok"}`))
+}
+
+func writeProviderKeys(t *testing.T, dir string) string {
+
+	signingKey, err := crypto.GenerateWebKey("signing", "ecdsa")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encryptionKey, err := crypto.GenerateWebKey("encryption", "ecdh")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	providerKeys := &ProviderKeys{}
+
+	if providerKeys.Signing, err = crypto.KeyAsWebKey(signingKey); err != nil {
+		t.Fatal(err)
+	}
+
+	if providerKeys.Encryption, err = crypto.KeyAsWebKey(encryptionKey); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(providerKeys)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filename := filepath.Join(dir, "provider-keys.json")
+
+	if err := ioutil.WriteFile(filename, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return filename
+}
+
+func runImport(settings *services.Settings, args ...string) error {
+
+	commands, err := Provider(settings)
+
+	if err != nil {
+		return err
+	}
+
+	app := cli.NewApp()
+	app.Commands = commands
+
+	return app.Run(append([]string{"kiebitz", "provider", "appointments", "import"}, args...))
+}
+
+func TestImportAppointments(t *testing.T) {
+
+	recorder := &publishRecorder{
+		failRequest: 2,
+		slotIDs:     map[string][]string{},
+	}
+
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+
+	settings := &services.Settings{
+		Admin: &services.AdminSettings{
+			Client: &services.ClientSettings{
+				AppointmentsEndpoint: server.URL,
+			},
+		},
+	}
+
+	dir := t.TempDir()
+	keysFile := writeProviderKeys(t, dir)
+	csvFile := filepath.Join(dir, "appointments.csv")
+
+	if err := ioutil.WriteFile(csvFile, []byte(strings.Join([]string{
+		"timestamp,duration,slots,vaccine",
+		"2030-10-01T10:00:00Z,30,2,biontech",
+		"2030-10-01T10:30:00Z,30,2,biontech",
+		"2030-10-01T10:30:00Z,30,2,moderna",
+		"2030-10-01T11:00:00Z,30,1,biontech",
+	}, "\n")), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// the second chunk fails, the import reports it and continues
+	if err := runImport(settings, "--keys", keysFile, "--chunk", "2", csvFile); err == nil {
+		t.Fatalf("expected an error")
+	} else if !strings.Contains(err.Error(), "[3, 4]") {
+		t.Fatalf("expected the failed chunk to be reported, got: %v", err)
+	}
+
+	if recorder.requests != 2 || len(recorder.slotIDs) != 2 {
+		t.Fatalf("expected two appointments from one chunk, got %d", len(recorder.slotIDs))
+	}
+
+	firstSlotIDs := map[string][]string{}
+
+	for id, slotIDs := range recorder.slotIDs {
+		firstSlotIDs[id] = slotIDs
+	}
+
+	// importing the file again updates the appointments that were already
+	// published instead of duplicating them
+	if err := runImport(settings, "--keys", keysFile, "--chunk", "2", csvFile); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recorder.slotIDs) != 4 {
+		t.Fatalf("expected four appointments, got %d", len(recorder.slotIDs))
+	}
+
+	for id, slotIDs := range firstSlotIDs {
+		if newSlotIDs := recorder.slotIDs[id]; strings.Join(newSlotIDs, "") != strings.Join(slotIDs, "") {
+			t.Fatalf("expected the slot IDs to be stable")
+		}
+	}
+
+}
+
+func TestImportICalAppointmentIDs(t *testing.T) {
+
+	provider, err := loadProvider(writeProviderKeys(t, t.TempDir()))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte(strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"BEGIN:VEVENT",
+		"UID:first@example.com",
+		"DTSTART:20301001T100000Z",
+		"DURATION:PT30M",
+		"X-KIEBITZ-SLOTS:2",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:second@example.com",
+		"DTSTART:20301001T100000Z",
+		"DURATION:PT30M",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n"))
+
+	ids := func() []string {
+
+		importedAppointments, err := readICalAppointments(data, &importedAppointment{
+			Duration:   15,
+			Slots:      1,
+			Properties: map[string]interface{}{"vaccine": "biontech"},
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		signedAppointments, err := makeSignedAppointments(importedAppointments, provider)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ids := make([]string, 0)
+
+		for _, signedAppointment := range signedAppointments {
+			ids = append(ids, string(signedAppointment.Data.ID))
+			for _, slot := range signedAppointment.Data.SlotData {
+				ids = append(ids, string(slot.ID))
+			}
+		}
+
+		return ids
+	}
+
+	first, second := ids(), ids()
+
+	if len(first) != 5 {
+		t.Fatalf("expected two appointments with three slots, got %d IDs", len(first))
+	}
+
+	if first[0] == first[3] {
+		t.Fatalf("expected events with the same start time to have different IDs")
+	}
+
+	if strings.Join(first, "") != strings.Join(second, "") {
+		t.Fatalf("expected the IDs to be stable")
+	}
+
+}
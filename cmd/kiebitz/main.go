@@ -32,12 +32,12 @@ func Settings(definitions *services.Definitions) (*services.Settings, error) {
 		return nil, err
 	} else {
 
-		key, err := crypto.BuildKeyFromEnv()
+		passphrase, err := crypto.PassphraseFromEnv()
 		if err != nil {
 			services.Log.Warning(err)
 		}
 
-		encFs := encryptFs.New(fs, key)
+		encFs := encryptFs.New(fs, passphrase)
 		return helpers.Settings(settingsPaths, encFs, definitions)
 	}
 }
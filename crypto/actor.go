@@ -25,26 +25,20 @@ type Actor struct {
 }
 
 func MakeActor(name string) (*Actor, error) {
+	return MakeActorWithKeyTypes(name, "ecdsa", "ecdh")
+}
 
-	signingKey, err := GenerateKey()
-
-	if err != nil {
-		return nil, err
-	}
-
-	encryptionKey, err := GenerateKey()
-
-	if err != nil {
-		return nil, err
-	}
+// Creates an actor with the given signing ('ecdsa' or 'ed25519') and
+// encryption ('ecdh' or 'x25519') key types
+func MakeActorWithKeyTypes(name, signingKeyType, encryptionKeyType string) (*Actor, error) {
 
-	signingSettingsKey, err := AsSettingsKey(signingKey, "signing", "ecdsa")
+	signingKey, err := GenerateWebKey("signing", signingKeyType)
 
 	if err != nil {
 		return nil, err
 	}
 
-	encryptionSettingsKey, err := AsSettingsKey(encryptionKey, "encryption", "ecdh")
+	encryptionKey, err := GenerateWebKey("encryption", encryptionKeyType)
 
 	if err != nil {
 		return nil, err
@@ -52,8 +46,8 @@ func MakeActor(name string) (*Actor, error) {
 
 	return &Actor{
 		Name:          name,
-		EncryptionKey: encryptionSettingsKey,
-		SigningKey:    signingSettingsKey,
+		EncryptionKey: encryptionKey,
+		SigningKey:    signingKey,
 	}, nil
 
 }
@@ -0,0 +1,209 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package crypto
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// A local signing agent holds private keys in a separate process and signs
+// digests for clients that connect to it via a Unix socket. Requests and
+// responses are newline-delimited JSON objects, so a connection can be used
+// for several requests.
+
+type AgentRequest struct {
+	Key    string `json:"key"`
+	Digest []byte `json:"digest"`
+}
+
+type AgentResponse struct {
+	Signature []byte `json:"signature,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+type AgentSigner struct {
+	socket    string
+	keyName   string
+	publicKey []byte
+	timeout   time.Duration
+}
+
+type AgentSignerSettings struct {
+	Socket string `json:"socket"`
+	// name of the key at the agent (defaults to the name of the key)
+	Key            string `json:"key"`
+	TimeoutSeconds int64  `json:"timeout_seconds"`
+}
+
+func MakeAgentSigner(key *Key, settings map[string]interface{}) (Signer, error) {
+
+	agentSettings := &AgentSignerSettings{}
+
+	if err := loadSignerSettings(settings, agentSettings); err != nil {
+		return nil, err
+	}
+
+	if agentSettings.Socket == "" {
+		return nil, fmt.Errorf("agent socket missing")
+	}
+
+	if agentSettings.Key == "" {
+		agentSettings.Key = key.Name
+	}
+
+	if agentSettings.TimeoutSeconds == 0 {
+		agentSettings.TimeoutSeconds = 5
+	}
+
+	return &AgentSigner{
+		socket:    agentSettings.Socket,
+		keyName:   agentSettings.Key,
+		publicKey: key.PublicKey,
+		timeout:   time.Duration(agentSettings.TimeoutSeconds) * time.Second,
+	}, nil
+}
+
+func (a *AgentSigner) Sign(digest []byte) ([]byte, error) {
+
+	conn, err := net.DialTimeout("unix", a.socket, a.timeout)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(a.timeout)); err != nil {
+		return nil, err
+	}
+
+	if err := json.NewEncoder(conn).Encode(&AgentRequest{
+		Key:    a.keyName,
+		Digest: digest,
+	}); err != nil {
+		return nil, err
+	}
+
+	response := &AgentResponse{}
+
+	if err := json.NewDecoder(conn).Decode(response); err != nil {
+		return nil, err
+	}
+
+	if response.Error != "" {
+		return nil, fmt.Errorf("signing agent: %s", response.Error)
+	}
+
+	// we make sure the agent signed with the key we expect
+	if publicKey, err := LoadPublicKey(a.publicKey); err != nil {
+		return nil, err
+	} else if ok, err := VerifyDigest(digest, response.Signature, publicKey); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, fmt.Errorf("signing agent returned an invalid signature")
+	}
+
+	return response.Signature, nil
+}
+
+type SigningAgent struct {
+	signers map[string]Signer
+}
+
+// creates an agent that signs with the given keys, which can use any signer
+// (e.g. a PKCS#11 token) except the agent itself
+func MakeSigningAgent(keys []*Key) (*SigningAgent, error) {
+
+	signers := map[string]Signer{}
+
+	for _, key := range keys {
+
+		if key.Signer != nil && key.Signer.Type == "agent" {
+			return nil, fmt.Errorf("key %s: agent cannot sign via another agent", key.Name)
+		}
+
+		if signer, err := MakeSigner(key); err != nil {
+			return nil, fmt.Errorf("key %s: %w", key.Name, err)
+		} else {
+			signers[key.Name] = signer
+		}
+	}
+
+	return &SigningAgent{
+		signers: signers,
+	}, nil
+}
+
+// accepts connections until the listener is closed
+func (s *SigningAgent) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *SigningAgent) handle(conn net.Conn) {
+
+	defer conn.Close()
+
+	decoder := json.NewDecoder(conn)
+	encoder := json.NewEncoder(conn)
+
+	for {
+
+		request := &AgentRequest{}
+
+		if err := decoder.Decode(request); err != nil {
+			if err != io.EOF {
+				encoder.Encode(&AgentResponse{Error: "invalid request"})
+			}
+			return
+		}
+
+		if err := encoder.Encode(s.sign(request)); err != nil {
+			return
+		}
+	}
+}
+
+func (s *SigningAgent) sign(request *AgentRequest) *AgentResponse {
+
+	signer, ok := s.signers[request.Key]
+
+	if !ok {
+		return &AgentResponse{Error: "unknown key"}
+	}
+
+	if len(request.Digest) != 32 {
+		return &AgentResponse{Error: "invalid digest"}
+	}
+
+	if signature, err := signer.Sign(request.Digest); err != nil {
+		return &AgentResponse{Error: err.Error()}
+	} else {
+		return &AgentResponse{Signature: signature}
+	}
+}
@@ -0,0 +1,77 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package crypto
+
+import (
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"os"
+)
+
+// Argon2id parameters, which are stored alongside the encrypted data so that
+// they can be increased over time without breaking existing files
+type Argon2Params struct {
+	Time    uint32
+	Memory  uint32 // in KiB
+	Threads uint8
+}
+
+// the second recommended option from RFC 9106
+var DefaultArgon2Params = Argon2Params{
+	Time:    3,
+	Memory:  64 * 1024,
+	Threads: 4,
+}
+
+// limits for parameters read from files, so that a manipulated file can't
+// make us allocate arbitrary amounts of memory
+const maxArgon2Time = 100
+const maxArgon2Memory = 1024 * 1024 // 1 GiB
+
+func (a *Argon2Params) Validate() error {
+	if a.Time < 1 || a.Time > maxArgon2Time {
+		return fmt.Errorf("invalid Argon2 time parameter: %d", a.Time)
+	}
+	if a.Memory < 8*uint32(a.Threads) || a.Memory > maxArgon2Memory {
+		return fmt.Errorf("invalid Argon2 memory parameter: %d", a.Memory)
+	}
+	if a.Threads < 1 {
+		return fmt.Errorf("invalid Argon2 threads parameter: %d", a.Threads)
+	}
+	return nil
+}
+
+// Derives a 256 bit key from the passphrase via Argon2id
+func DeriveArgon2Key(passphrase, salt []byte, params *Argon2Params) ([]byte, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	if len(salt) < 16 {
+		return nil, fmt.Errorf("salt too short")
+	}
+	return argon2.IDKey(passphrase, salt, params.Time, params.Memory, params.Threads, 32), nil
+}
+
+func PassphraseFromEnv() ([]byte, error) {
+	passphrase := os.Getenv(envPassName)
+	if passphrase == "" {
+		return nil, fmt.Errorf("no passphrase in environment")
+	}
+	return []byte(passphrase), nil
+}
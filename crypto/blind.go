@@ -0,0 +1,352 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package crypto
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// RSA blind signatures as specified in RFC 9474 (RSABSSA-SHA384-PSS-
+// Deterministic). A user blinds a token containing a random serial, the
+// server signs the blinded value and the user finalizes the result, obtaining
+// a regular RSASSA-PSS signature on a token that the server has never seen.
+// The server can therefore not link the issuance of a token to its later use.
+// As the token contains a random serial we don't need the randomized variant.
+
+const BlindKeyBits = 2048
+
+// the salt length equals the length of the SHA-384 hash
+const blindSaltLength = sha512.Size384
+
+var ErrOutOfRange = errors.New("value out of range")
+var ErrBlindSigner = errors.New("blind signing keys cannot use a signer")
+
+func GenerateBlindKey(name string) (*Key, error) {
+	key, err := rsa.GenerateKey(rand.Reader, BlindKeyBits)
+	if err != nil {
+		return nil, err
+	}
+	marshalledPublicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	marshalledPrivateKey, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{
+		Type:       "rsa",
+		PublicKey:  marshalledPublicKey,
+		PrivateKey: marshalledPrivateKey,
+		Purposes:   []string{"sign", "verify"},
+		Params: map[string]interface{}{
+			"modulusLength": BlindKeyBits,
+			"hash":          "sha-384",
+			"saltLength":    blindSaltLength,
+		},
+		Name:   name,
+		Format: "spki-pkcs8",
+	}, nil
+}
+
+func LoadBlindPublicKey(publicKey []byte) (*rsa.PublicKey, error) {
+	if key, err := x509.ParsePKIXPublicKey(publicKey); err != nil {
+		return nil, err
+	} else if rsaKey, ok := key.(*rsa.PublicKey); !ok {
+		return nil, fmt.Errorf("not an RSA public key")
+	} else if rsaKey.N.BitLen() < BlindKeyBits {
+		return nil, fmt.Errorf("RSA modulus too short")
+	} else {
+		return rsaKey, nil
+	}
+}
+
+func LoadBlindPrivateKey(privateKey []byte) (*rsa.PrivateKey, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(privateKey); err != nil {
+		return nil, err
+	} else if rsaKey, ok := key.(*rsa.PrivateKey); !ok {
+		return nil, fmt.Errorf("not an RSA private key")
+	} else if rsaKey.N.BitLen() < BlindKeyBits {
+		return nil, fmt.Errorf("RSA modulus too short")
+	} else {
+		return rsaKey, nil
+	}
+}
+
+// the byte length of the modulus, which all blinded values, blind signatures
+// and signatures need to have
+func modulusLength(publicKey *rsa.PublicKey) int {
+	return (publicKey.N.BitLen() + 7) / 8
+}
+
+// converts the value to a big-endian representation of the modulus length
+func modulusBytes(v *big.Int, publicKey *rsa.PublicKey) []byte {
+	return pad(v.Bytes(), modulusLength(publicKey))
+}
+
+// converts the value to an integer and checks that it is smaller than the
+// modulus (and has the length of the modulus)
+func modulusInt(v []byte, publicKey *rsa.PublicKey) (*big.Int, error) {
+	if len(v) != modulusLength(publicKey) {
+		return nil, ErrOutOfRange
+	}
+	i := new(big.Int).SetBytes(v)
+	if i.Sign() == 0 || i.Cmp(publicKey.N) >= 0 {
+		return nil, ErrOutOfRange
+	}
+	return i, nil
+}
+
+// XORs the data with the MGF1 mask (SHA-384) generated from the seed
+func mgf1XOR(data, seed []byte) {
+	counter := make([]byte, 4)
+	for i, done := uint32(0), 0; done < len(data); i++ {
+		binary.BigEndian.PutUint32(counter, i)
+		h := sha512.New384()
+		h.Write(seed)
+		h.Write(counter)
+		for _, b := range h.Sum(nil) {
+			if done >= len(data) {
+				break
+			}
+			data[done] ^= b
+			done++
+		}
+	}
+}
+
+// EMSA-PSS encoding of the message hash (RFC 8017, section 9.1.1)
+func emsaPSSEncode(mHash, salt []byte, emBits int) ([]byte, error) {
+
+	hLen, sLen := len(mHash), len(salt)
+	emLen := (emBits + 7) / 8
+
+	if emLen < hLen+sLen+2 {
+		return nil, fmt.Errorf("encoding error")
+	}
+
+	h := sha512.New384()
+	h.Write(make([]byte, 8))
+	h.Write(mHash)
+	h.Write(salt)
+	hash := h.Sum(nil)
+
+	db := make([]byte, emLen-hLen-1)
+	db[emLen-sLen-hLen-2] = 0x01
+	copy(db[emLen-sLen-hLen-1:], salt)
+
+	mgf1XOR(db, hash)
+
+	// we clear the leftmost bits so that the value is smaller than the modulus
+	db[0] &= 0xff >> uint(8*emLen-emBits)
+
+	return append(append(db, hash...), 0xbc), nil
+}
+
+// Blinds the given message for the public key (Blind in RFC 9474). Returns the
+// blinded message that should be sent to the signer as well as the inverse of
+// the blinding factor, which is needed to finalize the signature and must be
+// kept secret.
+func Blind(message, publicKeyData []byte) ([]byte, []byte, error) {
+	publicKey, err := LoadBlindPublicKey(publicKeyData)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	salt, err := RandomBytes(blindSaltLength)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	mHash := sha512.Sum384(message)
+	encoded, err := emsaPSSEncode(mHash[:], salt, publicKey.N.BitLen()-1)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	m := new(big.Int).SetBytes(encoded)
+	one := big.NewInt(1)
+
+	if new(big.Int).GCD(nil, nil, m, publicKey.N).Cmp(one) != 0 {
+		return nil, nil, fmt.Errorf("invalid input")
+	}
+
+	e := big.NewInt(int64(publicKey.E))
+
+	for {
+		r, err := rand.Int(rand.Reader, publicKey.N)
+		if err != nil {
+			return nil, nil, err
+		}
+		// r needs to be invertible modulo N
+		inv := new(big.Int).ModInverse(r, publicKey.N)
+		if r.Sign() == 0 || inv == nil {
+			continue
+		}
+		blinded := new(big.Int).Exp(r, e, publicKey.N)
+		blinded.Mul(blinded, m)
+		blinded.Mod(blinded, publicKey.N)
+		return modulusBytes(blinded, publicKey), modulusBytes(inv, publicKey), nil
+	}
+}
+
+// Removes the blinding factor from a signature on a blinded message and checks
+// the resulting signature on the original message (Finalize in RFC 9474).
+func Unblind(message, blindSignature, inverse, publicKeyData []byte) ([]byte, error) {
+	publicKey, err := LoadBlindPublicKey(publicKeyData)
+	if err != nil {
+		return nil, err
+	}
+
+	z, err := modulusInt(blindSignature, publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	inv, err := modulusInt(inverse, publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	s := z.Mul(z, inv)
+	s.Mod(s, publicKey.N)
+
+	signature := modulusBytes(s, publicKey)
+
+	if ok, err := VerifyBlindSignature(message, signature, publicKeyData); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, fmt.Errorf("invalid blind signature")
+	}
+
+	return signature, nil
+}
+
+// verifies a finalized signature, which is a regular RSASSA-PSS signature
+func VerifyBlindSignature(message, signature, publicKeyData []byte) (bool, error) {
+	publicKey, err := LoadBlindPublicKey(publicKeyData)
+	if err != nil {
+		return false, err
+	}
+
+	if len(signature) != modulusLength(publicKey) {
+		return false, nil
+	}
+
+	mHash := sha512.Sum384(message)
+
+	if err := rsa.VerifyPSS(publicKey, crypto.SHA384, mHash[:], signature, &rsa.PSSOptions{
+		SaltLength: blindSaltLength,
+		Hash:       crypto.SHA384,
+	}); err != nil {
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// computes m^d mod N. As m is chosen by the client and math/big doesn't
+// exponentiate in constant time, we blind m with a random value so that the
+// timing is unrelated to it (RSA blinding).
+func rsaSignRaw(privateKey *rsa.PrivateKey, m *big.Int) (*big.Int, error) {
+
+	n := privateKey.N
+	e := big.NewInt(int64(privateKey.E))
+
+	var r, rInv *big.Int
+
+	for {
+		var err error
+		if r, err = rand.Int(rand.Reader, n); err != nil {
+			return nil, err
+		}
+		if rInv = new(big.Int).ModInverse(r, n); r.Sign() != 0 && rInv != nil {
+			break
+		}
+	}
+
+	c := new(big.Int).Exp(r, e, n)
+	c.Mul(c, m)
+	c.Mod(c, n)
+
+	var s *big.Int
+
+	if len(privateKey.Primes) == 2 {
+		privateKey.Precompute()
+		// we use the CRT values to speed up the exponentiation
+		p, q := privateKey.Primes[0], privateKey.Primes[1]
+		mp := new(big.Int).Exp(c, privateKey.Precomputed.Dp, p)
+		mq := new(big.Int).Exp(c, privateKey.Precomputed.Dq, q)
+		s = mp.Sub(mp, mq)
+		s.Mul(s, privateKey.Precomputed.Qinv)
+		s.Mod(s, p)
+		s.Mul(s, q)
+		s.Add(s, mq)
+	} else {
+		s = new(big.Int).Exp(c, privateKey.D, n)
+	}
+
+	s.Mul(s, rInv)
+	s.Mod(s, n)
+
+	// we verify the signature to protect against faults leaking the key
+	if new(big.Int).Exp(s, e, n).Cmp(m) != 0 {
+		return nil, fmt.Errorf("blind signature verification failed")
+	}
+
+	return s, nil
+}
+
+// Signs a blinded message with the private key (BlindSign in RFC 9474). The
+// signer learns nothing about the original message. Signer backends only
+// create ECDSA signatures, so blind signing keys need their private key and
+// cannot have signer settings.
+func (k *Key) BlindSign(blinded []byte) ([]byte, error) {
+	if k.Signer != nil {
+		return nil, ErrBlindSigner
+	}
+	privateKey, err := LoadBlindPrivateKey(k.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := modulusInt(blinded, &privateKey.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := rsaSignRaw(privateKey, m)
+	if err != nil {
+		return nil, err
+	}
+
+	return modulusBytes(s, &privateKey.PublicKey), nil
+}
+
+func (k *Key) VerifyBlind(message, signature []byte) (bool, error) {
+	return VerifyBlindSignature(message, signature, k.PublicKey)
+}
@@ -0,0 +1,123 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package crypto
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha512"
+	"testing"
+)
+
+func TestBlindSignatures(t *testing.T) {
+
+	key, err := GenerateBlindKey("blind-token")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message := []byte("a random serial number")
+
+	blinded, blindingFactor, err := Blind(message, key.PublicKey)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blindSignature, err := key.BlindSign(blinded)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the blind signature must not be valid for the message itself
+	if ok, err := key.VerifyBlind(message, blindSignature); err != nil {
+		t.Fatal(err)
+	} else if ok {
+		t.Fatalf("blind signature should not verify")
+	}
+
+	// a tampered blind signature can't be finalized
+	tampered := append([]byte{}, blindSignature...)
+	tampered[len(tampered)-1] ^= 0xff
+
+	if _, err := Unblind(message, tampered, blindingFactor, key.PublicKey); err == nil {
+		t.Fatalf("expected an error")
+	}
+
+	signature, err := Unblind(message, blindSignature, blindingFactor, key.PublicKey)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := key.VerifyBlind(message, signature); err != nil {
+		t.Fatal(err)
+	} else if !ok {
+		t.Fatalf("expected a valid signature")
+	}
+
+	if ok, err := key.VerifyBlind([]byte("another serial number"), signature); err != nil {
+		t.Fatal(err)
+	} else if ok {
+		t.Fatalf("signature should not verify for a different message")
+	}
+
+	// finalized signatures are regular RSASSA-PSS signatures
+	privateKey, err := LoadBlindPrivateKey(key.PrivateKey)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mHash := sha512.Sum384(message)
+
+	if pssSignature, err := rsa.SignPSS(rand.Reader, privateKey, crypto.SHA384, mHash[:], &rsa.PSSOptions{
+		SaltLength: blindSaltLength,
+	}); err != nil {
+		t.Fatal(err)
+	} else if ok, err := key.VerifyBlind(message, pssSignature); err != nil {
+		t.Fatal(err)
+	} else if !ok {
+		t.Fatalf("expected a valid PSS signature")
+	}
+
+	// blinded values need to have the length of the modulus
+	// blind signing keys cannot use signer backends
+	signerKey := *key
+	signerKey.Signer = &SignerSettings{Type: "file"}
+
+	if _, err := signerKey.BlindSign(blinded); err != ErrBlindSigner {
+		t.Fatalf("expected ErrBlindSigner, got %v", err)
+	}
+
+	if _, err := key.BlindSign(blinded[1:]); err != ErrOutOfRange {
+		t.Fatalf("expected an out of range error")
+	}
+
+	// blinding the same message twice yields unrelated values
+	if otherBlinded, _, err := Blind(message, key.PublicKey); err != nil {
+		t.Fatal(err)
+	} else if string(otherBlinded) == string(blinded) {
+		t.Fatalf("expected blinded messages to differ")
+	}
+
+}
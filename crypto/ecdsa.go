@@ -20,6 +20,7 @@ package crypto
 
 import (
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
@@ -27,6 +28,7 @@ import (
 	"encoding/base64"
 	"fmt"
 	"math/big"
+	"strings"
 )
 
 // https://thanethomson.com/2018/11/30/validating-ecdsa-signatures-golang/
@@ -36,6 +38,12 @@ func GenerateKey() (*ecdsa.PrivateKey, error) {
 }
 
 func GenerateWebKey(name, keyType string) (*Key, error) {
+	switch keyType {
+	case "ed25519":
+		return GenerateEd25519Key(name)
+	case "x25519":
+		return GenerateX25519Key(name)
+	}
 	if key, err := GenerateKey(); err != nil {
 		return nil, err
 	} else {
@@ -50,7 +58,8 @@ type JWKPrivateKey struct {
 	KeyOps      []string `json:"key_ops"`
 	KeyType     string   `json:"kty"`
 	X           string   `json:"x"`
-	Y           string   `json:"y"`
+	// not defined for OKP keys (Ed25519 & X25519)
+	Y string `json:"y,omitempty"`
 }
 
 type WebKey struct {
@@ -122,6 +131,64 @@ func AsWebKey(key *ecdsa.PrivateKey, keyType string) (*WebKey, error) {
 	}, nil
 }
 
+// Converts a web key (e.g. as exported by the frontend or generated by AsWebKey)
+// back into a settings key. For OKP keys the key type is given by the curve.
+func LoadWebKey(webKey *WebKey, name, keyType string) (*Key, error) {
+
+	if webKey.PrivateKey == nil {
+		return nil, fmt.Errorf("private key missing")
+	}
+
+	if webKey.PrivateKey.KeyType == "OKP" {
+		return loadOKPWebKey(webKey.PrivateKey, name)
+	}
+
+	if webKey.PrivateKey.Curve != "P-256" {
+		return nil, fmt.Errorf("unsupported curve: %s", webKey.PrivateKey.Curve)
+	}
+
+	decode := func(value string) (*big.Int, error) {
+		if data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "=")); err != nil {
+			return nil, err
+		} else {
+			return new(big.Int).SetBytes(data), nil
+		}
+	}
+
+	d, err := decode(webKey.PrivateKey.D)
+
+	if err != nil {
+		return nil, err
+	}
+
+	x, err := decode(webKey.PrivateKey.X)
+
+	if err != nil {
+		return nil, err
+	}
+
+	y, err := decode(webKey.PrivateKey.Y)
+
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey := &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     x,
+			Y:     y,
+		},
+		D: d,
+	}
+
+	if !privateKey.Curve.IsOnCurve(x, y) {
+		return nil, fmt.Errorf("invalid public key")
+	}
+
+	return AsSettingsKey(privateKey, name, keyType)
+}
+
 func LoadPublicKey(publicKey []byte) (*ecdsa.PublicKey, error) {
 	pub, err := x509.ParsePKIXPublicKey(publicKey)
 	if err != nil {
@@ -155,15 +222,29 @@ func (e *ECDSASignature) Serialize() []byte {
 	return append(pad(e.R.Bytes(), 32), pad(e.S.Bytes(), 32)...)
 }
 
+// Verifies an ECDSA (P-256) or Ed25519 signature, depending on the type of
+// the given public key
 func VerifyWithBytes(message, signature, publicKeyData []byte) (bool, error) {
-	if publicKey, err := LoadPublicKey(publicKeyData); err != nil {
+	if publicKey, err := ParsePublicKey(publicKeyData); err != nil {
 		return false, err
 	} else {
-		return Verify(message, signature, publicKey)
+		switch publicKey := publicKey.(type) {
+		case *ecdsa.PublicKey:
+			return Verify(message, signature, publicKey)
+		case ed25519.PublicKey:
+			return VerifyEd25519(message, signature, publicKey)
+		default:
+			return false, fmt.Errorf("invalid public key type")
+		}
 	}
 }
 
 func Verify(message []byte, signatureBytes []byte, publicKey *ecdsa.PublicKey) (bool, error) {
+	hash := sha256.Sum256(message)
+	return VerifyDigest(hash[:], signatureBytes, publicKey)
+}
+
+func VerifyDigest(digest []byte, signatureBytes []byte, publicKey *ecdsa.PublicKey) (bool, error) {
 	sig := &ECDSASignature{
 		R: &big.Int{},
 		S: &big.Int{},
@@ -178,11 +259,9 @@ func Verify(message []byte, signatureBytes []byte, publicKey *ecdsa.PublicKey) (
 	sig.R.SetBytes(signatureBytes[0:32])
 	sig.S.SetBytes(signatureBytes[32:])
 
-	hash := sha256.Sum256(message)
-
 	valid := ecdsa.Verify(
 		publicKey,
-		hash[:],
+		digest,
 		sig.R,
 		sig.S,
 	)
@@ -193,13 +272,17 @@ func Verify(message []byte, signatureBytes []byte, publicKey *ecdsa.PublicKey) (
 }
 
 func Sign(message []byte, privateKey *ecdsa.PrivateKey) (*ECDSASignature, error) {
-
 	hash := sha256.Sum256(message)
+	return SignDigest(hash[:], privateKey)
+}
+
+// signs a SHA-256 digest, which allows signers to sign data they never see
+func SignDigest(digest []byte, privateKey *ecdsa.PrivateKey) (*ECDSASignature, error) {
 
 	r, s, err := ecdsa.Sign(
 		rand.Reader,
 		privateKey,
-		hash[:],
+		digest,
 	)
 	if err != nil {
 		return nil, err
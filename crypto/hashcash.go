@@ -0,0 +1,61 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package crypto
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math/bits"
+)
+
+// Hashcash-style proof of work: a solution is valid if the SHA-256 hash of
+// the challenge followed by the solution starts with the given number of zero
+// bits. Finding a solution takes about 2^difficulty hash operations, while
+// verifying it takes only one.
+
+func leadingZeroBits(hash []byte) int {
+	n := 0
+	for _, b := range hash {
+		if b == 0 {
+			n += 8
+			continue
+		}
+		return n + bits.LeadingZeros8(b)
+	}
+	return n
+}
+
+func VerifyHashcash(challenge, solution []byte, difficulty int) bool {
+	h := sha256.New()
+	h.Write(challenge)
+	h.Write(solution)
+	return leadingZeroBits(h.Sum(nil)) >= difficulty
+}
+
+// Finds a solution for the given challenge. This is mostly useful for testing,
+// as regular clients solve challenges themselves.
+func SolveHashcash(challenge []byte, difficulty int) []byte {
+	solution := make([]byte, 8)
+	for i := uint64(0); ; i++ {
+		binary.BigEndian.PutUint64(solution, i)
+		if VerifyHashcash(challenge, solution, difficulty) {
+			return solution
+		}
+	}
+}
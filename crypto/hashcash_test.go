@@ -0,0 +1,43 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package crypto
+
+import (
+	"testing"
+)
+
+func TestHashcash(t *testing.T) {
+
+	challenge := []byte("challenge")
+
+	solution := SolveHashcash(challenge, 12)
+
+	if !VerifyHashcash(challenge, solution, 12) {
+		t.Fatalf("expected a valid solution")
+	}
+
+	if VerifyHashcash([]byte("another challenge"), solution, 12) && VerifyHashcash([]byte("yet another challenge"), solution, 12) {
+		t.Fatalf("solution should not be valid for other challenges")
+	}
+
+	if leadingZeroBits([]byte{0, 0x10, 0xff}) != 11 {
+		t.Fatalf("expected 11 leading zero bits")
+	}
+
+}
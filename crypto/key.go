@@ -18,6 +18,14 @@
 
 package crypto
 
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"fmt"
+	"sync"
+)
+
 type Key struct {
 	Name      string                 `json:"name"`
 	Type      string                 `json:"type"`
@@ -27,15 +35,53 @@ type Key struct {
 	Purposes  []string               `json:"purposes"`
 	// only defined for local signing operations
 	PrivateKey []byte `json:"privateKey,omitempty"`
+	// signs with an external signer instead of the private key (optional)
+	Signer *SignerSettings `json:"signer,omitempty"`
+	// the signer is created on first use (see getSigner)
+	signer *cachedSigner
 }
 
-func (k *Key) Encrypt(data []byte, recipient *Key) (*ECDHEncryptedData, error) {
-	if privateKey, err := LoadPrivateKey(k.PrivateKey); err != nil {
+// a signer together with the key material it was made for, so that copies of
+// a key with a different private key or signer don't use it. Signer settings
+// are compared by identity, so they must be replaced rather than modified.
+type cachedSigner struct {
+	signer     Signer
+	settings   *SignerSettings
+	privateKey []byte
+}
+
+var signerCacheMutex sync.Mutex
+
+// returns the signer of the key, which is only created once as making it can
+// be expensive (e.g. reading a key file or opening a PKCS#11 module)
+func (k *Key) getSigner() (Signer, error) {
+
+	signerCacheMutex.Lock()
+	defer signerCacheMutex.Unlock()
+
+	if c := k.signer; c != nil && c.settings == k.Signer && bytes.Equal(c.privateKey, k.PrivateKey) {
+		return c.signer, nil
+	}
+
+	signer, err := MakeSigner(k)
+
+	if err != nil {
 		return nil, err
-	} else if publicKey, err := LoadPublicKey(recipient.PublicKey); err != nil {
+	}
+
+	k.signer = &cachedSigner{
+		signer:     signer,
+		settings:   k.Signer,
+		privateKey: k.PrivateKey,
+	}
+
+	return signer, nil
+}
+
+func (k *Key) Encrypt(data []byte, recipient *Key) (*ECDHEncryptedData, error) {
+	if key, err := DeriveSharedKey(k.PrivateKey, recipient.PublicKey); err != nil {
 		return nil, err
 	} else {
-		key := DeriveKey(publicKey, privateKey)
 		if encryptedData, err := Encrypt(data, key); err != nil {
 			return nil, err
 		} else {
@@ -48,6 +94,18 @@ func (k *Key) Encrypt(data []byte, recipient *Key) (*ECDHEncryptedData, error) {
 	}
 }
 
+// Decrypts data that was encrypted for this key via ECDH (e.g. using Encrypt)
+func (k *Key) Decrypt(data *ECDHEncryptedData) ([]byte, error) {
+	if key, err := DeriveSharedKey(k.PrivateKey, data.PublicKey); err != nil {
+		return nil, err
+	} else {
+		return Decrypt(&EncryptedData{
+			IV:   data.IV,
+			Data: data.Data,
+		}, key)
+	}
+}
+
 func (k *Key) SignString(data string) (*SignedStringData, error) {
 	if signature, err := k.Sign([]byte(data)); err != nil {
 		return nil, err
@@ -61,31 +119,45 @@ func (k *Key) SignString(data string) (*SignedStringData, error) {
 }
 
 func (k *Key) Sign(data []byte) (*SignedData, error) {
-	if privateKey, err := LoadPrivateKey(k.PrivateKey); err != nil {
+	if k.Type == "ed25519" {
+		return k.signEd25519(data)
+	}
+	digest := sha256.Sum256(data)
+	if signer, err := k.getSigner(); err != nil {
 		return nil, err
-	} else if signature, err := Sign(data, privateKey); err != nil {
+	} else if signature, err := signer.Sign(digest[:]); err != nil {
 		return nil, err
 	} else {
 		return &SignedData{
 			Data:      data,
-			Signature: signature.Serialize(),
+			Signature: signature,
 			PublicKey: k.PublicKey,
 		}, nil
 	}
 }
 
-func (k *Key) Verify(data *SignedData) (bool, error) {
-	if publicKey, err := LoadPublicKey(k.PublicKey); err != nil {
-		return false, err
+// Ed25519 signs the message itself rather than a digest, so external signers
+// (which only see the digest) can't be used with these keys
+func (k *Key) signEd25519(data []byte) (*SignedData, error) {
+	if k.Signer != nil {
+		return nil, fmt.Errorf("external signers are not supported for Ed25519 keys")
+	} else if privateKey, err := ParsePrivateKey(k.PrivateKey); err != nil {
+		return nil, err
+	} else if privateKey, ok := privateKey.(ed25519.PrivateKey); !ok {
+		return nil, fmt.Errorf("invalid private key type")
 	} else {
-		return Verify(data.Data, data.Signature, publicKey)
+		return &SignedData{
+			Data:      data,
+			Signature: ed25519.Sign(privateKey, data),
+			PublicKey: k.PublicKey,
+		}, nil
 	}
 }
 
+func (k *Key) Verify(data *SignedData) (bool, error) {
+	return VerifyWithBytes(data.Data, data.Signature, k.PublicKey)
+}
+
 func (k *Key) VerifyString(data *SignedStringData) (bool, error) {
-	if publicKey, err := LoadPublicKey(k.PublicKey); err != nil {
-		return false, err
-	} else {
-		return Verify([]byte(data.Data), data.Signature, publicKey)
-	}
+	return VerifyWithBytes([]byte(data.Data), data.Signature, k.PublicKey)
 }
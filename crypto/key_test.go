@@ -0,0 +1,88 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package crypto
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncryptAndDecrypt(t *testing.T) {
+
+	sender, err := GenerateWebKey("sender", "ecdh")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recipient, err := GenerateWebKey("recipient", "ecdh")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte("this is a test")
+
+	encryptedData, err := sender.Encrypt(data, recipient)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if decryptedData, err := recipient.Decrypt(encryptedData); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(decryptedData, data) {
+		t.Fatalf("decrypted data does not match")
+	}
+
+}
+
+func TestLoadWebKey(t *testing.T) {
+
+	key, err := GenerateKey()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	webKey, err := AsWebKey(key, "ecdsa")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settingsKey, err := LoadWebKey(webKey, "signing", "ecdsa")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signedData, err := settingsKey.Sign([]byte("this is a test"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := signedData.Verify(&key.PublicKey); err != nil {
+		t.Fatal(err)
+	} else if !ok {
+		t.Fatalf("expected a valid signature")
+	}
+
+}
@@ -0,0 +1,294 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package crypto
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+)
+
+// Merkle trees as specified in RFC 6962 (Certificate Transparency). Leaves
+// and inner nodes are hashed with different prefixes so that a leaf cannot
+// be passed off as an inner node. All functions below operate on the leaf
+// hashes, leaf indexes start at 0.
+
+func MerkleLeafHash(data []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0x00})
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func merkleNodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0x01})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// returns the largest power of two smaller than n (n > 1)
+func merkleSplit(n int64) int64 {
+	var k int64 = 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+// MerkleNodes returns the hash of the complete subtree with 2^level leaves
+// that starts with the leaf index<<level (for level 0 the leaf hashes). Logs
+// can store these hashes when appending leaves, so that roots and proofs need
+// only O(log^2(n)) of them.
+type MerkleNodes func(level uint, index int64) ([]byte, error)
+
+// returns the nodes that are completed by appending the leaf with the given
+// index, i.e. the leaf hash itself (level 0) and its complete ancestors. The
+// node at level l has the index index>>l.
+func MerkleAppend(nodes MerkleNodes, index int64, leafHash []byte) ([][]byte, error) {
+	added := [][]byte{leafHash}
+	hash := leafHash
+	for level := uint(0); index&1 == 1; level++ {
+		left, err := nodes(level, index-1)
+		if err != nil {
+			return nil, err
+		}
+		hash = merkleNodeHash(left, hash)
+		added = append(added, hash)
+		index >>= 1
+	}
+	return added, nil
+}
+
+// returns the nodes of the tree with the given leaf hashes
+func merkleLeafNodes(leaves [][]byte) MerkleNodes {
+	var nodes MerkleNodes
+	nodes = func(level uint, index int64) ([]byte, error) {
+		if level == 0 {
+			return leaves[index], nil
+		}
+		left, _ := nodes(level-1, 2*index)
+		right, _ := nodes(level-1, 2*index+1)
+		return merkleNodeHash(left, right), nil
+	}
+	return nodes
+}
+
+// returns the root hash of the n leaves starting at the given one. As we
+// always split off the largest power of two, complete subtrees are aligned.
+func merkleRangeRoot(nodes MerkleNodes, start, n int64) ([]byte, error) {
+	if n == 0 {
+		return Hash(nil), nil
+	}
+	if n&(n-1) == 0 {
+		var level uint
+		for int64(1)<<level < n {
+			level++
+		}
+		return nodes(level, start>>level)
+	}
+	k := merkleSplit(n)
+	left, err := merkleRangeRoot(nodes, start, k)
+	if err != nil {
+		return nil, err
+	}
+	right, err := merkleRangeRoot(nodes, start+k, n-k)
+	if err != nil {
+		return nil, err
+	}
+	return merkleNodeHash(left, right), nil
+}
+
+// returns the root hash of the tree with the given leaf hashes
+func MerkleRoot(leaves [][]byte) []byte {
+	root, _ := merkleRangeRoot(merkleLeafNodes(leaves), 0, int64(len(leaves)))
+	return root
+}
+
+// returns the root hash of the tree with the given size
+func MerkleRootOf(nodes MerkleNodes, size int64) ([]byte, error) {
+	return merkleRangeRoot(nodes, 0, size)
+}
+
+// returns the audit path that proves that the leaf with the given index is
+// part of the tree
+func MerkleInclusionProof(leaves [][]byte, index int) ([][]byte, error) {
+	return MerkleInclusionProofOf(merkleLeafNodes(leaves), int64(index), int64(len(leaves)))
+}
+
+// returns the audit path for the leaf with the given index in the tree with
+// the given size
+func MerkleInclusionProofOf(nodes MerkleNodes, index, size int64) ([][]byte, error) {
+	if index < 0 || index >= size {
+		return nil, fmt.Errorf("leaf index out of range")
+	}
+	return merklePath(nodes, 0, size, index)
+}
+
+func merklePath(nodes MerkleNodes, start, n, index int64) ([][]byte, error) {
+	if n <= 1 {
+		return [][]byte{}, nil
+	}
+	k := merkleSplit(n)
+	var path [][]byte
+	var sibling []byte
+	var err error
+	if index < k {
+		if path, err = merklePath(nodes, start, k, index); err == nil {
+			sibling, err = merkleRangeRoot(nodes, start+k, n-k)
+		}
+	} else {
+		if path, err = merklePath(nodes, start+k, n-k, index-k); err == nil {
+			sibling, err = merkleRangeRoot(nodes, start, k)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append(path, sibling), nil
+}
+
+// returns the proof that the tree consisting of the first 'size' leaves is a
+// prefix of the tree with the given leaves, i.e. that the log is append-only
+func MerkleConsistencyProof(leaves [][]byte, size int) ([][]byte, error) {
+	return MerkleConsistencyProofOf(merkleLeafNodes(leaves), int64(size), int64(len(leaves)))
+}
+
+// returns the proof that the tree with the first size leaves is a prefix of
+// the tree with the second size
+func MerkleConsistencyProofOf(nodes MerkleNodes, first, second int64) ([][]byte, error) {
+	if first < 0 || first > second {
+		return nil, fmt.Errorf("tree size out of range")
+	}
+	if first == 0 {
+		// the empty tree is consistent with every tree
+		return [][]byte{}, nil
+	}
+	return merkleSubproof(nodes, 0, second, first, true)
+}
+
+func merkleSubproof(nodes MerkleNodes, start, n, size int64, complete bool) ([][]byte, error) {
+	if size == n {
+		if complete {
+			return [][]byte{}, nil
+		}
+		root, err := merkleRangeRoot(nodes, start, n)
+		if err != nil {
+			return nil, err
+		}
+		return [][]byte{root}, nil
+	}
+	k := merkleSplit(n)
+	var proof [][]byte
+	var sibling []byte
+	var err error
+	if size <= k {
+		if proof, err = merkleSubproof(nodes, start, k, size, complete); err == nil {
+			sibling, err = merkleRangeRoot(nodes, start+k, n-k)
+		}
+	} else {
+		if proof, err = merkleSubproof(nodes, start+k, n-k, size-k, false); err == nil {
+			sibling, err = merkleRangeRoot(nodes, start, k)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append(proof, sibling), nil
+}
+
+// verifies an audit path as returned by MerkleInclusionProof
+func VerifyMerkleInclusion(leafHash []byte, index, size int64, proof [][]byte, root []byte) bool {
+
+	if index < 0 || index >= size {
+		return false
+	}
+
+	fn, sn := index, size-1
+	r := leafHash
+
+	for _, p := range proof {
+		if sn == 0 {
+			return false
+		}
+		if fn&1 == 1 || fn == sn {
+			r = merkleNodeHash(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = merkleNodeHash(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+
+	return sn == 0 && bytes.Equal(r, root)
+}
+
+// verifies a consistency proof as returned by MerkleConsistencyProof
+func VerifyMerkleConsistency(first, second int64, firstRoot, secondRoot []byte, proof [][]byte) bool {
+
+	switch {
+	case first < 0 || first > second:
+		return false
+	case first == 0:
+		return len(proof) == 0
+	case first == second:
+		return len(proof) == 0 && bytes.Equal(firstRoot, secondRoot)
+	case len(proof) == 0:
+		return false
+	}
+
+	// if the first tree is complete its root is part of the second tree
+	if first&(first-1) == 0 {
+		proof = append([][]byte{firstRoot}, proof...)
+	}
+
+	fn, sn := first-1, second-1
+
+	for fn&1 == 1 {
+		fn >>= 1
+		sn >>= 1
+	}
+
+	fr, sr := proof[0], proof[0]
+
+	for _, c := range proof[1:] {
+		if sn == 0 {
+			return false
+		}
+		if fn&1 == 1 || fn == sn {
+			fr = merkleNodeHash(c, fr)
+			sr = merkleNodeHash(c, sr)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			sr = merkleNodeHash(sr, c)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+
+	return sn == 0 && bytes.Equal(fr, firstRoot) && bytes.Equal(sr, secondRoot)
+}
@@ -0,0 +1,147 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package crypto
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestMerkleProofs(t *testing.T) {
+
+	leaves := [][]byte{}
+
+	for i := 0; i < 20; i++ {
+		leaves = append(leaves, MerkleLeafHash([]byte(fmt.Sprintf("leaf %d", i))))
+	}
+
+	for n := 1; n <= len(leaves); n++ {
+
+		root := MerkleRoot(leaves[:n])
+
+		for i := 0; i < n; i++ {
+
+			proof, err := MerkleInclusionProof(leaves[:n], i)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !VerifyMerkleInclusion(leaves[i], int64(i), int64(n), proof, root) {
+				t.Fatalf("invalid inclusion proof for leaf %d of %d", i, n)
+			}
+
+			if VerifyMerkleInclusion(leaves[(i+1)%len(leaves)], int64(i), int64(n), proof, root) {
+				t.Fatalf("inclusion proof should not be valid for another leaf")
+			}
+		}
+
+		for m := 0; m <= n; m++ {
+
+			proof, err := MerkleConsistencyProof(leaves[:n], m)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !VerifyMerkleConsistency(int64(m), int64(n), MerkleRoot(leaves[:m]), root, proof) {
+				t.Fatalf("invalid consistency proof for %d and %d", m, n)
+			}
+
+			if m > 0 && m < n && VerifyMerkleConsistency(int64(m), int64(n), MerkleRoot(leaves[1:m+1]), root, proof) {
+				t.Fatalf("consistency proof should not be valid for another tree")
+			}
+		}
+	}
+
+	if _, err := MerkleInclusionProof(leaves, len(leaves)); err == nil {
+		t.Fatalf("expected an error")
+	}
+
+}
+
+func TestMerkleNodes(t *testing.T) {
+
+	stored := map[string][]byte{}
+
+	nodes := func(level uint, index int64) ([]byte, error) {
+		if hash, ok := stored[fmt.Sprintf("%d:%d", level, index)]; ok {
+			return hash, nil
+		}
+		return nil, fmt.Errorf("node %d:%d missing", level, index)
+	}
+
+	leaves := [][]byte{}
+
+	for i := 0; i < 20; i++ {
+
+		leafHash := MerkleLeafHash([]byte(fmt.Sprintf("leaf %d", i)))
+		leaves = append(leaves, leafHash)
+
+		added, err := MerkleAppend(nodes, int64(i), leafHash)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for level, hash := range added {
+			stored[fmt.Sprintf("%d:%d", level, i>>uint(level))] = hash
+		}
+
+		n := int64(i + 1)
+
+		root, err := MerkleRootOf(nodes, n)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(root, MerkleRoot(leaves)) {
+			t.Fatalf("roots do not match for %d leaves", n)
+		}
+
+		for j := int64(0); j < n; j++ {
+
+			proof, err := MerkleInclusionProofOf(nodes, j, n)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !VerifyMerkleInclusion(leaves[j], j, n, proof, root) {
+				t.Fatalf("invalid inclusion proof for leaf %d of %d", j, n)
+			}
+		}
+
+		for m := int64(0); m <= n; m++ {
+
+			proof, err := MerkleConsistencyProofOf(nodes, m, n)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !VerifyMerkleConsistency(m, n, MerkleRoot(leaves[:m]), root, proof) {
+				t.Fatalf("invalid consistency proof for %d and %d", m, n)
+			}
+		}
+	}
+
+}
@@ -0,0 +1,356 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"fmt"
+	"golang.org/x/crypto/curve25519"
+	"strings"
+)
+
+// Ed25519 signatures and X25519 key agreement, which can be used instead of
+// ECDSA and ECDH on P-256. Keys use the same SPKI & PKCS8 encodings (RFC 8410)
+// as P-256 keys, so the algorithm of a key can always be told from the key
+// data itself. This allows mixing algorithms in key chains (e.g. a P-256 root
+// key signing an Ed25519 mediator key) while keys are being migrated.
+
+type X25519PublicKey []byte
+type X25519PrivateKey []byte
+
+var oidX25519 = asn1.ObjectIdentifier{1, 3, 101, 110}
+
+type okpAlgorithm struct {
+	Algorithm asn1.ObjectIdentifier
+}
+
+type okpPublicKey struct {
+	Algorithm okpAlgorithm
+	PublicKey asn1.BitString
+}
+
+type okpPrivateKey struct {
+	Version    int
+	Algorithm  okpAlgorithm
+	PrivateKey []byte
+}
+
+func MarshalX25519PublicKey(publicKey X25519PublicKey) ([]byte, error) {
+	return asn1.Marshal(okpPublicKey{
+		Algorithm: okpAlgorithm{oidX25519},
+		PublicKey: asn1.BitString{Bytes: publicKey, BitLength: 8 * len(publicKey)},
+	})
+}
+
+func MarshalX25519PrivateKey(privateKey X25519PrivateKey) ([]byte, error) {
+	// the private key is an octet string wrapped in another octet string
+	if data, err := asn1.Marshal([]byte(privateKey)); err != nil {
+		return nil, err
+	} else {
+		return asn1.Marshal(okpPrivateKey{
+			Algorithm:  okpAlgorithm{oidX25519},
+			PrivateKey: data,
+		})
+	}
+}
+
+func parseX25519PublicKey(data []byte) (X25519PublicKey, error) {
+	publicKey := okpPublicKey{}
+	if rest, err := asn1.Unmarshal(data, &publicKey); err != nil {
+		return nil, err
+	} else if len(rest) > 0 || !publicKey.Algorithm.Algorithm.Equal(oidX25519) || len(publicKey.PublicKey.Bytes) != curve25519.PointSize {
+		return nil, fmt.Errorf("invalid X25519 public key")
+	}
+	return X25519PublicKey(publicKey.PublicKey.Bytes), nil
+}
+
+func parseX25519PrivateKey(data []byte) (X25519PrivateKey, error) {
+	privateKey := okpPrivateKey{}
+	var scalar []byte
+	if _, err := asn1.Unmarshal(data, &privateKey); err != nil {
+		return nil, err
+	} else if !privateKey.Algorithm.Algorithm.Equal(oidX25519) {
+		return nil, fmt.Errorf("invalid X25519 private key")
+	} else if _, err := asn1.Unmarshal(privateKey.PrivateKey, &scalar); err != nil {
+		return nil, err
+	} else if len(scalar) != curve25519.ScalarSize {
+		return nil, fmt.Errorf("invalid X25519 private key")
+	}
+	return X25519PrivateKey(scalar), nil
+}
+
+// Returns the public key as *ecdsa.PublicKey (P-256), ed25519.PublicKey or
+// X25519PublicKey.
+func ParsePublicKey(data []byte) (interface{}, error) {
+	// newer versions of Go parse X25519 keys as well, so we only accept the
+	// types we know and parse everything else ourselves
+	if publicKey, err := x509.ParsePKIXPublicKey(data); err == nil {
+		switch publicKey := publicKey.(type) {
+		case *ecdsa.PublicKey, ed25519.PublicKey:
+			return publicKey, nil
+		}
+	}
+	if publicKey, err := parseX25519PublicKey(data); err == nil {
+		return publicKey, nil
+	}
+	return nil, fmt.Errorf("cannot parse public key")
+}
+
+// Returns the private key as *ecdsa.PrivateKey (P-256), ed25519.PrivateKey or
+// X25519PrivateKey.
+func ParsePrivateKey(data []byte) (interface{}, error) {
+	if privateKey, err := x509.ParsePKCS8PrivateKey(data); err == nil {
+		switch privateKey := privateKey.(type) {
+		case *ecdsa.PrivateKey, ed25519.PrivateKey:
+			return privateKey, nil
+		}
+	}
+	if privateKey, err := parseX25519PrivateKey(data); err == nil {
+		return privateKey, nil
+	}
+	return nil, fmt.Errorf("cannot parse private key")
+}
+
+func GenerateEd25519Key(name string) (*Key, error) {
+
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return AsEd25519SettingsKey(privateKey, publicKey, name)
+}
+
+func AsEd25519SettingsKey(privateKey ed25519.PrivateKey, publicKey ed25519.PublicKey, name string) (*Key, error) {
+
+	marshalledPublicKey, err := x509.MarshalPKIXPublicKey(publicKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	marshalledPrivateKey, err := x509.MarshalPKCS8PrivateKey(privateKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Key{
+		Type:       "ed25519",
+		PublicKey:  marshalledPublicKey,
+		PrivateKey: marshalledPrivateKey,
+		Purposes:   []string{"sign", "verify"},
+		Params: map[string]interface{}{
+			"curve": "Ed25519",
+		},
+		Name:   name,
+		Format: "spki-pkcs8",
+	}, nil
+}
+
+func GenerateX25519Key(name string) (*Key, error) {
+
+	privateKey, err := RandomBytes(curve25519.ScalarSize)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return AsX25519SettingsKey(privateKey, name)
+}
+
+func AsX25519SettingsKey(privateKey X25519PrivateKey, name string) (*Key, error) {
+
+	publicKey, err := curve25519.X25519(privateKey, curve25519.Basepoint)
+
+	if err != nil {
+		return nil, err
+	}
+
+	marshalledPublicKey, err := MarshalX25519PublicKey(publicKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	marshalledPrivateKey, err := MarshalX25519PrivateKey(privateKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Key{
+		Type:       "x25519",
+		PublicKey:  marshalledPublicKey,
+		PrivateKey: marshalledPrivateKey,
+		Purposes:   []string{"deriveKey"},
+		Params: map[string]interface{}{
+			"curve": "X25519",
+		},
+		Name:   name,
+		Format: "spki-pkcs8",
+	}, nil
+}
+
+func VerifyEd25519(message, signature []byte, publicKey ed25519.PublicKey) (bool, error) {
+	if len(signature) != ed25519.SignatureSize {
+		return false, fmt.Errorf("expected %d bytes for signature, but got %d", ed25519.SignatureSize, len(signature))
+	}
+	return ed25519.Verify(publicKey, message, signature), nil
+}
+
+// Derives a shared key from a private and a public key, which need to use the
+// same algorithm (ECDH on P-256 or X25519). Like DeriveKey, this returns the
+// raw shared secret, which is what the subtle crypto API uses as well.
+func DeriveSharedKey(privateKeyData, publicKeyData []byte) ([]byte, error) {
+
+	privateKey, err := ParsePrivateKey(privateKeyData)
+
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, err := ParsePublicKey(publicKeyData)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch privateKey := privateKey.(type) {
+	case *ecdsa.PrivateKey:
+		if publicKey, ok := publicKey.(*ecdsa.PublicKey); ok {
+			return DeriveKey(publicKey, privateKey), nil
+		}
+	case X25519PrivateKey:
+		if publicKey, ok := publicKey.(X25519PublicKey); ok {
+			// this fails for low-order points
+			return curve25519.X25519(privateKey, publicKey)
+		}
+	}
+
+	return nil, fmt.Errorf("key algorithms do not match")
+}
+
+// returns the key type ('ecdsa', 'ed25519' or 'x25519') of the public key
+// data, P-256 keys can be used for ECDH as well
+func PublicKeyType(publicKeyData []byte) (string, error) {
+	if publicKey, err := ParsePublicKey(publicKeyData); err != nil {
+		return "", err
+	} else {
+		switch publicKey.(type) {
+		case *ecdsa.PublicKey:
+			return "ecdsa", nil
+		case ed25519.PublicKey:
+			return "ed25519", nil
+		default:
+			return "x25519", nil
+		}
+	}
+}
+
+// Converts a settings key with a private key into a web key, using the 'OKP'
+// JWK format (RFC 8037) for Ed25519 & X25519 keys
+func KeyAsWebKey(key *Key) (*WebKey, error) {
+
+	privateKey, err := ParsePrivateKey(key.PrivateKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var curve string
+	var d, x []byte
+	var ops []string
+
+	switch privateKey := privateKey.(type) {
+	case *ecdsa.PrivateKey:
+		return AsWebKey(privateKey, key.Type)
+	case ed25519.PrivateKey:
+		curve, d, x = "Ed25519", privateKey.Seed(), privateKey.Public().(ed25519.PublicKey)
+		ops = []string{"sign", "verify"}
+	case X25519PrivateKey:
+		if x, err = curve25519.X25519(privateKey, curve25519.Basepoint); err != nil {
+			return nil, err
+		}
+		curve, d = "X25519", privateKey
+		ops = []string{"deriveKey"}
+	}
+
+	return &WebKey{
+		PublicKey: base64.StdEncoding.EncodeToString(key.PublicKey),
+		PrivateKey: &JWKPrivateKey{
+			Curve:       curve,
+			D:           base64.RawURLEncoding.EncodeToString(d),
+			Extractable: true,
+			KeyOps:      ops,
+			KeyType:     "OKP",
+			X:           base64.RawURLEncoding.EncodeToString(x),
+		},
+	}, nil
+}
+
+func loadOKPWebKey(jwk *JWKPrivateKey, name string) (*Key, error) {
+
+	d, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(jwk.D, "="))
+
+	if err != nil {
+		return nil, err
+	}
+
+	x, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(jwk.X, "="))
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch jwk.Curve {
+	case "Ed25519":
+		if len(d) != ed25519.SeedSize {
+			return nil, fmt.Errorf("invalid private key")
+		}
+		privateKey := ed25519.NewKeyFromSeed(d)
+		publicKey := privateKey.Public().(ed25519.PublicKey)
+		if !publicKey.Equal(ed25519.PublicKey(x)) {
+			return nil, fmt.Errorf("invalid public key")
+		}
+		return AsEd25519SettingsKey(privateKey, publicKey, name)
+	case "X25519":
+		if len(d) != curve25519.ScalarSize {
+			return nil, fmt.Errorf("invalid private key")
+		}
+		key, err := AsX25519SettingsKey(X25519PrivateKey(d), name)
+		if err != nil {
+			return nil, err
+		}
+		if publicKey, err := curve25519.X25519(d, curve25519.Basepoint); err != nil {
+			return nil, err
+		} else if string(publicKey) != string(x) {
+			return nil, fmt.Errorf("invalid public key")
+		}
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("unsupported curve: %s", jwk.Curve)
+}
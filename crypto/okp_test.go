@@ -0,0 +1,149 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package crypto
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEd25519Keys(t *testing.T) {
+
+	key, err := GenerateWebKey("signing", "ed25519")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signedData, err := key.Sign([]byte("this is a test"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := VerifyWithBytes(signedData.Data, signedData.Signature, key.PublicKey); err != nil {
+		t.Fatal(err)
+	} else if !ok {
+		t.Fatalf("expected a valid signature")
+	}
+
+	if ok, _ := VerifyWithBytes([]byte("another test"), signedData.Signature, key.PublicKey); ok {
+		t.Fatalf("signature should not be valid for other data")
+	}
+
+	webKey, err := KeyAsWebKey(key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loadedKey, err := LoadWebKey(webKey, "signing", ""); err != nil {
+		t.Fatal(err)
+	} else if loadedKey.Type != "ed25519" || !bytes.Equal(loadedKey.PublicKey, key.PublicKey) || !bytes.Equal(loadedKey.PrivateKey, key.PrivateKey) {
+		t.Fatalf("loaded key does not match")
+	}
+
+}
+
+func TestX25519Keys(t *testing.T) {
+
+	sender, err := GenerateWebKey("sender", "x25519")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recipient, err := GenerateWebKey("recipient", "x25519")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte("this is a test")
+
+	encryptedData, err := sender.Encrypt(data, recipient)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if decryptedData, err := recipient.Decrypt(encryptedData); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(decryptedData, data) {
+		t.Fatalf("decrypted data does not match")
+	}
+
+	webKey, err := KeyAsWebKey(recipient)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loadedKey, err := LoadWebKey(webKey, "recipient", ""); err != nil {
+		t.Fatal(err)
+	} else if loadedKey.Type != "x25519" || !bytes.Equal(loadedKey.PublicKey, recipient.PublicKey) {
+		t.Fatalf("loaded key does not match")
+	}
+
+	// keys of different algorithms cannot be combined
+	p256Key, err := GenerateWebKey("recipient", "ecdh")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sender.Encrypt(data, p256Key); err == nil {
+		t.Fatalf("expected an error")
+	}
+
+}
+
+func TestMixedKeyChain(t *testing.T) {
+
+	// a P-256 root key signs an Ed25519 mediator key, which signs a P-256
+	// provider key
+	root, err := GenerateWebKey("root", "ecdsa")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mediator, err := GenerateWebKey("mediator", "ed25519")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider, err := GenerateWebKey("provider", "ecdsa")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, link := range [][]*Key{{root, mediator}, {mediator, provider}} {
+		if signedData, err := link[0].Sign(link[1].PublicKey); err != nil {
+			t.Fatal(err)
+		} else if ok, err := VerifyWithBytes(signedData.Data, signedData.Signature, signedData.PublicKey); err != nil {
+			t.Fatal(err)
+		} else if !ok {
+			t.Fatalf("expected a valid signature by the %s key", link[0].Name)
+		}
+	}
+
+}
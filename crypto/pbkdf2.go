@@ -21,20 +21,25 @@ package crypto
 import (
 	"crypto/sha256"
 	"encoding/base64"
-	"fmt"
 	pbkdf2 "golang.org/x/crypto/pbkdf2"
-	"os"
 )
 
 const rounds = 100_000
 const base64Salt = "tlsfpYaKiH/WZUnWkoeE2g=="
 const envPassName = "KIEBITZ_PASSPHRASE"
 
+// Deprecated: this uses a fixed salt and is only needed to read settings files
+// in the legacy format, please use DeriveArgon2Key with a random salt instead
 func BuildKeyFromEnv() ([]byte, error) {
-	salt, _ := base64.StdEncoding.DecodeString(base64Salt)
-	passphrase := os.Getenv(envPassName)
-	if passphrase == "" {
-		return nil, fmt.Errorf("no passphrase in environment")
+	if passphrase, err := PassphraseFromEnv(); err != nil {
+		return nil, err
+	} else {
+		return BuildKey(passphrase), nil
 	}
-	return pbkdf2.Key([]byte(passphrase), salt, rounds, 32, sha256.New), nil
+}
+
+// Deprecated: see BuildKeyFromEnv
+func BuildKey(passphrase []byte) []byte {
+	salt, _ := base64.StdEncoding.DecodeString(base64Salt)
+	return pbkdf2.Key(passphrase, salt, rounds, 32, sha256.New)
 }
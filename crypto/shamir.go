@@ -0,0 +1,249 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package crypto
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Shamir secret sharing over GF(2^8), which allows us to split e.g. the root
+// key into N shares so that any K of them are needed to reconstruct it. Each
+// byte of the secret is shared using its own random polynomial of degree K-1.
+// A share consists of the polynomial values for every byte of the secret,
+// followed by the x coordinate at which they were evaluated (1...255).
+
+// multiplication in GF(2^8), using the AES polynomial x^8 + x^4 + x^3 + x + 1
+func gfMul(a, b byte) byte {
+	var p byte
+	for b > 0 {
+		if b&1 == 1 {
+			p ^= a
+		}
+		carry := a & 0x80
+		a <<= 1
+		if carry != 0 {
+			a ^= 0x1b
+		}
+		b >>= 1
+	}
+	return p
+}
+
+// the multiplicative inverse is a^254, as a^255 = 1 for all a != 0
+func gfInv(a byte) byte {
+	r := byte(1)
+	for i := 0; i < 254; i++ {
+		r = gfMul(r, a)
+	}
+	return r
+}
+
+func gfDiv(a, b byte) byte {
+	return gfMul(a, gfInv(b))
+}
+
+// evaluates the polynomial with the given coefficients at x
+func gfEval(coefficients []byte, x byte) byte {
+	var r byte
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		r = gfMul(r, x) ^ coefficients[i]
+	}
+	return r
+}
+
+// Splits the secret into the given number of shares, of which threshold
+// many are needed to reconstruct the secret.
+func SplitSecret(secret []byte, shares, threshold int) ([][]byte, error) {
+
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("secret is empty")
+	}
+
+	if threshold < 2 || shares < threshold || shares > 255 {
+		return nil, fmt.Errorf("invalid number of shares or threshold (need 2 <= threshold <= shares <= 255)")
+	}
+
+	result := make([][]byte, shares)
+
+	for i := range result {
+		result[i] = make([]byte, len(secret)+1)
+		result[i][len(secret)] = byte(i + 1)
+	}
+
+	coefficients := make([]byte, threshold)
+
+	for j, value := range secret {
+
+		// the constant term is the secret, all other coefficients are random
+		if randomCoefficients, err := RandomBytes(threshold - 1); err != nil {
+			return nil, err
+		} else {
+			coefficients[0] = value
+			copy(coefficients[1:], randomCoefficients)
+		}
+
+		for i := range result {
+			result[i][j] = gfEval(coefficients, byte(i+1))
+		}
+	}
+
+	// we overwrite the coefficients, as they contain parts of the secret
+	for i := range coefficients {
+		coefficients[i] = 0
+	}
+
+	return result, nil
+}
+
+// Reconstructs the secret from the given shares via Lagrange interpolation at
+// x = 0. Note that we can't detect whether enough shares were given, so an
+// insufficient number of shares will simply produce a wrong secret.
+func CombineShares(shares [][]byte) ([]byte, error) {
+
+	if len(shares) < 2 {
+		return nil, fmt.Errorf("at least two shares are required")
+	}
+
+	n := len(shares[0]) - 1
+
+	if n < 1 {
+		return nil, fmt.Errorf("invalid share")
+	}
+
+	xs := make([]byte, len(shares))
+
+	for i, share := range shares {
+		if len(share) != n+1 {
+			return nil, fmt.Errorf("shares have different lengths")
+		}
+		xs[i] = share[n]
+		if xs[i] == 0 {
+			return nil, fmt.Errorf("invalid share")
+		}
+		for j := 0; j < i; j++ {
+			if xs[j] == xs[i] {
+				return nil, fmt.Errorf("duplicate share")
+			}
+		}
+	}
+
+	secret := make([]byte, n)
+
+	for i := range shares {
+
+		// the Lagrange basis polynomial for share i, evaluated at 0
+		basis := byte(1)
+		for j := range shares {
+			if i == j {
+				continue
+			}
+			// in GF(2^8), subtraction is the same as addition (XOR)
+			basis = gfMul(basis, gfDiv(xs[j], xs[j]^xs[i]))
+		}
+
+		for k := 0; k < n; k++ {
+			secret[k] ^= gfMul(shares[i][k], basis)
+		}
+	}
+
+	return secret, nil
+}
+
+// A share of the private part of a key, which also contains the public key
+// data (so that we can check the reconstructed key).
+type KeyShare struct {
+	Key       *Key   `json:"key"`
+	Threshold int    `json:"threshold"`
+	Shares    int    `json:"shares"`
+	Share     []byte `json:"share"`
+}
+
+// Splits the private key of the given key into shares.
+func SplitKey(key *Key, shares, threshold int) ([]*KeyShare, error) {
+
+	if key.PrivateKey == nil {
+		return nil, fmt.Errorf("private key missing")
+	}
+
+	secretShares, err := SplitSecret(key.PrivateKey, shares, threshold)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// the shares only contain the public key
+	publicKey := *key
+	publicKey.PrivateKey = nil
+	publicKey.Signer = nil
+
+	keyShares := make([]*KeyShare, len(secretShares))
+
+	for i, share := range secretShares {
+		keyShares[i] = &KeyShare{
+			Key:       &publicKey,
+			Threshold: threshold,
+			Shares:    shares,
+			Share:     share,
+		}
+	}
+
+	return keyShares, nil
+}
+
+// Reconstructs a key from the given shares and checks that the private key
+// matches the public key, so we don't sign with a wrong key.
+func CombineKeyShares(keyShares []*KeyShare) (*Key, error) {
+
+	if len(keyShares) == 0 {
+		return nil, fmt.Errorf("no shares given")
+	}
+
+	first := keyShares[0]
+
+	if len(keyShares) < first.Threshold {
+		return nil, fmt.Errorf("need at least %d shares, got %d", first.Threshold, len(keyShares))
+	}
+
+	shares := make([][]byte, len(keyShares))
+
+	for i, keyShare := range keyShares {
+		if keyShare.Key == nil || !bytes.Equal(keyShare.Key.PublicKey, first.Key.PublicKey) {
+			return nil, fmt.Errorf("shares belong to different keys")
+		}
+		shares[i] = keyShare.Share
+	}
+
+	privateKey, err := CombineShares(shares)
+
+	if err != nil {
+		return nil, err
+	}
+
+	key := *first.Key
+	key.PrivateKey = privateKey
+
+	if signedData, err := key.Sign([]byte("kiebitz key share check")); err != nil {
+		return nil, fmt.Errorf("cannot reconstruct key (wrong shares?): %w", err)
+	} else if ok, err := VerifyWithBytes(signedData.Data, signedData.Signature, key.PublicKey); err != nil || !ok {
+		return nil, fmt.Errorf("reconstructed key does not match the public key (wrong shares?)")
+	}
+
+	return &key, nil
+}
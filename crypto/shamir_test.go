@@ -0,0 +1,116 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package crypto
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestShamirSecretSharing(t *testing.T) {
+
+	secret := []byte("this is a very secret test")
+
+	shares, err := SplitSecret(secret, 5, 3)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// any three shares reconstruct the secret
+	for _, indexes := range [][]int{{0, 1, 2}, {4, 2, 0}, {1, 3, 4}, {0, 1, 2, 3, 4}} {
+		selected := [][]byte{}
+		for _, i := range indexes {
+			selected = append(selected, shares[i])
+		}
+		if combined, err := CombineShares(selected); err != nil {
+			t.Fatal(err)
+		} else if !bytes.Equal(combined, secret) {
+			t.Fatalf("reconstructed secret does not match for shares %v", indexes)
+		}
+	}
+
+	// two shares are not enough
+	if combined, err := CombineShares(shares[:2]); err != nil {
+		t.Fatal(err)
+	} else if bytes.Equal(combined, secret) {
+		t.Fatalf("two shares should not reconstruct the secret")
+	}
+
+	if _, err := CombineShares([][]byte{shares[0], shares[0]}); err == nil {
+		t.Fatalf("expected an error for duplicate shares")
+	}
+
+	if _, err := SplitSecret(secret, 2, 3); err == nil {
+		t.Fatalf("expected an error for an invalid threshold")
+	}
+
+}
+
+func TestKeyShares(t *testing.T) {
+
+	for _, keyType := range []string{"ecdsa", "ed25519"} {
+
+		key, err := GenerateWebKey("root", keyType)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		keyShares, err := SplitKey(key, 3, 2)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, keyShare := range keyShares {
+			if keyShare.Key.PrivateKey != nil {
+				t.Fatalf("shares should not contain the private key")
+			}
+		}
+
+		if combinedKey, err := CombineKeyShares(keyShares[1:]); err != nil {
+			t.Fatal(err)
+		} else if !bytes.Equal(combinedKey.PrivateKey, key.PrivateKey) {
+			t.Fatalf("reconstructed %s key does not match", keyType)
+		}
+
+		if _, err := CombineKeyShares(keyShares[:1]); err == nil {
+			t.Fatalf("expected an error for too few shares")
+		}
+
+		// shares of another key can't be mixed in
+		otherKey, err := GenerateWebKey("root", keyType)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		otherShares, err := SplitKey(otherKey, 3, 2)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := CombineKeyShares([]*KeyShare{keyShares[0], otherShares[1]}); err == nil {
+			t.Fatalf("expected an error for shares of different keys")
+		}
+	}
+
+}
@@ -0,0 +1,132 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+// A signer creates ECDSA signatures for a key, so that the private key does
+// not need to be part of the settings (or even be present in memory). Signers
+// sign SHA-256 digests and return signatures in the format produced by
+// ECDSASignature.Serialize.
+type Signer interface {
+	Sign(digest []byte) ([]byte, error)
+}
+
+// describes which signer to use for a key. If a key has no signer settings
+// its private key is used directly.
+type SignerSettings struct {
+	Type     string                 `json:"type"`
+	Settings map[string]interface{} `json:"settings"`
+}
+
+type SignerMaker func(key *Key, settings map[string]interface{}) (Signer, error)
+
+var signersMutex sync.Mutex
+var signers = map[string]SignerMaker{
+	"file":  MakeFileSigner,
+	"agent": MakeAgentSigner,
+}
+
+// makes a signer type available (e.g. from files with specific build tags)
+func RegisterSigner(signerType string, maker SignerMaker) {
+	signersMutex.Lock()
+	defer signersMutex.Unlock()
+	signers[signerType] = maker
+}
+
+func MakeSigner(key *Key) (Signer, error) {
+
+	if key.Signer == nil {
+		return MakeFileSigner(key, nil)
+	}
+
+	signersMutex.Lock()
+	maker, ok := signers[key.Signer.Type]
+	signersMutex.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unsupported signer type: %s", key.Signer.Type)
+	}
+
+	return maker(key, key.Signer.Settings)
+}
+
+// decodes signer settings into the given struct
+func loadSignerSettings(settings map[string]interface{}, target interface{}) error {
+	if data, err := json.Marshal(settings); err != nil {
+		return err
+	} else {
+		return json.Unmarshal(data, target)
+	}
+}
+
+// Signs with a private key that is either part of the key itself or stored
+// in a separate file (as base64-encoded PKCS8 data), e.g. a mounted secret.
+type FileSigner struct {
+	privateKey *ecdsa.PrivateKey
+}
+
+type FileSignerSettings struct {
+	Path string `json:"path"`
+}
+
+func MakeFileSigner(key *Key, settings map[string]interface{}) (Signer, error) {
+
+	fileSettings := &FileSignerSettings{}
+
+	if err := loadSignerSettings(settings, fileSettings); err != nil {
+		return nil, err
+	}
+
+	privateKeyData := key.PrivateKey
+
+	if fileSettings.Path == "" {
+		if privateKeyData == nil {
+			return nil, fmt.Errorf("private key missing")
+		}
+	} else if data, err := ioutil.ReadFile(fileSettings.Path); err != nil {
+		return nil, err
+	} else if privateKeyData, err = base64.StdEncoding.DecodeString(strings.TrimSpace(string(data))); err != nil {
+		return nil, err
+	}
+
+	privateKey, err := LoadPrivateKey(privateKeyData)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileSigner{privateKey: privateKey}, nil
+}
+
+func (f *FileSigner) Sign(digest []byte) ([]byte, error) {
+	if signature, err := SignDigest(digest, f.privateKey); err != nil {
+		return nil, err
+	} else {
+		return signature.Serialize(), nil
+	}
+}
@@ -0,0 +1,196 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+//go:build pkcs11
+// +build pkcs11
+
+package crypto
+
+import (
+	"fmt"
+	"github.com/miekg/pkcs11"
+	"os"
+	"sync"
+)
+
+// Signs with a private key stored on a PKCS#11 token (e.g. an HSM or
+// SoftHSM), which never leaves the token. As this requires cgo, the signer
+// is only available if the services are built with the 'pkcs11' tag.
+
+func init() {
+	RegisterSigner("pkcs11", MakePKCS11Signer)
+}
+
+type PKCS11SignerSettings struct {
+	Library    string `json:"library"`
+	TokenLabel string `json:"token_label"`
+	PIN        string `json:"pin"`
+	// name of an environment variable that contains the PIN (optional)
+	PINEnv string `json:"pin_env"`
+	// label of the private key on the token (defaults to the name of the key)
+	KeyLabel string `json:"key_label"`
+}
+
+type PKCS11Signer struct {
+	ctx      *pkcs11.Ctx
+	slot     uint
+	pin      string
+	keyLabel string
+}
+
+// modules can only be initialized once per process, so we share them
+var pkcs11Mutex sync.Mutex
+var pkcs11Modules = map[string]*pkcs11.Ctx{}
+
+func loadPKCS11Module(library string) (*pkcs11.Ctx, error) {
+
+	pkcs11Mutex.Lock()
+	defer pkcs11Mutex.Unlock()
+
+	if ctx, ok := pkcs11Modules[library]; ok {
+		return ctx, nil
+	}
+
+	ctx := pkcs11.New(library)
+
+	if ctx == nil {
+		return nil, fmt.Errorf("cannot load PKCS#11 library %s", library)
+	}
+
+	if err := ctx.Initialize(); err != nil {
+		ctx.Destroy()
+		return nil, err
+	}
+
+	pkcs11Modules[library] = ctx
+
+	return ctx, nil
+}
+
+func findPKCS11Slot(ctx *pkcs11.Ctx, tokenLabel string) (uint, error) {
+
+	slots, err := ctx.GetSlotList(true)
+
+	if err != nil {
+		return 0, err
+	}
+
+	for _, slot := range slots {
+		if tokenInfo, err := ctx.GetTokenInfo(slot); err != nil {
+			return 0, err
+		} else if tokenInfo.Label == tokenLabel {
+			return slot, nil
+		}
+	}
+
+	return 0, fmt.Errorf("PKCS#11 token %s not found", tokenLabel)
+}
+
+func MakePKCS11Signer(key *Key, settings map[string]interface{}) (Signer, error) {
+
+	pkcs11Settings := &PKCS11SignerSettings{}
+
+	if err := loadSignerSettings(settings, pkcs11Settings); err != nil {
+		return nil, err
+	}
+
+	if pkcs11Settings.Library == "" {
+		return nil, fmt.Errorf("PKCS#11 library missing")
+	}
+
+	if pkcs11Settings.PINEnv != "" {
+		pkcs11Settings.PIN = os.Getenv(pkcs11Settings.PINEnv)
+	}
+
+	if pkcs11Settings.KeyLabel == "" {
+		pkcs11Settings.KeyLabel = key.Name
+	}
+
+	ctx, err := loadPKCS11Module(pkcs11Settings.Library)
+
+	if err != nil {
+		return nil, err
+	}
+
+	slot, err := findPKCS11Slot(ctx, pkcs11Settings.TokenLabel)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &PKCS11Signer{
+		ctx:      ctx,
+		slot:     slot,
+		pin:      pkcs11Settings.PIN,
+		keyLabel: pkcs11Settings.KeyLabel,
+	}, nil
+}
+
+func (p *PKCS11Signer) Sign(digest []byte) ([]byte, error) {
+
+	session, err := p.ctx.OpenSession(p.slot, pkcs11.CKF_SERIAL_SESSION)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer p.ctx.CloseSession(session)
+
+	// the login state is shared by all sessions of the application
+	if err := p.ctx.Login(session, pkcs11.CKU_USER, p.pin); err != nil && err != pkcs11.Error(pkcs11.CKR_USER_ALREADY_LOGGED_IN) {
+		return nil, err
+	}
+
+	if err := p.ctx.FindObjectsInit(session, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PRIVATE_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, p.keyLabel),
+	}); err != nil {
+		return nil, err
+	}
+
+	objects, _, err := p.ctx.FindObjects(session, 1)
+
+	if finalErr := p.ctx.FindObjectsFinal(session); err == nil {
+		err = finalErr
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(objects) == 0 {
+		return nil, fmt.Errorf("PKCS#11 key %s not found", p.keyLabel)
+	}
+
+	if err := p.ctx.SignInit(session, []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil)}, objects[0]); err != nil {
+		return nil, err
+	}
+
+	// the token returns the concatenated R & S values, as we do
+	signature, err := p.ctx.Sign(session, digest)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(signature) != 64 {
+		return nil, fmt.Errorf("unexpected signature length: %d", len(signature))
+	}
+
+	return signature, nil
+}
@@ -0,0 +1,190 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+//go:build pkcs11
+// +build pkcs11
+
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"github.com/miekg/pkcs11"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Runs against SoftHSM, e.g. via
+// SOFTHSM2_LIBRARY=/usr/lib/softhsm/libsofthsm2.so go test -tags pkcs11 ./crypto
+func TestPKCS11Signer(t *testing.T) {
+
+	library := os.Getenv("SOFTHSM2_LIBRARY")
+
+	if library == "" {
+		t.Skip("SOFTHSM2_LIBRARY not set")
+	}
+
+	dir, err := ioutil.TempDir("", "softhsm")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	config := filepath.Join(dir, "softhsm2.conf")
+
+	if err := ioutil.WriteFile(config, []byte(fmt.Sprintf("directories.tokendir = %s\nobjectstore.backend = file\n", dir)), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("SOFTHSM2_CONF", config)
+
+	ctx, err := loadPKCS11Module(library)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slots, err := ctx.GetSlotList(false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ctx.InitToken(slots[0], "1234", "kiebitz"); err != nil {
+		t.Fatal(err)
+	}
+
+	slot, err := findPKCS11Slot(ctx, "kiebitz")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ctx.Login(session, pkcs11.CKU_SO, "1234"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ctx.InitPIN(session, "5678"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ctx.Logout(session); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ctx.Login(session, pkcs11.CKU_USER, "5678"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the DER-encoded OID of the P-256 curve
+	curve, err := asn1.Marshal(asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publicKeyHandle, _, err := ctx.GenerateKeyPair(session,
+		[]*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_EC_KEY_PAIR_GEN, nil)},
+		[]*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+			pkcs11.NewAttribute(pkcs11.CKA_VERIFY, true),
+			pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, curve),
+			pkcs11.NewAttribute(pkcs11.CKA_LABEL, "token"),
+		},
+		[]*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+			pkcs11.NewAttribute(pkcs11.CKA_SIGN, true),
+			pkcs11.NewAttribute(pkcs11.CKA_SENSITIVE, true),
+			pkcs11.NewAttribute(pkcs11.CKA_EXTRACTABLE, false),
+			pkcs11.NewAttribute(pkcs11.CKA_LABEL, "token"),
+		})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attributes, err := ctx.GetAttributeValue(session, publicKeyHandle, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_EC_POINT, nil),
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx.CloseSession(session)
+
+	// the point is encoded as a DER octet string
+	var point []byte
+
+	if _, err := asn1.Unmarshal(attributes[0].Value, &point); err != nil {
+		t.Fatal(err)
+	}
+
+	x, y := elliptic.Unmarshal(elliptic.P256(), point)
+
+	if x == nil {
+		t.Fatalf("invalid public key")
+	}
+
+	publicKey, err := x509.MarshalPKIXPublicKey(&ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := &Key{
+		Name:      "token",
+		Type:      "ecdsa",
+		Format:    "spki-pkcs8",
+		PublicKey: publicKey,
+		Signer: &SignerSettings{
+			Type: "pkcs11",
+			Settings: map[string]interface{}{
+				"library":     library,
+				"token_label": "kiebitz",
+				"pin":         "5678",
+			},
+		},
+	}
+
+	signedData, err := key.Sign([]byte("this is a test"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := key.Verify(signedData); err != nil {
+		t.Fatal(err)
+	} else if !ok {
+		t.Fatalf("invalid signature")
+	}
+
+}
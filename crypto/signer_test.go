@@ -0,0 +1,168 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package crypto
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileSigner(t *testing.T) {
+
+	key, err := GenerateWebKey("test", "ecdsa")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "signer")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "test.key")
+
+	if err := ioutil.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(key.PrivateKey)), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// the private key is only stored in the file
+	fileKey := *key
+	fileKey.PrivateKey = nil
+	fileKey.Signer = &SignerSettings{
+		Type: "file",
+		Settings: map[string]interface{}{
+			"path": path,
+		},
+	}
+
+	signedData, err := fileKey.Sign([]byte("this is a test"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := key.Verify(signedData); err != nil {
+		t.Fatal(err)
+	} else if !ok {
+		t.Fatalf("invalid signature")
+	}
+
+	// the signer is only made once, so the file is not read again
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := fileKey.Sign([]byte("this is another test")); err != nil {
+		t.Fatal(err)
+	}
+
+	fileKey.Signer = nil
+
+	if _, err := fileKey.Sign([]byte("this is a test")); err == nil {
+		t.Fatalf("expected an error without a private key")
+	}
+
+}
+
+func TestAgentSigner(t *testing.T) {
+
+	key, err := GenerateWebKey("token", "ecdsa")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherKey, err := GenerateWebKey("other", "ecdsa")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	agent, err := MakeSigningAgent([]*Key{key, otherKey})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "agent")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "agent.sock")
+
+	listener, err := net.Listen("unix", socket)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+
+	go agent.Serve(listener)
+
+	agentSettings := func(settings map[string]interface{}) *SignerSettings {
+		settings["socket"] = socket
+		return &SignerSettings{
+			Type:     "agent",
+			Settings: settings,
+		}
+	}
+
+	agentKey := *key
+	agentKey.PrivateKey = nil
+	agentKey.Signer = agentSettings(map[string]interface{}{})
+
+	signedData, err := agentKey.Sign([]byte("this is a test"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := key.Verify(signedData); err != nil {
+		t.Fatal(err)
+	} else if !ok {
+		t.Fatalf("invalid signature")
+	}
+
+	// signatures with another key than the expected one are rejected
+	agentKey.Signer = agentSettings(map[string]interface{}{"key": "other"})
+
+	if _, err := agentKey.Sign([]byte("this is a test")); err == nil {
+		t.Fatalf("expected an error for a signature with another key")
+	}
+
+	agentKey.Signer = agentSettings(map[string]interface{}{"key": "unknown"})
+
+	if _, err := agentKey.Sign([]byte("this is a test")); err == nil {
+		t.Fatalf("expected an error for an unknown key")
+	}
+
+}
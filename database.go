@@ -52,7 +52,12 @@ type Database interface {
 	Close() error
 	Open() error
 	Reset() error
+	// resets all tables except the given ones (e.g. append-only logs)
+	ResetExcept(tables ...string) error
 	Lock(lockKey string) (Lock, error)
+	// obtains a lock that expires after ttl, retrying for up to wait if it
+	// is held already
+	LockFor(lockKey string, ttl, wait time.Duration) (Lock, error)
 
 	DatabaseOps
 }
@@ -105,6 +110,9 @@ type Integer interface {
 	Object
 	Set(value int64, ttl time.Duration) error
 	IncrBy(int64) (int64, error)
+	// atomically increments the value and sets the given TTL if the value
+	// doesn't expire yet (e.g. because it was just created)
+	IncrByWithTTL(value int64, ttl time.Duration) (int64, error)
 	Get() (int64, error)
 	Del() error
 }
@@ -112,6 +120,9 @@ type Integer interface {
 type Value interface {
 	Object
 	Set(value []byte, ttl time.Duration) error
+	// atomically sets the value (with the given TTL) unless it exists already,
+	// returns whether the value was set
+	SetIfNotExists(value []byte, ttl time.Duration) (bool, error)
 	Get() ([]byte, error)
 	Del() error
 }
@@ -68,6 +68,10 @@ func (d *InMemory) Reset() error {
 	return nil
 }
 
+func (d *InMemory) ResetExcept(tables ...string) error {
+	return nil
+}
+
 func (d *InMemory) Close() error {
 	return nil
 }
@@ -80,6 +84,16 @@ func (d *InMemory) Lock(lockKey string) (services.Lock, error) {
 	return nil, nil
 }
 
+func (d *InMemory) LockFor(lockKey string, ttl, wait time.Duration) (services.Lock, error) {
+	return &InMemoryLock{}, nil
+}
+
+type InMemoryLock struct{}
+
+func (l *InMemoryLock) Release() error {
+	return nil
+}
+
 func (d *InMemory) Expire(table string, key []byte, ttl time.Duration) error {
 	return nil
 }
@@ -29,6 +29,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"hash/fnv"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -61,8 +62,22 @@ func MakeRedisLock(ctx context.Context, lockKey string, client redis.UniversalCl
 }
 
 func (r *RedisLock) Lock() error {
+	return r.LockFor(100*time.Millisecond, 0)
+}
+
+// LockFor obtains a lock that expires after ttl, retrying every 10 ms for up
+// to wait if it is held already. Only the holder can release it.
+func (r *RedisLock) LockFor(ttl, wait time.Duration) error {
 
-	lock, err := r.dLockClient.Obtain(r.ctx, r.lockKey, 100*time.Millisecond, nil)
+	var opts *redislock.Options
+
+	if retries := int(wait / (10 * time.Millisecond)); retries > 0 {
+		opts = &redislock.Options{
+			RetryStrategy: redislock.LimitRetry(redislock.LinearBackoff(10*time.Millisecond), retries),
+		}
+	}
+
+	lock, err := r.dLockClient.Obtain(r.ctx, r.lockKey, ttl, opts)
 
 	if err != nil {
 		return err
@@ -356,6 +371,38 @@ func (d *Redis) Reset() error {
 	return nil
 }
 
+func (d *Redis) ResetExcept(tables ...string) error {
+	for _, c := range d.clients {
+		var cursor uint64
+		for {
+			keys, nextCursor, err := c.Scan(d.Ctx, cursor, "*", 1000).Result()
+			if err != nil {
+				return err
+			}
+			toDelete := make([]string, 0, len(keys))
+		keys:
+			for _, key := range keys {
+				for _, table := range tables {
+					if strings.HasPrefix(key, table+"::") {
+						continue keys
+					}
+				}
+				toDelete = append(toDelete, key)
+			}
+			if len(toDelete) > 0 {
+				if err := c.Del(d.Ctx, toDelete...).Err(); err != nil {
+					return err
+				}
+			}
+			if nextCursor == 0 {
+				break
+			}
+			cursor = nextCursor
+		}
+	}
+	return nil
+}
+
 func (d *Redis) Lock(lockKey string) (services.Lock, error) {
 	c := d.Client(lockKey)
 	redisLock := MakeRedisLock(d.Ctx, lockKey, c)
@@ -368,6 +415,17 @@ func (d *Redis) Lock(lockKey string) (services.Lock, error) {
 
 }
 
+func (d *Redis) LockFor(lockKey string, ttl, wait time.Duration) (services.Lock, error) {
+	c := d.Client(lockKey)
+	redisLock := MakeRedisLock(d.Ctx, lockKey, c)
+
+	if err := redisLock.LockFor(ttl, wait); err != nil {
+		return nil, err
+	}
+
+	return redisLock, nil
+}
+
 func (d *Redis) getShardForKey(key string) uint32 {
 	f := fnv.New32()
 	f.Write([]byte(key))
@@ -554,6 +612,19 @@ func (r *RedisInteger) IncrBy(value int64) (int64, error) {
 	}
 }
 
+// increments the key and sets its TTL unless it has one already, in one step
+var incrByWithTTLScript = redis.NewScript(`
+local n = redis.call("INCRBY", KEYS[1], ARGV[1])
+if redis.call("PTTL", KEYS[1]) < 0 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return n
+`)
+
+func (r *RedisInteger) IncrByWithTTL(value int64, ttl time.Duration) (int64, error) {
+	return incrByWithTTLScript.Run(r.db.Ctx, r.db.Client(r.fullKey), []string{r.fullKey}, value, ttl.Milliseconds()).Int64()
+}
+
 func (r *RedisInteger) Get() (int64, error) {
 	result, err := r.db.Client(r.fullKey).Get(r.db.Ctx, string(r.fullKey)).Result()
 	if err != nil {
@@ -582,6 +653,10 @@ func (r *RedisValue) Set(data []byte, ttl time.Duration) error {
 	return r.db.Client(r.fullKey).Set(r.db.Ctx, string(r.fullKey), string(data), ttl).Err()
 }
 
+func (r *RedisValue) SetIfNotExists(data []byte, ttl time.Duration) (bool, error) {
+	return r.db.Client(r.fullKey).SetNX(r.db.Ctx, string(r.fullKey), string(data), ttl).Result()
+}
+
 func (r *RedisValue) Get() ([]byte, error) {
 	result, err := r.db.Client(r.fullKey).Get(r.db.Ctx, string(r.fullKey)).Result()
 	if err != nil {
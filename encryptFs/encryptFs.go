@@ -23,6 +23,8 @@
 package encryptFs
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"github.com/kiebitz-oss/services/crypto"
@@ -30,22 +32,24 @@ import (
 	"io/fs"
 )
 
+// Files are decrypted transparently if they are in the current format (see
+// format.go) or in the legacy format (a JSON-encoded crypto.EncryptedData
+// structure with a PBKDF2 key), all other files are returned as they are.
 type EncryptedFS struct {
-	envfs fs.FS
-	key   []byte
+	envfs      fs.FS
+	passphrase []byte
 }
 
 type EncryptedFile struct {
-	file   fs.File
-	key    []byte
-	buffer []byte
-	isEOF  bool
+	file       fs.File
+	passphrase []byte
+	reader     io.Reader
 }
 
-func New(fs fs.FS, key []byte) fs.FS {
+func New(fs fs.FS, passphrase []byte) fs.FS {
 	return &EncryptedFS{
-		envfs: fs,
-		key:   key,
+		envfs:      fs,
+		passphrase: passphrase,
 	}
 }
 
@@ -54,10 +58,8 @@ func (e *EncryptedFS) Open(name string) (fs.File, error) {
 		return nil, err
 	} else {
 		return &EncryptedFile{
-			file:   file,
-			key:    e.key,
-			buffer: []byte{},
-			isEOF:  false,
+			file:       file,
+			passphrase: e.passphrase,
 		}, nil
 	}
 }
@@ -74,45 +76,62 @@ func (e *EncryptedFile) Stat() (fs.FileInfo, error) {
 	return e.file.Stat()
 }
 
-// this is not efficient and should only be used for relatively small files
 func (e *EncryptedFile) Read(p []byte) (int, error) {
-	if len(e.buffer) == 0 && !e.isEOF {
-
-		var data []byte
-		var buffer = make([]byte, 32)
-
-		for {
-			size, err := e.file.Read(buffer)
-			if err == io.EOF {
-				break
-			} else if err != nil {
-				return 0, err
-			}
-			data = append(data, buffer[:size]...)
-		}
-
-		var encData crypto.EncryptedData
-		if err := json.Unmarshal(data, &encData); err != nil || encData.IV == nil || encData.Data == nil {
-			e.buffer = data
+	if e.reader == nil {
+		if reader, err := OpenReader(e.file, e.passphrase); err != nil {
+			return 0, err
 		} else {
-			decData, err := crypto.Decrypt(&encData, e.key)
-			if err != nil {
-				return 0, fmt.Errorf("decrypt failed")
-			}
-			e.buffer = decData
+			e.reader = reader
 		}
+	}
+	return e.reader.Read(p)
+}
+
+// Returns a reader that decrypts the data of the given reader, depending on
+// its format. Files in the current format are decrypted chunk by chunk.
+func OpenReader(r io.Reader, passphrase []byte) (io.Reader, error) {
+
+	reader := bufio.NewReader(r)
+
+	if prefix, err := reader.Peek(len(Magic)); err != nil && err != io.EOF {
+		return nil, err
+	} else if IsEncrypted(prefix) {
+		return NewReader(reader, passphrase)
+	}
+
+	// legacy files are small, so we can simply read them at once
+	data, err := io.ReadAll(reader)
 
+	if err != nil {
+		return nil, err
 	}
-	if e.isEOF {
-		return 0, io.EOF
+
+	if decryptedData, err := DecryptLegacy(data, passphrase); err != nil {
+		return nil, err
+	} else if decryptedData != nil {
+		data = decryptedData
 	}
 
-	size := copy(p, e.buffer)
-	e.buffer = e.buffer[size:]
-	if len(e.buffer) == 0 {
-		e.isEOF = true
+	return bytes.NewReader(data), nil
+}
+
+// Decrypts data in the legacy format, returns nil if the data isn't in that
+// format (e.g. because it isn't encrypted at all)
+func DecryptLegacy(data, passphrase []byte) ([]byte, error) {
+
+	var encData crypto.EncryptedData
+
+	if err := json.Unmarshal(data, &encData); err != nil || encData.IV == nil || encData.Data == nil {
+		return nil, nil
 	}
 
-	return size, nil
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("passphrase missing")
+	}
 
+	if decData, err := crypto.Decrypt(&encData, crypto.BuildKey(passphrase)); err != nil {
+		return nil, fmt.Errorf("decrypt failed")
+	} else {
+		return decData, nil
+	}
 }
@@ -0,0 +1,364 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package encryptFs
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+	"github.com/kiebitz-oss/services/crypto"
+	"io"
+)
+
+// Version 2 of the encrypted file format. Files start with a fixed-size
+// header, followed by the data, which is encrypted in chunks with AES-GCM
+// (using the STREAM construction):
+//
+//   magic (6) | version (1) | Argon2id time (4), memory (4) & threads (1) |
+//   salt (16) | chunk size (4) | nonce prefix (7) | chunk | chunk | ...
+//
+// The nonce of each chunk consists of the nonce prefix, the chunk counter (4)
+// and a flag (1) that marks the final chunk, so chunks can't be reordered and
+// files can't be truncated without this being noticed. The header is used as
+// additional data for all chunks, which authenticates the parameters as well.
+
+var Magic = [6]byte{'K', 'B', 'Z', 'E', 'N', 'C'}
+
+const Version = 2
+
+const DefaultChunkSize = 64 * 1024
+const maxChunkSize = 16 * 1024 * 1024
+
+type Params struct {
+	crypto.Argon2Params
+	ChunkSize uint32
+}
+
+var DefaultParams = Params{
+	Argon2Params: crypto.DefaultArgon2Params,
+	ChunkSize:    DefaultChunkSize,
+}
+
+type header struct {
+	Magic       [6]byte
+	Version     uint8
+	Time        uint32
+	Memory      uint32
+	Threads     uint8
+	Salt        [16]byte
+	ChunkSize   uint32
+	NoncePrefix [7]byte
+}
+
+func (h *header) bytes() []byte {
+	buffer := &bytes.Buffer{}
+	// writing to a buffer can't fail
+	binary.Write(buffer, binary.BigEndian, h)
+	return buffer.Bytes()
+}
+
+// Returns true if the data starts with the magic bytes of the format
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, Magic[:])
+}
+
+type stream struct {
+	aead        cipher.AEAD
+	header      []byte
+	noncePrefix [7]byte
+	counter     uint32
+	done        bool
+}
+
+func makeStream(h *header, passphrase []byte) (*stream, error) {
+
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("passphrase missing")
+	}
+
+	key, err := crypto.DeriveArgon2Key(passphrase, h.Salt[:], &crypto.Argon2Params{
+		Time:    h.Time,
+		Memory:  h.Memory,
+		Threads: h.Threads,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &stream{
+		aead:        aead,
+		header:      h.bytes(),
+		noncePrefix: h.NoncePrefix,
+	}, nil
+}
+
+func (s *stream) nonce(final bool) ([]byte, error) {
+	if s.done {
+		return nil, fmt.Errorf("stream is already finished")
+	}
+	nonce := make([]byte, 12)
+	copy(nonce, s.noncePrefix[:])
+	binary.BigEndian.PutUint32(nonce[7:11], s.counter)
+	if final {
+		nonce[11] = 1
+		s.done = true
+	} else if s.counter == ^uint32(0) {
+		return nil, fmt.Errorf("too many chunks")
+	}
+	s.counter++
+	return nonce, nil
+}
+
+func (s *stream) seal(chunk []byte, final bool) ([]byte, error) {
+	if nonce, err := s.nonce(final); err != nil {
+		return nil, err
+	} else {
+		return s.aead.Seal(nil, nonce, chunk, s.header), nil
+	}
+}
+
+func (s *stream) open(chunk []byte, final bool) ([]byte, error) {
+	if nonce, err := s.nonce(final); err != nil {
+		return nil, err
+	} else if data, err := s.aead.Open(nil, nonce, chunk, s.header); err != nil {
+		return nil, fmt.Errorf("decrypt failed")
+	} else {
+		return data, nil
+	}
+}
+
+type Writer struct {
+	writer    io.Writer
+	stream    *stream
+	chunkSize int
+	buffer    []byte
+}
+
+// Returns a writer that encrypts everything written to it and writes it to
+// the given writer. Close needs to be called to write the final chunk.
+func NewWriter(w io.Writer, passphrase []byte, params *Params) (*Writer, error) {
+
+	if params == nil {
+		params = &DefaultParams
+	}
+
+	if params.ChunkSize < 1 || params.ChunkSize > maxChunkSize {
+		return nil, fmt.Errorf("invalid chunk size: %d", params.ChunkSize)
+	}
+
+	h := &header{
+		Magic:     Magic,
+		Version:   Version,
+		Time:      params.Time,
+		Memory:    params.Memory,
+		Threads:   params.Threads,
+		ChunkSize: params.ChunkSize,
+	}
+
+	if salt, err := crypto.RandomBytes(len(h.Salt)); err != nil {
+		return nil, err
+	} else {
+		copy(h.Salt[:], salt)
+	}
+
+	if noncePrefix, err := crypto.RandomBytes(len(h.NoncePrefix)); err != nil {
+		return nil, err
+	} else {
+		copy(h.NoncePrefix[:], noncePrefix)
+	}
+
+	stream, err := makeStream(h, passphrase)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(stream.header); err != nil {
+		return nil, err
+	}
+
+	return &Writer{
+		writer:    w,
+		stream:    stream,
+		chunkSize: int(params.ChunkSize),
+	}, nil
+}
+
+func (e *Writer) Write(p []byte) (int, error) {
+	e.buffer = append(e.buffer, p...)
+	// we always keep the last chunk in the buffer, as we only know whether
+	// it is the final one when Close is called
+	for len(e.buffer) > e.chunkSize {
+		if err := e.writeChunk(e.buffer[:e.chunkSize], false); err != nil {
+			return 0, err
+		}
+		e.buffer = e.buffer[e.chunkSize:]
+	}
+	return len(p), nil
+}
+
+func (e *Writer) writeChunk(chunk []byte, final bool) error {
+	if data, err := e.stream.seal(chunk, final); err != nil {
+		return err
+	} else {
+		_, err := e.writer.Write(data)
+		return err
+	}
+}
+
+// Writes the final chunk, this does not close the underlying writer
+func (e *Writer) Close() error {
+	err := e.writeChunk(e.buffer, true)
+	e.buffer = nil
+	return err
+}
+
+type Reader struct {
+	reader *bufio.Reader
+	stream *stream
+	chunk  []byte
+	buffer []byte
+}
+
+// Returns a reader that decrypts the data from the given reader, which needs
+// to start with the header of the format
+func NewReader(r io.Reader, passphrase []byte) (*Reader, error) {
+
+	h := &header{}
+
+	if err := binary.Read(r, binary.BigEndian, h); err != nil {
+		return nil, fmt.Errorf("cannot read header: %w", err)
+	}
+
+	if h.Magic != Magic {
+		return nil, fmt.Errorf("not an encrypted file")
+	}
+
+	if h.Version != Version {
+		return nil, fmt.Errorf("unsupported version: %d", h.Version)
+	}
+
+	if h.ChunkSize < 1 || h.ChunkSize > maxChunkSize {
+		return nil, fmt.Errorf("invalid chunk size: %d", h.ChunkSize)
+	}
+
+	stream, err := makeStream(h, passphrase)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Reader{
+		reader: bufio.NewReader(r),
+		stream: stream,
+		chunk:  make([]byte, int(h.ChunkSize)+stream.aead.Overhead()),
+	}, nil
+}
+
+func (d *Reader) Read(p []byte) (int, error) {
+	for len(d.buffer) == 0 {
+		if d.stream.done {
+			return 0, io.EOF
+		}
+		if err := d.readChunk(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.buffer)
+	d.buffer = d.buffer[n:]
+	return n, nil
+}
+
+func (d *Reader) readChunk() error {
+
+	n, err := io.ReadFull(d.reader, d.chunk)
+
+	final := false
+
+	switch err {
+	case nil:
+		// a full chunk is the final one if no more data follows
+		if _, err := d.reader.Peek(1); err == io.EOF {
+			final = true
+		} else if err != nil {
+			return err
+		}
+	case io.ErrUnexpectedEOF:
+		final = true
+	case io.EOF:
+		return fmt.Errorf("encrypted file is truncated")
+	default:
+		return err
+	}
+
+	if data, err := d.stream.open(d.chunk[:n], final); err != nil {
+		return err
+	} else {
+		d.buffer = data
+	}
+
+	return nil
+}
+
+// Encrypts the data in the given format
+func Encrypt(data, passphrase []byte, params *Params) ([]byte, error) {
+
+	buffer := &bytes.Buffer{}
+
+	writer, err := NewWriter(buffer, passphrase, params)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// Decrypts data in the given format
+func Decrypt(data, passphrase []byte) ([]byte, error) {
+	if reader, err := NewReader(bytes.NewReader(data), passphrase); err != nil {
+		return nil, err
+	} else {
+		return io.ReadAll(reader)
+	}
+}
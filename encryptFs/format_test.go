@@ -0,0 +1,157 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package encryptFs
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/kiebitz-oss/services/crypto"
+	"io"
+	"testing"
+	"testing/fstest"
+)
+
+// we use weak parameters and small chunks to keep the tests fast
+var testParams = &Params{
+	Argon2Params: crypto.Argon2Params{
+		Time:    1,
+		Memory:  64,
+		Threads: 1,
+	},
+	ChunkSize: 16,
+}
+
+var passphrase = []byte("test passphrase")
+
+func TestEncryptAndDecrypt(t *testing.T) {
+
+	for _, size := range []int{0, 1, 15, 16, 17, 32, 100} {
+
+		data := bytes.Repeat([]byte("x"), size)
+
+		encryptedData, err := Encrypt(data, passphrase, testParams)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !IsEncrypted(encryptedData) {
+			t.Fatalf("expected the data to be recognized as encrypted")
+		}
+
+		if decryptedData, err := Decrypt(encryptedData, passphrase); err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		} else if !bytes.Equal(decryptedData, data) {
+			t.Fatalf("size %d: decrypted data does not match", size)
+		}
+
+		if _, err := Decrypt(encryptedData, []byte("wrong passphrase")); err == nil {
+			t.Fatalf("expected an error for a wrong passphrase")
+		}
+	}
+
+}
+
+func TestTamperedData(t *testing.T) {
+
+	data := bytes.Repeat([]byte("abcdefgh"), 10)
+
+	encryptedData, err := Encrypt(data, passphrase, testParams)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	headerSize := len((&header{}).bytes())
+	chunkSize := 16 + 16
+
+	tamper := func(f func([]byte) []byte) []byte {
+		return f(append([]byte{}, encryptedData...))
+	}
+
+	cases := map[string][]byte{
+		// the header is authenticated as well
+		"header": tamper(func(d []byte) []byte { d[10] ^= 1; return d }),
+		"chunk":  tamper(func(d []byte) []byte { d[headerSize+5] ^= 1; return d }),
+		// the file is truncated at a chunk boundary
+		"truncated": tamper(func(d []byte) []byte { return d[:headerSize+2*chunkSize] }),
+		// the first two chunks are swapped
+		"reordered": tamper(func(d []byte) []byte {
+			first := append([]byte{}, d[headerSize:headerSize+chunkSize]...)
+			copy(d[headerSize:], d[headerSize+chunkSize:headerSize+2*chunkSize])
+			copy(d[headerSize+chunkSize:], first)
+			return d
+		}),
+	}
+
+	for name, tamperedData := range cases {
+		if _, err := Decrypt(tamperedData, passphrase); err == nil {
+			t.Fatalf("%s: expected an error", name)
+		}
+	}
+
+}
+
+func TestEncryptedFS(t *testing.T) {
+
+	data := []byte(`{"test": true}`)
+
+	encryptedData, err := Encrypt(data, passphrase, testParams)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// files in the legacy format can still be read
+	legacyData, err := crypto.Encrypt(data, crypto.BuildKey(passphrase))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	legacyJSON, err := json.Marshal(legacyData)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fs := New(fstest.MapFS{
+		"encrypted.json": &fstest.MapFile{Data: encryptedData},
+		"legacy.json":    &fstest.MapFile{Data: legacyJSON},
+		"plain.json":     &fstest.MapFile{Data: data},
+	}, passphrase)
+
+	for _, name := range []string{"encrypted.json", "legacy.json", "plain.json"} {
+
+		file, err := fs.Open(name)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if fileData, err := io.ReadAll(file); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		} else if !bytes.Equal(fileData, data) {
+			t.Fatalf("%s: data does not match", name)
+		}
+
+		file.Close()
+	}
+
+}
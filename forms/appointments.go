@@ -73,14 +73,14 @@ var PublicKeyValidators = []forms.Validator{
 	forms.IsBytes{
 		Encoding:  "base64",
 		MaxLength: 128,
-		MinLength: 64,
+		MinLength: 44, // Ed25519 & X25519 keys are shorter
 	},
 }
 
 var PublicKeyField = forms.Field{
 	Name:        "publicKey",
 	Global:      true,
-	Description: "An ECDSA or ECDH public key.",
+	Description: "An ECDSA/Ed25519 or ECDH/X25519 public key.",
 	Validators:  PublicKeyValidators,
 }
 
@@ -168,6 +168,38 @@ var RawProviderDataForm = forms.Form{
 				},
 			},
 		},
+		{
+			Name:        "version",
+			Description: "Version of verified provider data.",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 0},
+				forms.IsInteger{
+					HasMin: true,
+					Min:    0,
+				},
+			},
+		},
+		{
+			Name:        "baseVersion",
+			Description: "Version of the verified provider data that an update replaces.",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 0},
+				forms.IsInteger{
+					HasMin: true,
+					Min:    0,
+				},
+			},
+		},
+		{
+			Name:        "invitation",
+			Description: "The invitation the provider registered with.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsStringMap{
+					Form: &InvitationForm,
+				},
+			},
+		},
 	},
 }
 
@@ -203,6 +235,14 @@ var ConfirmProviderDataForm = forms.Form{
 				},
 			},
 		},
+		{
+			Name:        "metadataHash",
+			Description: "Hash of the provider metadata recomputed by the mediator, required if the provider registered with an invitation bound to it.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				ID,
+			},
+		},
 	},
 }
 
@@ -313,672 +353,1850 @@ var ResetDBDataForm = forms.Form{
 	},
 }
 
-var AddMediatorPublicKeysForm = forms.Form{
-	Name:   "addMediatorPublicKeys",
-	Fields: SignedDataFields(&AddMediatorPublicKeysDataForm),
-}
-
-var AddMediatorPublicKeysDataForm = forms.Form{
-	Name: "addMediatorPublicKeysData",
-	Fields: []forms.Field{
-		{
-			Name:        "signedKeyData",
-			Description: "Signed mediator key data.",
-			Validators: []forms.Validator{
-				forms.IsStringMap{
-					Form: SignedKeyDataForm(&MediatorKeyDataForm, "mediatorSignedKeyData"),
-				},
-			},
-		},
-		TimestampField,
-	},
-}
-
-var MediatorKeyDataForm = forms.Form{
-	Name: "mediatorKeyData",
-	Fields: []forms.Field{
-		{
-			Name:        "signing",
-			Description: "Public signing key of the mediator.",
-			Validators:  PublicKeyValidators,
-		},
-		{
-			Name:        "encryption",
-			Description: "Public encryption key of the mediator.",
-			Validators:  PublicKeyValidators,
-		},
-	},
-}
-
-// admin endpoints
-
-var AddCodesForm = forms.Form{
-	Name:   "addCodes",
-	Fields: SignedDataFields(&CodesDataForm),
+var GetAuditLogForm = forms.Form{
+	Name:   "getAuditLog",
+	Fields: SignedDataFields(&GetAuditLogDataForm),
 }
 
-var CodesDataForm = forms.Form{
-	Name: "codesData",
+var GetAuditLogDataForm = forms.Form{
+	Name: "getAuditLogData",
 	Fields: []forms.Field{
 		TimestampField,
 		{
-			Name:        "actor",
-			Description: "The actor for which to store signup codes.",
+			Name:        "from",
+			Description: "Index of the first entry to return.",
 			Validators: []forms.Validator{
-				forms.IsString{},
-				forms.IsIn{Choices: []interface{}{"provider", "user"}},
+				forms.IsOptional{Default: 1},
+				forms.IsInteger{
+					HasMin: true,
+					Min:    1,
+				},
 			},
 		},
 		{
-			Name:        "codes",
-			Description: "The signup codes to store.",
+			Name:        "limit",
+			Description: "Number of entries to return at most.",
 			Validators: []forms.Validator{
-				forms.IsList{
-					Validators: []forms.Validator{
-						forms.IsBytes{
-							Encoding:  "hex",
-							MaxLength: 32,
-							MinLength: 16,
-						},
-					},
+				forms.IsOptional{Default: 1000},
+				forms.IsInteger{
+					HasMin: true,
+					HasMax: true,
+					Min:    1,
+					Max:    10000,
 				},
 			},
 		},
 	},
 }
 
-var UploadDistancesForm = forms.Form{
-	Name:   "uploadDistances",
-	Fields: SignedDataFields(&DistancesDataForm),
+var GetKeyLogHeadForm = forms.Form{
+	Name:   "getKeyLogHead",
+	Fields: []forms.Field{},
 }
 
-var DistancesDataForm = forms.Form{
-	Name: "distancesData",
+var GetKeyLogEntriesForm = forms.Form{
+	Name: "getKeyLogEntries",
 	Fields: []forms.Field{
-		TimestampField,
 		{
-			Name:        "type",
-			Description: "The type of distance information to store.",
+			Name:        "from",
+			Description: "Index of the first entry to return.",
 			Validators: []forms.Validator{
-				forms.IsIn{Choices: []interface{}{"zipCode", "zipArea"}},
+				forms.IsOptional{Default: 0},
+				forms.IsInteger{
+					HasMin:  true,
+					Min:     0,
+					Convert: true,
+				},
 			},
 		},
 		{
-			Name:        "distances",
-			Description: "The distances to store.",
+			Name:        "limit",
+			Description: "Number of entries to return at most.",
 			Validators: []forms.Validator{
-				forms.IsList{
-					Validators: []forms.Validator{
-						forms.IsStringMap{
-							Form: &DistanceForm,
-						},
-					},
+				forms.IsOptional{Default: 1000},
+				forms.IsInteger{
+					HasMin:  true,
+					HasMax:  true,
+					Min:     1,
+					Max:     10000,
+					Convert: true,
 				},
 			},
 		},
 	},
 }
 
-var DistanceForm = forms.Form{
-	Name: "distance",
+var GetKeyLogInclusionProofForm = forms.Form{
+	Name: "getKeyLogInclusionProof",
 	Fields: []forms.Field{
 		{
-			Name:        "from",
-			Description: "The origin.",
+			Name:        "index",
+			Description: "Index of the entry to prove (either this or the ID is required).",
 			Validators: []forms.Validator{
-				forms.IsString{},
+				forms.IsOptional{},
+				forms.IsInteger{
+					HasMin:  true,
+					Min:     0,
+					Convert: true,
+				},
 			},
 		},
 		{
-			Name:        "to",
-			Description: "The destination.",
+			Name:        "id",
+			Description: "ID of a mediator or provider key, the latest entry of which is proven.",
 			Validators: []forms.Validator{
-				forms.IsString{},
+				forms.IsOptional{},
+				ID,
 			},
 		},
 		{
-			Name:        "distance",
-			Description: "The distance between origin and destination.",
+			Name:        "treeSize",
+			Description: "Size of the tree for which to prove the inclusion (defaults to the current size).",
 			Validators: []forms.Validator{
-				forms.IsFloat{
-					HasMin: true,
-					Min:    0.0,
-					HasMax: true,
-					Max:    200.0,
+				forms.IsOptional{},
+				forms.IsInteger{
+					HasMin:  true,
+					Min:     1,
+					Convert: true,
 				},
 			},
 		},
 	},
 }
 
-var GetKeysForm = forms.Form{
-	Name:   "getKeys",
-	Fields: []forms.Field{},
-}
-
-var GetTokenForm = forms.Form{
-	Name: "getToken",
+var GetKeyLogConsistencyProofForm = forms.Form{
+	Name: "getKeyLogConsistencyProof",
 	Fields: []forms.Field{
 		{
-			Name:        "hash",
-			Description: "The user-generated hash to store with the token.",
+			Name:        "first",
+			Description: "Size of the earlier tree.",
 			Validators: []forms.Validator{
-				ID,
+				forms.IsInteger{
+					HasMin:  true,
+					Min:     0,
+					Convert: true,
+				},
 			},
 		},
 		{
-			Name:        "code",
-			Description: "The optional signup code to use.",
+			Name:        "second",
+			Description: "Size of the later tree (defaults to the current size).",
 			Validators: []forms.Validator{
 				forms.IsOptional{},
-				forms.IsBytes{
-					Encoding:  "hex", // we encode this as hex since it gets passed in URLs
-					MinLength: 16,
-					MaxLength: 32,
+				forms.IsInteger{
+					HasMin:  true,
+					Min:     0,
+					Convert: true,
 				},
 			},
 		},
-		PublicKeyField,
 	},
 }
 
-var SignedTokenDataForm = forms.Form{
-	Name:   "signedTokenData",
-	Fields: SignedDataFields(&TokenDataForm),
+var AddMediatorPublicKeysForm = forms.Form{
+	Name:   "addMediatorPublicKeys",
+	Fields: SignedDataFields(&AddMediatorPublicKeysDataForm),
 }
 
-var PriorityTokenForm = forms.Form{
-	Name: "priorityToken",
+var AddMediatorPublicKeysDataForm = forms.Form{
+	Name: "addMediatorPublicKeysData",
 	Fields: []forms.Field{
 		{
-			Name: "n",
+			Name:        "signedKeyData",
+			Description: "Signed mediator key data.",
 			Validators: []forms.Validator{
-				forms.IsInteger{HasMin: true, Min: 0},
+				forms.IsStringMap{
+					Form: SignedKeyDataForm(&MediatorKeyDataForm, "mediatorSignedKeyData"),
+				},
 			},
 		},
+		TimestampField,
 	},
 }
 
-var TokenDataForm = forms.Form{
-	Name: "tokenData",
+var MediatorKeyDataForm = forms.Form{
+	Name: "mediatorKeyData",
 	Fields: []forms.Field{
 		{
-			Name:        "hash",
-			Description: "The user-generated hash belonging to the token.",
+			Name:        "signing",
+			Description: "Public signing key of the mediator.",
+			Validators:  PublicKeyValidators,
+		},
+		{
+			Name:        "encryption",
+			Description: "Public encryption key of the mediator.",
+			Validators:  PublicKeyValidators,
+		},
+		{
+			Name:        "validFrom",
+			Description: "Time from which on the key is valid.",
 			Validators: []forms.Validator{
-				ID,
+				forms.IsOptional{},
+				forms.IsTime{Format: "rfc3339"},
 			},
 		},
 		{
-			Name:        "token",
-			Description: "The server-generated token.",
+			Name:        "validUntil",
+			Description: "Time until which the key is valid.",
 			Validators: []forms.Validator{
-				ID,
+				forms.IsOptional{},
+				forms.IsTime{Format: "rfc3339"},
 			},
 		},
-		PublicKeyField,
 		{
-			Name:        "data",
-			Description: "Optional data associated with the token.",
+			Name:        "predecessor",
+			Description: "ID of the mediator key this key replaces.",
 			Validators: []forms.Validator{
 				forms.IsOptional{},
-				forms.IsString{},
-				JSON{
-					Key: "json",
-				},
-				forms.IsStringMap{
-					Form: &PriorityTokenForm,
-				},
+				ID,
 			},
 		},
 	},
 }
 
-var GetAppointmentsByZipCodeForm = forms.Form{
-	Name: "getAppointmentsByZipCode",
+var RevokeMediatorKeyForm = forms.Form{
+	Name:   "revokeMediatorKey",
+	Fields: SignedDataFields(&RevokeMediatorKeyDataForm),
+}
+
+var RevokeMediatorKeyDataForm = forms.Form{
+	Name: "revokeMediatorKeyData",
 	Fields: []forms.Field{
+		TimestampField,
+		IDField,
 		{
-			Name:        "radius",
-			Description: "The radius around the given zip code for which to show appointments.",
-			Validators: []forms.Validator{
-				forms.IsOptional{Default: 50},
-				forms.IsInteger{
-					HasMin:  true,
-					HasMax:  true,
-					Min:     5,
-					Max:     80,
-					Convert: true,
-				},
-			},
-		},
-		{
-			Name:        "zipCode",
-			Description: "The zip code to use as the user location.",
+			Name:        "reason",
+			Description: "The reason for the revocation.",
 			Validators: []forms.Validator{
 				forms.IsString{
-					MaxLength: 5,
-					MinLength: 5,
+					MinLength: 1,
+					MaxLength: 1000,
 				},
 			},
 		},
+	},
+}
+
+var RevokeTokensForm = forms.Form{
+	Name:   "revokeTokens",
+	Fields: SignedDataFields(&RevokeTokensDataForm),
+}
+
+var RevokeTokensDataForm = forms.Form{
+	Name: "revokeTokensData",
+	Fields: []forms.Field{
+		TimestampField,
 		{
-			Name:        "from",
-			Description: "The earliest date of appointments to return.",
+			Name:        "tokens",
+			Description: "The tokens to revoke.",
 			Validators: []forms.Validator{
-				forms.IsTime{Format: "rfc3339"},
+				forms.IsList{
+					Validators: []forms.Validator{
+						ID,
+					},
+				},
 			},
 		},
 		{
-			Name:        "to",
-			Description: "The latest date of appointments to return.",
+			Name:        "reason",
+			Description: "The reason for the revocation.",
 			Validators: []forms.Validator{
-				forms.IsTime{Format: "rfc3339"},
+				forms.IsString{
+					MinLength: 1,
+					MaxLength: 1000,
+				},
 			},
 		},
+	},
+}
+
+var GetProviderKeysForm = forms.Form{
+	Name:   "getProviderKeys",
+	Fields: SignedDataFields(&GetProviderKeysDataForm),
+}
+
+var GetProviderKeysDataForm = forms.Form{
+	Name: "getProviderKeysData",
+	Fields: []forms.Field{
+		TimestampField,
+	},
+}
+
+var RotateMediatorKeyForm = forms.Form{
+	Name:   "rotateMediatorKey",
+	Fields: SignedDataFields(&RotateMediatorKeyDataForm),
+}
+
+var RotateMediatorKeyDataForm = forms.Form{
+	Name: "rotateMediatorKeyData",
+	Fields: []forms.Field{
+		TimestampField,
 		{
-			Name:        "aggregate",
-			Description: "Whether to return aggregate data instead of actual appointments.",
+			Name:        "signatures",
+			Description: "New signatures of the provider key data confirmed by the predecessor key.",
 			Validators: []forms.Validator{
-				forms.IsOptional{Default: false},
-				forms.IsBoolean{},
+				forms.IsList{
+					Validators: []forms.Validator{
+						forms.IsStringMap{
+							Form: &ProviderKeySignatureForm,
+						},
+					},
+				},
 			},
 		},
 	},
-	Validator: func(values map[string]interface{}, errorAdder forms.ErrorAdder) error {
-		from := values["from"].(time.Time)
-		to := values["to"].(time.Time)
-		if from.After(to) {
-			return fmt.Errorf("'from' value is after 'to' value")
-		}
-		if to.Sub(from) > time.Hour*48 {
-			return fmt.Errorf("date span exceeds 2 days")
-		}
-		return nil
+}
+
+var ProviderKeySignatureForm = forms.Form{
+	Name: "providerKeySignature",
+	Fields: []forms.Field{
+		IDField,
+		SignatureField,
 	},
 }
 
-var GetProviderAppointmentsForm = forms.Form{
-	Name:   "getProviderAppointments",
-	Fields: SignedDataFields(&GetProviderAppointmentsDataForm),
+// admin endpoints
+
+var AddCodesForm = forms.Form{
+	Name:   "addCodes",
+	Fields: SignedDataFields(&CodesDataForm),
 }
 
-var GetProviderAppointmentsDataForm = forms.Form{
-	Name: "getProviderAppointmentsData",
+var CodesDataForm = forms.Form{
+	Name: "codesData",
 	Fields: []forms.Field{
 		TimestampField,
 		{
-			Name:        "from",
-			Description: "The earliest date of appointments to return.",
+			Name:        "actor",
+			Description: "The actor for which to store signup codes.",
 			Validators: []forms.Validator{
-				forms.IsTime{Format: "rfc3339"},
+				forms.IsString{},
+				forms.IsIn{Choices: []interface{}{"provider", "user"}},
 			},
 		},
 		{
-			Name:        "to",
-			Description: "The latest date of appointments to return.",
+			Name:        "codes",
+			Description: "The signup codes to store.",
 			Validators: []forms.Validator{
-				forms.IsTime{Format: "rfc3339"},
+				forms.IsList{
+					Validators: []forms.Validator{
+						forms.IsBytes{
+							Encoding:  "hex",
+							MaxLength: 32,
+							MinLength: 16,
+						},
+					},
+				},
 			},
 		},
 		{
-			Name:        "updatedSince",
-			Description: "The minimum 'updatedAt' value of appointments to return.",
+			Name:        "batch",
+			Description: "The optional batch the codes belong to.",
 			Validators: []forms.Validator{
 				forms.IsOptional{},
-				forms.IsTime{Format: "rfc3339"},
+				forms.IsStringMap{
+					Form: &CodeBatchDataForm,
+				},
 			},
 		},
 	},
-	Validator: func(values map[string]interface{}, errorAdder forms.ErrorAdder) error {
-		// form validator only gets called if values are valid, so we can
-		// perform a type assertion without check here
-		from := values["from"].(time.Time)
-		to := values["to"].(time.Time)
-		if from.After(to) {
-			return fmt.Errorf("'from' value is after 'to' value")
-		}
-		if to.Sub(from) > time.Hour*24*14 {
-			return fmt.Errorf("date span exceeds 14 days")
-		}
-		return nil
+}
+
+var CodeBatchDataForm = forms.Form{
+	Name: "codeBatchData",
+	Fields: []forms.Field{
+		IDField,
+		{
+			Name:        "label",
+			Description: "A human-readable label of the batch.",
+			Validators: []forms.Validator{
+				forms.IsString{
+					MinLength: 1,
+					MaxLength: 100,
+				},
+			},
+		},
+		{
+			Name:        "issuedBy",
+			Description: "The person or organization that issued the batch.",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: ""},
+				forms.IsString{
+					MaxLength: 100,
+				},
+			},
+		},
+		{
+			Name:        "expiresAt",
+			Description: "Time after which codes of the batch cannot be used anymore.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsTime{
+					Format: "rfc3339",
+				},
+			},
+		},
 	},
 }
 
-var PublishAppointmentsForm = forms.Form{
-	Name:   "publishAppointments",
-	Fields: SignedDataFields(&PublishAppointmentsDataForm),
+var RevokeCodeBatchForm = forms.Form{
+	Name:   "revokeCodeBatch",
+	Fields: SignedDataFields(&RevokeCodeBatchDataForm),
 }
 
-var PublishAppointmentsDataForm = forms.Form{
-	Name: "publishAppointmentsData",
+var RevokeCodeBatchDataForm = forms.Form{
+	Name: "revokeCodeBatchData",
 	Fields: []forms.Field{
 		TimestampField,
+		IDField,
 		{
-			Name:        "appointments",
-			Description: "The appointments to publish.",
+			Name:        "actor",
+			Description: "The actor the codes belong to.",
 			Validators: []forms.Validator{
-				forms.IsList{
-					Validators: []forms.Validator{
-						forms.IsStringMap{
-							Form: &SignedAppointmentForm,
-						},
-					},
+				forms.IsString{},
+				forms.IsIn{Choices: []interface{}{"provider", "user"}},
+			},
+		},
+		{
+			Name:        "reason",
+			Description: "The reason for the revocation.",
+			Validators: []forms.Validator{
+				forms.IsString{
+					MinLength: 1,
+					MaxLength: 1000,
 				},
 			},
 		},
 	},
 }
 
-var AppointmentPropertiesForm = forms.Form{
-	Name: "appointmentProperties",
+var GetCodeBatchesForm = forms.Form{
+	Name:   "getCodeBatches",
+	Fields: SignedDataFields(&GetCodeBatchesDataForm),
+}
+
+var GetCodeBatchesDataForm = forms.Form{
+	Name: "getCodeBatchesData",
 	Fields: []forms.Field{
+		TimestampField,
 		{
-			Name:        "vaccine",
-			Description: "The vaccine type used.",
+			Name:        "actor",
+			Description: "The actor the codes belong to.",
 			Validators: []forms.Validator{
-				forms.IsIn{Choices: []interface{}{"biontech", "moderna", "astrazeneca", "johnson-johnson"}},
+				forms.IsString{},
+				forms.IsIn{Choices: []interface{}{"provider", "user"}},
 			},
 		},
 	},
 }
 
-var BookingForm = forms.Form{
-	Name: "booking",
+var UploadDistancesForm = forms.Form{
+	Name:   "uploadDistances",
+	Fields: SignedDataFields(&DistancesDataForm),
+}
+
+var DistancesDataForm = forms.Form{
+	Name: "distancesData",
 	Fields: []forms.Field{
-		IDField,
-		PublicKeyField,
+		TimestampField,
 		{
-			Name:        "token",
-			Description: "The token used for this booking.",
+			Name:        "type",
+			Description: "The type of distance information to store.",
 			Validators: []forms.Validator{
-				ID,
+				forms.IsIn{Choices: []interface{}{"zipCode", "zipArea"}},
 			},
 		},
 		{
-			Name:        "encryptedData",
-			Description: "Encrypted data for the provider.",
+			Name:        "distances",
+			Description: "The distances to store.",
 			Validators: []forms.Validator{
-				forms.IsStringMap{
-					Form: &ECDHEncryptedDataForm,
+				forms.IsList{
+					Validators: []forms.Validator{
+						forms.IsStringMap{
+							Form: &DistanceForm,
+						},
+					},
 				},
 			},
 		},
 	},
 }
 
-var SignedAppointmentForm = forms.Form{
-	Name: "signedAppointment",
-	Fields: append(SignedDataFields(&AppointmentDataForm), []forms.Field{
+var DistanceForm = forms.Form{
+	Name: "distance",
+	Fields: []forms.Field{
 		{
-			Name:        "updatedAt",
-			Description: "Time the appointment has last been updated.",
+			Name:        "from",
+			Description: "The origin.",
 			Validators: []forms.Validator{
-				forms.IsOptional{}, // only for reading, not for submitting
-				forms.IsTime{
-					Format: "rfc3339",
-				},
+				forms.IsString{},
 			},
 		},
 		{
-			Name:        "bookedSlots",
-			Description: "Booked slots associated with the appointment (visible to users).",
+			Name:        "to",
+			Description: "The destination.",
 			Validators: []forms.Validator{
-				forms.IsOptional{}, // only for reading, not for submitting
-				forms.IsList{
-					Validators: []forms.Validator{
-						forms.IsStringMap{
-							Form: &SlotForm,
-						},
-					},
-				},
+				forms.IsString{},
 			},
 		},
 		{
-			Name:        "bookings",
-			Description: "Bookings associated with the appointment (only visible to providers).",
+			Name:        "distance",
+			Description: "The distance between origin and destination.",
 			Validators: []forms.Validator{
-				forms.IsOptional{}, // only for reading, not for submitting
-				forms.IsList{
-					Validators: []forms.Validator{
-						forms.IsStringMap{
-							Form: &BookingForm,
-						},
-					},
+				forms.IsFloat{
+					HasMin: true,
+					Min:    0.0,
+					HasMax: true,
+					Max:    200.0,
 				},
 			},
 		},
-	}...),
+	},
+}
+
+var GetKeysForm = forms.Form{
+	Name:   "getKeys",
+	Fields: []forms.Field{},
+}
+
+var GetTokenChallengeForm = forms.Form{
+	Name:   "getTokenChallenge",
+	Fields: []forms.Field{},
+}
+
+var GetTokenForm = forms.Form{
+	Name: "getToken",
+	Fields: []forms.Field{
+		{
+			Name:        "hash",
+			Description: "The user-generated hash to store with the token.",
+			Validators: []forms.Validator{
+				ID,
+			},
+		},
+		{
+			Name:        "code",
+			Description: "The optional signup code to use.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsBytes{
+					Encoding:  "hex", // we encode this as hex since it gets passed in URLs
+					MinLength: 16,
+					MaxLength: 32,
+				},
+			},
+		},
+		PublicKeyField,
+		{
+			Name:        "challenge",
+			Description: "Solution of a token challenge (required if token challenges are enabled).",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsStringMap{
+					Form: &TokenChallengeSolutionForm,
+				},
+			},
+		},
+	},
+}
+
+var BlindSignatureValidators = []forms.Validator{
+	forms.IsBytes{
+		Encoding:  "base64",
+		MinLength: 256,
+		MaxLength: 512,
+	},
+}
+
+var GetBlindTokenForm = forms.Form{
+	Name: "getBlindToken",
+	Fields: []forms.Field{
+		{
+			Name:        "blindedToken",
+			Description: "The blinded token data to sign.",
+			Validators:  BlindSignatureValidators,
+		},
+		{
+			Name:        "code",
+			Description: "The optional signup code to use.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsBytes{
+					Encoding:  "hex", // we encode this as hex since it gets passed in URLs
+					MinLength: 16,
+					MaxLength: 32,
+				},
+			},
+		},
+		{
+			Name:        "challenge",
+			Description: "Solution of a token challenge (required if token challenges are enabled).",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsStringMap{
+					Form: &TokenChallengeSolutionForm,
+				},
+			},
+		},
+	},
+}
+
+var BlindTokenForm = forms.Form{
+	Name: "blindToken",
+	Fields: []forms.Field{
+		{
+			Name:        "data",
+			Description: "The JSON-encoded token data.",
+			Validators: []forms.Validator{
+				forms.IsString{},
+				JSON{
+					Key: "json",
+				},
+				forms.IsStringMap{
+					Form: &BlindTokenDataForm,
+				},
+			},
+		},
+		{
+			Name:        "signature",
+			Description: "The unblinded signature of the token data.",
+			Validators:  BlindSignatureValidators,
+		},
+	},
+}
+
+var BlindTokenDataForm = forms.Form{
+	Name: "blindTokenData",
+	Fields: []forms.Field{
+		{
+			Name:        "serial",
+			Description: "The user-generated serial of the token.",
+			Validators: []forms.Validator{
+				ID,
+			},
+		},
+		PublicKeyField,
+	},
+}
+
+var TokenChallengeForm = forms.Form{
+	Name: "tokenChallenge",
+	Fields: []forms.Field{
+		{
+			Name:        "nonce",
+			Description: "A random nonce.",
+			Validators: []forms.Validator{
+				ID,
+			},
+		},
+		{
+			Name:        "difficulty",
+			Description: "The number of leading zero bits the solution hash needs to have.",
+			Validators: []forms.Validator{
+				forms.IsInteger{
+					HasMin: true,
+					Min:    1,
+					HasMax: true,
+					Max:    32,
+				},
+			},
+		},
+		{
+			Name:        "expiresAt",
+			Description: "Time after which the challenge cannot be used anymore.",
+			Validators: []forms.Validator{
+				forms.IsTime{
+					Format: "rfc3339",
+				},
+			},
+		},
+	},
+}
+
+var SignedTokenChallengeForm = forms.Form{
+	Name: "signedTokenChallenge",
+	Fields: []forms.Field{
+		{
+			Name:        "data",
+			Description: "The JSON-encoded challenge.",
+			Validators: []forms.Validator{
+				forms.IsString{},
+				JSON{
+					Key: "json",
+				},
+				forms.IsStringMap{
+					Form: &TokenChallengeForm,
+				},
+			},
+		},
+		{
+			Name:        "signature",
+			Description: "The HMAC of the challenge.",
+			Validators: []forms.Validator{
+				forms.IsBytes{
+					Encoding:  "base64",
+					MinLength: 32,
+					MaxLength: 32,
+				},
+			},
+		},
+	},
+}
+
+var TokenChallengeSolutionForm = forms.Form{
+	Name: "tokenChallengeSolution",
+	Fields: []forms.Field{
+		{
+			Name:        "challenge",
+			Description: "The signed challenge as returned by the server.",
+			Validators: []forms.Validator{
+				forms.IsStringMap{
+					Form: &SignedTokenChallengeForm,
+				},
+			},
+		},
+		{
+			Name:        "solution",
+			Description: "The solution of the challenge.",
+			Validators: []forms.Validator{
+				forms.IsBytes{
+					Encoding:  "base64",
+					MinLength: 1,
+					MaxLength: 64,
+				},
+			},
+		},
+	},
+}
+
+var SignedTokenDataForm = forms.Form{
+	Name:   "signedTokenData",
+	Fields: SignedDataFields(&TokenDataForm),
+}
+
+var PriorityTokenForm = forms.Form{
+	Name: "priorityToken",
+	Fields: []forms.Field{
+		{
+			Name: "n",
+			Validators: []forms.Validator{
+				forms.IsInteger{HasMin: true, Min: 0},
+			},
+		},
+	},
+}
+
+var TokenDataForm = forms.Form{
+	Name: "tokenData",
+	Fields: []forms.Field{
+		{
+			Name:        "hash",
+			Description: "The user-generated hash belonging to the token.",
+			Validators: []forms.Validator{
+				ID,
+			},
+		},
+		{
+			Name:        "token",
+			Description: "The server-generated token.",
+			Validators: []forms.Validator{
+				ID,
+			},
+		},
+		PublicKeyField,
+		{
+			Name:        "expiresAt",
+			Description: "Time after which the token cannot be used anymore.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsTime{
+					Format: "rfc3339",
+				},
+			},
+		},
+		{
+			Name:        "data",
+			Description: "Optional data associated with the token.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsString{},
+				JSON{
+					Key: "json",
+				},
+				forms.IsStringMap{
+					Form: &PriorityTokenForm,
+				},
+			},
+		},
+	},
+}
+
+var GetAppointmentsByZipCodeForm = forms.Form{
+	Name: "getAppointmentsByZipCode",
+	Fields: []forms.Field{
+		{
+			Name:        "radius",
+			Description: "The radius around the given zip code for which to show appointments.",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 50},
+				forms.IsInteger{
+					HasMin:  true,
+					HasMax:  true,
+					Min:     5,
+					Max:     80,
+					Convert: true,
+				},
+			},
+		},
+		{
+			Name:        "zipCode",
+			Description: "The zip code to use as the user location.",
+			Validators: []forms.Validator{
+				forms.IsString{
+					MaxLength: 5,
+					MinLength: 5,
+				},
+			},
+		},
+		{
+			Name:        "from",
+			Description: "The earliest date of appointments to return.",
+			Validators: []forms.Validator{
+				forms.IsTime{Format: "rfc3339"},
+			},
+		},
+		{
+			Name:        "to",
+			Description: "The latest date of appointments to return.",
+			Validators: []forms.Validator{
+				forms.IsTime{Format: "rfc3339"},
+			},
+		},
+		{
+			Name:        "aggregate",
+			Description: "Whether to return aggregate data instead of actual appointments.",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: false},
+				forms.IsBoolean{},
+			},
+		},
+	},
+	Validator: func(values map[string]interface{}, errorAdder forms.ErrorAdder) error {
+		from := values["from"].(time.Time)
+		to := values["to"].(time.Time)
+		if from.After(to) {
+			return fmt.Errorf("'from' value is after 'to' value")
+		}
+		if to.Sub(from) > time.Hour*48 {
+			return fmt.Errorf("date span exceeds 2 days")
+		}
+		return nil
+	},
+}
+
+var GetProviderAppointmentsForm = forms.Form{
+	Name:   "getProviderAppointments",
+	Fields: SignedDataFields(&GetProviderAppointmentsDataForm),
+}
+
+var GetProviderAppointmentsDataForm = forms.Form{
+	Name: "getProviderAppointmentsData",
+	Fields: []forms.Field{
+		TimestampField,
+		{
+			Name:        "from",
+			Description: "The earliest date of appointments to return.",
+			Validators: []forms.Validator{
+				forms.IsTime{Format: "rfc3339"},
+			},
+		},
+		{
+			Name:        "to",
+			Description: "The latest date of appointments to return.",
+			Validators: []forms.Validator{
+				forms.IsTime{Format: "rfc3339"},
+			},
+		},
+		{
+			Name:        "updatedSince",
+			Description: "The minimum 'updatedAt' value of appointments to return.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsTime{Format: "rfc3339"},
+			},
+		},
+	},
+	Validator: func(values map[string]interface{}, errorAdder forms.ErrorAdder) error {
+		// form validator only gets called if values are valid, so we can
+		// perform a type assertion without check here
+		from := values["from"].(time.Time)
+		to := values["to"].(time.Time)
+		if from.After(to) {
+			return fmt.Errorf("'from' value is after 'to' value")
+		}
+		if to.Sub(from) > time.Hour*24*14 {
+			return fmt.Errorf("date span exceeds 14 days")
+		}
+		return nil
+	},
+}
+
+var PublishAppointmentsForm = forms.Form{
+	Name:   "publishAppointments",
+	Fields: SignedDataFields(&PublishAppointmentsDataForm),
+}
+
+var PublishAppointmentsDataForm = forms.Form{
+	Name: "publishAppointmentsData",
+	Fields: []forms.Field{
+		TimestampField,
+		{
+			Name:        "appointments",
+			Description: "The appointments to publish.",
+			Validators: []forms.Validator{
+				forms.IsList{
+					Validators: []forms.Validator{
+						forms.IsStringMap{
+							Form: &SignedAppointmentForm,
+						},
+					},
+				},
+			},
+		},
+	},
+}
+
+var DeleteAppointmentsForm = forms.Form{
+	Name:   "deleteAppointments",
+	Fields: SignedDataFields(&DeleteAppointmentsDataForm),
+}
+
+var DeleteAppointmentsDataForm = forms.Form{
+	Name: "deleteAppointmentsData",
+	Fields: []forms.Field{
+		TimestampField,
+		{
+			Name:        "ids",
+			Description: "The IDs of the appointments to delete.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsList{
+					Validators: []forms.Validator{
+						ID,
+					},
+				},
+			},
+		},
+		{
+			Name:        "from",
+			Description: "The earliest date of appointments to delete.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsTime{Format: "rfc3339"},
+			},
+		},
+		{
+			Name:        "to",
+			Description: "The latest date of appointments to delete.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsTime{Format: "rfc3339"},
+			},
+		},
+	},
+	Validator: func(values map[string]interface{}, errorAdder forms.ErrorAdder) error {
+		if values["from"] != nil && values["to"] == nil || values["to"] != nil && values["from"] == nil {
+			return fmt.Errorf("both from and to must be specified")
+		}
+		if values["ids"] == nil && values["from"] == nil {
+			return fmt.Errorf("you need to specify either ids or from/to")
+		}
+		if values["from"] != nil {
+			from := values["from"].(time.Time)
+			to := values["to"].(time.Time)
+			if from.After(to) {
+				return fmt.Errorf("'from' value is after 'to' value")
+			}
+		}
+		return nil
+	},
+}
+
+var GetDeletedAppointmentsForm = forms.Form{
+	Name:   "getDeletedAppointments",
+	Fields: SignedDataFields(&GetDeletedAppointmentsDataForm),
+}
+
+var GetDeletedAppointmentsDataForm = forms.Form{
+	Name: "getDeletedAppointmentsData",
+	Fields: []forms.Field{
+		TimestampField,
+		{
+			Name:        "updatedSince",
+			Description: "Only return appointments that were deleted after this time.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsTime{Format: "rfc3339"},
+			},
+		},
+	},
+}
+
+var AppointmentTombstoneForm = forms.Form{
+	Name: "appointmentTombstone",
+	Fields: []forms.Field{
+		IDField,
+		{
+			Name:        "deletedAt",
+			Description: "Time the appointment has been deleted.",
+			Validators: []forms.Validator{
+				forms.IsTime{Format: "rfc3339"},
+			},
+		},
+	},
+}
+
+var SyncProviderAppointmentsForm = forms.Form{
+	Name:   "syncProviderAppointments",
+	Fields: SignedDataFields(&SyncProviderAppointmentsDataForm),
+}
+
+var SyncProviderAppointmentsDataForm = forms.Form{
+	Name: "syncProviderAppointmentsData",
+	Fields: []forms.Field{
+		TimestampField,
+		{
+			Name:        "since",
+			Description: "The sequence number of the last change the client has seen.",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 0},
+				forms.IsInteger{
+					HasMin: true,
+					Min:    0,
+				},
+			},
+		},
+		{
+			Name:        "epoch",
+			Description: "The epoch of the change log the sequence number belongs to.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				ID,
+			},
+		},
+		{
+			Name:        "limit",
+			Description: "Number of changes to return at most.",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 1000},
+				forms.IsInteger{
+					HasMin: true,
+					HasMax: true,
+					Min:    1,
+					Max:    10000,
+				},
+			},
+		},
+	},
+}
+
+var AppointmentChangeForm = forms.Form{
+	Name: "appointmentChange",
+	Fields: []forms.Field{
+		IDField,
+		{
+			Name:        "seq",
+			Description: "The sequence number of the change.",
+			Validators: []forms.Validator{
+				forms.IsInteger{
+					HasMin: true,
+					Min:    1,
+				},
+			},
+		},
+		{
+			Name:        "deleted",
+			Description: "Whether the appointment has been deleted.",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: false},
+				forms.IsBoolean{},
+			},
+		},
+	},
+}
+
+var AppointmentPropertiesForm = forms.Form{
+	Name: "appointmentProperties",
+	Fields: []forms.Field{
+		{
+			Name:        "vaccine",
+			Description: "The vaccine type used.",
+			Validators: []forms.Validator{
+				forms.IsIn{Choices: []interface{}{"biontech", "moderna", "astrazeneca", "johnson-johnson"}},
+			},
+		},
+	},
+}
+
+var BookingForm = forms.Form{
+	Name: "booking",
+	Fields: []forms.Field{
+		IDField,
+		PublicKeyField,
+		{
+			Name:        "token",
+			Description: "The token used for this booking.",
+			Validators: []forms.Validator{
+				ID,
+			},
+		},
+		{
+			Name:        "encryptedData",
+			Description: "Encrypted data for the provider.",
+			Validators: []forms.Validator{
+				forms.IsStringMap{
+					Form: &ECDHEncryptedDataForm,
+				},
+			},
+		},
+	},
+}
+
+var SignedAppointmentForm = forms.Form{
+	Name: "signedAppointment",
+	Fields: append(SignedDataFields(&AppointmentDataForm), []forms.Field{
+		{
+			Name:        "updatedAt",
+			Description: "Time the appointment has last been updated.",
+			Validators: []forms.Validator{
+				forms.IsOptional{}, // only for reading, not for submitting
+				forms.IsTime{
+					Format: "rfc3339",
+				},
+			},
+		},
+		{
+			Name:        "bookedSlots",
+			Description: "Booked slots associated with the appointment (visible to users).",
+			Validators: []forms.Validator{
+				forms.IsOptional{}, // only for reading, not for submitting
+				forms.IsList{
+					Validators: []forms.Validator{
+						forms.IsStringMap{
+							Form: &SlotForm,
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:        "bookings",
+			Description: "Bookings associated with the appointment (only visible to providers).",
+			Validators: []forms.Validator{
+				forms.IsOptional{}, // only for reading, not for submitting
+				forms.IsList{
+					Validators: []forms.Validator{
+						forms.IsStringMap{
+							Form: &BookingForm,
+						},
+					},
+				},
+			},
+		},
+	}...),
+}
+
+var AppointmentDataForm = forms.Form{
+	Name: "appointmentData",
+	Fields: []forms.Field{
+		TimestampField,
+		{
+			Name:        "duration",
+			Description: "Duration of the appointment.",
+			Validators: []forms.Validator{
+				forms.IsInteger{
+					HasMin: true,
+					HasMax: true,
+					Min:    5,
+					Max:    300,
+				},
+			},
+		},
+		{
+			Name:        "properties",
+			Description: "Properties of the appointment.",
+			Validators: []forms.Validator{
+				forms.IsStringMap{
+					Form: &AppointmentPropertiesForm,
+				},
+			},
+		},
+		PublicKeyField,
+		IDField,
+		{
+			Name:        "slotData",
+			Description: "Appointment slots.",
+			Validators: []forms.Validator{
+				forms.IsList{
+					Validators: []forms.Validator{
+						forms.IsStringMap{
+							Form: &SlotForm,
+						},
+					},
+				},
+			},
+		},
+	},
+}
+
+var SlotForm = forms.Form{
+	Name: "slot",
+	Fields: []forms.Field{
+		IDField,
+	},
+}
+
+var GetBookedAppointmentsDataForm = forms.Form{
+	Name: "getBookedAppointmentsData",
+	Fields: []forms.Field{
+		TimestampField,
+	},
+}
+var GetBookedAppointmentsForm = forms.Form{
+	Name:   "getBookedAppointments",
+	Fields: SignedDataFields(&GetBookedAppointmentsDataForm),
+}
+
+var BookAppointmentForm = forms.Form{
+	Name:   "bookAppointment",
+	Fields: SignedDataFields(&BookAppointmentDataForm),
+}
+
+var BookAppointmentDataForm = forms.Form{
+	Name: "bookAppointmentData",
+	Fields: []forms.Field{
+		ProviderIDField,
+		IDField,
+		TimestampField,
+		{
+			Name:        "signedTokenData",
+			Description: "Signed token data of the user (either this or a blind token is required).",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsStringMap{
+					Form: &SignedTokenDataForm,
+				},
+			},
+		},
+		{
+			Name:        "blindToken",
+			Description: "Blind token of the user (either this or signed token data is required).",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsStringMap{
+					Form: &BlindTokenForm,
+				},
+			},
+		},
+		{
+			Name:        "encryptedData",
+			Description: "Encrypted data for the provider.",
+			Validators: []forms.Validator{
+				forms.IsStringMap{
+					Form: &ECDHEncryptedDataForm,
+				},
+			},
+		},
+	},
+}
+
+var GetAppointmentForm = forms.Form{
+	Name: "getAppointment",
+	Fields: []forms.Field{
+		IDField,
+		ProviderIDField,
+	},
+}
+
+var CancelAppointmentForm = forms.Form{
+	Name:   "cancelAppointment",
+	Fields: SignedDataFields(&CancelAppointmentDataForm),
+}
+
+var CancelAppointmentDataForm = forms.Form{
+	Name: "cancelAppointmentData",
+	Fields: []forms.Field{
+		IDField,
+		ProviderIDField,
+		{
+			Name:        "slotID",
+			Description: "The ID of the slot to cancel.",
+			Validators: []forms.Validator{
+				ID,
+			},
+		},
+		TimestampField,
+		{
+			Name:        "signedTokenData",
+			Description: "Signed token data of the user (either this or a blind token is required).",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsStringMap{
+					Form: &SignedTokenDataForm,
+				},
+			},
+		},
+		{
+			Name:        "blindToken",
+			Description: "Blind token of the user (either this or signed token data is required).",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsStringMap{
+					Form: &BlindTokenForm,
+				},
+			},
+		},
+	},
+}
+
+var CheckProviderDataForm = forms.Form{
+	Name:   "checkProviderData",
+	Fields: SignedDataFields(&CheckProviderDataDataForm),
+}
+
+var CheckProviderDataDataForm = forms.Form{
+	Name: "checkProviderDataData",
+	Fields: []forms.Field{
+		TimestampField,
+	},
+}
+
+var StoreProviderDataForm = forms.Form{
+	Name:   "storeProviderData",
+	Fields: SignedDataFields(&StoreProviderDataDataForm),
+}
+
+var ConfirmedProviderDataForm = forms.Form{
+	Name:   "confirmedProviderData",
+	Fields: SignedDataFields(&ECDHEncryptedDataForm),
+}
+
+var StoreProviderDataDataForm = forms.Form{
+	Name: "storeProviderDataData",
+	Fields: []forms.Field{
+		TimestampField,
+		{
+			Name:        "code",
+			Description: "Optional signup code.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsBytes{
+					Encoding:  "hex", // we encode this as hex since it gets passed in URLs
+					MinLength: 16,
+					MaxLength: 32,
+				},
+			},
+		},
+		{
+			Name:        "metadataHash",
+			Description: "Hash of the provider metadata, required if the code is an invitation bound to it.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				ID,
+			},
+		},
+		{
+			Name:        "encryptedData",
+			Description: "Encrypted data for mediators to review.",
+			Validators: []forms.Validator{
+				forms.IsStringMap{
+					Form: &ECDHEncryptedDataForm,
+				},
+			},
+		},
+	},
+}
+
+var IssueInvitationForm = forms.Form{
+	Name:   "issueInvitation",
+	Fields: SignedDataFields(&IssueInvitationDataForm),
+}
+
+var IssueInvitationDataForm = forms.Form{
+	Name: "issueInvitationData",
+	Fields: []forms.Field{
+		TimestampField,
+		{
+			Name:        "code",
+			Description: "The invitation code that is handed to the provider.",
+			Validators: []forms.Validator{
+				forms.IsBytes{
+					Encoding:  "hex", // we encode this as hex since it gets passed in URLs
+					MinLength: 16,
+					MaxLength: 32,
+				},
+			},
+		},
+		{
+			Name:        "providerKey",
+			Description: "The public key the provider needs to sign its data with.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsBytes{
+					Encoding:  "base64",
+					MaxLength: 128,
+					MinLength: 44,
+				},
+			},
+		},
+		{
+			Name:        "metadataHash",
+			Description: "Hash of the expected provider metadata.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				ID,
+			},
+		},
+		{
+			Name:        "expiresAt",
+			Description: "Time after which the invitation cannot be used anymore.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsTime{
+					Format: "rfc3339",
+				},
+			},
+		},
+	},
+}
+
+var InvitationForm = forms.Form{
+	Name: "invitation",
+	Fields: []forms.Field{
+		{
+			Name:        "id",
+			Description: "The hash of the invitation code.",
+			Validators: []forms.Validator{
+				ID,
+			},
+		},
+		{
+			Name:        "providerKey",
+			Description: "The public key the provider needs to sign its data with.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsBytes{
+					Encoding:  "base64",
+					MaxLength: 128,
+					MinLength: 44,
+				},
+			},
+		},
+		{
+			Name:        "metadataHash",
+			Description: "Hash of the expected provider metadata.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				ID,
+			},
+		},
+		{
+			Name:        "expiresAt",
+			Description: "Time after which the invitation cannot be used anymore.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsTime{
+					Format: "rfc3339",
+				},
+			},
+		},
+		{
+			Name:        "issuedAt",
+			Description: "Time at which the invitation was issued.",
+			Validators: []forms.Validator{
+				forms.IsTime{
+					Format: "rfc3339",
+				},
+			},
+		},
+		{
+			Name:        "issuedBy",
+			Description: "The public key of the root or mediator that issued the invitation.",
+			Validators:  PublicKeyValidators,
+		},
+		{
+			Name:        "usedBy",
+			Description: "The ID of the provider that used the invitation.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				ID,
+			},
+		},
+		{
+			Name:        "usedAt",
+			Description: "Time at which the invitation was used.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsTime{
+					Format: "rfc3339",
+				},
+			},
+		},
+	},
+}
+
+var GetPendingProviderDataForm = forms.Form{
+	Name:   "getPendingProviderData",
+	Fields: SignedDataFields(&GetPendingProviderDataDataForm),
+}
+
+var GetPendingProviderDataDataForm = forms.Form{
+	Name: "getPendingProviderDataData",
+	Fields: []forms.Field{
+		TimestampField,
+		{
+			Name:        "limit",
+			Description: "Number of entries to return at most.",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 1000},
+				forms.IsInteger{
+					HasMin: true,
+					HasMax: true,
+					Min:    1,
+					Max:    10000,
+				},
+			},
+		},
+		{
+			Name:        "offset",
+			Description: "Number of entries to skip.",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 0},
+				forms.IsInteger{
+					HasMin: true,
+					Min:    0,
+				},
+			},
+		},
+		{
+			Name:        "unclaimed",
+			Description: "Only return entries that are not claimed by other mediators.",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: false},
+				forms.IsBoolean{},
+			},
+		},
+	},
+}
+
+var RejectProviderForm = forms.Form{
+	Name:   "rejectProvider",
+	Fields: SignedDataFields(&RejectProviderDataForm),
+}
+
+var RejectProviderDataForm = forms.Form{
+	Name: "rejectProviderData",
+	Fields: []forms.Field{
+		TimestampField,
+		IDField,
+		{
+			Name:        "encryptedReason",
+			Description: "The reason for the rejection, encrypted for the provider.",
+			Validators: []forms.Validator{
+				forms.IsStringMap{
+					Form: &ECDHEncryptedDataForm,
+				},
+			},
+		},
+	},
+}
+
+var RejectProviderDataUpdateForm = forms.Form{
+	Name:   "rejectProviderDataUpdate",
+	Fields: SignedDataFields(&RejectProviderDataUpdateDataForm),
+}
+
+var RejectProviderDataUpdateDataForm = forms.Form{
+	Name: "rejectProviderDataUpdateData",
+	Fields: []forms.Field{
+		TimestampField,
+		IDField,
+		{
+			Name:        "baseVersion",
+			Description: "Version of the verified provider data that the rejected update replaces.",
+			Validators: []forms.Validator{
+				forms.IsInteger{
+					HasMin: true,
+					Min:    0,
+				},
+			},
+		},
+		{
+			Name:        "reason",
+			Description: "The reason for the rejection.",
+			Validators: []forms.Validator{
+				forms.IsString{
+					MinLength: 1,
+					MaxLength: 1000,
+				},
+			},
+		},
+	},
+}
+
+var GetProviderDataVersionsForm = forms.Form{
+	Name:   "getProviderDataVersions",
+	Fields: SignedDataFields(&GetProviderDataVersionsDataForm),
+}
+
+var GetProviderDataVersionsDataForm = forms.Form{
+	Name: "getProviderDataVersionsData",
+	Fields: []forms.Field{
+		TimestampField,
+		IDField,
+	},
+}
+
+var ClaimProviderDataForm = forms.Form{
+	Name:   "claimProviderData",
+	Fields: SignedDataFields(&ProviderDataClaimDataForm),
+}
+
+var ReleaseProviderDataForm = forms.Form{
+	Name:   "releaseProviderData",
+	Fields: SignedDataFields(&ProviderDataClaimDataForm),
+}
+
+var ProviderDataClaimDataForm = forms.Form{
+	Name: "providerDataClaimData",
+	Fields: []forms.Field{
+		TimestampField,
+		IDField,
+	},
+}
+
+var GetPendingProviderApprovalsForm = forms.Form{
+	Name:   "getPendingProviderApprovals",
+	Fields: SignedDataFields(&GetPendingProviderApprovalsDataForm),
+}
+
+var GetPendingProviderApprovalsDataForm = forms.Form{
+	Name: "getPendingProviderApprovalsData",
+	Fields: []forms.Field{
+		TimestampField,
+	},
+}
+
+var GetVerifiedProviderDataForm = forms.Form{
+	Name:   "getVerifiedProviderData",
+	Fields: SignedDataFields(&GetVerifiedProviderDataDataForm),
 }
 
-var AppointmentDataForm = forms.Form{
-	Name: "appointmentData",
+var GetVerifiedProviderDataDataForm = forms.Form{
+	Name: "getVerifiedProviderDataData",
 	Fields: []forms.Field{
 		TimestampField,
 		{
-			Name:        "duration",
-			Description: "Duration of the appointment.",
+			Name:        "limit",
+			Description: "Number of entries to return at most.",
 			Validators: []forms.Validator{
+				forms.IsOptional{Default: 1000},
 				forms.IsInteger{
 					HasMin: true,
 					HasMax: true,
-					Min:    5,
-					Max:    300,
+					Min:    1,
+					Max:    10000,
 				},
 			},
 		},
+	},
+}
+
+var RotateProviderKeyForm = forms.Form{
+	Name:   "rotateProviderKey",
+	Fields: SignedDataFields(&RotateProviderKeyDataForm),
+}
+
+var RotateProviderKeyDataForm = forms.Form{
+	Name: "rotateProviderKeyData",
+	Fields: []forms.Field{
+		TimestampField,
 		{
-			Name:        "properties",
-			Description: "Properties of the appointment.",
+			Name:        "signedKeyData",
+			Description: "New key data, signed with the current signing key.",
 			Validators: []forms.Validator{
 				forms.IsStringMap{
-					Form: &AppointmentPropertiesForm,
+					Form: SignedKeyDataForm(&ProviderKeyDataForm, "providerSignedKeyData"),
 				},
 			},
 		},
-		PublicKeyField,
-		IDField,
 		{
-			Name:        "slotData",
-			Description: "Appointment slots.",
-			Validators: []forms.Validator{
-				forms.IsList{
-					Validators: []forms.Validator{
-						forms.IsStringMap{
-							Form: &SlotForm,
-						},
-					},
-				},
-			},
+			Name:        "proof",
+			Description: "Signature of the signed key data with the new signing key.",
+			Validators:  PublicKeyValidators,
 		},
 	},
 }
 
-var SlotForm = forms.Form{
-	Name: "slot",
-	Fields: []forms.Field{
-		IDField,
-	},
+var ReplaceProviderKeyForm = forms.Form{
+	Name:   "replaceProviderKey",
+	Fields: SignedDataFields(&ReplaceProviderKeyDataForm),
 }
 
-var GetBookedAppointmentsDataForm = forms.Form{
-	Name: "getBookedAppointmentsData",
+var ReplaceProviderKeyDataForm = forms.Form{
+	Name: "replaceProviderKeyData",
 	Fields: []forms.Field{
 		TimestampField,
+		IDField,
+		{
+			Name:        "signedKeyData",
+			Description: "New key data, signed by the mediator.",
+			Validators: []forms.Validator{
+				forms.IsStringMap{
+					Form: SignedKeyDataForm(&ProviderKeyDataForm, "providerSignedKeyData"),
+				},
+			},
+		},
 	},
 }
-var GetBookedAppointmentsForm = forms.Form{
-	Name:   "getBookedAppointments",
-	Fields: SignedDataFields(&GetBookedAppointmentsDataForm),
-}
-
-var BookAppointmentForm = forms.Form{
-	Name:   "bookAppointment",
-	Fields: SignedDataFields(&BookAppointmentDataForm),
-}
 
-var BookAppointmentDataForm = forms.Form{
-	Name: "bookAppointmentData",
+var DelegationDataForm = forms.Form{
+	Name: "delegationData",
 	Fields: []forms.Field{
-		ProviderIDField,
-		IDField,
-		TimestampField,
 		{
-			Name:        "signedTokenData",
-			Description: "Signed token data of the user.",
+			Name:        "signing",
+			Description: "Public signing key of the delegate.",
+			Validators:  PublicKeyValidators,
+		},
+		{
+			Name:        "name",
+			Description: "Name of the delegate (e.g. of a staff member).",
 			Validators: []forms.Validator{
-				forms.IsStringMap{
-					Form: &SignedTokenDataForm,
+				forms.IsOptional{Default: ""},
+				forms.IsString{
+					MaxLength: 100,
 				},
 			},
 		},
 		{
-			Name:        "encryptedData",
-			Description: "Encrypted data for the provider.",
+			Name:        "scopes",
+			Description: "The operations the delegate can perform on behalf of the provider.",
 			Validators: []forms.Validator{
-				forms.IsStringMap{
-					Form: &ECDHEncryptedDataForm,
+				forms.IsList{
+					Validators: []forms.Validator{
+						forms.IsIn{Choices: []interface{}{"publish", "read-bookings"}},
+					},
 				},
 			},
 		},
+		{
+			Name:        "validUntil",
+			Description: "Time until which the delegation is valid.",
+			Validators: []forms.Validator{
+				forms.IsTime{Format: "rfc3339"},
+			},
+		},
 	},
 }
 
-var GetAppointmentForm = forms.Form{
-	Name: "getAppointment",
-	Fields: []forms.Field{
-		IDField,
-		ProviderIDField,
-	},
-}
-
-var CancelAppointmentForm = forms.Form{
-	Name:   "cancelAppointment",
-	Fields: SignedDataFields(&CancelAppointmentDataForm),
+var AddProviderDelegationForm = forms.Form{
+	Name:   "addProviderDelegation",
+	Fields: SignedDataFields(&AddProviderDelegationDataForm),
 }
 
-var CancelAppointmentDataForm = forms.Form{
-	Name: "cancelAppointmentData",
+var AddProviderDelegationDataForm = forms.Form{
+	Name: "addProviderDelegationData",
 	Fields: []forms.Field{
-		IDField,
-		ProviderIDField,
-		{
-			Name:        "slotID",
-			Description: "The ID of the slot to cancel.",
-			Validators: []forms.Validator{
-				ID,
-			},
-		},
 		TimestampField,
 		{
-			Name:        "signedTokenData",
-			Description: "Signed token data of the user.",
+			Name:        "signedDelegation",
+			Description: "Delegation certificate, signed with the signing key of the provider.",
 			Validators: []forms.Validator{
 				forms.IsStringMap{
-					Form: &SignedTokenDataForm,
+					Form: SignedKeyDataForm(&DelegationDataForm, "signedDelegationData"),
 				},
 			},
 		},
 	},
 }
 
-var CheckProviderDataForm = forms.Form{
-	Name:   "checkProviderData",
-	Fields: SignedDataFields(&CheckProviderDataDataForm),
+var GetProviderDelegationsForm = forms.Form{
+	Name:   "getProviderDelegations",
+	Fields: SignedDataFields(&GetProviderDelegationsDataForm),
 }
 
-var CheckProviderDataDataForm = forms.Form{
-	Name: "checkProviderDataData",
+var GetProviderDelegationsDataForm = forms.Form{
+	Name: "getProviderDelegationsData",
 	Fields: []forms.Field{
 		TimestampField,
 	},
 }
 
-var StoreProviderDataForm = forms.Form{
-	Name:   "storeProviderData",
-	Fields: SignedDataFields(&StoreProviderDataDataForm),
+var RevokeProviderDelegationForm = forms.Form{
+	Name:   "revokeProviderDelegation",
+	Fields: SignedDataFields(&RevokeProviderDelegationDataForm),
 }
 
-var ConfirmedProviderDataForm = forms.Form{
-	Name:   "confirmedProviderData",
-	Fields: SignedDataFields(&ECDHEncryptedDataForm),
+var RevokeProviderDelegationDataForm = forms.Form{
+	Name: "revokeProviderDelegationData",
+	Fields: []forms.Field{
+		TimestampField,
+		IDField,
+	},
 }
 
-var StoreProviderDataDataForm = forms.Form{
-	Name: "storeProviderDataData",
-	Fields: []forms.Field{
+var ProviderStatusDataFields = func(status string) []forms.Field {
+	return []forms.Field{
 		TimestampField,
+		IDField,
 		{
-			Name:        "code",
-			Description: "Optional signup code.",
+			Name:        "status",
+			Description: "The new status of the provider.",
 			Validators: []forms.Validator{
-				forms.IsOptional{},
-				forms.IsBytes{
-					Encoding:  "hex", // we encode this as hex since it gets passed in URLs
-					MinLength: 16,
-					MaxLength: 32,
-				},
+				forms.IsIn{Choices: []interface{}{status}},
 			},
 		},
 		{
-			Name:        "encryptedData",
-			Description: "Encrypted data for mediators to review.",
+			Name:        "reason",
+			Description: "The reason for the status change.",
 			Validators: []forms.Validator{
-				forms.IsStringMap{
-					Form: &ECDHEncryptedDataForm,
+				forms.IsString{
+					MinLength: 1,
+					MaxLength: 1000,
 				},
 			},
 		},
-	},
+	}
 }
 
-var GetPendingProviderDataForm = forms.Form{
-	Name:   "getPendingProviderData",
-	Fields: SignedDataFields(&GetPendingProviderDataDataForm),
+var SuspendProviderForm = forms.Form{
+	Name:   "suspendProvider",
+	Fields: SignedDataFields(&SuspendProviderDataForm),
 }
 
-var GetPendingProviderDataDataForm = forms.Form{
-	Name: "getPendingProviderDataData",
-	Fields: []forms.Field{
-		TimestampField,
-		{
-			Name:        "limit",
-			Description: "Number of entries to return at most.",
-			Validators: []forms.Validator{
-				forms.IsOptional{Default: 1000},
-				forms.IsInteger{
-					HasMin: true,
-					HasMax: true,
-					Min:    1,
-					Max:    10000,
-				},
-			},
-		},
-	},
+var SuspendProviderDataForm = forms.Form{
+	Name:   "suspendProviderData",
+	Fields: ProviderStatusDataFields("suspended"),
 }
 
-var GetVerifiedProviderDataForm = forms.Form{
-	Name:   "getVerifiedProviderData",
-	Fields: SignedDataFields(&GetVerifiedProviderDataDataForm),
+var ReactivateProviderForm = forms.Form{
+	Name:   "reactivateProvider",
+	Fields: SignedDataFields(&ReactivateProviderDataForm),
 }
 
-var GetVerifiedProviderDataDataForm = forms.Form{
-	Name: "getVerifiedProviderDataData",
-	Fields: []forms.Field{
-		TimestampField,
-		{
-			Name:        "limit",
-			Description: "Number of entries to return at most.",
-			Validators: []forms.Validator{
-				forms.IsOptional{Default: 1000},
-				forms.IsInteger{
-					HasMin: true,
-					HasMax: true,
-					Min:    1,
-					Max:    10000,
-				},
-			},
-		},
-	},
+var ReactivateProviderDataForm = forms.Form{
+	Name:   "reactivateProviderData",
+	Fields: ProviderStatusDataFields("active"),
+}
+
+var RevokeProviderForm = forms.Form{
+	Name:   "revokeProvider",
+	Fields: SignedDataFields(&RevokeProviderDataForm),
+}
+
+var RevokeProviderDataForm = forms.Form{
+	Name:   "revokeProviderData",
+	Fields: ProviderStatusDataFields("revoked"),
 }
 
 var GetStatsForm = forms.Form{
@@ -988,7 +2206,7 @@ var GetStatsForm = forms.Form{
 			Name:        "id",
 			Description: "ID of the statistics to return.",
 			Validators: []forms.Validator{
-				forms.IsIn{Choices: []interface{}{"queues", "tokens"}},
+				forms.IsIn{Choices: []interface{}{"queues", "tokens", "verification"}},
 			},
 		},
 		{
@@ -1050,3 +2268,75 @@ var GetStatsForm = forms.Form{
 	Transforms: []forms.Transform{},
 	Validator:  UsageValidator,
 }
+
+var GetProviderStatsForm = forms.Form{
+	Name:   "getProviderStats",
+	Fields: SignedDataFields(&GetProviderStatsDataForm),
+}
+
+var GetProviderStatsDataForm = forms.Form{
+	Name: "getProviderStatsData",
+	Fields: []forms.Field{
+		TimestampField,
+		{
+			Name:        "type",
+			Description: "Time window type of the statistics to return.",
+			Validators: []forms.Validator{
+				forms.IsIn{Choices: []interface{}{"minute", "hour", "day", "quarterHour", "week", "month"}},
+			},
+		},
+		{
+			Name:        "metric",
+			Description: "Optional sub-metric to return.",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: ""},
+				forms.IsIn{Choices: []interface{}{"", "open", "booked", "cancelled", "noShows"}},
+			},
+		},
+		{
+			Name:        "from",
+			Description: "Earliest date for which to return statistics. Only applicable if 'n' is not set.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsTime{Format: "rfc3339", ToUTC: true},
+			},
+		},
+		{
+			Name:        "to",
+			Description: "Latest date for which to return statistics. Only applicable if 'n' is not set.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsTime{Format: "rfc3339", ToUTC: true},
+			},
+		},
+		{
+			Name:        "n",
+			Description: "Maximum number of statistics values to return.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsInteger{HasMin: true, Min: 1, HasMax: true, Max: 500, Convert: true},
+			},
+		},
+	},
+	Validator: UsageValidator,
+}
+
+var MarkNoShowForm = forms.Form{
+	Name:   "markNoShow",
+	Fields: SignedDataFields(&MarkNoShowDataForm),
+}
+
+var MarkNoShowDataForm = forms.Form{
+	Name: "markNoShowData",
+	Fields: []forms.Field{
+		TimestampField,
+		IDField,
+		{
+			Name:        "slotID",
+			Description: "The ID of the slot that was not attended.",
+			Validators: []forms.Validator{
+				ID,
+			},
+		},
+	},
+}
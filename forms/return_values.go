@@ -28,6 +28,119 @@ var GetTokenRVV = []forms.Validator{
 	},
 }
 
+var GetCodeBatchesRVV = []forms.Validator{
+	forms.IsList{
+		Validators: []forms.Validator{
+			forms.IsStringMap{
+				Form: &CodeBatchForm,
+			},
+		},
+	},
+}
+
+var CodeBatchForm = forms.Form{
+	Name: "codeBatch",
+	Fields: []forms.Field{
+		IDField,
+		{
+			Name:        "actor",
+			Description: "The actor the codes of the batch belong to.",
+			Validators: []forms.Validator{
+				forms.IsIn{Choices: []interface{}{"provider", "user"}},
+			},
+		},
+		{
+			Name:        "label",
+			Description: "A human-readable label of the batch.",
+			Validators: []forms.Validator{
+				forms.IsString{},
+			},
+		},
+		{
+			Name:        "issuedBy",
+			Description: "The person or organization that issued the batch.",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: ""},
+				forms.IsString{},
+			},
+		},
+		{
+			Name:        "createdAt",
+			Description: "Time at which the batch was created.",
+			Validators: []forms.Validator{
+				forms.IsTime{
+					Format: "rfc3339",
+				},
+			},
+		},
+		{
+			Name:        "expiresAt",
+			Description: "Time after which codes of the batch cannot be used anymore.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsTime{
+					Format: "rfc3339",
+				},
+			},
+		},
+		{
+			Name:        "revokedAt",
+			Description: "Time at which the batch was revoked.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsTime{
+					Format: "rfc3339",
+				},
+			},
+		},
+		{
+			Name:        "revocationReason",
+			Description: "The reason for the revocation.",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: ""},
+				forms.IsString{},
+			},
+		},
+		{
+			Name:        "codes",
+			Description: "The number of codes in the batch.",
+			Validators: []forms.Validator{
+				forms.IsInteger{HasMin: true, Min: 0},
+			},
+		},
+		{
+			Name:        "redeemed",
+			Description: "The number of codes of the batch that were used at least once.",
+			Validators: []forms.Validator{
+				forms.IsInteger{HasMin: true, Min: 0},
+			},
+		},
+	},
+}
+
+var GetTokenChallengeRVV = []forms.Validator{
+	forms.IsStringMap{
+		Form: &SignedTokenChallengeForm,
+	},
+}
+
+var GetBlindTokenRVV = []forms.Validator{
+	forms.IsStringMap{
+		Form: &BlindTokenSignatureForm,
+	},
+}
+
+var BlindTokenSignatureForm = forms.Form{
+	Name: "blindTokenSignature",
+	Fields: []forms.Field{
+		{
+			Name:        "signature",
+			Description: "The blind signature of the blinded token data.",
+			Validators:  BlindSignatureValidators,
+		},
+	},
+}
+
 var GetAppointmentRVV = []forms.Validator{
 	forms.IsStringMap{
 		Form: &SignedAppointmentForm,
@@ -50,9 +163,106 @@ var GetProviderAppointmentsRVV = []forms.Validator{
 	},
 }
 
+var GetProviderAppointmentsCalendarRVV = []forms.Validator{
+	forms.IsString{},
+}
+
+var GetDeletedAppointmentsRVV = []forms.Validator{
+	forms.IsList{
+		Validators: []forms.Validator{
+			forms.IsStringMap{
+				Form: &AppointmentTombstoneForm,
+			},
+		},
+	},
+}
+
+var AppointmentsSyncForm = forms.Form{
+	Name: "appointmentsSync",
+	Fields: []forms.Field{
+		{
+			Name:        "seq",
+			Description: "The sequence number to pass in the next sync request.",
+			Validators: []forms.Validator{
+				forms.IsInteger{},
+			},
+		},
+		{
+			Name:        "more",
+			Description: "Whether there are more changes to fetch.",
+			Validators: []forms.Validator{
+				forms.IsBoolean{},
+			},
+		},
+		{
+			Name:        "upserts",
+			Description: "Appointments that have been created or modified.",
+			Validators: []forms.Validator{
+				forms.IsList{
+					Validators: []forms.Validator{
+						forms.IsStringMap{
+							Form: &SignedAppointmentForm,
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:        "deletions",
+			Description: "IDs of appointments that have been deleted.",
+			Validators: []forms.Validator{
+				forms.IsList{
+					Validators: []forms.Validator{
+						ID,
+					},
+				},
+			},
+		},
+	},
+}
+
+var SyncProviderAppointmentsRVV = []forms.Validator{
+	forms.IsStringMap{
+		Form: &AppointmentsSyncForm,
+	},
+}
+
 var CheckProviderDataRVV = []forms.Validator{
 	forms.IsStringMap{
-		Form: &ConfirmedProviderDataForm,
+		Form: &ProviderDataStatusForm,
+	},
+}
+
+var ProviderDataStatusForm = forms.Form{
+	Name: "providerDataStatus",
+	Fields: []forms.Field{
+		{
+			Name:        "status",
+			Description: "Status of the data most recently submitted by the provider.",
+			Validators: []forms.Validator{
+				forms.IsIn{Choices: []interface{}{"pending", "confirmed", "rejected"}},
+			},
+		},
+		{
+			Name:        "confirmedData",
+			Description: "Confirmed provider data, if the provider has been verified.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsStringMap{
+					Form: &ConfirmedProviderDataForm,
+				},
+			},
+		},
+		{
+			Name:        "rejection",
+			Description: "The rejection by a mediator, with the reason encrypted for the provider.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsStringMap{
+					Form: &RejectProviderForm,
+				},
+			},
+		},
 	},
 }
 
@@ -66,6 +276,413 @@ var GetProviderDataRVV = []forms.Validator{
 	},
 }
 
+var GetPendingProviderDataRVV = []forms.Validator{
+	forms.IsList{
+		Validators: []forms.Validator{
+			forms.IsStringMap{
+				Form: &PendingProviderDataForm,
+			},
+		},
+	},
+}
+
+var PendingProviderDataForm = forms.Form{
+	Name: "pendingProviderData",
+	Fields: append(RawProviderDataForm.Fields,
+		IDField,
+		forms.Field{
+			Name:        "submittedAt",
+			Description: "Time at which the provider data was submitted.",
+			Validators: []forms.Validator{
+				forms.IsTime{
+					Format: "rfc3339",
+				},
+			},
+		},
+		forms.Field{
+			Name:        "claim",
+			Description: "Active claim of a mediator on the provider data.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsStringMap{
+					Form: &VerificationClaimForm,
+				},
+			},
+		},
+		forms.Field{
+			Name:        "verifiedData",
+			Description: "For updates, the currently verified provider data.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsStringMap{
+					Form: &RawProviderDataForm,
+				},
+			},
+		},
+		forms.Field{
+			Name:        "metadataCheckRequired",
+			Description: "Set if the invitation is bound to provider metadata. Mediators must recompute the metadata hash from the decrypted data and not confirm the provider on a mismatch.",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: false},
+				forms.IsBoolean{},
+			},
+		},
+	),
+}
+
+var GetProviderDataVersionsRVV = []forms.Validator{
+	forms.IsStringMap{
+		Form: &ProviderDataHistoryForm,
+	},
+}
+
+var ProviderDataHistoryForm = forms.Form{
+	Name: "providerDataHistory",
+	Fields: []forms.Field{
+		{
+			Name:        "versions",
+			Description: "All verified versions of the provider data, the oldest first.",
+			Validators:  GetProviderDataRVV,
+		},
+		{
+			Name:        "rejections",
+			Description: "All rejected updates of the provider data.",
+			Validators: []forms.Validator{
+				forms.IsList{
+					Validators: []forms.Validator{
+						forms.IsStringMap{
+							Form: &RejectProviderDataUpdateForm,
+						},
+					},
+				},
+			},
+		},
+	},
+}
+
+var ClaimProviderDataRVV = []forms.Validator{
+	forms.IsStringMap{
+		Form: &VerificationClaimForm,
+	},
+}
+
+var VerificationClaimForm = forms.Form{
+	Name: "verificationClaim",
+	Fields: []forms.Field{
+		{
+			Name:        "mediatorID",
+			Description: "ID of the mediator key that claimed the provider data.",
+			Validators: []forms.Validator{
+				forms.IsBytes{
+					Encoding: "base64",
+				},
+			},
+		},
+		{
+			Name:        "claimedAt",
+			Description: "Time at which the provider data was claimed.",
+			Validators: []forms.Validator{
+				forms.IsTime{
+					Format: "rfc3339",
+				},
+			},
+		},
+		{
+			Name:        "expiresAt",
+			Description: "Time at which the claim expires.",
+			Validators: []forms.Validator{
+				forms.IsTime{
+					Format: "rfc3339",
+				},
+			},
+		},
+	},
+}
+
+var GetAuditLogRVV = []forms.Validator{
+	forms.IsList{
+		Validators: []forms.Validator{
+			forms.IsStringMap{
+				Form: &AuditLogEntryForm,
+			},
+		},
+	},
+}
+
+var AuditLogEntryForm = forms.Form{
+	Name: "auditLogEntry",
+	Fields: []forms.Field{
+		{
+			Name:        "index",
+			Description: "Position of the entry in the audit log, starting at 1.",
+			Validators: []forms.Validator{
+				forms.IsInteger{
+					HasMin: true,
+					Min:    1,
+				},
+			},
+		},
+		{
+			Name:        "timestamp",
+			Description: "Time at which the entry was recorded.",
+			Validators: []forms.Validator{
+				forms.IsTime{
+					Format: "rfc3339",
+				},
+			},
+		},
+		{
+			Name:        "method",
+			Description: "Name of the privileged method that was called.",
+			Validators: []forms.Validator{
+				forms.IsString{},
+			},
+		},
+		{
+			Name:        "data",
+			Description: "The signed request payload.",
+			Validators: []forms.Validator{
+				forms.IsString{},
+			},
+		},
+		{
+			Name:        "signature",
+			Description: "Signature of the request payload.",
+			Validators: []forms.Validator{
+				forms.IsBytes{
+					Encoding: "base64",
+				},
+			},
+		},
+		{
+			Name:        "publicKey",
+			Description: "Public key of the actor that signed the request.",
+			Validators: []forms.Validator{
+				forms.IsBytes{
+					Encoding: "base64",
+				},
+			},
+		},
+		{
+			Name:        "prevHash",
+			Description: "Hash of the previous entry (empty for the first entry).",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsBytes{
+					Encoding: "base64",
+				},
+			},
+		},
+		{
+			Name:        "hash",
+			Description: "Hash of the entry, including the hash of the previous entry.",
+			Validators: []forms.Validator{
+				forms.IsBytes{
+					Encoding: "base64",
+				},
+			},
+		},
+	},
+}
+
+var MerkleHashValidators = []forms.Validator{
+	forms.IsBytes{
+		Encoding:  "base64",
+		MinLength: 32,
+		MaxLength: 32,
+	},
+}
+
+var MerkleProofValidators = []forms.Validator{
+	forms.IsList{
+		Validators: MerkleHashValidators,
+	},
+}
+
+var GetKeyLogHeadRVV = []forms.Validator{
+	forms.IsStringMap{
+		Form: &SignedTreeHeadForm,
+	},
+}
+
+var GetKeyLogEntriesRVV = []forms.Validator{
+	forms.IsList{
+		Validators: []forms.Validator{
+			forms.IsStringMap{
+				Form: &KeyLogEntryForm,
+			},
+		},
+	},
+}
+
+var GetKeyLogInclusionProofRVV = []forms.Validator{
+	forms.IsStringMap{
+		Form: &KeyLogInclusionProofForm,
+	},
+}
+
+var GetKeyLogConsistencyProofRVV = []forms.Validator{
+	forms.IsStringMap{
+		Form: &KeyLogConsistencyProofForm,
+	},
+}
+
+var SignedTreeHeadForm = forms.Form{
+	Name: "signedTreeHead",
+	Fields: []forms.Field{
+		{
+			Name:        "data",
+			Description: "The JSON-encoded tree head.",
+			Validators: []forms.Validator{
+				forms.IsString{},
+				JSON{
+					Key: "json",
+				},
+				forms.IsStringMap{
+					Form: &TreeHeadForm,
+				},
+			},
+		},
+		{
+			Name:        "signature",
+			Description: "Signature of the tree head.",
+			Validators: []forms.Validator{
+				forms.IsBytes{
+					Encoding: "base64",
+				},
+			},
+		},
+		{
+			Name:        "publicKey",
+			Description: "Public key of the key log.",
+			Validators: []forms.Validator{
+				forms.IsBytes{
+					Encoding: "base64",
+				},
+			},
+		},
+	},
+}
+
+var TreeHeadForm = forms.Form{
+	Name: "treeHead",
+	Fields: []forms.Field{
+		{
+			Name:        "treeSize",
+			Description: "Number of entries in the key log.",
+			Validators: []forms.Validator{
+				forms.IsInteger{
+					HasMin: true,
+					Min:    0,
+				},
+			},
+		},
+		{
+			Name:        "rootHash",
+			Description: "Root hash of the Merkle tree of all entries.",
+			Validators:  MerkleHashValidators,
+		},
+		{
+			Name:        "timestamp",
+			Description: "Time at which the tree head was signed.",
+			Validators: []forms.Validator{
+				forms.IsTime{
+					Format: "rfc3339",
+				},
+			},
+		},
+	},
+}
+
+var KeyLogEntryForm = forms.Form{
+	Name: "keyLogEntry",
+	Fields: []forms.Field{
+		{
+			Name:        "index",
+			Description: "Position of the entry in the key log, starting at 0.",
+			Validators: []forms.Validator{
+				forms.IsInteger{
+					HasMin: true,
+					Min:    0,
+				},
+			},
+		},
+		{
+			Name:        "data",
+			Description: "The JSON-encoded key event.",
+			Validators: []forms.Validator{
+				forms.IsString{},
+			},
+		},
+		{
+			Name:        "leafHash",
+			Description: "Merkle leaf hash of the key event.",
+			Validators:  MerkleHashValidators,
+		},
+	},
+}
+
+var KeyLogInclusionProofForm = forms.Form{
+	Name: "keyLogInclusionProof",
+	Fields: []forms.Field{
+		{
+			Name:        "entry",
+			Description: "The entry whose inclusion is proven.",
+			Validators: []forms.Validator{
+				forms.IsStringMap{
+					Form: &KeyLogEntryForm,
+				},
+			},
+		},
+		{
+			Name:        "treeSize",
+			Description: "Size of the tree the entry is included in.",
+			Validators: []forms.Validator{
+				forms.IsInteger{
+					HasMin: true,
+					Min:    1,
+				},
+			},
+		},
+		{
+			Name:        "auditPath",
+			Description: "Hashes needed to compute the root hash from the leaf hash.",
+			Validators:  MerkleProofValidators,
+		},
+	},
+}
+
+var KeyLogConsistencyProofForm = forms.Form{
+	Name: "keyLogConsistencyProof",
+	Fields: []forms.Field{
+		{
+			Name:        "first",
+			Description: "Size of the earlier tree.",
+			Validators: []forms.Validator{
+				forms.IsInteger{
+					HasMin: true,
+					Min:    0,
+				},
+			},
+		},
+		{
+			Name:        "second",
+			Description: "Size of the later tree.",
+			Validators: []forms.Validator{
+				forms.IsInteger{
+					HasMin: true,
+					Min:    0,
+				},
+			},
+		},
+		{
+			Name:        "proof",
+			Description: "Hashes needed to show that the earlier tree is a prefix of the later one.",
+			Validators:  MerkleProofValidators,
+		},
+	},
+}
+
 var StatsValueForm = forms.Form{
 	Name: "statsValue",
 	Fields: []forms.Field{
@@ -144,6 +761,28 @@ var KeysForm = forms.Form{
 			Description: "Public token key.",
 			Validators:  PublicKeyValidators,
 		},
+		{
+			Name:        "blindTokenKey",
+			Description: "Public RSA key for blind tokens (only present if blind tokens are enabled).",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsBytes{
+					Encoding:  "base64",
+					MinLength: 128,
+					MaxLength: 1024,
+				},
+			},
+		},
+		{
+			Name:        "logKey",
+			Description: "Public key that signs the heads of the key log (only present if the key log is enabled).",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsBytes{
+					Encoding: "base64",
+				},
+			},
+		},
 	},
 }
 
@@ -164,10 +803,111 @@ var GetAppointmentsByZipCodeRVV = []forms.Validator{
 }
 
 var ActorKeyForm = forms.Form{
-	Name:   "actorKey",
+	Name: "actorKey",
+	Fields: append(SignedDataFields(nil), forms.Field{
+		Name:        "approvals",
+		Description: "Signatures of all mediators that approved the key data.",
+		Validators: []forms.Validator{
+			forms.IsOptional{},
+			forms.IsList{
+				Validators: []forms.Validator{
+					forms.IsStringMap{
+						Form: &KeyApprovalForm,
+					},
+				},
+			},
+		},
+	}, forms.Field{
+		Name:        "predecessor",
+		Description: "The key that signed the key data after a key rotation.",
+		Validators: []forms.Validator{
+			forms.IsOptional{},
+			forms.IsStringMap{
+				Form: &PredecessorKeyForm,
+			},
+		},
+	}),
+}
+
+// predecessor keys are actor keys themselves, we do not validate them
+// recursively as a form cannot refer to itself
+var PredecessorKeyForm = forms.Form{
+	Name:   "predecessorKey",
 	Fields: SignedDataFields(nil),
 }
 
+var KeyApprovalForm = forms.Form{
+	Name: "keyApproval",
+	Fields: []forms.Field{
+		SignatureField,
+		PublicKeyField,
+	},
+}
+
+var PendingProviderApprovalForm = forms.Form{
+	Name: "pendingProviderApproval",
+	Fields: []forms.Field{
+		IDField,
+		{
+			Name:        "data",
+			Description: "The provider key data to approve.",
+			Validators: []forms.Validator{
+				forms.IsString{},
+			},
+		},
+		{
+			Name:        "approvals",
+			Description: "Signatures of the mediators that already approved the key data.",
+			Validators: []forms.Validator{
+				forms.IsList{
+					Validators: []forms.Validator{
+						forms.IsStringMap{
+							Form: &KeyApprovalForm,
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:        "required",
+			Description: "Number of approvals required.",
+			Validators: []forms.Validator{
+				forms.IsInteger{},
+			},
+		},
+	},
+}
+
+var GetPendingProviderApprovalsRVV = []forms.Validator{
+	forms.IsList{
+		Validators: []forms.Validator{
+			forms.IsStringMap{
+				Form: &PendingProviderApprovalForm,
+			},
+		},
+	},
+}
+
+var GetProviderKeysRVV = []forms.Validator{
+	forms.IsList{
+		Validators: []forms.Validator{
+			forms.IsStringMap{
+				Form: &ActorKeyForm,
+			},
+		},
+	},
+}
+
+var GetProviderDelegationsRVV = []forms.Validator{
+	forms.IsList{
+		Validators: []forms.Validator{
+			forms.IsStringMap{
+				Form: SignedKeyDataForm(&DelegationDataForm, "signedDelegationData"),
+			},
+		},
+	},
+}
+
 var KeyChainForm = forms.Form{
 	Name: "keyChain",
 	Fields: []forms.Field{
@@ -189,6 +929,34 @@ var KeyChainForm = forms.Form{
 				},
 			},
 		},
+		{
+			Name:        "mediators",
+			Description: "Public key data of all mediators that approved the provider.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsList{
+					Validators: []forms.Validator{
+						forms.IsStringMap{
+							Form: &ActorKeyForm,
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:        "delegations",
+			Description: "Delegation certificates (signed by the provider) of the delegate keys that signed some of the appointments.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsList{
+					Validators: []forms.Validator{
+						forms.IsStringMap{
+							Form: SignedKeyDataForm(&DelegationDataForm, "signedDelegationData"),
+						},
+					},
+				},
+			},
+		},
 	},
 }
 
@@ -227,6 +227,30 @@ var StorageForm = forms.Form{
 				},
 			},
 		},
+		{
+			Name: "signature_validity_seconds",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 60},
+				forms.IsInteger{
+					HasMin: true,
+					Min:    1,
+					HasMax: true,
+					Max:    3600,
+				},
+			},
+		},
+		{
+			Name: "clock_skew_seconds",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 5},
+				forms.IsInteger{
+					HasMin: true,
+					Min:    0,
+					HasMax: true,
+					Max:    300,
+				},
+			},
+		},
 		// how long we want to store settings
 		{
 			Name: "settings_ttl_days",
@@ -254,13 +278,132 @@ var ECDSAParamsForm = forms.Form{
 	},
 }
 
+var SignerForm = forms.Form{
+	Name: "signer",
+	Fields: []forms.Field{
+		{
+			Name: "type",
+			Validators: []forms.Validator{
+				forms.IsIn{Choices: []interface{}{"file", "agent", "pkcs11"}}, // pkcs11 requires the 'pkcs11' build tag
+			},
+		},
+		{
+			Name: "settings",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: map[string]interface{}{}},
+				forms.Switch{
+					Key: "type",
+					Cases: map[string][]forms.Validator{
+						"file": []forms.Validator{
+							forms.IsStringMap{
+								Form: &FileSignerSettingsForm,
+							},
+						},
+						"agent": []forms.Validator{
+							forms.IsStringMap{
+								Form: &AgentSignerSettingsForm,
+							},
+						},
+						"pkcs11": []forms.Validator{
+							forms.IsStringMap{
+								Form: &PKCS11SignerSettingsForm,
+							},
+						},
+					},
+				},
+			},
+		},
+	},
+}
+
+var FileSignerSettingsForm = forms.Form{
+	Name: "fileSignerSettings",
+	Fields: []forms.Field{
+		{
+			Name: "path",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsString{},
+			},
+		},
+	},
+}
+
+var AgentSignerSettingsForm = forms.Form{
+	Name: "agentSignerSettings",
+	Fields: []forms.Field{
+		{
+			Name: "socket",
+			Validators: []forms.Validator{
+				forms.IsString{},
+			},
+		},
+		{
+			Name: "key",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsString{},
+			},
+		},
+		{
+			Name: "timeout_seconds",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 5},
+				forms.IsInteger{
+					HasMin: true,
+					Min:    1,
+				},
+			},
+		},
+	},
+}
+
+var PKCS11SignerSettingsForm = forms.Form{
+	Name: "pkcs11SignerSettings",
+	Fields: []forms.Field{
+		{
+			Name: "library",
+			Validators: []forms.Validator{
+				forms.IsString{},
+			},
+		},
+		{
+			Name: "token_label",
+			Validators: []forms.Validator{
+				forms.IsString{},
+			},
+		},
+		{
+			Name: "pin",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsString{},
+			},
+		},
+		{
+			Name: "pin_env",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsString{},
+			},
+		},
+		{
+			Name: "key_label",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsString{},
+			},
+		},
+	},
+}
+
 var KeyForm = forms.Form{
 	Name: "key",
 	Fields: []forms.Field{
 		{
 			Name: "type",
 			Validators: []forms.Validator{
-				forms.IsIn{Choices: []interface{}{"ecdsa", "ecdh"}}, // we only support ECDSA & ECDH for now
+				forms.IsIn{Choices: []interface{}{"ecdsa", "ecdh", "ed25519", "x25519", "rsa"}}, // we support ECDSA & ECDH on P-256, Ed25519 & X25519 (and RSA for blind tokens)
 			},
 		},
 		{
@@ -303,6 +446,15 @@ var KeyForm = forms.Form{
 				},
 			},
 		},
+		{
+			Name: "signer",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsStringMap{
+					Form: &SignerForm,
+				},
+			},
+		},
 		{
 			Name: "params",
 			Validators: []forms.Validator{
@@ -397,6 +549,145 @@ var AppointmentsForm = forms.Form{
 				},
 			},
 		},
+		{
+			Name: "provider_approvals_required",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 1},
+				forms.IsInteger{
+					HasMin: true,
+					Min:    1,
+					HasMax: true,
+					Max:    100,
+				},
+			},
+		},
+		{
+			Name: "signature_validity_seconds",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 60},
+				forms.IsInteger{
+					HasMin: true,
+					Min:    1,
+					HasMax: true,
+					Max:    3600,
+				},
+			},
+		},
+		{
+			Name: "clock_skew_seconds",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 5},
+				forms.IsInteger{
+					HasMin: true,
+					Min:    0,
+					HasMax: true,
+					Max:    300,
+				},
+			},
+		},
+		{
+			Name: "token_validity_days",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 30},
+				forms.IsInteger{
+					HasMin: true,
+					Min:    1,
+					HasMax: true,
+					Max:    365,
+				},
+			},
+		},
+		{
+			Name: "token_issuance_limit",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 3},
+				forms.IsInteger{
+					HasMin: true,
+					Min:    0,
+					HasMax: true,
+					Max:    1000,
+				},
+			},
+		},
+		{
+			Name: "token_issuance_window_hours",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 24},
+				forms.IsInteger{
+					HasMin: true,
+					Min:    1,
+					HasMax: true,
+					Max:    720,
+				},
+			},
+		},
+		{
+			Name: "token_challenge_enabled",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: false},
+				forms.IsBoolean{},
+			},
+		},
+		{
+			// minimum number of leading zero bits of a solution
+			Name: "token_challenge_difficulty",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 16},
+				forms.IsInteger{
+					HasMin: true,
+					Min:    1,
+					HasMax: true,
+					Max:    32,
+				},
+			},
+		},
+		{
+			Name: "token_challenge_max_difficulty",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 24},
+				forms.IsInteger{
+					HasMin: true,
+					Min:    1,
+					HasMax: true,
+					Max:    32,
+				},
+			},
+		},
+		{
+			// tokens issued per minute above which the difficulty increases
+			Name: "token_challenge_rate",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 60},
+				forms.IsInteger{
+					HasMin: true,
+					Min:    1,
+				},
+			},
+		},
+		{
+			Name: "token_challenge_validity_seconds",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 120},
+				forms.IsInteger{
+					HasMin: true,
+					Min:    10,
+					HasMax: true,
+					Max:    3600,
+				},
+			},
+		},
+		{
+			Name: "provider_claim_lease_minutes",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 30},
+				forms.IsInteger{
+					HasMin: true,
+					Min:    1,
+					HasMax: true,
+					Max:    1440,
+				},
+			},
+		},
 		{
 			Name: "response_max_appointment",
 			Validators: []forms.Validator{
@@ -6,6 +6,7 @@ require (
 	github.com/bsm/redislock v0.7.1
 	github.com/go-redis/redis/v8 v8.11.4
 	github.com/kiprotect/go-helpers v0.0.0-20211210144244-79ce90e73e79
+	github.com/miekg/pkcs11 v1.1.1
 	github.com/prometheus/client_golang v1.11.0
 	github.com/sirupsen/logrus v1.8.1
 	github.com/urfave/cli v1.22.5
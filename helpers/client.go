@@ -20,6 +20,7 @@ package helpers
 
 import (
 	"bytes"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"github.com/kiebitz-oss/services"
@@ -199,6 +200,22 @@ func (a *AppointmentsClient) GetKeys() (*Response, error) {
 	return a.requester("getKeys", nil, nil)
 }
 
+func (a *AppointmentsClient) GetKeyLogHead() (*Response, error) {
+	return a.requester("getKeyLogHead", nil, nil)
+}
+
+func (a *AppointmentsClient) GetKeyLogEntries(params *services.GetKeyLogEntriesParams) (*Response, error) {
+	return a.requester("getKeyLogEntries", params, nil)
+}
+
+func (a *AppointmentsClient) GetKeyLogInclusionProof(params *services.GetKeyLogInclusionProofParams) (*Response, error) {
+	return a.requester("getKeyLogInclusionProof", params, nil)
+}
+
+func (a *AppointmentsClient) GetKeyLogConsistencyProof(params *services.GetKeyLogConsistencyProofParams) (*Response, error) {
+	return a.requester("getKeyLogConsistencyProof", params, nil)
+}
+
 func (a *AppointmentsClient) ResetDB() (*Response, error) {
 	signingKey := a.settings.Admin.Signing.Key("root")
 
@@ -215,17 +232,19 @@ func (a *AppointmentsClient) ResetDB() (*Response, error) {
 }
 
 func (a *AppointmentsClient) AddMediatorPublicKeys(mediator *crypto.Actor) (*Response, error) {
+	return a.AddMediatorKeyData(&services.MediatorKeyData{
+		Signing:    mediator.SigningKey.PublicKey,
+		Encryption: mediator.EncryptionKey.PublicKey,
+	})
+}
+
+func (a *AppointmentsClient) AddMediatorKeyData(keyData *services.MediatorKeyData) (*Response, error) {
 	rootKey := a.settings.Admin.Signing.Key("root")
 
 	if rootKey == nil {
 		return nil, fmt.Errorf("root key missing")
 	}
 
-	keyData := &services.MediatorKeyData{
-		Signing:    mediator.SigningKey.PublicKey,
-		Encryption: mediator.EncryptionKey.PublicKey,
-	}
-
 	signedKeyData, err := keyData.Sign(rootKey)
 
 	if err != nil {
@@ -241,6 +260,93 @@ func (a *AppointmentsClient) AddMediatorPublicKeys(mediator *crypto.Actor) (*Res
 
 }
 
+func (a *AppointmentsClient) GetAuditLog(params *services.GetAuditLogParams) (*Response, error) {
+
+	rootKey := a.settings.Admin.Signing.Key("root")
+
+	if rootKey == nil {
+		return nil, fmt.Errorf("root key missing")
+	}
+
+	return a.requester("getAuditLog", params, rootKey)
+}
+
+func (a *AppointmentsClient) RevokeMediatorKey(params *services.RevokeMediatorKeyParams) (*Response, error) {
+	rootKey := a.settings.Admin.Signing.Key("root")
+
+	if rootKey == nil {
+		return nil, fmt.Errorf("root key missing")
+	}
+
+	return a.requester("revokeMediatorKey", params, rootKey)
+}
+
+func (a *AppointmentsClient) GetProviderKeys(params *services.GetProviderKeysParams, mediator *crypto.Actor) (*Response, error) {
+	return a.requester("getProviderKeys", params, mediator.SigningKey)
+}
+
+// RotateMediatorKey re-signs all provider keys confirmed by the predecessor
+// of the given mediator key
+func (a *AppointmentsClient) RotateMediatorKey(mediator *crypto.Actor) (*Response, error) {
+
+	resp, err := a.GetProviderKeys(&services.GetProviderKeysParams{
+		Timestamp: time.Now(),
+	}, mediator)
+
+	if err != nil {
+		return nil, err
+	} else if resp.StatusCode != 200 {
+		return resp, nil
+	}
+
+	result, err := resp.JSON()
+
+	if err != nil {
+		return nil, err
+	}
+
+	list, ok := result["result"].([]interface{})
+
+	if !ok {
+		return nil, fmt.Errorf("expected a list of provider keys")
+	}
+
+	signatures := make([]*services.ProviderKeySignature, 0, len(list))
+
+	for _, item := range list {
+
+		providerKey := &services.ActorKey{}
+
+		if data, err := json.Marshal(item); err != nil {
+			return nil, err
+		} else if err := json.Unmarshal(data, providerKey); err != nil {
+			return nil, err
+		}
+
+		// only the original key of a provider is signed by a mediator
+		originKey := providerKey.Origin()
+
+		// keys that have already been signed by this key can be skipped
+		if bytes.Equal(originKey.PublicKey, mediator.SigningKey.PublicKey) {
+			continue
+		}
+
+		if signedData, err := mediator.SigningKey.Sign([]byte(originKey.Data)); err != nil {
+			return nil, err
+		} else {
+			signatures = append(signatures, &services.ProviderKeySignature{
+				ID:        providerKey.ID,
+				Signature: signedData.Signature,
+			})
+		}
+	}
+
+	return a.requester("rotateMediatorKey", &services.RotateMediatorKeyParams{
+		Timestamp:  time.Now(),
+		Signatures: signatures,
+	}, mediator.SigningKey)
+}
+
 type Provider struct {
 	Actor      *crypto.Actor
 	DataKey    *crypto.Key
@@ -250,6 +356,19 @@ type Provider struct {
 
 func (a *AppointmentsClient) ConfirmProvider(provider *Provider, mediator *crypto.Actor) (*Response, error) {
 
+	var metadataHash []byte
+
+	if provider.PublicData != nil {
+		metadataHash = services.ProviderMetadataHash(provider.PublicData.Name, provider.PublicData.ZipCode)
+	}
+
+	return a.ConfirmProviderWithMetadataHash(provider, mediator, metadataHash)
+}
+
+// ConfirmProviderWithMetadataHash confirms the provider, attesting the given
+// hash of the provider metadata
+func (a *AppointmentsClient) ConfirmProviderWithMetadataHash(provider *Provider, mediator *crypto.Actor, metadataHash []byte) (*Response, error) {
+
 	keyData := &services.ProviderKeyData{
 		Signing:    provider.Actor.SigningKey.PublicKey,
 		Encryption: provider.Actor.EncryptionKey.PublicKey,
@@ -264,7 +383,7 @@ func (a *AppointmentsClient) ConfirmProvider(provider *Provider, mediator *crypt
 
 	providerData := []byte("test")
 
-	ephemeralKey, err := crypto.GenerateWebKey("ephemeral-mediator", "ecdh")
+	ephemeralKey, err := crypto.GenerateWebKey("ephemeral-mediator", provider.Actor.EncryptionKey.Type)
 
 	if err != nil {
 		return nil, err
@@ -298,13 +417,89 @@ func (a *AppointmentsClient) ConfirmProvider(provider *Provider, mediator *crypt
 			Data:      confirmedProviderData,
 		},
 		SignedKeyData: signedKeyData,
+		MetadataHash:  metadataHash,
 	}
 
 	return a.requester("confirmProvider", params, mediator.SigningKey)
 }
 
-func (a *AppointmentsClient) AddCodes(params *services.AddCodesParams) (*Response, error) {
-	return nil, nil
+func (a *AppointmentsClient) GetPendingProviderApprovals(params *services.GetPendingProviderApprovalsParams, mediator *crypto.Actor) (*Response, error) {
+	return a.requester("getPendingProviderApprovals", params, mediator.SigningKey)
+}
+
+// ReplaceProviderKey replaces the key of the provider with the given ID with
+// the current key of the given provider
+func (a *AppointmentsClient) ReplaceProviderKey(id []byte, provider *Provider, mediator *crypto.Actor) (*Response, error) {
+
+	keyData := &services.ProviderKeyData{
+		Signing:    provider.Actor.SigningKey.PublicKey,
+		Encryption: provider.Actor.EncryptionKey.PublicKey,
+		QueueData:  provider.QueueData,
+	}
+
+	signedKeyData, err := keyData.Sign(mediator.SigningKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return a.requester("replaceProviderKey", &services.ReplaceProviderKeyParams{
+		Timestamp:     time.Now(),
+		ID:            id,
+		SignedKeyData: signedKeyData,
+	}, mediator.SigningKey)
+}
+
+func (a *AppointmentsClient) SuspendProvider(params *services.ProviderStatusParams, mediator *crypto.Actor) (*Response, error) {
+	return a.requester("suspendProvider", params, mediator.SigningKey)
+}
+
+func (a *AppointmentsClient) ReactivateProvider(params *services.ProviderStatusParams, mediator *crypto.Actor) (*Response, error) {
+	return a.requester("reactivateProvider", params, mediator.SigningKey)
+}
+
+func (a *AppointmentsClient) RevokeProvider(params *services.ProviderStatusParams, mediator *crypto.Actor) (*Response, error) {
+	return a.requester("revokeProvider", params, mediator.SigningKey)
+}
+
+// codes are hex-encoded, so params should not be a services.CodesData
+func (a *AppointmentsClient) AddCodes(params interface{}) (*Response, error) {
+
+	rootKey := a.settings.Admin.Signing.Key("root")
+
+	if rootKey == nil {
+		return nil, fmt.Errorf("root key missing")
+	}
+
+	return a.requester("addCodes", params, rootKey)
+}
+
+// invitations can be issued by root or by mediators, the code in the params
+// needs to be hex-encoded
+func (a *AppointmentsClient) IssueInvitation(params interface{}, key *crypto.Key) (*Response, error) {
+	return a.requester("issueInvitation", params, key)
+}
+
+func (a *AppointmentsClient) RevokeCodeBatch(params *services.RevokeCodeBatchParams) (*Response, error) {
+
+	rootKey := a.settings.Admin.Signing.Key("root")
+
+	if rootKey == nil {
+		return nil, fmt.Errorf("root key missing")
+	}
+
+	return a.requester("revokeCodeBatch", params, rootKey)
+}
+
+func (a *AppointmentsClient) GetCodeBatches(params *services.GetCodeBatchesParams) (*Response, error) {
+
+	rootKey := a.settings.Admin.Signing.Key("root")
+
+	if rootKey == nil {
+		return nil, fmt.Errorf("root key missing")
+	}
+
+	return a.requester("getCodeBatches", params, rootKey)
 }
 
 func (a *AppointmentsClient) UploadDistances(params *services.UploadDistancesParams) (*Response, error) {
@@ -319,14 +514,97 @@ func (a *AppointmentsClient) GetAppointmentsByZipCode(params *services.GetAppoin
 	return a.requester("getAppointmentsByZipCode", params, nil)
 }
 
-func (a *AppointmentsClient) GetProviderAppointments(params *services.GetProviderAppointmentsParams) (*Response, error) {
-	return nil, nil
+func (a *AppointmentsClient) GetProviderAppointments(params *services.GetProviderAppointmentsParams, provider *Provider) (*Response, error) {
+	return a.requester("getProviderAppointments", params, provider.Actor.SigningKey)
+}
+
+func (a *AppointmentsClient) GetProviderAppointmentsCalendar(params *services.GetProviderAppointmentsParams, provider *Provider) (*Response, error) {
+	return a.requester("getProviderAppointmentsCalendar", params, provider.Actor.SigningKey)
 }
 
 func (a *AppointmentsClient) PublishAppointments(params *services.PublishAppointmentsParams, provider *Provider) (*Response, error) {
 	return a.requester("publishAppointments", params, provider.Actor.SigningKey)
 }
 
+func (a *AppointmentsClient) DeleteAppointments(params *services.DeleteAppointmentsParams, provider *Provider) (*Response, error) {
+	return a.requester("deleteAppointments", params, provider.Actor.SigningKey)
+}
+
+func (a *AppointmentsClient) GetDeletedAppointments(params *services.GetDeletedAppointmentsParams, provider *Provider) (*Response, error) {
+	return a.requester("getDeletedAppointments", params, provider.Actor.SigningKey)
+}
+
+func (a *AppointmentsClient) SyncProviderAppointments(params *services.SyncProviderAppointmentsParams, provider *Provider) (*Response, error) {
+	return a.requester("syncProviderAppointments", params, provider.Actor.SigningKey)
+}
+
+func (a *AppointmentsClient) GetProviderStats(params *services.GetProviderStatsParams, provider *Provider) (*Response, error) {
+	return a.requester("getProviderStats", params, provider.Actor.SigningKey)
+}
+
+func (a *AppointmentsClient) MarkNoShow(params *services.MarkNoShowParams, provider *Provider) (*Response, error) {
+	return a.requester("markNoShow", params, provider.Actor.SigningKey)
+}
+
+// RotateProviderKey replaces the key of the provider with the given actor,
+// which the provider uses from then on if the rotation succeeds
+func (a *AppointmentsClient) RotateProviderKey(provider *Provider, actor *crypto.Actor) (*Response, error) {
+
+	keyData := &services.ProviderKeyData{
+		Signing:    actor.SigningKey.PublicKey,
+		Encryption: actor.EncryptionKey.PublicKey,
+		QueueData:  provider.QueueData,
+	}
+
+	signedKeyData, err := keyData.Sign(provider.Actor.SigningKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	proof, err := actor.SigningKey.Sign([]byte(signedKeyData.JSON))
+
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := a.requester("rotateProviderKey", &services.RotateProviderKeyParams{
+		Timestamp:     time.Now(),
+		SignedKeyData: signedKeyData,
+		Proof:         proof.Signature,
+	}, provider.Actor.SigningKey)
+
+	if err == nil && resp.StatusCode == 200 {
+		provider.Actor = actor
+	}
+
+	return resp, err
+}
+
+// AddProviderDelegation signs the given delegation with the key of the
+// provider and adds it
+func (a *AppointmentsClient) AddProviderDelegation(delegation *services.DelegationData, provider *Provider) (*Response, error) {
+
+	signedDelegation, err := delegation.Sign(provider.Actor.SigningKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return a.requester("addProviderDelegation", &services.AddProviderDelegationParams{
+		Timestamp:        time.Now(),
+		SignedDelegation: signedDelegation,
+	}, provider.Actor.SigningKey)
+}
+
+func (a *AppointmentsClient) GetProviderDelegations(params *services.GetProviderDelegationsParams, provider *Provider) (*Response, error) {
+	return a.requester("getProviderDelegations", params, provider.Actor.SigningKey)
+}
+
+func (a *AppointmentsClient) RevokeProviderDelegation(params *services.RevokeProviderDelegationParams, provider *Provider) (*Response, error) {
+	return a.requester("revokeProviderDelegation", params, provider.Actor.SigningKey)
+}
+
 func (a *AppointmentsClient) BookAppointment(params interface{}) (*Response, error) {
 	return nil, nil
 }
@@ -336,7 +614,26 @@ func (a *AppointmentsClient) CancelAppointment(params interface{}) (*Response, e
 }
 
 func (a *AppointmentsClient) GetToken(params interface{}) (*Response, error) {
-	return nil, nil
+	return a.requester("getToken", params, nil)
+}
+
+func (a *AppointmentsClient) GetTokenChallenge() (*Response, error) {
+	return a.requester("getTokenChallenge", nil, nil)
+}
+
+func (a *AppointmentsClient) GetBlindToken(params *services.GetBlindTokenParams) (*Response, error) {
+	return a.requester("getBlindToken", params, nil)
+}
+
+func (a *AppointmentsClient) RevokeTokens(params *services.RevokeTokensParams) (*Response, error) {
+
+	rootKey := a.settings.Admin.Signing.Key("root")
+
+	if rootKey == nil {
+		return nil, fmt.Errorf("root key missing")
+	}
+
+	return a.requester("revokeTokens", params, rootKey)
 }
 
 type ConfirmProviderData struct {
@@ -350,6 +647,12 @@ type PublicKeys struct {
 }
 
 func (a *AppointmentsClient) StoreProviderData(provider *Provider) (*Response, error) {
+	return a.StoreProviderDataWithCode(provider, nil, nil)
+}
+
+// stores the provider data using the given (provider or invitation) code and
+// the hash of the provider metadata, which are both optional
+func (a *AppointmentsClient) StoreProviderDataWithCode(provider *Provider, code, metadataHash []byte) (*Response, error) {
 
 	dataKey := a.settings.Appointments.Key("provider")
 
@@ -379,10 +682,23 @@ func (a *AppointmentsClient) StoreProviderData(provider *Provider) (*Response, e
 	}
 
 	encryptedProviderData, err := provider.DataKey.Encrypt(data, dataKey)
-	storeProviderDataParams := &services.StoreProviderDataParams{
-		Timestamp:     time.Now(),
-		EncryptedData: encryptedProviderData,
-		Code:          nil,
+
+	if err != nil {
+		return nil, err
+	}
+
+	// codes are hex-encoded, so we cannot use services.StoreProviderDataParams
+	storeProviderDataParams := map[string]interface{}{
+		"timestamp":     time.Now(),
+		"encryptedData": encryptedProviderData,
+	}
+
+	if code != nil {
+		storeProviderDataParams["code"] = hex.EncodeToString(code)
+	}
+
+	if metadataHash != nil {
+		storeProviderDataParams["metadataHash"] = metadataHash
 	}
 
 	return a.requester("storeProviderData", storeProviderDataParams, provider.Actor.SigningKey)
@@ -396,8 +712,49 @@ func (a *AppointmentsClient) CheckProviderData(provider *Provider) (*Response, e
 	return a.requester("checkProviderData", params, provider.Actor.SigningKey)
 }
 
-func (a *AppointmentsClient) GetPendingProviderData(params interface{}) (*Response, error) {
-	return nil, nil
+func (a *AppointmentsClient) GetPendingProviderData(params *services.GetPendingProviderDataParams, mediator *crypto.Actor) (*Response, error) {
+	return a.requester("getPendingProviderData", params, mediator.SigningKey)
+}
+
+// RejectProvider rejects the data of the given provider, encrypting the reason
+// for the encryption key of the provider
+func (a *AppointmentsClient) RejectProvider(provider *Provider, reason string, mediator *crypto.Actor) (*Response, error) {
+
+	ephemeralKey, err := crypto.GenerateWebKey("ephemeral-mediator", provider.Actor.EncryptionKey.Type)
+
+	if err != nil {
+		return nil, err
+	}
+
+	encryptedReason, err := ephemeralKey.Encrypt([]byte(reason), provider.Actor.EncryptionKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	params := &services.RejectProviderParams{
+		Timestamp:       time.Now(),
+		ID:              crypto.Hash(provider.Actor.SigningKey.PublicKey),
+		EncryptedReason: encryptedReason,
+	}
+
+	return a.requester("rejectProvider", params, mediator.SigningKey)
+}
+
+func (a *AppointmentsClient) RejectProviderDataUpdate(params *services.RejectProviderDataUpdateParams, mediator *crypto.Actor) (*Response, error) {
+	return a.requester("rejectProviderDataUpdate", params, mediator.SigningKey)
+}
+
+func (a *AppointmentsClient) GetProviderDataVersions(params *services.GetProviderDataVersionsParams, mediator *crypto.Actor) (*Response, error) {
+	return a.requester("getProviderDataVersions", params, mediator.SigningKey)
+}
+
+func (a *AppointmentsClient) ClaimProviderData(params *services.ProviderDataClaimParams, mediator *crypto.Actor) (*Response, error) {
+	return a.requester("claimProviderData", params, mediator.SigningKey)
+}
+
+func (a *AppointmentsClient) ReleaseProviderData(params *services.ProviderDataClaimParams, mediator *crypto.Actor) (*Response, error) {
+	return a.requester("releaseProviderData", params, mediator.SigningKey)
 }
 
 func (a *AppointmentsClient) GetVerifiedProviderData(params interface{}) (*Response, error) {
@@ -0,0 +1,104 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package ical
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/kiebitz-oss/services"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BookingDescriber returns a textual description of a booking, e.g. based on
+// its decrypted data
+type BookingDescriber func(booking *services.Booking) (string, error)
+
+// MakeAppointmentsCalendar creates a calendar with one event per appointment.
+// If describe is given, the descriptions of all bookings will be added to the
+// event descriptions.
+func MakeAppointmentsCalendar(appointments []*services.SignedAppointment, describe BookingDescriber) (*Calendar, error) {
+
+	sortedAppointments := make([]*services.SignedAppointment, len(appointments))
+	copy(sortedAppointments, appointments)
+
+	sort.Slice(sortedAppointments, func(i, j int) bool {
+		return sortedAppointments[i].Data.Timestamp.Before(sortedAppointments[j].Data.Timestamp)
+	})
+
+	calendar := MakeCalendar()
+
+	for _, appointment := range sortedAppointments {
+
+		slots := len(appointment.Data.SlotData)
+		bookings := len(appointment.Bookings)
+
+		extra := map[string]string{
+			"kiebitz-slots":    fmt.Sprintf("%d", slots),
+			"kiebitz-bookings": fmt.Sprintf("%d", bookings),
+		}
+
+		description := []string{
+			fmt.Sprintf("Slots: %d", slots),
+			fmt.Sprintf("Bookings: %d", bookings),
+		}
+
+		// we sort the properties to produce a stable output
+		properties := make([]string, 0, len(appointment.Data.Properties))
+		for name := range appointment.Data.Properties {
+			properties = append(properties, name)
+		}
+		sort.Strings(properties)
+
+		for _, name := range properties {
+			value := fmt.Sprintf("%v", appointment.Data.Properties[name])
+			extra["kiebitz-"+name] = value
+			description = append(description, fmt.Sprintf("%s: %s", name, value))
+		}
+
+		if describe != nil {
+			for i, booking := range appointment.Bookings {
+				if bookingDescription, err := describe(booking); err != nil {
+					return nil, err
+				} else {
+					description = append(description, fmt.Sprintf("Booking %d: %s", i+1, bookingDescription))
+				}
+			}
+		}
+
+		stamp := appointment.UpdatedAt
+
+		if stamp.IsZero() {
+			stamp = time.Now()
+		}
+
+		calendar.Events = append(calendar.Events, &Event{
+			UID:         fmt.Sprintf("%s@kiebitz", hex.EncodeToString(appointment.Data.ID)),
+			Stamp:       stamp,
+			Start:       appointment.Data.Timestamp,
+			Duration:    time.Duration(appointment.Data.Duration) * time.Minute,
+			Summary:     fmt.Sprintf("Appointment (%d/%d slots booked)", bookings, slots),
+			Description: strings.Join(description, "\n"),
+			Extra:       extra,
+		})
+	}
+
+	return calendar, nil
+}
@@ -0,0 +1,451 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package ical implements a minimal subset of the iCalendar format (RFC 5545)
+// that is sufficient to exchange appointments with calendar tools.
+package ical
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	dateTimeFormat = "20060102T150405Z"
+	maxLineLength  = 75
+)
+
+var invalidNameChars = regexp.MustCompile(`[^A-Z0-9\-]`)
+
+type Calendar struct {
+	ProdID string
+	Events []*Event
+}
+
+type Event struct {
+	UID         string
+	Stamp       time.Time
+	Start       time.Time
+	Duration    time.Duration
+	Summary     string
+	Description string
+	// non-standard properties, names will be prefixed with 'X-'
+	Extra map[string]string
+}
+
+func MakeCalendar() *Calendar {
+	return &Calendar{
+		ProdID: "-//Kiebitz//Kiebitz Services//EN",
+		Events: make([]*Event, 0),
+	}
+}
+
+// Encode returns the calendar in iCalendar format
+func (c *Calendar) Encode() []byte {
+
+	w := &writer{}
+
+	w.line("BEGIN", "VCALENDAR")
+	w.line("VERSION", "2.0")
+	w.line("PRODID", c.ProdID)
+	w.line("CALSCALE", "GREGORIAN")
+
+	for _, event := range c.Events {
+		w.line("BEGIN", "VEVENT")
+		w.line("UID", escape(event.UID))
+		w.line("DTSTAMP", event.Stamp.UTC().Format(dateTimeFormat))
+		w.line("DTSTART", event.Start.UTC().Format(dateTimeFormat))
+		w.line("DURATION", FormatDuration(event.Duration))
+
+		if event.Summary != "" {
+			w.line("SUMMARY", escape(event.Summary))
+		}
+
+		if event.Description != "" {
+			w.line("DESCRIPTION", escape(event.Description))
+		}
+
+		// we sort the extra properties to produce a stable output
+		names := make([]string, 0, len(event.Extra))
+		for name := range event.Extra {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			w.line(ExtraName(name), escape(event.Extra[name]))
+		}
+
+		w.line("END", "VEVENT")
+	}
+
+	w.line("END", "VCALENDAR")
+
+	return w.buf.Bytes()
+}
+
+// ExtraName turns a name into a valid non-standard property name
+func ExtraName(name string) string {
+	return "X-" + invalidNameChars.ReplaceAllString(strings.ToUpper(name), "-")
+}
+
+// FormatDuration formats a duration as an RFC 5545 duration value (e.g. PT1H30M)
+func FormatDuration(d time.Duration) string {
+
+	if d < 0 {
+		return "-" + FormatDuration(-d)
+	}
+
+	days := d / (24 * time.Hour)
+	d -= days * 24 * time.Hour
+	hours := d / time.Hour
+	d -= hours * time.Hour
+	minutes := d / time.Minute
+	d -= minutes * time.Minute
+	seconds := d / time.Second
+
+	s := "P"
+
+	if days > 0 {
+		s += fmt.Sprintf("%dD", days)
+	}
+
+	if hours == 0 && minutes == 0 && seconds == 0 {
+		if days == 0 {
+			return "PT0S"
+		}
+		return s
+	}
+
+	s += "T"
+
+	if hours > 0 {
+		s += fmt.Sprintf("%dH", hours)
+	}
+
+	if minutes > 0 {
+		s += fmt.Sprintf("%dM", minutes)
+	}
+
+	if seconds > 0 {
+		s += fmt.Sprintf("%dS", seconds)
+	}
+
+	return s
+}
+
+// escapes a TEXT value as described in RFC 5545, section 3.3.11
+func escape(value string) string {
+	value = strings.ReplaceAll(value, "\\", "\\\\")
+	value = strings.ReplaceAll(value, ";", "\\;")
+	value = strings.ReplaceAll(value, ",", "\\,")
+	value = strings.ReplaceAll(value, "\r\n", "\\n")
+	value = strings.ReplaceAll(value, "\n", "\\n")
+	return value
+}
+
+type writer struct {
+	buf bytes.Buffer
+}
+
+// writes a content line, folding it so that no line is longer than 75 octets
+// (without breaking multi-byte characters)
+func (w *writer) line(name, value string) {
+
+	line := name + ":" + value
+	limit := maxLineLength
+
+	for len(line) > limit {
+
+		n := limit
+
+		for n > 0 && !utf8.RuneStart(line[n]) {
+			n--
+		}
+
+		w.buf.WriteString(line[:n])
+		w.buf.WriteString("\r\n ")
+		line = line[n:]
+
+		// continuation lines start with a space, which counts towards the limit
+		limit = maxLineLength - 1
+	}
+
+	w.buf.WriteString(line)
+	w.buf.WriteString("\r\n")
+}
+
+// Decode parses the events of an iCalendar file. Only the properties that
+// are supported by Event are parsed, all other properties are ignored.
+func Decode(data []byte) (*Calendar, error) {
+
+	calendar := &Calendar{
+		Events: make([]*Event, 0),
+	}
+
+	var event *Event
+	var end *time.Time
+	// the nesting depth of components within the current event (e.g. VALARM),
+	// whose properties must not be mistaken for those of the event
+	var depth int
+
+	for i, line := range unfold(string(data)) {
+
+		if line == "" {
+			continue
+		}
+
+		name, params, value, err := parseLine(line)
+
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+
+		if name == "BEGIN" && value == "VEVENT" {
+			event = &Event{
+				Extra: map[string]string{},
+			}
+			end = nil
+			depth = 0
+			continue
+		}
+
+		if event == nil {
+			if name == "PRODID" {
+				calendar.ProdID = value
+			}
+			continue
+		}
+
+		if name == "BEGIN" {
+			depth++
+			continue
+		}
+
+		if depth > 0 {
+			if name == "END" {
+				depth--
+			}
+			continue
+		}
+
+		switch name {
+		case "END":
+			if value != "VEVENT" {
+				continue
+			}
+			if event.Start.IsZero() {
+				return nil, fmt.Errorf("event without start time")
+			}
+			if end != nil && event.Duration == 0 {
+				event.Duration = end.Sub(event.Start)
+			}
+			calendar.Events = append(calendar.Events, event)
+			event = nil
+		case "UID":
+			event.UID = unescape(value)
+		case "SUMMARY":
+			event.Summary = unescape(value)
+		case "DESCRIPTION":
+			event.Description = unescape(value)
+		case "DTSTAMP":
+			if event.Stamp, err = parseDateTime(value, params); err != nil {
+				return nil, err
+			}
+		case "DTSTART":
+			if event.Start, err = parseDateTime(value, params); err != nil {
+				return nil, err
+			}
+		case "DTEND":
+			if t, err := parseDateTime(value, params); err != nil {
+				return nil, err
+			} else {
+				end = &t
+			}
+		case "DURATION":
+			if event.Duration, err = ParseDuration(value); err != nil {
+				return nil, err
+			}
+		default:
+			if strings.HasPrefix(name, "X-") {
+				event.Extra[strings.ToLower(name[2:])] = unescape(value)
+			}
+		}
+	}
+
+	return calendar, nil
+}
+
+// ParseDuration parses an RFC 5545 duration value (e.g. PT1H30M)
+func ParseDuration(value string) (time.Duration, error) {
+
+	s := value
+	sign := time.Duration(1)
+
+	if strings.HasPrefix(s, "-") {
+		sign = -1
+		s = s[1:]
+	} else if strings.HasPrefix(s, "+") {
+		s = s[1:]
+	}
+
+	if !strings.HasPrefix(s, "P") || len(s) < 3 {
+		return 0, fmt.Errorf("invalid duration: %s", value)
+	}
+
+	s = s[1:]
+
+	var d time.Duration
+	var n int64
+	hasN := false
+	inTime := false
+
+	for _, c := range s {
+		switch {
+		case c >= '0' && c <= '9':
+			n = n*10 + int64(c-'0')
+			hasN = true
+			continue
+		case c == 'T' && !inTime && !hasN:
+			inTime = true
+			continue
+		}
+
+		if !hasN {
+			return 0, fmt.Errorf("invalid duration: %s", value)
+		}
+
+		switch {
+		case c == 'W' && !inTime:
+			d += time.Duration(n) * 7 * 24 * time.Hour
+		case c == 'D' && !inTime:
+			d += time.Duration(n) * 24 * time.Hour
+		case c == 'H' && inTime:
+			d += time.Duration(n) * time.Hour
+		case c == 'M' && inTime:
+			d += time.Duration(n) * time.Minute
+		case c == 'S' && inTime:
+			d += time.Duration(n) * time.Second
+		default:
+			return 0, fmt.Errorf("invalid duration: %s", value)
+		}
+
+		n = 0
+		hasN = false
+	}
+
+	if hasN {
+		return 0, fmt.Errorf("invalid duration: %s", value)
+	}
+
+	return sign * d, nil
+}
+
+// parses a DATE or DATE-TIME value, taking the TZID parameter into account
+func parseDateTime(value string, params map[string]string) (time.Time, error) {
+
+	location := time.Local
+
+	if tzid, ok := params["TZID"]; ok {
+		if loc, err := time.LoadLocation(tzid); err != nil {
+			return time.Time{}, err
+		} else {
+			location = loc
+		}
+	}
+
+	if strings.HasSuffix(value, "Z") {
+		return time.Parse(dateTimeFormat, value)
+	} else if len(value) == 8 {
+		return time.ParseInLocation("20060102", value, location)
+	}
+
+	return time.ParseInLocation("20060102T150405", value, location)
+}
+
+// unfolds content lines as described in RFC 5545, section 3.1
+func unfold(data string) []string {
+
+	lines := make([]string, 0)
+
+	for _, line := range strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n") {
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+		} else {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines
+}
+
+// splits a content line into its name, parameters and value
+func parseLine(line string) (string, map[string]string, string, error) {
+
+	params := map[string]string{}
+	inQuotes := false
+
+	for i, c := range line {
+		switch {
+		case c == '"':
+			inQuotes = !inQuotes
+		case c == ':' && !inQuotes:
+			parts := strings.Split(line[:i], ";")
+			for _, param := range parts[1:] {
+				kv := strings.SplitN(param, "=", 2)
+				if len(kv) != 2 {
+					return "", nil, "", fmt.Errorf("invalid parameter: %s", param)
+				}
+				params[strings.ToUpper(kv[0])] = strings.Trim(kv[1], `"`)
+			}
+			return strings.ToUpper(parts[0]), params, line[i+1:], nil
+		}
+	}
+
+	return "", nil, "", fmt.Errorf("invalid content line")
+}
+
+// reverses the escaping of a TEXT value
+func unescape(value string) string {
+
+	var b strings.Builder
+	escaped := false
+
+	for _, c := range value {
+		if escaped {
+			switch c {
+			case 'n', 'N':
+				b.WriteRune('\n')
+			default:
+				b.WriteRune(c)
+			}
+			escaped = false
+		} else if c == '\\' {
+			escaped = true
+		} else {
+			b.WriteRune(c)
+		}
+	}
+
+	return b.String()
+}
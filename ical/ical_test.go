@@ -0,0 +1,214 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatDuration(t *testing.T) {
+
+	for duration, expected := range map[time.Duration]string{
+		0:                             "PT0S",
+		30 * time.Minute:              "PT30M",
+		90 * time.Minute:              "PT1H30M",
+		24 * time.Hour:                "P1D",
+		25*time.Hour + 10*time.Second: "P1DT1H10S",
+		-15 * time.Minute:             "-PT15M",
+	} {
+		if value := FormatDuration(duration); value != expected {
+			t.Fatalf("expected %s, got %s", expected, value)
+		}
+	}
+
+}
+
+func TestEncode(t *testing.T) {
+
+	calendar := MakeCalendar()
+
+	calendar.Events = append(calendar.Events, &Event{
+		UID:         "test@kiebitz",
+		Stamp:       time.Date(2022, 10, 1, 10, 0, 0, 0, time.UTC),
+		Start:       time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC),
+		Duration:    30 * time.Minute,
+		Summary:     "Appointment; with, special\ncharacters",
+		Description: strings.Repeat("ä", 100),
+		Extra: map[string]string{
+			"kiebitz-slots": "5",
+		},
+	})
+
+	data := string(calendar.Encode())
+
+	for _, expected := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"DTSTART:20221001T120000Z\r\n",
+		"DURATION:PT30M\r\n",
+		"SUMMARY:Appointment\\; with\\, special\\ncharacters\r\n",
+		"X-KIEBITZ-SLOTS:5\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(data, expected) {
+			t.Fatalf("expected calendar to contain %q", expected)
+		}
+	}
+
+	for _, line := range strings.Split(data, "\r\n") {
+		if len(line) > 75 {
+			t.Fatalf("line exceeds 75 octets: %q", line)
+		}
+	}
+
+}
+
+func TestParseDuration(t *testing.T) {
+
+	for value, expected := range map[string]time.Duration{
+		"PT0S":      0,
+		"PT30M":     30 * time.Minute,
+		"PT1H30M":   90 * time.Minute,
+		"P1D":       24 * time.Hour,
+		"P1W":       7 * 24 * time.Hour,
+		"P1DT1H10S": 25*time.Hour + 10*time.Second,
+		"-PT15M":    -15 * time.Minute,
+	} {
+		if duration, err := ParseDuration(value); err != nil {
+			t.Fatal(err)
+		} else if duration != expected {
+			t.Fatalf("expected %s, got %s", expected, duration)
+		}
+	}
+
+	for _, value := range []string{"", "P", "PT", "30M", "PT30", "P1H", "PTM"} {
+		if _, err := ParseDuration(value); err == nil {
+			t.Fatalf("expected an error for %q", value)
+		}
+	}
+
+}
+
+func TestDecode(t *testing.T) {
+
+	calendar := MakeCalendar()
+
+	calendar.Events = append(calendar.Events, &Event{
+		UID:         "test@kiebitz",
+		Stamp:       time.Date(2022, 10, 1, 10, 0, 0, 0, time.UTC),
+		Start:       time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC),
+		Duration:    30 * time.Minute,
+		Summary:     "Appointment; with, special\ncharacters",
+		Description: strings.Repeat("ä", 100),
+		Extra: map[string]string{
+			"kiebitz-slots": "5",
+		},
+	})
+
+	decoded, err := Decode(calendar.Encode())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(decoded.Events) != 1 {
+		t.Fatalf("expected one event, got %d", len(decoded.Events))
+	}
+
+	event, expected := decoded.Events[0], calendar.Events[0]
+
+	if event.UID != expected.UID || event.Summary != expected.Summary || event.Description != expected.Description {
+		t.Fatalf("text values do not match")
+	}
+
+	if !event.Start.Equal(expected.Start) || event.Duration != expected.Duration {
+		t.Fatalf("start or duration do not match")
+	}
+
+	if event.Extra["kiebitz-slots"] != "5" {
+		t.Fatalf("expected extra property to be decoded")
+	}
+
+	// events from other tools often use DTEND and local times
+	decoded, err = Decode([]byte("BEGIN:VCALENDAR\nBEGIN:VEVENT\nDTSTART;TZID=Europe/Berlin:20221001T120000\nDTEND;TZID=Europe/Berlin:20221001T124500\nEND:VEVENT\nEND:VCALENDAR\n"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(decoded.Events) != 1 {
+		t.Fatalf("expected one event, got %d", len(decoded.Events))
+	}
+
+	if !decoded.Events[0].Start.Equal(time.Date(2022, 10, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected start time: %s", decoded.Events[0].Start)
+	}
+
+	if decoded.Events[0].Duration != 45*time.Minute {
+		t.Fatalf("unexpected duration: %s", decoded.Events[0].Duration)
+	}
+
+}
+
+func TestDecodeNestedComponents(t *testing.T) {
+
+	// the properties of the alarm must not overwrite those of the event
+	decoded, err := Decode([]byte(strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"BEGIN:VEVENT",
+		"UID:alarm@example.com",
+		"DTSTART:20221001T120000Z",
+		"DESCRIPTION:Vaccination",
+		"BEGIN:VALARM",
+		"ACTION:DISPLAY",
+		"DESCRIPTION:Reminder",
+		"TRIGGER:-PT1H",
+		"DURATION:PT15M",
+		"REPEAT:2",
+		"X-WR-ALARMUID:1234",
+		"END:VALARM",
+		"DURATION:PT30M",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(decoded.Events) != 1 {
+		t.Fatalf("expected one event, got %d", len(decoded.Events))
+	}
+
+	event := decoded.Events[0]
+
+	if event.Description != "Vaccination" {
+		t.Fatalf("unexpected description: %s", event.Description)
+	}
+
+	if event.Duration != 30*time.Minute {
+		t.Fatalf("unexpected duration: %s", event.Duration)
+	}
+
+	if _, ok := event.Extra["wr-alarmuid"]; ok {
+		t.Fatalf("expected properties of the alarm to be ignored")
+	}
+
+}
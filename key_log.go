@@ -0,0 +1,128 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/kiebitz-oss/services/crypto"
+	"time"
+)
+
+// The key log is an append-only Merkle tree (RFC 6962) of all events that
+// change the published system, mediator and provider keys. The server signs
+// the tree head, so a server that shows different keys to different users
+// needs to sign inconsistent tree heads, which clients and monitors can
+// detect by comparing them and by requesting consistency proofs.
+
+// an event that changes the published keys
+type KeyEvent struct {
+	Timestamp time.Time `json:"timestamp"`
+	// system, mediator, provider or delegation
+	Actor string `json:"actor"`
+	// publish, add, revoke, replace, rotate or resign
+	Event string `json:"event"`
+	// ID of the affected actor key (not set for system keys)
+	ID []byte `json:"id,omitempty"`
+	// the published key data (as JSON)
+	Data string `json:"data"`
+}
+
+type KeyLogEntry struct {
+	// position of the entry in the log, starting at 0
+	Index int64 `json:"index"`
+	// the JSON-encoded key event, which forms the leaf of the Merkle tree
+	Data     string `json:"data"`
+	LeafHash []byte `json:"leafHash"`
+}
+
+func (k *KeyLogEntry) ComputeLeafHash() []byte {
+	return crypto.MerkleLeafHash([]byte(k.Data))
+}
+
+func (k *KeyLogEntry) Event() (*KeyEvent, error) {
+	event := &KeyEvent{}
+	if err := json.Unmarshal([]byte(k.Data), event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+type TreeHead struct {
+	TreeSize  int64     `json:"treeSize"`
+	RootHash  []byte    `json:"rootHash"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type SignedTreeHead struct {
+	JSON      string    `json:"data" coerce:"name:json"`
+	Data      *TreeHead `json:"-" coerce:"name:data"`
+	Signature []byte    `json:"signature"`
+	PublicKey []byte    `json:"publicKey"`
+}
+
+func (t *TreeHead) Sign(key *crypto.Key) (*SignedTreeHead, error) {
+	if data, err := json.Marshal(t); err != nil {
+		return nil, err
+	} else if signedData, err := key.Sign(data); err != nil {
+		return nil, err
+	} else {
+		return &SignedTreeHead{
+			JSON:      string(data),
+			Signature: signedData.Signature,
+			PublicKey: signedData.PublicKey,
+			Data:      t,
+		}, nil
+	}
+}
+
+// verifies that the tree head has been signed with the given log key
+func (s *SignedTreeHead) Verify(publicKey []byte) (bool, error) {
+	if !bytes.Equal(s.PublicKey, publicKey) {
+		return false, nil
+	}
+	return crypto.VerifyWithBytes([]byte(s.JSON), s.Signature, publicKey)
+}
+
+type KeyLogInclusionProof struct {
+	Entry     *KeyLogEntry `json:"entry"`
+	TreeSize  int64        `json:"treeSize"`
+	AuditPath [][]byte     `json:"auditPath"`
+}
+
+// verifies that the entry is part of the tree with the given root hash
+func (k *KeyLogInclusionProof) Verify(rootHash []byte) bool {
+	leafHash := k.Entry.ComputeLeafHash()
+	if !bytes.Equal(leafHash, k.Entry.LeafHash) {
+		return false
+	}
+	return crypto.VerifyMerkleInclusion(leafHash, k.Entry.Index, k.TreeSize, k.AuditPath, rootHash)
+}
+
+type KeyLogConsistencyProof struct {
+	First  int64    `json:"first"`
+	Second int64    `json:"second"`
+	Proof  [][]byte `json:"proof"`
+}
+
+// verifies that the tree with the first root hash is a prefix of the tree
+// with the second one
+func (k *KeyLogConsistencyProof) Verify(firstRootHash, secondRootHash []byte) bool {
+	return crypto.VerifyMerkleConsistency(k.First, k.Second, firstRootHash, secondRootHash, k.Proof)
+}
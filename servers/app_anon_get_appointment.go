@@ -28,6 +28,11 @@ func (c *Appointments) getAppointment(context services.Context, params *services
 	// get all provider keys
 	keys, err := c.getActorKeys()
 
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
 	publicProviderData := c.backend.PublicProviderData()
 
 	providerKey, err := findActorKey(keys.Providers, params.ProviderID)
@@ -40,6 +45,18 @@ func (c *Appointments) getAppointment(context services.Context, params *services
 		return context.InternalError()
 	}
 
+	// the provider has been revoked (or never existed)
+	if providerKey == nil {
+		return context.NotFound()
+	}
+
+	if status, err := c.backend.ProviderStatus().Status(params.ProviderID); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else if status != services.ProviderActive {
+		return context.NotFound()
+	}
+
 	// fetch the full public data of the provider
 	providerData, err := publicProviderData.Get(params.ProviderID)
 
@@ -51,19 +68,16 @@ func (c *Appointments) getAppointment(context services.Context, params *services
 		return context.InternalError()
 	}
 
-	mediatorKey, err := findActorKey(keys.Mediators, providerKey.PublicKey)
+	keyChain, err := makeKeyChain(keys, providerKey)
 
 	if err != nil {
-		if err == databases.NotFound {
-			return context.NotFound()
-		}
 		services.Log.Error(err)
 		return context.InternalError()
 	}
 
-	keyChain := &services.KeyChain{
-		Provider: providerKey,
-		Mediator: mediatorKey,
+	// the mediator key has been revoked or has expired
+	if keyChain == nil {
+		return context.NotFound()
 	}
 
 	providerData.ID = params.ProviderID
@@ -95,6 +109,11 @@ func (c *Appointments) getAppointment(context services.Context, params *services
 			signedAppointment.Bookings = nil
 			signedAppointment.BookedSlots = slots
 
+			if err := c.addDelegations(keyChain, params.ProviderID, []*services.SignedAppointment{signedAppointment}); err != nil {
+				services.Log.Error(err)
+				return context.InternalError()
+			}
+
 			return context.Result(&services.ProviderAppointments{
 				Provider:     providerData,
 				Appointments: []*services.SignedAppointment{signedAppointment},
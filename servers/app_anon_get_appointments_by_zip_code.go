@@ -20,7 +20,6 @@ package servers
 
 import (
 	"github.com/kiebitz-oss/services"
-	"github.com/kiebitz-oss/services/crypto"
 	"github.com/kiebitz-oss/services/databases"
 	"time"
 )
@@ -35,6 +34,14 @@ func (c *Appointments) getAppointmentsByZipCode(context services.Context, params
 		return context.InternalError()
 	}
 
+	// suspended or revoked providers are not shown to users
+	providerStatus, err := c.backend.ProviderStatus().GetAll()
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
 	// get all neighboring zip codes for the given zip code
 	neighbors := c.backend.Neighbors("zipCode", params.ZipCode)
 	// public provider data structure
@@ -76,8 +83,12 @@ func (c *Appointments) getAppointmentsByZipCode(context services.Context, params
 			}
 		}
 
-		// the provider "ID" is the hash of the signing key
-		hash := crypto.Hash(pkd.Signing)
+		// the provider "ID" is the hash of its original signing key
+		hash := providerKey.ID
+
+		if record, ok := providerStatus[string(hash)]; ok && record.Data.Status != services.ProviderActive {
+			continue
+		}
 
 		// fetch the full public data of the provider
 		providerData, err := publicProviderData.Get(hash)
@@ -160,16 +171,17 @@ func (c *Appointments) getAppointmentsByZipCode(context services.Context, params
 			continue
 		}
 
-		mediatorKey, err := findActorKey(keys.Mediators, providerKey.PublicKey)
+		keyChain, err := makeKeyChain(keys, providerKey)
 
 		if err != nil {
 			services.Log.Error(err)
 			continue
 		}
 
-		keyChain := &services.KeyChain{
-			Provider: providerKey,
-			Mediator: mediatorKey,
+		// the mediator key has been revoked or has expired, the provider key
+		// needs to be re-signed first
+		if keyChain == nil {
+			continue
 		}
 
 		// we add the hash for convenience
@@ -190,6 +202,10 @@ func (c *Appointments) getAppointmentsByZipCode(context services.Context, params
 			}
 			providerAppointments.AggregatedAppointments = openAppointments
 		} else {
+			if err := c.addDelegations(keyChain, hash, signedAppointments); err != nil {
+				services.Log.Error(err)
+				continue
+			}
 			providerAppointments.Appointments = signedAppointments
 		}
 
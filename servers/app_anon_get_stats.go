@@ -32,6 +32,19 @@ func (c *Appointments) getStats(context services.Context, params *services.GetSt
 		return context.InternalError()
 	}
 
+	values, err := c.statsValues(params)
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	return context.Result(values)
+}
+
+// returns the sorted statistics values for the given parameters
+func (c *Appointments) statsValues(params *services.GetStatsParams) ([]*services.StatsValue, error) {
+
 	toTime := time.Now().UTC().UnixNano()
 
 	var metrics []*services.Metric
@@ -44,8 +57,7 @@ func (c *Appointments) getStats(context services.Context, params *services.GetSt
 	}
 
 	if err != nil {
-		services.Log.Error(err)
-		return context.InternalError()
+		return nil, err
 	}
 
 	values := make([]*services.StatsValue, 0)
@@ -87,7 +99,7 @@ addMetric:
 	sortableValues := Values{values: values}
 	sort.Sort(sortableValues)
 
-	return context.Result(values)
+	return values, nil
 }
 
 type Values struct {
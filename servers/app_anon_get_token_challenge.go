@@ -0,0 +1,196 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"time"
+)
+
+// we derive a dedicated key with this label so that challenge MACs cannot be
+// confused with other values authenticated with the server secret
+var tokenChallengeLabel = []byte("token-challenge")
+
+// the minimum length of the secret we derive the challenge key from
+const minTokenChallengeSecretLength = 16
+
+// derives the key for authenticating token challenges from the server secret
+func deriveTokenChallengeKey(secret []byte) ([]byte, error) {
+	if len(secret) < minTokenChallengeSecretLength {
+		return nil, fmt.Errorf("token challenges require a secret of at least %d bytes", minTokenChallengeSecretLength)
+	}
+	h := hmac.New(sha256.New, secret)
+	h.Write(tokenChallengeLabel)
+	return h.Sum(nil), nil
+}
+
+func (c *Appointments) tokenChallengeMAC(data string) ([]byte, error) {
+	if c.tokenChallengeKey == nil {
+		return nil, fmt.Errorf("no token challenge key")
+	}
+	h := hmac.New(sha256.New, c.tokenChallengeKey)
+	h.Write([]byte(data))
+	return h.Sum(nil), nil
+}
+
+// The difficulty adapts to the number of tokens issued during the current
+// minute: for each doubling of the rate above the configured one we require
+// one additional bit, up to the maximum difficulty.
+func (c *Appointments) tokenChallengeDifficulty() int64 {
+
+	difficulty := c.settings.TokenChallengeDifficulty
+
+	if c.meter == nil || c.settings.TokenChallengeRate <= 0 {
+		return difficulty
+	}
+
+	metric, err := c.meter.Get("tokens", "issued", map[string]string{}, services.Minute(time.Now().UTC().UnixNano()))
+
+	if err != nil {
+		// we fall back to the minimum difficulty
+		services.Log.Error(err)
+		return difficulty
+	}
+
+	if metric != nil {
+		for rate := metric.Value; rate >= c.settings.TokenChallengeRate; rate /= 2 {
+			difficulty++
+		}
+	}
+
+	if difficulty > c.settings.TokenChallengeMaxDifficulty {
+		difficulty = c.settings.TokenChallengeMaxDifficulty
+	}
+
+	return difficulty
+}
+
+// records that a token was issued, which we use to adapt the difficulty of
+// challenges
+func (c *Appointments) addTokenStats() {
+
+	if c.meter == nil {
+		return
+	}
+
+	now := time.Now().UTC().UnixNano()
+
+	for _, twt := range tws {
+
+		// generate the time window
+		tw := twt(now)
+
+		if err := c.meter.Add("tokens", "issued", map[string]string{}, tw, 1); err != nil {
+			services.Log.Error(err)
+		}
+	}
+}
+
+// checks the solution of a token challenge if challenges are enabled. The
+// binding ties the solution to the request, so it cannot be reused for
+// different tokens.
+func (c *Appointments) checkTokenChallenge(context services.Context, solution *services.TokenChallengeSolution, binding []byte) services.Response {
+
+	if !c.settings.TokenChallengeEnabled {
+		return nil
+	}
+
+	if solution == nil {
+		return context.Error(401, "challenge required", nil)
+	}
+
+	challenge := solution.Challenge
+
+	if mac, err := c.tokenChallengeMAC(challenge.JSON); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else if !hmac.Equal(mac, challenge.Signature) {
+		return context.Error(400, "invalid challenge", nil)
+	}
+
+	now := time.Now()
+
+	if now.After(challenge.Data.ExpiresAt) {
+		return context.Error(410, "challenge expired", nil)
+	}
+
+	data := append(append([]byte{}, challenge.Data.Nonce...), binding...)
+
+	if !crypto.VerifyHashcash(data, solution.Solution, int(challenge.Data.Difficulty)) {
+		return context.Error(400, "invalid solution", nil)
+	}
+
+	// each challenge can only be used once
+	if ok, err := c.backend.TokenChallenges().Use(challenge.Data.Nonce, challenge.Data.ExpiresAt.Sub(now)+time.Second); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else if !ok {
+		return context.Error(409, "challenge already used", nil)
+	}
+
+	return nil
+}
+
+// returns a new proof-of-work challenge for getting a token
+func (c *Appointments) getTokenChallenge(context services.Context, params *services.GetTokenChallengeParams) services.Response {
+
+	if !c.settings.TokenChallengeEnabled {
+		return context.Error(400, "token challenges not enabled", nil)
+	}
+
+	nonce, err := crypto.RandomBytes(32)
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	validity := time.Duration(c.settings.TokenChallengeValiditySeconds) * time.Second
+
+	challenge := &services.TokenChallenge{
+		Nonce:      nonce,
+		Difficulty: c.tokenChallengeDifficulty(),
+		ExpiresAt:  time.Now().Add(validity).UTC(),
+	}
+
+	data, err := json.Marshal(challenge)
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	mac, err := c.tokenChallengeMAC(string(data))
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	return context.Result(&services.SignedTokenChallenge{
+		JSON:      string(data),
+		Signature: mac,
+	})
+
+}
@@ -0,0 +1,140 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers_test
+
+import (
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/definitions"
+	"github.com/kiebitz-oss/services/forms"
+	"github.com/kiebitz-oss/services/helpers"
+	at "github.com/kiebitz-oss/services/testing"
+	af "github.com/kiebitz-oss/services/testing/fixtures"
+	"testing"
+)
+
+func TestTokenChallenge(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+	settings := fixtures["settings"].(*services.Settings)
+
+	settings.Appointments.TokenChallengeEnabled = true
+
+	user, err := crypto.MakeActor("user")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := crypto.RandomBytes(32)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params := &services.GetTokenParams{
+		Hash:      hash,
+		PublicKey: user.SigningKey.PublicKey,
+	}
+
+	// without a solution we do not get a token
+	if resp, err := client.Appointments.GetToken(params); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 401 {
+		t.Fatalf("expected a 401 status code, got %d instead", resp.StatusCode)
+	}
+
+	resp, err := client.Appointments.GetTokenChallenge()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	challenge := &services.SignedTokenChallenge{}
+
+	if err := resp.CoerceResult(challenge, &forms.SignedTokenChallengeForm); err != nil {
+		t.Fatal(err)
+	}
+
+	if challenge.Data.Difficulty != settings.Appointments.TokenChallengeDifficulty {
+		t.Fatalf("expected the minimum difficulty, got %d instead", challenge.Data.Difficulty)
+	}
+
+	data := append(append([]byte{}, challenge.Data.Nonce...), hash...)
+
+	params.Challenge = &services.TokenChallengeSolution{
+		Challenge: challenge,
+		Solution:  crypto.SolveHashcash(data, int(challenge.Data.Difficulty)),
+	}
+
+	// a tampered challenge is refused
+	tamperedChallenge := *challenge
+	tamperedChallenge.Signature = append([]byte{}, challenge.Signature...)
+	tamperedChallenge.Signature[0] ^= 0xff
+
+	if resp, err := client.Appointments.GetToken(&services.GetTokenParams{
+		Hash:      hash,
+		PublicKey: user.SigningKey.PublicKey,
+		Challenge: &services.TokenChallengeSolution{
+			Challenge: &tamperedChallenge,
+			Solution:  params.Challenge.Solution,
+		},
+	}); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 400 {
+		t.Fatalf("expected a 400 status code, got %d instead", resp.StatusCode)
+	}
+
+	if resp, err := client.Appointments.GetToken(params); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	// each challenge can be used only once
+	if resp, err := client.Appointments.GetToken(params); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 409 {
+		t.Fatalf("expected a 409 status code, got %d instead", resp.StatusCode)
+	}
+
+}
@@ -0,0 +1,234 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/databases"
+	"time"
+)
+
+// appends an event concerning the given actor key to the key log
+func (c *Appointments) logKeyEvent(actor, event string, id []byte, key *services.ActorKey) error {
+
+	// the key is logged as it is published, i.e. including its ID
+	publishedKey := *key
+	publishedKey.ID = id
+
+	return c.appendKeyEvent(actor, event, id, &publishedKey)
+}
+
+// appends an event concerning the delegation certificate with the given ID
+// (the hash of the delegated signing key) to the key log
+func (c *Appointments) logDelegationEvent(event string, id []byte, delegation *services.SignedDelegationData) error {
+	return c.appendKeyEvent("delegation", event, id, delegation)
+}
+
+func (c *Appointments) appendKeyEvent(actor, event string, id []byte, key interface{}) error {
+
+	data, err := json.Marshal(key)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = c.backend.KeyLog().Append(&services.KeyEvent{
+		Timestamp: time.Now().UTC(),
+		Actor:     actor,
+		Event:     event,
+		ID:        id,
+		Data:      string(data),
+	})
+
+	return err
+}
+
+// system keys are defined in the settings, so we log them at startup if they
+// differ from the last logged version
+func (c *Appointments) logSystemKeys() error {
+
+	keys, err := c.getKeysData()
+
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(keys)
+
+	if err != nil {
+		return err
+	}
+
+	return c.backend.KeyLog().AppendIfChanged("system", &services.KeyEvent{
+		Timestamp: time.Now().UTC(),
+		Actor:     "system",
+		Event:     "publish",
+		Data:      string(data),
+	})
+}
+
+func (c *Appointments) getKeyLogHead(context services.Context, params *services.GetKeyLogHeadParams) services.Response {
+
+	logKey := c.settings.Key("log")
+
+	if logKey == nil {
+		return context.Error(400, "key log not supported", nil)
+	}
+
+	keyLog := c.backend.KeyLog()
+
+	treeHead, err := keyLog.TreeHead()
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	// we only sign the head again if the tree changed since it was signed
+	if signedTreeHead, err := keyLog.SignedTreeHead(); err == nil && signedTreeHead.Data.TreeSize == treeHead.TreeSize && bytes.Equal(signedTreeHead.Data.RootHash, treeHead.RootHash) {
+		return context.Result(signedTreeHead)
+	} else if err != nil && err != databases.NotFound {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	signedTreeHead, err := treeHead.Sign(logKey)
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if err := keyLog.SetSignedTreeHead(signedTreeHead); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	return context.Result(signedTreeHead)
+}
+
+func (c *Appointments) getKeyLogEntries(context services.Context, params *services.GetKeyLogEntriesParams) services.Response {
+
+	entries, err := c.backend.KeyLog().GetRange(params.From, params.Limit)
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	return context.Result(entries)
+}
+
+func (c *Appointments) getKeyLogInclusionProof(context services.Context, params *services.GetKeyLogInclusionProofParams) services.Response {
+
+	keyLog := c.backend.KeyLog()
+
+	treeSize, err := keyLog.Size()
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if params.TreeSize != nil {
+		if *params.TreeSize > treeSize {
+			return context.Error(400, "tree size exceeds size of the key log", nil)
+		}
+		treeSize = *params.TreeSize
+	}
+
+	var index int64
+
+	switch {
+	case params.Index != nil && params.ID == nil:
+		index = *params.Index
+	case params.ID != nil && params.Index == nil:
+		if index, err = keyLog.IndexOf(params.ID); err == databases.NotFound {
+			return context.NotFound()
+		} else if err != nil {
+			services.Log.Error(err)
+			return context.InternalError()
+		}
+	default:
+		return context.Error(400, "either index or id required", nil)
+	}
+
+	if index >= treeSize {
+		return context.NotFound()
+	}
+
+	entry, err := keyLog.Get(index)
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	auditPath, err := crypto.MerkleInclusionProofOf(keyLog.Node, index, treeSize)
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	return context.Result(&services.KeyLogInclusionProof{
+		Entry:     entry,
+		TreeSize:  treeSize,
+		AuditPath: auditPath,
+	})
+}
+
+func (c *Appointments) getKeyLogConsistencyProof(context services.Context, params *services.GetKeyLogConsistencyProofParams) services.Response {
+
+	keyLog := c.backend.KeyLog()
+
+	second, err := keyLog.Size()
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if params.Second != nil {
+		if *params.Second > second {
+			return context.Error(400, "tree size exceeds size of the key log", nil)
+		}
+		second = *params.Second
+	}
+
+	if params.First > second {
+		return context.Error(400, "first tree size exceeds second tree size", nil)
+	}
+
+	proof, err := crypto.MerkleConsistencyProofOf(keyLog.Node, params.First, second)
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	return context.Result(&services.KeyLogConsistencyProof{
+		First:  params.First,
+		Second: second,
+		Proof:  proof,
+	})
+}
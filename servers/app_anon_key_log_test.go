@@ -0,0 +1,289 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers_test
+
+import (
+	"encoding/json"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/definitions"
+	"github.com/kiebitz-oss/services/forms"
+	"github.com/kiebitz-oss/services/helpers"
+	at "github.com/kiebitz-oss/services/testing"
+	af "github.com/kiebitz-oss/services/testing/fixtures"
+	"testing"
+	"time"
+)
+
+func getKeyLogHead(t *testing.T, client *helpers.Client, logKey []byte) *services.TreeHead {
+
+	resp, err := client.Appointments.GetKeyLogHead()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	signedTreeHead := &services.SignedTreeHead{}
+
+	if err := resp.CoerceResult(signedTreeHead, &forms.SignedTreeHeadForm); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := signedTreeHead.Verify(logKey); err != nil {
+		t.Fatal(err)
+	} else if !ok {
+		t.Fatalf("invalid tree head signature")
+	}
+
+	return signedTreeHead.Data
+}
+
+func TestKeyLog(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+
+		// we create a mediator
+		at.FC{af.Mediator{}, "mediator"},
+
+		// we create a provider
+		at.FC{af.Provider{
+			ZipCode:   "10707",
+			StoreData: true,
+			Confirm:   true,
+		}, "provider"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+	mediator := fixtures["mediator"].(*crypto.Actor)
+	provider := fixtures["provider"].(*helpers.Provider)
+
+	resp, err := client.Appointments.GetKeys()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := &services.Keys{}
+
+	if err := resp.CoerceResult(keys, &forms.KeysForm); err != nil {
+		t.Fatal(err)
+	}
+
+	if keys.LogKey == nil {
+		t.Fatalf("expected a log key")
+	}
+
+	head := getKeyLogHead(t, client, keys.LogKey)
+
+	// system keys, mediator key and provider key
+	if head.TreeSize != 3 {
+		t.Fatalf("expected 3 entries, got %d", head.TreeSize)
+	}
+
+	// the signed head is cached until the log changes
+	if cachedHead := getKeyLogHead(t, client, keys.LogKey); !cachedHead.Timestamp.Equal(head.Timestamp) {
+		t.Fatalf("expected the cached tree head")
+	}
+
+	if resp, err = client.Appointments.GetKeyLogEntries(&services.GetKeyLogEntriesParams{
+		From:  0,
+		Limit: 100,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	bytes, err := resp.Bytes()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entriesResult := &struct {
+		Result []*services.KeyLogEntry `json:"result"`
+	}{}
+
+	if err := json.Unmarshal(bytes, entriesResult); err != nil {
+		t.Fatal(err)
+	}
+
+	leafHashes := [][]byte{}
+	actors := map[string]bool{}
+
+	for _, entry := range entriesResult.Result {
+		event, err := entry.Event()
+		if err != nil {
+			t.Fatal(err)
+		}
+		actors[event.Actor] = true
+		leafHashes = append(leafHashes, entry.ComputeLeafHash())
+	}
+
+	for _, actor := range []string{"system", "mediator", "provider"} {
+		if !actors[actor] {
+			t.Fatalf("expected a key log entry for %s", actor)
+		}
+	}
+
+	if string(crypto.MerkleRoot(leafHashes)) != string(head.RootHash) {
+		t.Fatalf("root hash does not match the entries")
+	}
+
+	mediatorID := crypto.Hash(mediator.SigningKey.PublicKey)
+
+	getInclusionProof := func() *services.KeyLogInclusionProof {
+
+		resp, err := client.Appointments.GetKeyLogInclusionProof(&services.GetKeyLogInclusionProofParams{
+			ID: mediatorID,
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode != 200 {
+			t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+		}
+
+		bytes, err := resp.Bytes()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result := &struct {
+			Result *services.KeyLogInclusionProof `json:"result"`
+		}{}
+
+		if err := json.Unmarshal(bytes, result); err != nil {
+			t.Fatal(err)
+		}
+
+		return result.Result
+	}
+
+	inclusionProof := getInclusionProof()
+
+	if !inclusionProof.Verify(head.RootHash) {
+		t.Fatalf("invalid inclusion proof")
+	}
+
+	if resp, err = client.Appointments.RevokeMediatorKey(&services.RevokeMediatorKeyParams{
+		Timestamp: time.Now(),
+		ID:        mediatorID,
+	}); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	newHead := getKeyLogHead(t, client, keys.LogKey)
+
+	if newHead.TreeSize != head.TreeSize+1 {
+		t.Fatalf("expected a new entry")
+	}
+
+	// the latest entry of the mediator key is the revocation
+	inclusionProof = getInclusionProof()
+
+	if event, err := inclusionProof.Entry.Event(); err != nil {
+		t.Fatal(err)
+	} else if event.Event != "revoke" {
+		t.Fatalf("expected a revocation event, got %s instead", event.Event)
+	}
+
+	if !inclusionProof.Verify(newHead.RootHash) {
+		t.Fatalf("invalid inclusion proof")
+	}
+
+	if resp, err = client.Appointments.GetKeyLogConsistencyProof(&services.GetKeyLogConsistencyProofParams{
+		First: head.TreeSize,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes, err = resp.Bytes(); err != nil {
+		t.Fatal(err)
+	}
+
+	consistencyResult := &struct {
+		Result *services.KeyLogConsistencyProof `json:"result"`
+	}{}
+
+	if err := json.Unmarshal(bytes, consistencyResult); err != nil {
+		t.Fatal(err)
+	}
+
+	consistencyProof := consistencyResult.Result
+
+	if consistencyProof.Second != newHead.TreeSize {
+		t.Fatalf("expected a proof for the current tree size")
+	}
+
+	if !consistencyProof.Verify(head.RootHash, newHead.RootHash) {
+		t.Fatalf("invalid consistency proof")
+	}
+
+	// a server showing a different earlier tree cannot prove consistency
+	if consistencyProof.Verify(inclusionProof.Entry.LeafHash, newHead.RootHash) {
+		t.Fatalf("consistency proof should not be valid for another tree")
+	}
+
+	staffActor, err := crypto.MakeActor("staff")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// delegation keys are logged as well
+	if resp, err = client.Appointments.AddProviderDelegation(&services.DelegationData{
+		Signing:    staffActor.SigningKey.PublicKey,
+		Name:       "front desk",
+		Scopes:     []string{services.DelegationScopeReadBookings},
+		ValidUntil: time.Now().Add(24 * time.Hour),
+	}, provider); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	if delegationHead := getKeyLogHead(t, client, keys.LogKey); delegationHead.TreeSize != newHead.TreeSize+1 {
+		t.Fatalf("expected a new entry for the delegation")
+	}
+
+}
@@ -19,10 +19,16 @@
 package servers
 
 import (
+	"bytes"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/databases"
 	"github.com/kiebitz-oss/services/forms"
+	"sort"
+	"strconv"
 	"time"
 )
 
@@ -51,6 +57,42 @@ func (a *AppointmentsBackend) Keys(actor string) *Keys {
 	}
 }
 
+func (a *AppointmentsBackend) ProviderStatus() *ProviderStatus {
+	return &ProviderStatus{
+		dbs: a.db.Map("providerStatus", []byte("all")),
+	}
+}
+
+func (a *AppointmentsBackend) MediatorKeyRevocations() *MediatorKeyRevocations {
+	return &MediatorKeyRevocations{
+		dbs: a.db.Map("mediatorKeyRevocations", []byte("all")),
+	}
+}
+
+func (a *AppointmentsBackend) ProviderApprovals(providerID []byte) *ProviderApprovals {
+	return &ProviderApprovals{
+		dbs: a.db.Map("providerApprovals", providerID),
+	}
+}
+
+func (a *AppointmentsBackend) PendingProviderApprovals() *PendingProviderApprovals {
+	return &PendingProviderApprovals{
+		dbs: a.db.Set("providerApprovals", []byte("pending")),
+	}
+}
+
+func (a *AppointmentsBackend) Delegations(providerID []byte) *Delegations {
+	return &Delegations{
+		dbs: a.db.Map("delegations", providerID),
+	}
+}
+
+func (a *AppointmentsBackend) DelegateProviders() *DelegateProviders {
+	return &DelegateProviders{
+		dbs: a.db.Map("delegateProviders", []byte("all")),
+	}
+}
+
 func (a *AppointmentsBackend) Codes(actor string) *Codes {
 	return &Codes{
 		codes:  a.db.Set("codes", []byte(actor)),
@@ -58,6 +100,20 @@ func (a *AppointmentsBackend) Codes(actor string) *Codes {
 	}
 }
 
+func (a *AppointmentsBackend) CodeBatches(actor string) *CodeBatches {
+	return &CodeBatches{
+		db:      a.db,
+		batches: a.db.Map("codeBatches", []byte(actor)),
+		codes:   a.db.Map("codeBatchByCode", []byte(actor)),
+	}
+}
+
+func (a *AppointmentsBackend) Invitations() *Invitations {
+	return &Invitations{
+		dbs: a.db.Map("invitations", []byte("all")),
+	}
+}
+
 func (a *AppointmentsBackend) PublicProviderData() *PublicProviderData {
 	return &PublicProviderData{
 		dbs: a.db.Map("providerData", []byte("public")),
@@ -82,6 +138,64 @@ func (a *AppointmentsBackend) VerifiedProviderData() *RawProviderData {
 	}
 }
 
+func (a *AppointmentsBackend) RejectedProviderData() *RawProviderData {
+	return &RawProviderData{
+		dbs: a.db.Map("providerData", []byte("rejected")),
+	}
+}
+
+func (a *AppointmentsBackend) ProviderRejections() *ProviderRejections {
+	return &ProviderRejections{
+		dbs: a.db.Map("providerRejections", []byte("all")),
+	}
+}
+
+func (a *AppointmentsBackend) ProviderDataVersions(providerID []byte) *ProviderDataVersions {
+	return &ProviderDataVersions{
+		dbs: a.db.Map("providerDataVersions", providerID),
+	}
+}
+
+func (a *AppointmentsBackend) ProviderDataRejections(providerID []byte) *ProviderDataRejections {
+	return &ProviderDataRejections{
+		dbs: a.db.Map("providerDataRejections", providerID),
+	}
+}
+
+func (a *AppointmentsBackend) VerificationQueue() *VerificationQueue {
+	return &VerificationQueue{
+		dbs: a.db.SortedSet("providerData", []byte("queue")),
+	}
+}
+
+func (a *AppointmentsBackend) VerificationClaims() *VerificationClaims {
+	return &VerificationClaims{
+		db:  a.db,
+		dbs: a.db.Map("verificationClaims", []byte("all")),
+	}
+}
+
+func (a *AppointmentsBackend) AuditLog() *AuditLog {
+	return &AuditLog{
+		db:      a.db,
+		entries: a.db.Map(auditLogTable, []byte("entries")),
+		head:    a.db.Value(auditLogTable, []byte("head")),
+	}
+}
+
+func (a *AppointmentsBackend) KeyLog() *KeyLog {
+	return &KeyLog{
+		db:         a.db,
+		entries:    a.db.Map("keyLog", []byte("entries")),
+		ids:        a.db.Map("keyLog", []byte("ids")),
+		states:     a.db.Map("keyLog", []byte("states")),
+		nodes:      a.db.Map("keyLog", []byte("nodes")),
+		head:       a.db.Value("keyLog", []byte("head")),
+		treeHead:   a.db.Value("keyLog", []byte("treeHead")),
+		signedHead: a.db.Value("keyLog", []byte("signedHead")),
+	}
+}
+
 func (a *AppointmentsBackend) AppointmentsByDate(providerID []byte, date string) *AppointmentsByDate {
 	dateKey := append(providerID, []byte(date)...)
 	return &AppointmentsByDate{
@@ -97,6 +211,42 @@ func (a *AppointmentsBackend) AppointmentDatesByID(providerID []byte) *Appointme
 	}
 }
 
+func (a *AppointmentsBackend) AppointmentTombstones(providerID []byte) *AppointmentTombstones {
+	return &AppointmentTombstones{
+		providerID: providerID,
+		db:         a.db,
+		dbs:        a.db.Map("appointmentTombstones", providerID),
+	}
+}
+
+func (a *AppointmentsBackend) AppointmentChanges(providerID []byte) *AppointmentChanges {
+	return &AppointmentChanges{
+		providerID: providerID,
+		db:         a.db,
+		seq:        a.db.Integer("appointmentChangesSeq", providerID),
+		epoch:      a.db.Value("appointmentChangesEpoch", providerID),
+		changes:    a.db.SortedSet("appointmentChanges", providerID),
+	}
+}
+
+func (a *AppointmentsBackend) RevokedTokens() *RevokedTokens {
+	return &RevokedTokens{
+		dbs: a.db.Set("tokens", []byte("revoked")),
+	}
+}
+
+func (a *AppointmentsBackend) TokenIssuance(hash []byte) *TokenIssuance {
+	return &TokenIssuance{
+		count: a.db.Integer("tokenIssuance", hash),
+	}
+}
+
+func (a *AppointmentsBackend) TokenChallenges() *TokenChallenges {
+	return &TokenChallenges{
+		db: a.db,
+	}
+}
+
 func (a *AppointmentsBackend) UsedTokens() *UsedTokens {
 	return &UsedTokens{
 		dbs: a.db.Set("bookings", []byte("tokens")),
@@ -174,175 +324,1453 @@ func (k *Keys) GetAll() ([]*services.ActorKey, error) {
 
 }
 
-type Codes struct {
-	codes  services.Set
-	scores services.SortedSet
+func (k *Keys) Del(id []byte) error {
+	return k.keys.Del(id)
 }
 
-func (c *Codes) Has(code []byte) (bool, error) {
-	return c.codes.Has(code)
+// the status of a provider is stored as the signed request of the mediator
+// that changed it, providers without a status are active
+type ProviderStatus struct {
+	dbs services.Map
 }
 
-func (c *Codes) Add(code []byte) error {
-	return c.codes.Add(code)
+func (p *ProviderStatus) Set(id []byte, record *services.ProviderStatusSignedParams) error {
+	if data, err := json.Marshal(record); err != nil {
+		return err
+	} else {
+		return p.dbs.Set(id, data)
+	}
 }
 
-func (c *Codes) Del(code []byte) error {
-	return c.codes.Del(code)
+func (p *ProviderStatus) Get(id []byte) (*services.ProviderStatusSignedParams, error) {
+	if data, err := p.dbs.Get(id); err != nil {
+		return nil, err
+	} else {
+		return providerStatusRecord(data)
+	}
 }
 
-func (c *Codes) Score(code []byte) (int64, error) {
-	return c.scores.Score(code)
+// Status returns the status of the given provider
+func (p *ProviderStatus) Status(id []byte) (string, error) {
+	if record, err := p.Get(id); err == databases.NotFound {
+		return services.ProviderActive, nil
+	} else if err != nil {
+		return "", err
+	} else {
+		return record.Data.Status, nil
+	}
 }
 
-func (c *Codes) AddToScore(code []byte, score int64) error {
-	return c.scores.Add(code, score)
+func (p *ProviderStatus) GetAll() (map[string]*services.ProviderStatusSignedParams, error) {
+
+	allData, err := p.dbs.GetAll()
+
+	if err != nil {
+		return nil, err
+	}
+
+	records := make(map[string]*services.ProviderStatusSignedParams)
+
+	for id, data := range allData {
+		if record, err := providerStatusRecord(data); err != nil {
+			return nil, err
+		} else {
+			records[id] = record
+		}
+	}
+
+	return records, nil
 }
 
-type ConfirmedProviderData struct {
+func providerStatusRecord(data []byte) (*services.ProviderStatusSignedParams, error) {
+
+	record := &services.ProviderStatusSignedParams{}
+
+	if err := json.Unmarshal(data, record); err != nil {
+		return nil, err
+	}
+
+	record.Data = &services.ProviderStatusParams{}
+
+	if err := json.Unmarshal([]byte(record.JSON), record.Data); err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// revocation entries are stored as the signed requests of the root key
+type MediatorKeyRevocations struct {
 	dbs services.Map
 }
 
-func (c *ConfirmedProviderData) Set(providerID []byte, encryptedData *services.ConfirmedProviderData) error {
-	if data, err := json.Marshal(encryptedData); err != nil {
+func (m *MediatorKeyRevocations) Set(id []byte, record *services.RevokeMediatorKeySignedParams) error {
+	if data, err := json.Marshal(record); err != nil {
 		return err
 	} else {
-		return c.dbs.Set(providerID, data)
+		return m.dbs.Set(id, data)
 	}
 }
 
-func (c *ConfirmedProviderData) Get(providerID []byte) (*services.ConfirmedProviderData, error) {
-	if data, err := c.dbs.Get(providerID); err != nil {
+func (m *MediatorKeyRevocations) GetAll() (map[string]*services.RevokeMediatorKeySignedParams, error) {
+
+	allData, err := m.dbs.GetAll()
+
+	if err != nil {
 		return nil, err
-	} else {
-		var mapData map[string]interface{}
-		encryptedData := &services.ConfirmedProviderData{}
-		if err := json.Unmarshal(data, &mapData); err != nil {
-			return nil, err
-		} else if params, err := forms.ConfirmedProviderDataForm.Validate(mapData); err != nil {
+	}
+
+	records := make(map[string]*services.RevokeMediatorKeySignedParams)
+
+	for id, data := range allData {
+
+		record := &services.RevokeMediatorKeySignedParams{}
+
+		if err := json.Unmarshal(data, record); err != nil {
 			return nil, err
-		} else if err := forms.ConfirmedProviderDataForm.Coerce(encryptedData, params); err != nil {
+		}
+
+		record.Data = &services.RevokeMediatorKeyParams{}
+
+		if err := json.Unmarshal([]byte(record.JSON), record.Data); err != nil {
 			return nil, err
-		} else {
-			return encryptedData, nil
 		}
+
+		records[id] = record
 	}
+
+	return records, nil
 }
 
-type RawProviderData struct {
+// approvals of provider key data, stored by mediator key ID
+type ProviderApprovals struct {
 	dbs services.Map
 }
 
-func (c *RawProviderData) Set(providerID []byte, rawData *services.RawProviderData) error {
-	if data, err := json.Marshal(rawData); err != nil {
+func (p *ProviderApprovals) Set(mediatorID []byte, approval *services.ActorKey) error {
+	if data, err := json.Marshal(approval); err != nil {
 		return err
 	} else {
-		return c.dbs.Set(providerID, data)
+		return p.dbs.Set(mediatorID, data)
 	}
 }
 
-func (c *RawProviderData) Del(providerID []byte) error {
-	return c.dbs.Del(providerID)
-}
+func (p *ProviderApprovals) GetAll() ([]*services.ActorKey, error) {
 
-func (c *RawProviderData) Get(providerID []byte) (*services.RawProviderData, error) {
-	if data, err := c.dbs.Get(providerID); err != nil {
+	allData, err := p.dbs.GetAll()
+
+	if err != nil {
 		return nil, err
-	} else {
-		var mapData map[string]interface{}
-		rawData := &services.RawProviderData{}
-		if err := json.Unmarshal(data, &mapData); err != nil {
-			return nil, err
-		} else if params, err := forms.RawProviderDataForm.Validate(mapData); err != nil {
-			return nil, err
-		} else if err := forms.RawProviderDataForm.Coerce(rawData, params); err != nil {
-			return nil, err
-		} else {
-			return rawData, nil
-		}
 	}
-}
 
-func (c *RawProviderData) GetAll() (map[string]*services.RawProviderData, error) {
-	if dataMap, err := c.dbs.GetAll(); err != nil {
-		return nil, err
-	} else {
-		providerDataMap := map[string]*services.RawProviderData{}
-		for id, data := range dataMap {
-			var mapData map[string]interface{}
-			rawData := &services.RawProviderData{}
-			if err := json.Unmarshal(data, &mapData); err != nil {
-				return nil, err
-			} else if params, err := forms.RawProviderDataForm.Validate(mapData); err != nil {
-				return nil, err
-			} else if err := forms.RawProviderDataForm.Coerce(rawData, params); err != nil {
-				return nil, err
-			} else {
-				providerDataMap[id] = rawData
-			}
+	approvals := make([]*services.ActorKey, 0, len(allData))
+
+	for id, data := range allData {
+		approval := &services.ActorKey{}
+		if err := json.Unmarshal(data, approval); err != nil {
+			return nil, err
 		}
-		return providerDataMap, nil
+		approval.ID = []byte(id)
+		approvals = append(approvals, approval)
 	}
-}
 
-type UsedTokens struct {
-	dbs services.Set
+	return approvals, nil
 }
 
-func (t *UsedTokens) Del(token []byte) error {
-	return t.dbs.Del(token)
+func (p *ProviderApprovals) Del(mediatorID []byte) error {
+	return p.dbs.Del(mediatorID)
 }
 
-func (t *UsedTokens) Has(token []byte) (bool, error) {
-	return t.dbs.Has(token)
-}
+func (p *ProviderApprovals) DelAll() error {
 
-func (t *UsedTokens) Add(token []byte) error {
-	return t.dbs.Add(token)
-}
+	allData, err := p.dbs.GetAll()
 
-type AppointmentDatesByID struct {
-	providerID []byte
-	dbs        services.Map
-	db         services.Database
+	if err != nil {
+		return err
+	}
+
+	for id := range allData {
+		if err := p.dbs.Del([]byte(id)); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
-func (a *AppointmentDatesByID) GetAll() (map[string][]byte, error) {
-	return a.dbs.GetAll()
+// delegation certificates of a provider, stored under the hash of the
+// delegated signing key
+type Delegations struct {
+	dbs services.Map
 }
 
-func (a *AppointmentDatesByID) Get(id []byte) (string, error) {
-	if data, err := a.dbs.Get(id); err != nil {
-		return "", err
+func (d *Delegations) Set(id []byte, delegation *services.SignedDelegationData) error {
+	if data, err := json.Marshal(delegation); err != nil {
+		return err
 	} else {
-		return string(data), nil
+		return d.dbs.Set(id, data)
 	}
 }
 
-func (a *AppointmentDatesByID) Set(id []byte, date string) error {
-	// ID map will auto-delete after one year (purely for storage reasons, it does not contain sensitive data)
-	if err := a.db.Expire("appointmentDatesByID", a.providerID, time.Hour*24*365); err != nil {
-		return err
+func (d *Delegations) Get(id []byte) (*services.SignedDelegationData, error) {
+	if data, err := d.dbs.Get(id); err != nil {
+		return nil, err
+	} else {
+		return parseDelegation(data)
 	}
-	return a.dbs.Set(id, []byte(date))
 }
 
-func (a *AppointmentDatesByID) Del(id []byte) error {
-	return a.dbs.Del(id)
+func (d *Delegations) GetAll() ([]*services.SignedDelegationData, error) {
+
+	allData, err := d.dbs.GetAll()
+
+	if err != nil {
+		return nil, err
+	}
+
+	delegations := make([]*services.SignedDelegationData, 0, len(allData))
+
+	for _, data := range allData {
+		if delegation, err := parseDelegation(data); err != nil {
+			return nil, err
+		} else {
+			delegations = append(delegations, delegation)
+		}
+	}
+
+	return delegations, nil
 }
 
-type PublicProviderData struct {
-	dbs services.Map
+func (d *Delegations) Del(id []byte) error {
+	return d.dbs.Del(id)
 }
 
-func (p *PublicProviderData) Get(id []byte) (*services.SignedProviderData, error) {
-	if data, err := p.dbs.Get(id); err != nil {
+func parseDelegation(data []byte) (*services.SignedDelegationData, error) {
+
+	delegation := &services.SignedDelegationData{}
+
+	if err := json.Unmarshal(data, delegation); err != nil {
 		return nil, err
-	} else if signedProviderData, err := SignedProviderData(data); err != nil {
+	}
+
+	delegation.Data = &services.DelegationData{}
+
+	if err := json.Unmarshal([]byte(delegation.JSON), delegation.Data); err != nil {
 		return nil, err
-	} else {
-		return signedProviderData, nil
 	}
+
+	return delegation, nil
+}
+
+// maps the hash of a delegated signing key to the ID of the provider
+type DelegateProviders struct {
+	dbs services.Map
+}
+
+func (d *DelegateProviders) Set(id, providerID []byte) error {
+	return d.dbs.Set(id, providerID)
+}
+
+func (d *DelegateProviders) Get(id []byte) ([]byte, error) {
+	return d.dbs.Get(id)
+}
+
+func (d *DelegateProviders) Del(id []byte) error {
+	return d.dbs.Del(id)
+}
+
+// IDs of all providers with pending approvals
+type PendingProviderApprovals struct {
+	dbs services.Set
+}
+
+func (p *PendingProviderApprovals) Add(providerID []byte) error {
+	return p.dbs.Add(providerID)
+}
+
+func (p *PendingProviderApprovals) Del(providerID []byte) error {
+	return p.dbs.Del(providerID)
+}
+
+func (p *PendingProviderApprovals) GetAll() ([][]byte, error) {
+
+	members, err := p.dbs.Members()
+
+	if err != nil {
+		return nil, err
+	}
+
+	providerIDs := make([][]byte, len(members))
+
+	for i, member := range members {
+		providerIDs[i] = member.Data
+	}
+
+	return providerIDs, nil
+}
+
+type Codes struct {
+	codes  services.Set
+	scores services.SortedSet
+}
+
+func (c *Codes) Has(code []byte) (bool, error) {
+	return c.codes.Has(code)
+}
+
+func (c *Codes) Add(code []byte) error {
+	return c.codes.Add(code)
+}
+
+func (c *Codes) Del(code []byte) error {
+	return c.codes.Del(code)
+}
+
+func (c *Codes) Score(code []byte) (int64, error) {
+	return c.scores.Score(code)
+}
+
+func (c *Codes) AddToScore(code []byte, score int64) error {
+	return c.scores.Add(code, score)
+}
+
+// code batches and the assignment of codes to them, codes that were added
+// without a batch do not appear here
+type CodeBatches struct {
+	db      services.Database
+	batches services.Map
+	codes   services.Map
+}
+
+func (c *CodeBatches) count(id []byte, name string) services.Integer {
+	return c.db.Integer(name, id)
+}
+
+func (c *CodeBatches) Set(batch *services.CodeBatch) error {
+	if data, err := json.Marshal(batch); err != nil {
+		return err
+	} else {
+		return c.batches.Set(batch.ID, data)
+	}
+}
+
+func (c *CodeBatches) parse(data []byte) (*services.CodeBatch, error) {
+
+	batch := &services.CodeBatch{}
+
+	if err := json.Unmarshal(data, batch); err != nil {
+		return nil, err
+	}
+
+	// the counts are stored separately, as they change frequently
+	for name, value := range map[string]*int64{
+		"codeBatchCodes":    &batch.Codes,
+		"codeBatchRedeemed": &batch.Redeemed,
+	} {
+		if n, err := c.count(batch.ID, name).Get(); err != nil && err != databases.NotFound {
+			return nil, err
+		} else {
+			*value = n
+		}
+	}
+
+	return batch, nil
+}
+
+func (c *CodeBatches) Get(id []byte) (*services.CodeBatch, error) {
+	if data, err := c.batches.Get(id); err != nil {
+		return nil, err
+	} else {
+		return c.parse(data)
+	}
+}
+
+func (c *CodeBatches) GetAll() ([]*services.CodeBatch, error) {
+
+	allData, err := c.batches.GetAll()
+
+	if err != nil {
+		return nil, err
+	}
+
+	batches := make([]*services.CodeBatch, 0, len(allData))
+
+	for _, data := range allData {
+		if batch, err := c.parse(data); err != nil {
+			return nil, err
+		} else {
+			batches = append(batches, batch)
+		}
+	}
+
+	return batches, nil
+}
+
+// adds the code to the batch, codes can only belong to one batch
+func (c *CodeBatches) AddCode(id, code []byte) error {
+
+	if _, err := c.codes.Get(code); err == nil {
+		return nil
+	} else if err != databases.NotFound {
+		return err
+	}
+
+	if err := c.codes.Set(code, id); err != nil {
+		return err
+	}
+
+	_, err := c.count(id, "codeBatchCodes").IncrBy(1)
+	return err
+}
+
+// returns the batch the code belongs to
+func (c *CodeBatches) BatchOf(code []byte) (*services.CodeBatch, error) {
+	if id, err := c.codes.Get(code); err != nil {
+		return nil, err
+	} else {
+		return c.Get(id)
+	}
+}
+
+// records that a code of the batch was used for the first time
+func (c *CodeBatches) Redeem(code []byte) error {
+
+	id, err := c.codes.Get(code)
+
+	if err == databases.NotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	_, err = c.count(id, "codeBatchRedeemed").IncrBy(1)
+	return err
+}
+
+// invitations by the hash of their code
+type Invitations struct {
+	dbs services.Map
+}
+
+func (i *Invitations) Set(invitation *services.Invitation) error {
+	if data, err := json.Marshal(invitation); err != nil {
+		return err
+	} else {
+		return i.dbs.Set(invitation.ID, data)
+	}
+}
+
+func (i *Invitations) Get(id []byte) (*services.Invitation, error) {
+
+	data, err := i.dbs.Get(id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	invitation := &services.Invitation{}
+
+	if err := json.Unmarshal(data, invitation); err != nil {
+		return nil, err
+	}
+
+	return invitation, nil
+}
+
+type ConfirmedProviderData struct {
+	dbs services.Map
+}
+
+func (c *ConfirmedProviderData) Set(providerID []byte, encryptedData *services.ConfirmedProviderData) error {
+	if data, err := json.Marshal(encryptedData); err != nil {
+		return err
+	} else {
+		return c.dbs.Set(providerID, data)
+	}
+}
+
+func (c *ConfirmedProviderData) Get(providerID []byte) (*services.ConfirmedProviderData, error) {
+	if data, err := c.dbs.Get(providerID); err != nil {
+		return nil, err
+	} else {
+		var mapData map[string]interface{}
+		encryptedData := &services.ConfirmedProviderData{}
+		if err := json.Unmarshal(data, &mapData); err != nil {
+			return nil, err
+		} else if params, err := forms.ConfirmedProviderDataForm.Validate(mapData); err != nil {
+			return nil, err
+		} else if err := forms.ConfirmedProviderDataForm.Coerce(encryptedData, params); err != nil {
+			return nil, err
+		} else {
+			return encryptedData, nil
+		}
+	}
+}
+
+type RawProviderData struct {
+	dbs services.Map
+}
+
+func (c *RawProviderData) Set(providerID []byte, rawData *services.RawProviderData) error {
+	if data, err := json.Marshal(rawData); err != nil {
+		return err
+	} else {
+		return c.dbs.Set(providerID, data)
+	}
+}
+
+func (c *RawProviderData) Del(providerID []byte) error {
+	return c.dbs.Del(providerID)
+}
+
+func (c *RawProviderData) Get(providerID []byte) (*services.RawProviderData, error) {
+	if data, err := c.dbs.Get(providerID); err != nil {
+		return nil, err
+	} else {
+		var mapData map[string]interface{}
+		rawData := &services.RawProviderData{}
+		if err := json.Unmarshal(data, &mapData); err != nil {
+			return nil, err
+		} else if params, err := forms.RawProviderDataForm.Validate(mapData); err != nil {
+			return nil, err
+		} else if err := forms.RawProviderDataForm.Coerce(rawData, params); err != nil {
+			return nil, err
+		} else {
+			return rawData, nil
+		}
+	}
+}
+
+func (c *RawProviderData) GetAll() (map[string]*services.RawProviderData, error) {
+	if dataMap, err := c.dbs.GetAll(); err != nil {
+		return nil, err
+	} else {
+		providerDataMap := map[string]*services.RawProviderData{}
+		for id, data := range dataMap {
+			var mapData map[string]interface{}
+			rawData := &services.RawProviderData{}
+			if err := json.Unmarshal(data, &mapData); err != nil {
+				return nil, err
+			} else if params, err := forms.RawProviderDataForm.Validate(mapData); err != nil {
+				return nil, err
+			} else if err := forms.RawProviderDataForm.Coerce(rawData, params); err != nil {
+				return nil, err
+			} else {
+				providerDataMap[id] = rawData
+			}
+		}
+		return providerDataMap, nil
+	}
+}
+
+// all verified versions of the data of a provider, by version number
+type ProviderDataVersions struct {
+	dbs services.Map
+}
+
+func (p *ProviderDataVersions) Set(rawData *services.RawProviderData) error {
+	if data, err := json.Marshal(rawData); err != nil {
+		return err
+	} else {
+		return p.dbs.Set([]byte(strconv.FormatInt(rawData.Version, 10)), data)
+	}
+}
+
+// returns all versions, the oldest first
+func (p *ProviderDataVersions) GetAll() ([]*services.RawProviderData, error) {
+
+	allData, err := p.dbs.GetAll()
+
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]*services.RawProviderData, 0, len(allData))
+
+	for _, data := range allData {
+		rawData := &services.RawProviderData{}
+		if err := json.Unmarshal(data, rawData); err != nil {
+			return nil, err
+		}
+		versions = append(versions, rawData)
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Version < versions[j].Version
+	})
+
+	return versions, nil
+}
+
+// rejected updates are stored as the signed requests of the mediators
+type ProviderDataRejections struct {
+	dbs services.Map
+}
+
+func (p *ProviderDataRejections) Add(record *services.RejectProviderDataUpdateSignedParams) error {
+	if data, err := json.Marshal(record); err != nil {
+		return err
+	} else {
+		return p.dbs.Set(crypto.Hash([]byte(record.JSON)), data)
+	}
+}
+
+func (p *ProviderDataRejections) GetAll() ([]*services.RejectProviderDataUpdateSignedParams, error) {
+
+	allData, err := p.dbs.GetAll()
+
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]*services.RejectProviderDataUpdateSignedParams, 0, len(allData))
+
+	for _, data := range allData {
+
+		record := &services.RejectProviderDataUpdateSignedParams{}
+
+		if err := json.Unmarshal(data, record); err != nil {
+			return nil, err
+		}
+
+		record.Data = &services.RejectProviderDataUpdateParams{}
+
+		if err := json.Unmarshal([]byte(record.JSON), record.Data); err != nil {
+			return nil, err
+		}
+
+		records = append(records, record)
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Data.Timestamp.Before(records[j].Data.Timestamp)
+	})
+
+	return records, nil
+}
+
+// the rejection of the data of a provider that has not been verified yet,
+// stored as the signed request of the mediator
+type ProviderRejections struct {
+	dbs services.Map
+}
+
+func (p *ProviderRejections) Set(providerID []byte, record *services.RejectProviderSignedParams) error {
+	if data, err := json.Marshal(record); err != nil {
+		return err
+	} else {
+		return p.dbs.Set(providerID, data)
+	}
+}
+
+func (p *ProviderRejections) Get(providerID []byte) (*services.RejectProviderSignedParams, error) {
+
+	data, err := p.dbs.Get(providerID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	record := &services.RejectProviderSignedParams{}
+
+	if err := json.Unmarshal(data, record); err != nil {
+		return nil, err
+	}
+
+	record.Data = &services.RejectProviderParams{}
+
+	if err := json.Unmarshal([]byte(record.JSON), record.Data); err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+func (p *ProviderRejections) Del(providerID []byte) error {
+	return p.dbs.Del(providerID)
+}
+
+// appends to the logs are serialized via a short lock, so that each entry
+// refers to its predecessor. The lock expires after logLockTTL in case its
+// holder dies, callers wait up to logLockWait to obtain it.
+const (
+	logLockTTL  = 5 * time.Second
+	logLockWait = time.Second
+)
+
+// the audit log table is never reset (see resetDB)
+const auditLogTable = "auditLog"
+
+// the append-only audit log, the head contains the last entry so that new
+// entries can be chained to it
+type AuditLog struct {
+	db      services.Database
+	entries services.Map
+	head    services.Value
+}
+
+// appends the entry to the log, setting its index and hashes
+func (a *AuditLog) Append(entry *services.AuditLogEntry) error {
+
+	lock, err := a.db.LockFor(auditLogTable+"::lock", logLockTTL, logLockWait)
+
+	if err != nil {
+		return err
+	}
+
+	defer lock.Release()
+
+	entry.Index = 1
+	entry.PrevHash = nil
+
+	if head, err := a.Head(); err == nil {
+		entry.Index = head.Index + 1
+		entry.PrevHash = head.Hash
+	} else if err != databases.NotFound {
+		return err
+	}
+
+	if hash, err := entry.ComputeHash(); err != nil {
+		return err
+	} else {
+		entry.Hash = hash
+	}
+
+	data, err := json.Marshal(entry)
+
+	if err != nil {
+		return err
+	}
+
+	if err := a.entries.Set([]byte(strconv.FormatInt(entry.Index, 10)), data); err != nil {
+		return err
+	}
+
+	return a.head.Set(data, 0)
+}
+
+// returns the last entry of the log
+func (a *AuditLog) Head() (*services.AuditLogEntry, error) {
+	if data, err := a.head.Get(); err != nil {
+		return nil, err
+	} else {
+		return parseAuditLogEntry(data)
+	}
+}
+
+// returns at most limit consecutive entries, starting at the given index
+func (a *AuditLog) GetRange(from, limit int64) ([]*services.AuditLogEntry, error) {
+
+	entries := make([]*services.AuditLogEntry, 0)
+
+	for i := from; i < from+limit; i++ {
+
+		data, err := a.entries.Get([]byte(strconv.FormatInt(i, 10)))
+
+		if err == databases.NotFound {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		entry, err := parseAuditLogEntry(data)
+
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func parseAuditLogEntry(data []byte) (*services.AuditLogEntry, error) {
+	entry := &services.AuditLogEntry{}
+	if err := json.Unmarshal(data, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// the append-only key log, which forms a Merkle tree of all key events. The
+// ids map contains the index of the latest entry of each actor key, the states
+// map the hash of the last logged data for keys that are logged on change.
+// The hashes of complete subtrees and the tree head are stored on append, so
+// that heads and proofs don't require reading all entries.
+type KeyLog struct {
+	db         services.Database
+	entries    services.Map
+	ids        services.Map
+	states     services.Map
+	nodes      services.Map
+	head       services.Value
+	treeHead   services.Value
+	signedHead services.Value
+}
+
+func (k *KeyLog) lock() (services.Lock, error) {
+	return k.db.LockFor("keyLog::lock", logLockTTL, logLockWait)
+}
+
+// appends the event to the log
+func (k *KeyLog) Append(event *services.KeyEvent) (*services.KeyLogEntry, error) {
+
+	lock, err := k.lock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer lock.Release()
+
+	return k.append(event)
+}
+
+// appends the event to the log unless the data of the last event with the
+// same state name was identical
+func (k *KeyLog) AppendIfChanged(state string, event *services.KeyEvent) error {
+
+	hash := crypto.Hash([]byte(event.Data))
+
+	// we check the state first to avoid taking the lock if nothing changed
+	if current, err := k.states.Get([]byte(state)); err == nil && bytes.Equal(current, hash) {
+		return nil
+	} else if err != nil && err != databases.NotFound {
+		return err
+	}
+
+	lock, err := k.lock()
+
+	if err != nil {
+		return err
+	}
+
+	defer lock.Release()
+
+	if current, err := k.states.Get([]byte(state)); err == nil && bytes.Equal(current, hash) {
+		return nil
+	} else if err != nil && err != databases.NotFound {
+		return err
+	}
+
+	if _, err := k.append(event); err != nil {
+		return err
+	}
+
+	return k.states.Set([]byte(state), hash)
+}
+
+func (k *KeyLog) append(event *services.KeyEvent) (*services.KeyLogEntry, error) {
+
+	size, err := k.Size()
+
+	if err != nil {
+		return nil, err
+	}
+
+	eventData, err := json.Marshal(event)
+
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &services.KeyLogEntry{
+		Index: size,
+		Data:  string(eventData),
+	}
+
+	entry.LeafHash = entry.ComputeLeafHash()
+
+	data, err := json.Marshal(entry)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := k.entries.Set([]byte(strconv.FormatInt(entry.Index, 10)), data); err != nil {
+		return nil, err
+	}
+
+	nodes, err := crypto.MerkleAppend(k.Node, entry.Index, entry.LeafHash)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for level, hash := range nodes {
+		if err := k.nodes.Set(keyLogNodeKey(uint(level), entry.Index>>uint(level)), hash); err != nil {
+			return nil, err
+		}
+	}
+
+	rootHash, err := crypto.MerkleRootOf(k.Node, entry.Index+1)
+
+	if err != nil {
+		return nil, err
+	}
+
+	treeHeadData, err := json.Marshal(&services.TreeHead{
+		TreeSize:  entry.Index + 1,
+		RootHash:  rootHash,
+		Timestamp: time.Now().UTC(),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := k.treeHead.Set(treeHeadData, 0); err != nil {
+		return nil, err
+	}
+
+	if event.ID != nil {
+		if err := k.ids.Set(event.ID, []byte(strconv.FormatInt(entry.Index, 10))); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := k.head.Set(data, 0); err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// returns the number of entries in the log
+func (k *KeyLog) Size() (int64, error) {
+	if data, err := k.head.Get(); err == databases.NotFound {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	} else if head, err := parseKeyLogEntry(data); err != nil {
+		return 0, err
+	} else {
+		return head.Index + 1, nil
+	}
+}
+
+// returns the index of the latest entry of the given actor key
+func (k *KeyLog) IndexOf(id []byte) (int64, error) {
+	if data, err := k.ids.Get(id); err != nil {
+		return 0, err
+	} else {
+		return strconv.ParseInt(string(data), 10, 64)
+	}
+}
+
+func (k *KeyLog) Get(index int64) (*services.KeyLogEntry, error) {
+	if data, err := k.entries.Get([]byte(strconv.FormatInt(index, 10))); err != nil {
+		return nil, err
+	} else {
+		return parseKeyLogEntry(data)
+	}
+}
+
+// returns at most limit consecutive entries, starting at the given index
+func (k *KeyLog) GetRange(from, limit int64) ([]*services.KeyLogEntry, error) {
+
+	entries := make([]*services.KeyLogEntry, 0)
+
+	for i := from; i < from+limit; i++ {
+
+		entry, err := k.Get(i)
+
+		if err == databases.NotFound {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func keyLogNodeKey(level uint, index int64) []byte {
+	return []byte(fmt.Sprintf("%d:%d", level, index))
+}
+
+// returns the hash of a complete subtree (see crypto.MerkleNodes)
+func (k *KeyLog) Node(level uint, index int64) ([]byte, error) {
+	return k.nodes.Get(keyLogNodeKey(level, index))
+}
+
+// returns the head of the tree as of the last append
+func (k *KeyLog) TreeHead() (*services.TreeHead, error) {
+
+	data, err := k.treeHead.Get()
+
+	if err == databases.NotFound {
+		return &services.TreeHead{
+			TreeSize:  0,
+			RootHash:  crypto.MerkleRoot(nil),
+			Timestamp: time.Now().UTC(),
+		}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	treeHead := &services.TreeHead{}
+
+	if err := json.Unmarshal(data, treeHead); err != nil {
+		return nil, err
+	}
+
+	return treeHead, nil
+}
+
+// returns the last signed tree head, which may be older than the current one
+func (k *KeyLog) SignedTreeHead() (*services.SignedTreeHead, error) {
+
+	data, err := k.signedHead.Get()
+
+	if err != nil {
+		return nil, err
+	}
+
+	signedTreeHead := &services.SignedTreeHead{}
+
+	if err := json.Unmarshal(data, signedTreeHead); err != nil {
+		return nil, err
+	}
+
+	signedTreeHead.Data = &services.TreeHead{}
+
+	if err := json.Unmarshal([]byte(signedTreeHead.JSON), signedTreeHead.Data); err != nil {
+		return nil, err
+	}
+
+	return signedTreeHead, nil
+}
+
+func (k *KeyLog) SetSignedTreeHead(signedTreeHead *services.SignedTreeHead) error {
+	if data, err := json.Marshal(signedTreeHead); err != nil {
+		return err
+	} else {
+		return k.signedHead.Set(data, 0)
+	}
+}
+
+func parseKeyLogEntry(data []byte) (*services.KeyLogEntry, error) {
+	entry := &services.KeyLogEntry{}
+	if err := json.Unmarshal(data, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// IDs of all providers with unverified data, scored by the submission time
+// (in milliseconds, as scores are stored as floating point numbers)
+type VerificationQueue struct {
+	dbs services.SortedSet
+}
+
+func (v *VerificationQueue) Add(providerID []byte, submittedAt time.Time) error {
+	return v.dbs.Add(providerID, submittedAt.UnixNano()/int64(time.Millisecond))
+}
+
+func (v *VerificationQueue) SubmittedAt(providerID []byte) (time.Time, error) {
+	if score, err := v.dbs.Score(providerID); err != nil {
+		return time.Time{}, err
+	} else {
+		return time.Unix(0, score*int64(time.Millisecond)).UTC(), nil
+	}
+}
+
+func (v *VerificationQueue) Del(providerID []byte) error {
+	_, err := v.dbs.Del(providerID)
+	return err
+}
+
+// returns all entries, the oldest first
+func (v *VerificationQueue) GetAll() ([]*services.PendingProviderData, error) {
+
+	entries, err := v.dbs.Range(0, -1)
+
+	if err != nil {
+		return nil, err
+	}
+
+	pendingData := make([]*services.PendingProviderData, len(entries))
+
+	for i, entry := range entries {
+		pendingData[i] = &services.PendingProviderData{
+			ID:          entry.Data,
+			SubmittedAt: time.Unix(0, entry.Score*int64(time.Millisecond)).UTC(),
+		}
+	}
+
+	return pendingData, nil
+}
+
+// Claims on provider data. A claim is held until it expires, claims are
+// checked and changed under a short lock on the provider ID.
+type VerificationClaims struct {
+	db  services.Database
+	dbs services.Map
+}
+
+const (
+	claimLockTTL  = 5 * time.Second
+	claimLockWait = time.Second
+)
+
+func (v *VerificationClaims) lock(providerID []byte) (services.Lock, error) {
+	return v.db.LockFor(fmt.Sprintf("verificationClaims::lock::%s", hex.EncodeToString(providerID)), claimLockTTL, claimLockWait)
+}
+
+// Claim stores the claim unless an active claim of another mediator exists,
+// in which case it returns false and the existing claim. A mediator that
+// claims the provider data again extends its own claim.
+func (v *VerificationClaims) Claim(providerID []byte, claim *services.VerificationClaim) (bool, *services.VerificationClaim, error) {
+
+	lock, err := v.lock(providerID)
+
+	if err != nil {
+		return false, nil, err
+	}
+
+	defer lock.Release()
+
+	existingClaim, err := v.Get(providerID)
+
+	if err != nil && err != databases.NotFound {
+		return false, nil, err
+	}
+
+	if existingClaim != nil && existingClaim.IsActive(claim.ClaimedAt) {
+		if !bytes.Equal(existingClaim.MediatorID, claim.MediatorID) {
+			return false, existingClaim, nil
+		}
+		claim.ClaimedAt = existingClaim.ClaimedAt
+	}
+
+	return true, nil, v.set(providerID, claim)
+}
+
+// Release removes the claim unless it is an active claim of another mediator,
+// in which case it returns false and the existing claim.
+func (v *VerificationClaims) Release(providerID, mediatorID []byte, now time.Time) (bool, *services.VerificationClaim, error) {
+
+	lock, err := v.lock(providerID)
+
+	if err != nil {
+		return false, nil, err
+	}
+
+	defer lock.Release()
+
+	claim, err := v.Get(providerID)
+
+	if err != nil {
+		return false, nil, err
+	}
+
+	if claim.IsActive(now) && !bytes.Equal(claim.MediatorID, mediatorID) {
+		return false, claim, nil
+	}
+
+	return true, nil, v.Del(providerID)
+}
+
+func (v *VerificationClaims) set(providerID []byte, claim *services.VerificationClaim) error {
+	if data, err := json.Marshal(claim); err != nil {
+		return err
+	} else {
+		return v.dbs.Set(providerID, data)
+	}
+}
+
+func (v *VerificationClaims) Get(providerID []byte) (*services.VerificationClaim, error) {
+
+	data, err := v.dbs.Get(providerID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	claim := &services.VerificationClaim{}
+
+	if err := json.Unmarshal(data, claim); err != nil {
+		return nil, err
+	}
+
+	return claim, nil
+}
+
+func (v *VerificationClaims) GetAll() (map[string]*services.VerificationClaim, error) {
+
+	allData, err := v.dbs.GetAll()
+
+	if err != nil {
+		return nil, err
+	}
+
+	claims := make(map[string]*services.VerificationClaim)
+
+	for id, data := range allData {
+		claim := &services.VerificationClaim{}
+		if err := json.Unmarshal(data, claim); err != nil {
+			return nil, err
+		}
+		claims[id] = claim
+	}
+
+	return claims, nil
+}
+
+func (v *VerificationClaims) Del(providerID []byte) error {
+	if err := v.dbs.Del(providerID); err != nil && err != databases.NotFound {
+		return err
+	}
+
+	return nil
+}
+
+type UsedTokens struct {
+	dbs services.Set
+}
+
+func (t *UsedTokens) Del(token []byte) error {
+	return t.dbs.Del(token)
+}
+
+func (t *UsedTokens) Has(token []byte) (bool, error) {
+	return t.dbs.Has(token)
+}
+
+func (t *UsedTokens) Add(token []byte) error {
+	return t.dbs.Add(token)
+}
+
+type RevokedTokens struct {
+	dbs services.Set
+}
+
+func (t *RevokedTokens) Has(token []byte) (bool, error) {
+	return t.dbs.Has(token)
+}
+
+func (t *RevokedTokens) Add(token []byte) error {
+	return t.dbs.Add(token)
+}
+
+// the number of tokens issued for a given hash during the current window
+type TokenIssuance struct {
+	count services.Integer
+}
+
+// Incr returns the number of tokens issued during the current window
+// (including this one), the window starts with the first token
+func (t *TokenIssuance) Incr(window time.Duration) (int64, error) {
+	// the expiry is set in the same step, so the count can't outlive the window
+	return t.count.IncrByWithTTL(1, window)
+}
+
+// nonces of token challenges that were already solved
+type TokenChallenges struct {
+	db services.Database
+}
+
+// Use marks the challenge with the given nonce as used and returns false if
+// it was used before. The entry expires after the given TTL, which should be
+// at least as long as the challenge itself is valid.
+func (t *TokenChallenges) Use(nonce []byte, ttl time.Duration) (bool, error) {
+	// the nonce is recorded together with its expiry in a single step
+	return t.db.Value("tokenChallenges", nonce).SetIfNotExists([]byte("1"), ttl)
+}
+
+type AppointmentDatesByID struct {
+	providerID []byte
+	dbs        services.Map
+	db         services.Database
+}
+
+func (a *AppointmentDatesByID) GetAll() (map[string][]byte, error) {
+	return a.dbs.GetAll()
+}
+
+func (a *AppointmentDatesByID) Get(id []byte) (string, error) {
+	if data, err := a.dbs.Get(id); err != nil {
+		return "", err
+	} else {
+		return string(data), nil
+	}
+}
+
+func (a *AppointmentDatesByID) Set(id []byte, date string) error {
+	// ID map will auto-delete after one year (purely for storage reasons, it does not contain sensitive data)
+	if err := a.db.Expire("appointmentDatesByID", a.providerID, time.Hour*24*365); err != nil {
+		return err
+	}
+	return a.dbs.Set(id, []byte(date))
+}
+
+func (a *AppointmentDatesByID) Del(id []byte) error {
+	return a.dbs.Del(id)
+}
+
+type AppointmentTombstones struct {
+	providerID []byte
+	dbs        services.Map
+	db         services.Database
+}
+
+func (a *AppointmentTombstones) Add(id []byte, deletedAt time.Time) error {
+	if err := a.dbs.Set(id, []byte(deletedAt.Format(time.RFC3339Nano))); err != nil {
+		return err
+	}
+	// tombstones will auto-delete after one year, just like the ID map
+	return a.db.Expire("appointmentTombstones", a.providerID, time.Hour*24*365)
+}
+
+func (a *AppointmentTombstones) Del(id []byte) error {
+	return a.dbs.Del(id)
+}
+
+func (a *AppointmentTombstones) GetAll() ([]*services.AppointmentTombstone, error) {
+	tombstones := make([]*services.AppointmentTombstone, 0)
+	if allTombstones, err := a.dbs.GetAll(); err != nil {
+		return nil, err
+	} else {
+		for id, data := range allTombstones {
+			if deletedAt, err := time.Parse(time.RFC3339Nano, string(data)); err != nil {
+				return nil, err
+			} else {
+				tombstones = append(tombstones, &services.AppointmentTombstone{
+					ID:        []byte(id),
+					DeletedAt: deletedAt,
+				})
+			}
+		}
+	}
+	return tombstones, nil
+}
+
+// the change log only keeps the latest changes of each provider, clients that
+// are further behind need to resync
+const maxAppointmentChanges = 10000
+
+const appointmentChangesTTL = time.Hour * 24 * 365
+
+type AppointmentChanges struct {
+	providerID []byte
+	db         services.Database
+	seq        services.Integer
+	epoch      services.Value
+	changes    services.SortedSet
+}
+
+// Record adds a change to the log, using a monotonically increasing sequence
+// number that is scoped to the provider. A new log (e.g. after the previous
+// one expired) gets a new epoch, so that clients notice the sequence numbers
+// start over.
+func (a *AppointmentChanges) Record(id []byte, deleted bool) (int64, error) {
+
+	epoch, err := crypto.RandomBytes(32)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := a.epoch.SetIfNotExists(epoch, appointmentChangesTTL); err != nil {
+		return 0, err
+	}
+
+	seq, err := a.seq.IncrBy(1)
+
+	if err != nil {
+		return 0, err
+	}
+
+	change := &services.AppointmentChange{
+		Seq:     seq,
+		ID:      id,
+		Deleted: deleted,
+	}
+
+	if data, err := json.Marshal(change); err != nil {
+		return 0, err
+	} else if err := a.changes.Add(data, seq); err != nil {
+		return 0, err
+	}
+
+	if seq > maxAppointmentChanges {
+		if err := a.changes.RemoveRangeByScore(0, seq-maxAppointmentChanges); err != nil {
+			return 0, err
+		}
+	}
+
+	// the change log will auto-delete after one year, just like the ID map
+	for _, table := range []string{"appointmentChangesSeq", "appointmentChangesEpoch", "appointmentChanges"} {
+		if err := a.db.Expire(table, a.providerID, appointmentChangesTTL); err != nil {
+			return 0, err
+		}
+	}
+
+	return seq, nil
+}
+
+// Epoch returns the epoch of the change log, or nil if there's no log
+func (a *AppointmentChanges) Epoch() ([]byte, error) {
+	if epoch, err := a.epoch.Get(); err == databases.NotFound {
+		return nil, nil
+	} else {
+		return epoch, err
+	}
+}
+
+// Seq returns the sequence number of the latest change
+func (a *AppointmentChanges) Seq() (int64, error) {
+	if seq, err := a.seq.Get(); err == databases.NotFound {
+		return 0, nil
+	} else {
+		return seq, err
+	}
+}
+
+// Since returns the changes with a sequence number larger than the given one,
+// up to the given limit
+func (a *AppointmentChanges) Since(seq, limit int64) ([]*services.AppointmentChange, error) {
+
+	// sequence numbers are consecutive, so the limit is a range of scores
+	entries, err := a.changes.RangeByScore(seq+1, seq+limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]*services.AppointmentChange, 0, len(entries))
+
+	for _, entry := range entries {
+		var change *services.AppointmentChange
+		if err := json.Unmarshal(entry.Data, &change); err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+
+	return changes, nil
+}
+
+type PublicProviderData struct {
+	dbs services.Map
+}
+
+func (p *PublicProviderData) Get(id []byte) (*services.SignedProviderData, error) {
+	if data, err := p.dbs.Get(id); err != nil {
+		return nil, err
+	} else if signedProviderData, err := SignedProviderData(data); err != nil {
+		return nil, err
+	} else {
+		return signedProviderData, nil
+	}
+}
+
+func (p *PublicProviderData) Del(id []byte) error {
+	return p.dbs.Del(id)
 }
 
 func (p *PublicProviderData) Set(id []byte, signedProviderData *services.SignedProviderData) error {
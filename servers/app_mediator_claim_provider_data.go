@@ -0,0 +1,222 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"bytes"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/databases"
+	"time"
+)
+
+// Claims pending provider data for verification by the calling mediator.
+// Claims expire after a lease timeout, a mediator can extend its own claim by
+// claiming the provider data again.
+func (c *Appointments) claimProviderData(context services.Context, params *services.ProviderDataClaimSignedParams) services.Response {
+
+	resp, mediatorKey := c.isMediator(context, &services.SignedParams{
+		JSON:      params.JSON,
+		Signature: params.Signature,
+		PublicKey: params.PublicKey,
+		Timestamp: params.Data.Timestamp,
+	})
+
+	if resp != nil {
+		return resp
+	}
+
+	providerID := params.Data.ID
+
+	if _, err := c.backend.VerificationQueue().SubmittedAt(providerID); err != nil {
+		if err == databases.NotFound {
+			return context.NotFound()
+		}
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	claims := c.backend.VerificationClaims()
+	now := time.Now().UTC()
+
+	claim := &services.VerificationClaim{
+		MediatorID: mediatorKey.ID,
+		ClaimedAt:  now,
+		ExpiresAt:  now.Add(time.Duration(c.settings.ProviderClaimLeaseMinutes) * time.Minute),
+	}
+
+	if ok, existingClaim, err := claims.Claim(providerID, claim); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else if !ok {
+		return context.Error(409, "provider data already claimed", existingClaim)
+	}
+
+	return context.Result(claim)
+}
+
+// releases a claim so that other mediators can process the provider data
+func (c *Appointments) releaseProviderData(context services.Context, params *services.ProviderDataClaimSignedParams) services.Response {
+
+	resp, mediatorKey := c.isMediator(context, &services.SignedParams{
+		JSON:      params.JSON,
+		Signature: params.Signature,
+		PublicKey: params.PublicKey,
+		Timestamp: params.Data.Timestamp,
+	})
+
+	if resp != nil {
+		return resp
+	}
+
+	// expired claims can be released by anyone
+	if ok, _, err := c.backend.VerificationClaims().Release(params.Data.ID, mediatorKey.ID, time.Now()); err == databases.NotFound {
+		return context.NotFound()
+	} else if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else if !ok {
+		return context.Error(403, "provider data claimed by another mediator", nil)
+	}
+
+	return context.Acknowledge()
+}
+
+// returns an error response if the provider data is claimed by another mediator
+func (c *Appointments) checkVerificationClaim(context services.Context, providerID, mediatorID []byte) services.Response {
+
+	claim, err := c.backend.VerificationClaims().Get(providerID)
+
+	if err == databases.NotFound {
+		return nil
+	} else if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if claim.IsActive(time.Now()) && !bytes.Equal(claim.MediatorID, mediatorID) {
+		return context.Error(409, "provider data claimed by another mediator", claim)
+	}
+
+	return nil
+}
+
+// releases the claim of the given mediator, if it holds one (or an expired one)
+func (c *Appointments) releaseVerificationClaim(providerID, mediatorID []byte) error {
+
+	// claims of other mediators are left alone unless they have expired
+	if _, _, err := c.backend.VerificationClaims().Release(providerID, mediatorID, time.Now()); err != nil && err != databases.NotFound {
+		return err
+	}
+
+	return nil
+}
+
+// adds provider data to the verification queue, data that is already in the
+// queue keeps its original position
+func (c *Appointments) enqueueProviderData(providerID []byte) error {
+
+	queue := c.backend.VerificationQueue()
+
+	if _, err := queue.SubmittedAt(providerID); err == nil {
+		return nil
+	} else if err != databases.NotFound {
+		return err
+	}
+
+	if err := queue.Add(providerID, time.Now()); err != nil {
+		return err
+	}
+
+	c.addVerificationStats("submitted", 1)
+
+	return nil
+}
+
+// removes provider data from the queue and records the outcome (verified or
+// rejected) as well as how long the provider had to wait
+func (c *Appointments) dequeueProviderData(providerID []byte, outcome string) error {
+
+	queue := c.backend.VerificationQueue()
+
+	submittedAt, err := queue.SubmittedAt(providerID)
+
+	if err == nil {
+		if err := queue.Del(providerID); err != nil {
+			return err
+		}
+		c.addVerificationStats(outcome, 1)
+		c.addVerificationStats("waitSeconds", int64(time.Since(submittedAt)/time.Second))
+	} else if err != databases.NotFound {
+		return err
+	}
+
+	return c.backend.VerificationClaims().Del(providerID)
+}
+
+// adds the given value to a verification statistic, the average waiting time
+// is waitSeconds / (verified + rejected)
+func (c *Appointments) addVerificationStats(name string, value int64) {
+
+	if c.meter == nil {
+		return
+	}
+
+	now := time.Now().UTC().UnixNano()
+
+	for _, twt := range tws {
+
+		// generate the time window
+		tw := twt(now)
+
+		if err := c.meter.Add("verification", name, map[string]string{}, tw, value); err != nil {
+			services.Log.Error(err)
+		}
+	}
+}
+
+// records the size of the queue and the age of its oldest entry
+func (c *Appointments) addVerificationQueueStats(pending int64, oldest time.Time) {
+
+	if c.meter == nil {
+		return
+	}
+
+	maxWaitSeconds := int64(0)
+
+	if !oldest.IsZero() {
+		maxWaitSeconds = int64(time.Since(oldest) / time.Second)
+	}
+
+	now := time.Now().UTC().UnixNano()
+
+	for _, twt := range tws {
+
+		// generate the time window
+		tw := twt(now)
+
+		// we use a fixed UID so that we record the maximum for each window
+		if err := c.meter.AddMax("verification", "pending", "queue", map[string]string{}, tw, pending); err != nil {
+			services.Log.Error(err)
+		}
+
+		if err := c.meter.AddMax("verification", "maxWaitSeconds", "queue", map[string]string{}, tw, maxWaitSeconds); err != nil {
+			services.Log.Error(err)
+		}
+	}
+}
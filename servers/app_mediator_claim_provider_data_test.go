@@ -0,0 +1,177 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers_test
+
+import (
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/definitions"
+	"github.com/kiebitz-oss/services/helpers"
+	at "github.com/kiebitz-oss/services/testing"
+	af "github.com/kiebitz-oss/services/testing/fixtures"
+	"testing"
+	"time"
+)
+
+func pendingProviderData(t *testing.T, client *helpers.Client, mediator *crypto.Actor, limit int64, unclaimed bool) []interface{} {
+
+	resp, err := client.Appointments.GetPendingProviderData(&services.GetPendingProviderDataParams{
+		Timestamp: time.Now(),
+		Limit:     limit,
+		Unclaimed: unclaimed,
+	}, mediator)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result, err := resp.JSON(); err != nil {
+		t.Fatal(err)
+	} else if list, ok := result["result"].([]interface{}); !ok {
+		t.Fatalf("expected a list of pending provider data")
+	} else {
+		return list
+	}
+
+	return nil
+}
+
+func TestClaimProviderData(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+
+		// we create two mediators
+		at.FC{af.Mediator{}, "mediator"},
+		at.FC{af.Mediator{}, "otherMediator"},
+
+		// we create two providers (without confirming them)
+		at.FC{af.Provider{
+			ZipCode:   "10707",
+			StoreData: true,
+		}, "provider"},
+		at.FC{af.Provider{
+			ZipCode:   "10707",
+			StoreData: true,
+		}, "otherProvider"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+	mediator := fixtures["mediator"].(*crypto.Actor)
+	otherMediator := fixtures["otherMediator"].(*crypto.Actor)
+	provider := fixtures["provider"].(*helpers.Provider)
+
+	if n := len(pendingProviderData(t, client, mediator, 1, false)); n != 1 {
+		t.Fatalf("expected one entry, got %d", n)
+	}
+
+	if n := len(pendingProviderData(t, client, mediator, 10, false)); n != 2 {
+		t.Fatalf("expected two entries, got %d", n)
+	}
+
+	claimParams := &services.ProviderDataClaimParams{
+		Timestamp: time.Now(),
+		ID:        crypto.Hash(provider.Actor.SigningKey.PublicKey),
+	}
+
+	if resp, err := client.Appointments.ClaimProviderData(claimParams, mediator); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	claimParams.Timestamp = time.Now()
+
+	// the mediator can extend its own claim
+	if resp, err := client.Appointments.ClaimProviderData(claimParams, mediator); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	claimParams.Timestamp = time.Now()
+
+	if resp, err := client.Appointments.ClaimProviderData(claimParams, otherMediator); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 409 {
+		t.Fatalf("expected a 409 status code, got %d instead", resp.StatusCode)
+	}
+
+	if n := len(pendingProviderData(t, client, otherMediator, 10, true)); n != 1 {
+		t.Fatalf("expected one unclaimed entry, got %d", n)
+	}
+
+	// the claimed provider cannot be confirmed by the other mediator
+	if resp, err := client.Appointments.ConfirmProvider(provider, otherMediator); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 409 {
+		t.Fatalf("expected a 409 status code, got %d instead", resp.StatusCode)
+	}
+
+	claimParams.Timestamp = time.Now()
+
+	if resp, err := client.Appointments.ReleaseProviderData(claimParams, otherMediator); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 403 {
+		t.Fatalf("expected a 403 status code, got %d instead", resp.StatusCode)
+	}
+
+	claimParams.Timestamp = time.Now()
+
+	if resp, err := client.Appointments.ReleaseProviderData(claimParams, mediator); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	claimParams.Timestamp = time.Now()
+
+	if resp, err := client.Appointments.ClaimProviderData(claimParams, otherMediator); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	if resp, err := client.Appointments.ConfirmProvider(provider, otherMediator); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	// confirmed providers are removed from the queue
+	if n := len(pendingProviderData(t, client, mediator, 10, false)); n != 1 {
+		t.Fatalf("expected one entry, got %d", n)
+	}
+
+}
@@ -19,6 +19,7 @@
 package servers
 
 import (
+	"bytes"
 	"github.com/kiebitz-oss/services"
 	"github.com/kiebitz-oss/services/crypto"
 	"github.com/kiebitz-oss/services/databases"
@@ -27,7 +28,7 @@ import (
 // { id, key, providerData, keyData }, keyPair
 func (c *Appointments) confirmProvider(context services.Context, params *services.ConfirmProviderSignedParams) services.Response {
 
-	resp, _ := c.isMediator(context, &services.SignedParams{
+	resp, mediatorKey := c.isMediator(context, &services.SignedParams{
 		JSON:      params.JSON,
 		Signature: params.Signature,
 		PublicKey: params.PublicKey,
@@ -38,19 +39,39 @@ func (c *Appointments) confirmProvider(context services.Context, params *service
 		return resp
 	}
 
-	hash := crypto.Hash(params.Data.SignedKeyData.Data.Signing)
+	// providers that rotated their key keep their original ID
+	hash, err := c.providerID(params.Data.SignedKeyData.Data.Signing)
 
-	keys := c.backend.Keys("providers")
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
 
-	providerKey := &services.ActorKey{
-		Data:      params.Data.SignedKeyData.JSON,
-		Signature: params.Data.SignedKeyData.Signature,
-		PublicKey: params.Data.SignedKeyData.PublicKey,
+	// revoked providers cannot be confirmed again
+	if status, err := c.backend.ProviderStatus().Status(hash); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else if status == services.ProviderRevoked {
+		return context.Error(410, "provider has been revoked", nil)
 	}
 
-	if err := keys.Set(hash, providerKey); err != nil {
+	// the provider data may be claimed by another mediator
+	if resp := c.checkVerificationClaim(context, hash, mediatorKey.ID); resp != nil {
+		return resp
+	}
+
+	signedKeyData := params.Data.SignedKeyData
+
+	// the key data needs to be signed by the mediator making the request
+	if !bytes.Equal(signedKeyData.PublicKey, params.PublicKey) {
+		return context.Error(400, "key data not signed by mediator", nil)
+	}
+
+	if ok, err := crypto.VerifyWithBytes([]byte(signedKeyData.JSON), signedKeyData.Signature, signedKeyData.PublicKey); err != nil {
 		services.Log.Error(err)
 		return context.InternalError()
+	} else if !ok {
+		return context.Error(400, "invalid key data signature", nil)
 	}
 
 	unverifiedProviderData := c.backend.UnverifiedProviderData()
@@ -58,20 +79,85 @@ func (c *Appointments) confirmProvider(context services.Context, params *service
 	confirmedProviderData := c.backend.ConfirmedProviderData()
 	publicProviderData := c.backend.PublicProviderData()
 
-	oldPd, err := unverifiedProviderData.Get(hash)
+	currentPd, err := verifiedProviderData.Get(hash)
 
-	if err != nil {
-		if err == databases.NotFound {
-			// maybe this provider has already been verified before...
-			if oldPd, err = verifiedProviderData.Get(hash); err != nil {
-				if err == databases.NotFound {
-					return context.NotFound()
-				} else {
-					services.Log.Error(err)
-					return context.InternalError()
-				}
+	if err != nil && err != databases.NotFound {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	newData := true
+	pd, err := unverifiedProviderData.Get(hash)
+
+	if err == databases.NotFound {
+		// maybe this provider has already been verified before...
+		if currentPd == nil {
+			return context.NotFound()
+		}
+		pd = currentPd
+		newData = false
+	} else if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else if pd.Invitation != nil && pd.Invitation.MetadataHash != nil && !bytes.Equal(pd.Invitation.MetadataHash, params.Data.MetadataHash) {
+		// the server cannot decrypt the provider data, so the mediator needs
+		// to attest that it matches the metadata the invitation is bound to
+		return context.Error(403, "provider metadata does not match the invitation", nil)
+	} else if currentPd != nil {
+		if pd.BaseVersion == 0 {
+			// updates stored before versions were introduced
+			pd.BaseVersion = verifiedVersion(currentPd)
+		} else if pd.BaseVersion != verifiedVersion(currentPd) {
+			return context.Error(409, "provider data update is based on an outdated version", nil)
+		}
+	}
+
+	// the call is audited before any changes are made
+	if err := c.audit("confirmProvider", params.JSON, params.Signature, params.PublicKey); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	keys := c.backend.Keys("providers")
+
+	providerKey := &services.ActorKey{
+		Data:      signedKeyData.JSON,
+		Signature: signedKeyData.Signature,
+		PublicKey: signedKeyData.PublicKey,
+	}
+
+	// if multiple approvals are required we only confirm the provider once
+	// enough mediators have signed the same key data
+	if c.settings.ProviderApprovalsRequired > 1 {
+		resp, approvals := c.approveProvider(context, hash, mediatorKey, providerKey)
+		if resp != nil || approvals == nil {
+			// other mediators need to be able to claim the data for approval
+			if err := c.releaseVerificationClaim(hash, mediatorKey.ID); err != nil {
+				services.Log.Error(err)
+			}
+			if resp != nil {
+				return resp
 			}
-		} else {
+			return context.Acknowledge()
+		}
+		providerKey.Approvals = approvals
+	}
+
+	// the key is logged before it is stored, so that every key in use is
+	// contained in the log
+	if err := c.logKeyEvent("provider", "add", hash, providerKey); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if err := keys.Set(hash, providerKey); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	// new provider data becomes the next verified version
+	if newData {
+		if err := c.addProviderDataVersion(hash, pd, currentPd); err != nil {
 			services.Log.Error(err)
 			return context.InternalError()
 		}
@@ -84,7 +170,7 @@ func (c *Appointments) confirmProvider(context services.Context, params *service
 		}
 	}
 
-	if err := verifiedProviderData.Set(hash, oldPd); err != nil {
+	if err := verifiedProviderData.Set(hash, pd); err != nil {
 		services.Log.Error(err)
 		return context.InternalError()
 	}
@@ -102,5 +188,10 @@ func (c *Appointments) confirmProvider(context services.Context, params *service
 		}
 	}
 
+	if err := c.dequeueProviderData(hash, "verified"); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
 	return context.Acknowledge()
 }
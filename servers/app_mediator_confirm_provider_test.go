@@ -72,10 +72,82 @@ func TestConfirmProvider(t *testing.T) {
 		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
 	}
 
-	result := &services.ConfirmedProviderData{}
+	result := &services.ProviderDataStatus{}
 
-	if err := resp.CoerceResult(result, &forms.ConfirmedProviderDataForm); err != nil {
+	if err := resp.CoerceResult(result, &forms.ProviderDataStatusForm); err != nil {
 		t.Fatal(err)
 	}
 
+	if result.Status != services.ProviderDataConfirmed {
+		t.Fatalf("expected the provider data to be confirmed, got %s instead", result.Status)
+	}
+
+	if result.ConfirmedData == nil {
+		t.Fatalf("expected the confirmed data to be included")
+	}
+
+}
+
+func TestConfirmProviderWithMixedKeyTypes(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+
+		// we create a mediator with Ed25519 & X25519 keys (signed by the P-256 root key)
+		at.FC{af.Mediator{
+			SigningKeyType:    "ed25519",
+			EncryptionKeyType: "x25519",
+		}, "mediator"},
+
+		// we create a provider with a P-256 signing key and an X25519 encryption key
+		at.FC{af.Provider{
+			ZipCode:           "10707",
+			StoreData:         true,
+			Confirm:           true,
+			EncryptionKeyType: "x25519",
+		}, "provider"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+	provider := fixtures["provider"].(*helpers.Provider)
+
+	resp, err := client.Appointments.CheckProviderData(provider)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	result := &services.ProviderDataStatus{}
+
+	if err := resp.CoerceResult(result, &forms.ProviderDataStatusForm); err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Status != services.ProviderDataConfirmed {
+		t.Fatalf("expected the provider data to be confirmed, got %s instead", result.Status)
+	}
+
+	if _, err := provider.Actor.EncryptionKey.Decrypt(result.ConfirmedData.Data); err != nil {
+		t.Fatalf("cannot decrypt the confirmed data: %v", err)
+	}
+
 }
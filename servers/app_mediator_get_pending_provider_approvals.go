@@ -0,0 +1,248 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/databases"
+)
+
+// returns the ID of the first key in the rotation chain of the given mediator
+// key, so that approvals by a rotated key count for the same mediator
+func (c *Appointments) mediatorOrigin(mediatorKey *services.ActorKey) ([]byte, error) {
+
+	mediatorKeys := c.backend.Keys("mediators")
+	key := mediatorKey
+
+	// we limit the chain length in case of cyclic predecessors
+	for i := 0; i < 100; i++ {
+
+		mkd, err := key.MediatorKeyData()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if mkd.Predecessor == nil {
+			return key.ID, nil
+		}
+
+		if predecessorKey, err := mediatorKeys.Get(mkd.Predecessor); err == databases.NotFound {
+			return key.ID, nil
+		} else if err != nil {
+			return nil, err
+		} else {
+			key = predecessorKey
+		}
+	}
+
+	return nil, fmt.Errorf("mediator key chain too long")
+}
+
+// returns the origin of the valid, unrevoked mediator key that made the given
+// approval, or nil if the approval is no longer valid
+func (c *Appointments) approvalOrigin(approval *services.ActorKey, mediatorKeys []*services.ActorKey) ([]byte, error) {
+
+	mediatorKey, err := findActorKey(mediatorKeys, approval.ID)
+
+	if err != nil || mediatorKey == nil {
+		return nil, err
+	}
+
+	if mkd, err := mediatorKey.MediatorKeyData(); err != nil {
+		return nil, err
+	} else if !bytes.Equal(mkd.Signing, approval.PublicKey) {
+		return nil, nil
+	}
+
+	if ok, err := crypto.VerifyWithBytes([]byte(approval.Data), approval.Signature, approval.PublicKey); err != nil || !ok {
+		return nil, err
+	}
+
+	return c.mediatorOrigin(mediatorKey)
+}
+
+// Records the approval of the given provider key by a mediator. Returns no
+// approvals as long as the number of distinct approving mediators is below the
+// required number, and the list of approvals once enough mediators have
+// approved. Stored approvals are verified against the current mediator keys,
+// approvals by expired or revoked keys are dropped. A response is only
+// returned in case of an error.
+func (c *Appointments) approveProvider(context services.Context, providerID []byte, mediatorKey, providerKey *services.ActorKey) (services.Response, []*services.KeyApproval) {
+
+	providerApprovals := c.backend.ProviderApprovals(providerID)
+	pendingProviderApprovals := c.backend.PendingProviderApprovals()
+
+	keys, err := c.getActorKeys()
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError(), nil
+	}
+
+	origin, err := c.mediatorOrigin(mediatorKey)
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError(), nil
+	}
+
+	approvals, err := providerApprovals.GetAll()
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError(), nil
+	}
+
+	origins := map[string]bool{string(origin): true}
+	otherApprovals := make([]*services.ActorKey, 0, len(approvals))
+
+	for _, approval := range approvals {
+
+		approvalOrigin, err := c.approvalOrigin(approval, keys.Mediators)
+
+		if err != nil {
+			services.Log.Error(err)
+			return context.InternalError(), nil
+		}
+
+		if approvalOrigin == nil || bytes.Equal(approval.ID, mediatorKey.ID) {
+			// invalid approvals are dropped and the mediator can replace its
+			// own approval
+			if err := providerApprovals.Del(approval.ID); err != nil {
+				services.Log.Error(err)
+				return context.InternalError(), nil
+			}
+			continue
+		}
+
+		// all mediators need to sign exactly the same key data
+		if approval.Data != providerKey.Data {
+			return context.Error(409, "key data differs from pending approvals", nil), nil
+		}
+
+		// approvals by other keys of the same mediator are only counted once
+		if origins[string(approvalOrigin)] {
+			continue
+		}
+
+		origins[string(approvalOrigin)] = true
+		otherApprovals = append(otherApprovals, approval)
+	}
+
+	// the approval is audited with the signature of the mediator over the
+	// approved key data
+	if err := c.audit("approveProvider", providerKey.Data, providerKey.Signature, providerKey.PublicKey); err != nil {
+		services.Log.Error(err)
+		return context.InternalError(), nil
+	}
+
+	if err := providerApprovals.Set(mediatorKey.ID, providerKey); err != nil {
+		services.Log.Error(err)
+		return context.InternalError(), nil
+	}
+
+	if int64(len(otherApprovals)+1) < c.settings.ProviderApprovalsRequired {
+		if err := pendingProviderApprovals.Add(providerID); err != nil {
+			services.Log.Error(err)
+			return context.InternalError(), nil
+		}
+		return nil, nil
+	}
+
+	keyApprovals := make([]*services.KeyApproval, 0, len(otherApprovals)+1)
+
+	for _, approval := range append(otherApprovals, providerKey) {
+		keyApprovals = append(keyApprovals, &services.KeyApproval{
+			Signature: approval.Signature,
+			PublicKey: approval.PublicKey,
+		})
+	}
+
+	if err := providerApprovals.DelAll(); err != nil {
+		services.Log.Error(err)
+		return context.InternalError(), nil
+	}
+
+	if err := pendingProviderApprovals.Del(providerID); err != nil {
+		services.Log.Error(err)
+		return context.InternalError(), nil
+	}
+
+	return nil, keyApprovals
+}
+
+// returns provider keys that still need approvals by other mediators
+func (c *Appointments) getPendingProviderApprovals(context services.Context, params *services.GetPendingProviderApprovalsSignedParams) services.Response {
+
+	resp, _ := c.isMediator(context, &services.SignedParams{
+		JSON:      params.JSON,
+		Signature: params.Signature,
+		PublicKey: params.PublicKey,
+		Timestamp: params.Data.Timestamp,
+	})
+
+	if resp != nil {
+		return resp
+	}
+
+	providerIDs, err := c.backend.PendingProviderApprovals().GetAll()
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	pendingApprovals := make([]*services.PendingProviderApproval, 0, len(providerIDs))
+
+	for _, providerID := range providerIDs {
+
+		approvals, err := c.backend.ProviderApprovals(providerID).GetAll()
+
+		if err != nil {
+			services.Log.Error(err)
+			return context.InternalError()
+		}
+
+		if len(approvals) == 0 {
+			continue
+		}
+
+		pendingApproval := &services.PendingProviderApproval{
+			ID:        providerID,
+			Data:      approvals[0].Data,
+			Approvals: make([]*services.KeyApproval, len(approvals)),
+			Required:  c.settings.ProviderApprovalsRequired,
+		}
+
+		for i, approval := range approvals {
+			pendingApproval.Approvals[i] = &services.KeyApproval{
+				Signature: approval.Signature,
+				PublicKey: approval.PublicKey,
+			}
+		}
+
+		pendingApprovals = append(pendingApprovals, pendingApproval)
+	}
+
+	return context.Result(pendingApprovals)
+}
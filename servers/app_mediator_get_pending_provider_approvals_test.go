@@ -0,0 +1,264 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers_test
+
+import (
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/definitions"
+	"github.com/kiebitz-oss/services/helpers"
+	at "github.com/kiebitz-oss/services/testing"
+	af "github.com/kiebitz-oss/services/testing/fixtures"
+	"testing"
+	"time"
+)
+
+func pendingApprovals(t *testing.T, client *helpers.Client, mediator *crypto.Actor) []interface{} {
+
+	resp, err := client.Appointments.GetPendingProviderApprovals(&services.GetPendingProviderApprovalsParams{
+		Timestamp: time.Now(),
+	}, mediator)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result, err := resp.JSON(); err != nil {
+		t.Fatal(err)
+	} else if list, ok := result["result"].([]interface{}); !ok {
+		t.Fatalf("expected a list of pending approvals")
+	} else {
+		return list
+	}
+
+	return nil
+}
+
+func TestProviderApprovals(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+
+		// we create two mediators
+		at.FC{af.Mediator{}, "mediator"},
+		at.FC{af.Mediator{}, "otherMediator"},
+
+		// we create a provider (without confirming it)
+		at.FC{af.Provider{
+			ZipCode:   "10707",
+			StoreData: true,
+		}, "provider"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settings := fixtures["settings"].(*services.Settings)
+	client := fixtures["client"].(*helpers.Client)
+	mediator := fixtures["mediator"].(*crypto.Actor)
+	otherMediator := fixtures["otherMediator"].(*crypto.Actor)
+	provider := fixtures["provider"].(*helpers.Provider)
+
+	settings.Appointments.ProviderApprovalsRequired = 2
+
+	publish := func() int {
+
+		appointment, err := services.MakeAppointment(af.TS("2022-10-01T12:00:00Z"), 5, 30)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		appointment.PublicKey = provider.Actor.EncryptionKey.PublicKey
+		appointment.Properties = map[string]interface{}{"vaccine": "moderna"}
+
+		signedAppointment, err := appointment.Sign(provider.Actor.SigningKey)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := client.Appointments.PublishAppointments(&services.PublishAppointmentsParams{
+			Timestamp:    time.Now(),
+			Appointments: []*services.SignedAppointment{signedAppointment},
+		}, provider)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return resp.StatusCode
+	}
+
+	if resp, err := client.Appointments.ConfirmProvider(provider, mediator); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	// the provider is not active yet
+	if statusCode := publish(); statusCode != 403 {
+		t.Fatalf("expected a 403 status code, got %d instead", statusCode)
+	}
+
+	if list := pendingApprovals(t, client, otherMediator); len(list) != 1 {
+		t.Fatalf("expected one pending approval, got %d", len(list))
+	}
+
+	// approving twice with the same mediator does not count
+	if resp, err := client.Appointments.ConfirmProvider(provider, mediator); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	if statusCode := publish(); statusCode != 403 {
+		t.Fatalf("expected a 403 status code, got %d instead", statusCode)
+	}
+
+	if resp, err := client.Appointments.ConfirmProvider(provider, otherMediator); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	if list := pendingApprovals(t, client, otherMediator); len(list) != 0 {
+		t.Fatalf("expected no pending approvals, got %d", len(list))
+	}
+
+	if statusCode := publish(); statusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", statusCode)
+	}
+
+	resp, err := client.Appointments.GetAppointmentsByZipCode(&services.GetAppointmentsByZipCodeParams{
+		ZipCode: "10707",
+		Radius:  20,
+		From:    af.TS("2022-10-01T00:00:00Z"),
+		To:      af.TS("2022-10-02T00:00:00Z"),
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := resp.JSON()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list, ok := result["result"].([]interface{})
+
+	if !ok || len(list) != 1 {
+		t.Fatalf("expected one provider")
+	}
+
+	keyChain := list[0].(map[string]interface{})["keyChain"].(map[string]interface{})
+
+	if mediators, ok := keyChain["mediators"].([]interface{}); !ok || len(mediators) != 2 {
+		t.Fatalf("expected two mediators in the key chain")
+	}
+
+	if approvals, ok := keyChain["provider"].(map[string]interface{})["approvals"].([]interface{}); !ok || len(approvals) != 2 {
+		t.Fatalf("expected two approvals in the provider key")
+	}
+
+}
+
+func TestProviderApprovalsRevokedMediator(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+
+		// we create two mediators
+		at.FC{af.Mediator{}, "mediator"},
+		at.FC{af.Mediator{}, "otherMediator"},
+
+		// we create a provider (without confirming it)
+		at.FC{af.Provider{
+			ZipCode:   "10707",
+			StoreData: true,
+		}, "provider"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settings := fixtures["settings"].(*services.Settings)
+	client := fixtures["client"].(*helpers.Client)
+	mediator := fixtures["mediator"].(*crypto.Actor)
+	otherMediator := fixtures["otherMediator"].(*crypto.Actor)
+	provider := fixtures["provider"].(*helpers.Provider)
+
+	settings.Appointments.ProviderApprovalsRequired = 2
+
+	if resp, err := client.Appointments.ConfirmProvider(provider, mediator); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	if resp, err := client.Appointments.RevokeMediatorKey(&services.RevokeMediatorKeyParams{
+		Timestamp: time.Now(),
+		ID:        crypto.Hash(mediator.SigningKey.PublicKey),
+		Reason:    "compromised",
+	}); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	if resp, err := client.Appointments.ConfirmProvider(provider, otherMediator); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	// the approval of the revoked mediator key does not count anymore
+	if list := pendingApprovals(t, client, otherMediator); len(list) != 1 {
+		t.Fatalf("expected one pending approval, got %d", len(list))
+	} else if approvals := list[0].(map[string]interface{})["approvals"].([]interface{}); len(approvals) != 1 {
+		t.Fatalf("expected one remaining approval, got %d", len(approvals))
+	}
+
+}
@@ -19,14 +19,17 @@
 package servers
 
 import (
+	"bytes"
 	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/databases"
+	"time"
 )
 
 // mediator-only endpoint
-// { limit }, keyPair
+// { limit, offset, unclaimed }, keyPair
 func (c *Appointments) getPendingProviderData(context services.Context, params *services.GetPendingProviderDataSignedParams) services.Response {
 
-	resp, _ := c.isMediator(context, &services.SignedParams{
+	resp, mediatorKey := c.isMediator(context, &services.SignedParams{
 		JSON:      params.JSON,
 		Signature: params.Signature,
 		PublicKey: params.PublicKey,
@@ -38,6 +41,8 @@ func (c *Appointments) getPendingProviderData(context services.Context, params *
 	}
 
 	unverifiedProviderData := c.backend.UnverifiedProviderData()
+	verifiedProviderData := c.backend.VerifiedProviderData()
+	verificationQueue := c.backend.VerificationQueue()
 
 	providerDataMap, err := unverifiedProviderData.GetAll()
 
@@ -46,13 +51,99 @@ func (c *Appointments) getPendingProviderData(context services.Context, params *
 		return context.InternalError()
 	}
 
-	pdEntries := []*services.RawProviderData{}
+	queue, err := verificationQueue.GetAll()
 
-	for id, pd := range providerDataMap {
-		pd.ID = []byte(id)
-		pdEntries = append(pdEntries, pd)
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	queued := make(map[string]bool, len(queue))
+
+	for _, entry := range queue {
+		queued[string(entry.ID)] = true
+	}
+
+	// provider data that has been stored before the queue was introduced is
+	// added to the end of the queue
+	for id := range providerDataMap {
+		if queued[id] {
+			continue
+		}
+		if err := c.enqueueProviderData([]byte(id)); err != nil {
+			services.Log.Error(err)
+			return context.InternalError()
+		}
+		queue = append(queue, &services.PendingProviderData{
+			ID:          []byte(id),
+			SubmittedAt: time.Now().UTC(),
+		})
+	}
+
+	claims, err := c.backend.VerificationClaims().GetAll()
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
 	}
 
+	now := time.Now()
+	pdEntries := []*services.PendingProviderData{}
+	oldest := time.Time{}
+	offset := params.Data.Offset
+
+	for _, entry := range queue {
+
+		pd, ok := providerDataMap[string(entry.ID)]
+
+		if !ok {
+			// the provider data has been confirmed in the meantime
+			continue
+		}
+
+		if oldest.IsZero() {
+			oldest = entry.SubmittedAt
+		}
+
+		if claim, ok := claims[string(entry.ID)]; ok && claim.IsActive(now) {
+			if params.Data.Unclaimed && !bytes.Equal(claim.MediatorID, mediatorKey.ID) {
+				continue
+			}
+			entry.Claim = claim
+		}
+
+		if offset > 0 {
+			offset--
+			continue
+		}
+
+		if int64(len(pdEntries)) >= params.Data.Limit {
+			break
+		}
+
+		entry.EncryptedData = pd.EncryptedData
+		entry.Invitation = pd.Invitation
+		entry.MetadataCheckRequired = pd.Invitation != nil && pd.Invitation.MetadataHash != nil
+
+		// for updates we return the verified data so mediators can compare it
+		if verifiedPd, err := verifiedProviderData.Get(entry.ID); err == nil {
+			verifiedPd.ID = entry.ID
+			verifiedPd.Version = verifiedVersion(verifiedPd)
+			entry.VerifiedData = verifiedPd
+			entry.BaseVersion = pd.BaseVersion
+			if entry.BaseVersion == 0 {
+				entry.BaseVersion = verifiedPd.Version
+			}
+		} else if err != databases.NotFound {
+			services.Log.Error(err)
+			return context.InternalError()
+		}
+
+		pdEntries = append(pdEntries, entry)
+	}
+
+	c.addVerificationQueueStats(int64(len(providerDataMap)), oldest)
+
 	return context.Result(pdEntries)
 
 }
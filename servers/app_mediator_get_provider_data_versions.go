@@ -0,0 +1,85 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"github.com/kiebitz-oss/services"
+)
+
+// returns the version of verified provider data, data that has been verified
+// before versions were introduced is version 1
+func verifiedVersion(pd *services.RawProviderData) int64 {
+	if pd.Version == 0 {
+		return 1
+	}
+	return pd.Version
+}
+
+// stores new provider data as the next verified version
+func (c *Appointments) addProviderDataVersion(providerID []byte, pd, currentPd *services.RawProviderData) error {
+
+	versions := c.backend.ProviderDataVersions(providerID)
+
+	if currentPd != nil && currentPd.Version == 0 {
+		currentPd.Version = verifiedVersion(currentPd)
+		if err := versions.Set(currentPd); err != nil {
+			return err
+		}
+	}
+
+	pd.Version = pd.BaseVersion + 1
+	pd.BaseVersion = 0
+
+	return versions.Set(pd)
+}
+
+// returns all verified versions of the data of a provider as well as all
+// rejected updates, so that mediators can trace how the data changed
+func (c *Appointments) getProviderDataVersions(context services.Context, params *services.GetProviderDataVersionsSignedParams) services.Response {
+
+	resp, _ := c.isMediator(context, &services.SignedParams{
+		JSON:      params.JSON,
+		Signature: params.Signature,
+		PublicKey: params.PublicKey,
+		Timestamp: params.Data.Timestamp,
+	})
+
+	if resp != nil {
+		return resp
+	}
+
+	versions, err := c.backend.ProviderDataVersions(params.Data.ID).GetAll()
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	rejections, err := c.backend.ProviderDataRejections(params.Data.ID).GetAll()
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	return context.Result(&services.ProviderDataHistory{
+		Versions:   versions,
+		Rejections: rejections,
+	})
+}
@@ -0,0 +1,95 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"bytes"
+	"github.com/kiebitz-oss/services"
+)
+
+// returns the signing keys of the given mediator key and its predecessor
+func (c *Appointments) mediatorSigningKeys(mediatorKey *services.ActorKey) ([][]byte, error) {
+
+	mkd, err := mediatorKey.MediatorKeyData()
+
+	if err != nil {
+		return nil, err
+	}
+
+	signingKeys := [][]byte{mkd.Signing}
+
+	if mkd.Predecessor == nil {
+		return signingKeys, nil
+	}
+
+	predecessorKey, err := c.backend.Keys("mediators").Get(mkd.Predecessor)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if pkd, err := predecessorKey.MediatorKeyData(); err != nil {
+		return nil, err
+	} else {
+		return append(signingKeys, pkd.Signing), nil
+	}
+}
+
+// returns the provider keys confirmed by the calling mediator key or by its
+// predecessor, so that they can be re-signed after a key rotation
+func (c *Appointments) getProviderKeys(context services.Context, params *services.GetProviderKeysSignedParams) services.Response {
+
+	resp, mediatorKey := c.isMediator(context, &services.SignedParams{
+		JSON:      params.JSON,
+		Signature: params.Signature,
+		PublicKey: params.PublicKey,
+		Timestamp: params.Data.Timestamp,
+	})
+
+	if resp != nil {
+		return resp
+	}
+
+	signingKeys, err := c.mediatorSigningKeys(mediatorKey)
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	providerKeys, err := c.backend.Keys("providers").GetAll()
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	confirmedKeys := make([]*services.ActorKey, 0)
+
+	for _, providerKey := range providerKeys {
+		for _, signingKey := range signingKeys {
+			if bytes.Equal(providerKey.Origin().PublicKey, signingKey) {
+				confirmedKeys = append(confirmedKeys, providerKey)
+				break
+			}
+		}
+	}
+
+	return context.Result(confirmedKeys)
+}
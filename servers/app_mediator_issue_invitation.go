@@ -0,0 +1,131 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"bytes"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/databases"
+	"time"
+)
+
+// Invitations can be issued by the root key or by mediators. The invitation
+// code is added to the provider codes, storeProviderData then enforces the
+// binding of the invitation.
+func (c *Appointments) issueInvitation(context services.Context, params *services.IssueInvitationSignedParams) services.Response {
+
+	signedParams := &services.SignedParams{
+		JSON:      params.JSON,
+		Signature: params.Signature,
+		PublicKey: params.PublicKey,
+		Timestamp: params.Data.Timestamp,
+	}
+
+	if rootKey := c.settings.Key("root"); rootKey != nil && bytes.Equal(params.PublicKey, rootKey.PublicKey) {
+		if resp := c.isRoot(context, signedParams); resp != nil {
+			return resp
+		}
+	} else if resp, _ := c.isMediator(context, signedParams); resp != nil {
+		return resp
+	}
+
+	if params.Data.ProviderKey == nil && params.Data.MetadataHash == nil {
+		return context.Error(400, "invitation needs to be bound to a provider key or metadata", nil)
+	}
+
+	invitations := c.backend.Invitations()
+	id := crypto.Hash(params.Data.Code)
+
+	if _, err := invitations.Get(id); err == nil {
+		return context.Error(400, "invitation already exists", nil)
+	} else if err != databases.NotFound {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if err := c.audit("issueInvitation", params.JSON, params.Signature, params.PublicKey); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if err := invitations.Set(&services.Invitation{
+		ID:           id,
+		ProviderKey:  params.Data.ProviderKey,
+		MetadataHash: params.Data.MetadataHash,
+		ExpiresAt:    params.Data.ExpiresAt,
+		IssuedAt:     time.Now().UTC(),
+		IssuedBy:     params.PublicKey,
+	}); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if err := c.backend.Codes("provider").Add(params.Data.Code); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	return context.Acknowledge()
+}
+
+// checks the binding of the invitation belonging to the code (if any) and
+// marks the invitation as used by the provider
+func (c *Appointments) useInvitation(context services.Context, params *services.StoreProviderDataSignedParams, providerID []byte) (*services.Invitation, services.Response) {
+
+	invitations := c.backend.Invitations()
+
+	invitation, err := invitations.Get(crypto.Hash(params.Data.Code))
+
+	if err == databases.NotFound {
+		// this is a regular code
+		return nil, nil
+	} else if err != nil {
+		services.Log.Error(err)
+		return nil, context.InternalError()
+	}
+
+	now := time.Now().UTC()
+
+	if invitation.ExpiresAt != nil && now.After(*invitation.ExpiresAt) {
+		return nil, context.Error(410, "invitation expired", nil)
+	}
+
+	if invitation.UsedBy != nil && !bytes.Equal(invitation.UsedBy, providerID) {
+		return nil, context.Error(403, "invitation already used", nil)
+	}
+
+	if invitation.ProviderKey != nil && !bytes.Equal(invitation.ProviderKey, params.PublicKey) {
+		return nil, context.Error(403, "invitation is bound to a different key", nil)
+	}
+
+	if invitation.MetadataHash != nil && !bytes.Equal(invitation.MetadataHash, params.Data.MetadataHash) {
+		return nil, context.Error(403, "invitation is bound to different provider metadata", nil)
+	}
+
+	invitation.UsedBy = providerID
+	invitation.UsedAt = &now
+
+	if err := invitations.Set(invitation); err != nil {
+		services.Log.Error(err)
+		return nil, context.InternalError()
+	}
+
+	return invitation, nil
+}
@@ -0,0 +1,201 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers_test
+
+import (
+	"encoding/hex"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/definitions"
+	"github.com/kiebitz-oss/services/forms"
+	"github.com/kiebitz-oss/services/helpers"
+	at "github.com/kiebitz-oss/services/testing"
+	af "github.com/kiebitz-oss/services/testing/fixtures"
+	"testing"
+	"time"
+)
+
+func TestIssueInvitation(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+
+		// we create a mediator
+		at.FC{af.Mediator{}, "mediator"},
+
+		// we create two providers (without storing their data)
+		at.FC{af.Provider{
+			Name:    "Impfzentrum Mitte",
+			ZipCode: "10115",
+		}, "provider"},
+		at.FC{af.Provider{
+			Name:    "Impfzentrum Mitte",
+			ZipCode: "10115",
+		}, "otherProvider"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+	settings := fixtures["settings"].(*services.Settings)
+	mediator := fixtures["mediator"].(*crypto.Actor)
+	provider := fixtures["provider"].(*helpers.Provider)
+	otherProvider := fixtures["otherProvider"].(*helpers.Provider)
+
+	settings.Appointments.ProviderCodesEnabled = true
+
+	code, err := crypto.RandomBytes(16)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metadataHash := services.ProviderMetadataHash(provider.PublicData.Name, provider.PublicData.ZipCode)
+
+	if resp, err := client.Appointments.IssueInvitation(map[string]interface{}{
+		"timestamp":    time.Now(),
+		"code":         hex.EncodeToString(code),
+		"providerKey":  provider.Actor.SigningKey.PublicKey,
+		"metadataHash": metadataHash,
+	}, mediator.SigningKey); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	// the invitation cannot be used by another provider
+	if resp, err := client.Appointments.StoreProviderDataWithCode(otherProvider, code, metadataHash); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 403 {
+		t.Fatalf("expected a 403 status code, got %d instead", resp.StatusCode)
+	}
+
+	// the metadata hash needs to match
+	if resp, err := client.Appointments.StoreProviderDataWithCode(provider, code, crypto.Hash([]byte("other"))); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 403 {
+		t.Fatalf("expected a 403 status code, got %d instead", resp.StatusCode)
+	}
+
+	if resp, err := client.Appointments.StoreProviderDataWithCode(provider, code, metadataHash); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	// mediators see the invitation the provider registered with
+	resp, err := client.Appointments.GetPendingProviderData(&services.GetPendingProviderDataParams{
+		Timestamp: time.Now(),
+		Limit:     10,
+	}, mediator)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := resp.JSON()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list, ok := result["result"].([]interface{})
+
+	if !ok || len(list) != 1 {
+		t.Fatalf("expected one pending provider data entry")
+	}
+
+	params, err := forms.PendingProviderDataForm.Validate(list[0].(map[string]interface{}))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pendingData := &services.PendingProviderData{}
+
+	if err := forms.PendingProviderDataForm.Coerce(pendingData, params); err != nil {
+		t.Fatal(err)
+	}
+
+	if pendingData.Invitation == nil {
+		t.Fatalf("expected an invitation")
+	}
+
+	if string(pendingData.Invitation.IssuedBy) != string(mediator.SigningKey.PublicKey) {
+		t.Fatalf("expected the invitation to be issued by the mediator")
+	}
+
+	if !pendingData.MetadataCheckRequired {
+		t.Fatalf("expected a required metadata check")
+	}
+
+	if pendingData.MetadataMismatch(provider.PublicData) {
+		t.Fatalf("expected the invitation to match the provider data")
+	}
+
+	// a provider can declare the right hash but submit other data
+	otherData := *provider.PublicData
+	otherData.Name = "other"
+
+	if !pendingData.MetadataMismatch(&otherData) {
+		t.Fatalf("expected a metadata mismatch")
+	}
+
+	// the mediator needs to attest the metadata hash of the decrypted data
+	if resp, err := client.Appointments.ConfirmProviderWithMetadataHash(provider, mediator, nil); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 403 {
+		t.Fatalf("expected a 403 status code, got %d instead", resp.StatusCode)
+	}
+
+	if resp, err := client.Appointments.ConfirmProviderWithMetadataHash(provider, mediator, services.ProviderMetadataHash(otherData.Name, otherData.ZipCode)); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 403 {
+		t.Fatalf("expected a 403 status code, got %d instead", resp.StatusCode)
+	}
+
+	if resp, err := client.Appointments.ConfirmProvider(provider, mediator); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	// invitations are enforced even if provider codes are not required
+	settings.Appointments.ProviderCodesEnabled = false
+
+	if resp, err := client.Appointments.StoreProviderDataWithCode(otherProvider, code, metadataHash); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 403 {
+		t.Fatalf("expected a 403 status code, got %d instead", resp.StatusCode)
+	}
+
+}
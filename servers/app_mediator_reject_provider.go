@@ -0,0 +1,103 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/databases"
+)
+
+// Rejects the data of a provider that has not been verified yet. The data is
+// moved into the rejected state together with the (encrypted) reason, which
+// the provider can retrieve via checkProviderData before resubmitting.
+func (c *Appointments) rejectProvider(context services.Context, params *services.RejectProviderSignedParams) services.Response {
+
+	resp, mediatorKey := c.isMediator(context, &services.SignedParams{
+		JSON:      params.JSON,
+		Signature: params.Signature,
+		PublicKey: params.PublicKey,
+		Timestamp: params.Data.Timestamp,
+	})
+
+	if resp != nil {
+		return resp
+	}
+
+	providerID := params.Data.ID
+	unverifiedProviderData := c.backend.UnverifiedProviderData()
+
+	pd, err := unverifiedProviderData.Get(providerID)
+
+	if err == databases.NotFound {
+		return context.NotFound()
+	} else if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	// updates of verified providers are rejected via rejectProviderDataUpdate
+	if _, err := c.backend.VerifiedProviderData().Get(providerID); err == nil {
+		return context.Error(400, "provider has already been verified", nil)
+	} else if err != databases.NotFound {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if resp := c.checkVerificationClaim(context, providerID, mediatorKey.ID); resp != nil {
+		return resp
+	}
+
+	if err := c.audit("rejectProvider", params.JSON, params.Signature, params.PublicKey); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if err := c.backend.RejectedProviderData().Set(providerID, pd); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if err := c.backend.ProviderRejections().Set(providerID, params); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if err := unverifiedProviderData.Del(providerID); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	// approvals by other mediators refer to the rejected data
+	if err := c.backend.ProviderApprovals(providerID).DelAll(); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if err := c.backend.PendingProviderApprovals().Del(providerID); err != nil && err != databases.NotFound {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if err := c.dequeueProviderData(providerID, "rejected"); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	return context.Acknowledge()
+}
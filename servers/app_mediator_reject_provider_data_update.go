@@ -0,0 +1,99 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/databases"
+)
+
+// Rejects a pending update of the data of a verified provider. The verified,
+// confirmed and public data of the provider remain unchanged.
+func (c *Appointments) rejectProviderDataUpdate(context services.Context, params *services.RejectProviderDataUpdateSignedParams) services.Response {
+
+	resp, mediatorKey := c.isMediator(context, &services.SignedParams{
+		JSON:      params.JSON,
+		Signature: params.Signature,
+		PublicKey: params.PublicKey,
+		Timestamp: params.Data.Timestamp,
+	})
+
+	if resp != nil {
+		return resp
+	}
+
+	providerID := params.Data.ID
+	unverifiedProviderData := c.backend.UnverifiedProviderData()
+
+	pd, err := unverifiedProviderData.Get(providerID)
+
+	if err == databases.NotFound {
+		return context.NotFound()
+	} else if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	currentPd, err := c.backend.VerifiedProviderData().Get(providerID)
+
+	if err == databases.NotFound {
+		return context.Error(400, "provider data is not an update", nil)
+	} else if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	baseVersion := pd.BaseVersion
+
+	// updates stored before versions were introduced
+	if baseVersion == 0 {
+		baseVersion = verifiedVersion(currentPd)
+	}
+
+	// the mediator needs to refer to the update it has reviewed
+	if baseVersion != params.Data.BaseVersion {
+		return context.Error(409, "base version does not match", nil)
+	}
+
+	if resp := c.checkVerificationClaim(context, providerID, mediatorKey.ID); resp != nil {
+		return resp
+	}
+
+	if err := c.audit("rejectProviderDataUpdate", params.JSON, params.Signature, params.PublicKey); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if err := c.backend.ProviderDataRejections(providerID).Add(params); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if err := unverifiedProviderData.Del(providerID); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if err := c.dequeueProviderData(providerID, "rejected"); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	return context.Acknowledge()
+}
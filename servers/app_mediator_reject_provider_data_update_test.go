@@ -0,0 +1,156 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers_test
+
+import (
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/definitions"
+	"github.com/kiebitz-oss/services/helpers"
+	at "github.com/kiebitz-oss/services/testing"
+	af "github.com/kiebitz-oss/services/testing/fixtures"
+	"testing"
+	"time"
+)
+
+func TestProviderDataUpdates(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+
+		// we create a mediator
+		at.FC{af.Mediator{}, "mediator"},
+
+		// we create a provider
+		at.FC{af.Provider{
+			ZipCode:   "10707",
+			StoreData: true,
+			Confirm:   true,
+		}, "provider"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+	mediator := fixtures["mediator"].(*crypto.Actor)
+	provider := fixtures["provider"].(*helpers.Provider)
+	providerID := crypto.Hash(provider.Actor.SigningKey.PublicKey)
+
+	// the provider updates its data
+	if resp, err := client.Appointments.StoreProviderData(provider); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	list := pendingProviderData(t, client, mediator, 10, false)
+
+	if len(list) != 1 {
+		t.Fatalf("expected one pending update, got %d", len(list))
+	}
+
+	if entry, ok := list[0].(map[string]interface{}); !ok {
+		t.Fatalf("expected a map")
+	} else if entry["verifiedData"] == nil {
+		t.Fatalf("expected the verified data to be included")
+	} else if baseVersion, ok := entry["baseVersion"].(float64); !ok || baseVersion != 1 {
+		t.Fatalf("expected base version 1")
+	}
+
+	rejectParams := &services.RejectProviderDataUpdateParams{
+		Timestamp:   time.Now(),
+		ID:          providerID,
+		BaseVersion: 2,
+		Reason:      "invalid address",
+	}
+
+	if resp, err := client.Appointments.RejectProviderDataUpdate(rejectParams, mediator); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 409 {
+		t.Fatalf("expected a 409 status code, got %d instead", resp.StatusCode)
+	}
+
+	rejectParams.BaseVersion = 1
+
+	if resp, err := client.Appointments.RejectProviderDataUpdate(rejectParams, mediator); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	if n := len(pendingProviderData(t, client, mediator, 10, false)); n != 0 {
+		t.Fatalf("expected no pending updates, got %d", n)
+	}
+
+	// the provider submits another update, which is approved
+	if resp, err := client.Appointments.StoreProviderData(provider); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	if resp, err := client.Appointments.ConfirmProvider(provider, mediator); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	resp, err := client.Appointments.GetProviderDataVersions(&services.GetProviderDataVersionsParams{
+		Timestamp: time.Now(),
+		ID:        providerID,
+	}, mediator)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := resp.JSON()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	history, ok := result["result"].(map[string]interface{})
+
+	if !ok {
+		t.Fatalf("expected a provider data history")
+	}
+
+	if versions, ok := history["versions"].([]interface{}); !ok || len(versions) != 2 {
+		t.Fatalf("expected two versions")
+	}
+
+	if rejections, ok := history["rejections"].([]interface{}); !ok || len(rejections) != 1 {
+		t.Fatalf("expected one rejection")
+	}
+
+}
@@ -0,0 +1,146 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers_test
+
+import (
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/definitions"
+	"github.com/kiebitz-oss/services/forms"
+	"github.com/kiebitz-oss/services/helpers"
+	at "github.com/kiebitz-oss/services/testing"
+	af "github.com/kiebitz-oss/services/testing/fixtures"
+	"testing"
+)
+
+func checkProviderData(t *testing.T, client *helpers.Client, provider *helpers.Provider) *services.ProviderDataStatus {
+
+	resp, err := client.Appointments.CheckProviderData(provider)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	result := &services.ProviderDataStatus{}
+
+	if err := resp.CoerceResult(result, &forms.ProviderDataStatusForm); err != nil {
+		t.Fatal(err)
+	}
+
+	return result
+}
+
+func TestRejectProvider(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+
+		// we create a mediator
+		at.FC{af.Mediator{}, "mediator"},
+
+		// we create a provider that has stored but not confirmed its data
+		at.FC{af.Provider{
+			ZipCode:   "10707",
+			StoreData: true,
+		}, "provider"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+	mediator := fixtures["mediator"].(*crypto.Actor)
+	provider := fixtures["provider"].(*helpers.Provider)
+
+	if status := checkProviderData(t, client, provider); status.Status != services.ProviderDataPending {
+		t.Fatalf("expected the provider data to be pending, got %s instead", status.Status)
+	}
+
+	if resp, err := client.Appointments.RejectProvider(provider, "missing address", mediator); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	if n := len(pendingProviderData(t, client, mediator, 10, false)); n != 0 {
+		t.Fatalf("expected no pending provider data, got %d", n)
+	}
+
+	// rejecting the data again fails as it is not pending anymore
+	if resp, err := client.Appointments.RejectProvider(provider, "missing address", mediator); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 404 {
+		t.Fatalf("expected a 404 status code, got %d instead", resp.StatusCode)
+	}
+
+	status := checkProviderData(t, client, provider)
+
+	if status.Status != services.ProviderDataRejected {
+		t.Fatalf("expected the provider data to be rejected, got %s instead", status.Status)
+	}
+
+	if status.Rejection == nil {
+		t.Fatalf("expected the rejection to be included")
+	}
+
+	// only the provider can decrypt the reason
+	if reason, err := provider.Actor.EncryptionKey.Decrypt(status.Rejection.Data.EncryptedReason); err != nil {
+		t.Fatal(err)
+	} else if string(reason) != "missing address" {
+		t.Fatalf("unexpected reason: %s", string(reason))
+	}
+
+	// the provider resubmits corrected data, which can be confirmed
+	if resp, err := client.Appointments.StoreProviderData(provider); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	if status := checkProviderData(t, client, provider); status.Status != services.ProviderDataPending {
+		t.Fatalf("expected the provider data to be pending, got %s instead", status.Status)
+	}
+
+	if resp, err := client.Appointments.ConfirmProvider(provider, mediator); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	if status := checkProviderData(t, client, provider); status.Status != services.ProviderDataConfirmed {
+		t.Fatalf("expected the provider data to be confirmed, got %s instead", status.Status)
+	}
+
+}
@@ -0,0 +1,126 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"bytes"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/databases"
+)
+
+// Replaces the key of a provider that lost access to its current key with a
+// new key signed by the mediator. As with a key rotation the provider keeps
+// its ID, so its appointments and bookings remain available under the new key.
+func (c *Appointments) replaceProviderKey(context services.Context, params *services.ReplaceProviderKeySignedParams) services.Response {
+
+	resp, mediatorKey := c.isMediator(context, &services.SignedParams{
+		JSON:      params.JSON,
+		Signature: params.Signature,
+		PublicKey: params.PublicKey,
+		Timestamp: params.Data.Timestamp,
+	})
+
+	if resp != nil {
+		return resp
+	}
+
+	providerID := params.Data.ID
+	keys := c.backend.Keys("providers")
+
+	if _, err := keys.Get(providerID); err != nil {
+		if err == databases.NotFound {
+			return context.NotFound()
+		}
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	signedKeyData := params.Data.SignedKeyData
+
+	// the key data needs to be signed by the mediator making the request
+	if !bytes.Equal(signedKeyData.PublicKey, params.PublicKey) {
+		return context.Error(400, "key data not signed by mediator", nil)
+	}
+
+	if ok, err := crypto.VerifyWithBytes([]byte(signedKeyData.JSON), signedKeyData.Signature, signedKeyData.PublicKey); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else if !ok {
+		return context.Error(400, "invalid key data signature", nil)
+	}
+
+	providerKeys, err := keys.GetAll()
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	// the new key must not be in use by another provider
+	if existingKey, err := findActorKey(providerKeys, signedKeyData.Data.Signing); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else if existingKey != nil && !bytes.Equal(existingKey.ID, providerID) {
+		return context.Error(409, "key already in use", nil)
+	}
+
+	// the call is audited before any changes are made
+	if err := c.audit("replaceProviderKey", params.JSON, params.Signature, params.PublicKey); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	// the new key is signed by a mediator so it does not need a predecessor
+	providerKey := &services.ActorKey{
+		Data:      signedKeyData.JSON,
+		Signature: signedKeyData.Signature,
+		PublicKey: signedKeyData.PublicKey,
+	}
+
+	if c.settings.ProviderApprovalsRequired > 1 {
+		resp, approvals := c.approveProvider(context, providerID, mediatorKey, providerKey)
+		if resp != nil {
+			return resp
+		} else if approvals == nil {
+			return context.Acknowledge()
+		}
+		providerKey.Approvals = approvals
+	}
+
+	// the key is logged before it is stored, so that every key in use is
+	// contained in the log
+	if err := c.logKeyEvent("provider", "replace", providerID, providerKey); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	// the delegations were signed by the replaced key, which may be compromised
+	if err := c.removeDelegations(providerID); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if err := keys.Set(providerID, providerKey); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	return context.Acknowledge()
+}
@@ -0,0 +1,131 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"bytes"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/databases"
+)
+
+// Replaces the signatures of provider keys confirmed by the predecessor of the
+// calling mediator key with new signatures by the calling key. The provider
+// key data itself remains unchanged, so key chains returned to users verify
+// against the new mediator key, which in turn is signed by the root key.
+func (c *Appointments) rotateMediatorKey(context services.Context, params *services.RotateMediatorKeySignedParams) services.Response {
+
+	resp, mediatorKey := c.isMediator(context, &services.SignedParams{
+		JSON:      params.JSON,
+		Signature: params.Signature,
+		PublicKey: params.PublicKey,
+		Timestamp: params.Data.Timestamp,
+	})
+
+	if resp != nil {
+		return resp
+	}
+
+	mkd, err := mediatorKey.MediatorKeyData()
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if mkd.Predecessor == nil {
+		return context.Error(400, "mediator key has no predecessor", nil)
+	}
+
+	// the predecessor may already be revoked or expired
+	predecessorKey, err := c.backend.Keys("mediators").Get(mkd.Predecessor)
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	predecessorKeyData, err := predecessorKey.MediatorKeyData()
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	keys := c.backend.Keys("providers")
+	providerKeys := make([]*services.ActorKey, 0, len(params.Data.Signatures))
+
+	// we check all signatures before we store any of them
+	for _, signature := range params.Data.Signatures {
+
+		providerKey, err := keys.Get(signature.ID)
+
+		if err == databases.NotFound {
+			return context.NotFound()
+		} else if err != nil {
+			services.Log.Error(err)
+			return context.InternalError()
+		}
+
+		// if the provider rotated its own key we re-sign the original key
+		originKey := providerKey.Origin()
+
+		if !bytes.Equal(originKey.PublicKey, predecessorKeyData.Signing) {
+			return context.Error(400, "provider key was not confirmed by the predecessor key", nil)
+		}
+
+		if ok, err := crypto.VerifyWithBytes([]byte(originKey.Data), signature.Signature, mkd.Signing); err != nil {
+			services.Log.Error(err)
+			return context.InternalError()
+		} else if !ok {
+			return context.Error(400, "invalid signature", nil)
+		}
+
+		originKey.Signature = signature.Signature
+		originKey.PublicKey = mkd.Signing
+
+		// the approval of the predecessor is replaced as well
+		for _, approval := range originKey.Approvals {
+			if bytes.Equal(approval.PublicKey, predecessorKeyData.Signing) {
+				approval.Signature = signature.Signature
+				approval.PublicKey = mkd.Signing
+			}
+		}
+
+		providerKeys = append(providerKeys, providerKey)
+	}
+
+	if err := c.audit("rotateMediatorKey", params.JSON, params.Signature, params.PublicKey); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	for _, providerKey := range providerKeys {
+		if err := c.logKeyEvent("provider", "resign", providerKey.ID, providerKey); err != nil {
+			services.Log.Error(err)
+			return context.InternalError()
+		}
+		if err := keys.Set(providerKey.ID, providerKey); err != nil {
+			services.Log.Error(err)
+			return context.InternalError()
+		}
+	}
+
+	return context.Acknowledge()
+}
@@ -0,0 +1,173 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/definitions"
+	"github.com/kiebitz-oss/services/helpers"
+	at "github.com/kiebitz-oss/services/testing"
+	af "github.com/kiebitz-oss/services/testing/fixtures"
+	"testing"
+	"time"
+)
+
+func TestRotateMediatorKey(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+
+		// we create a mediator
+		at.FC{af.Mediator{}, "mediator"},
+
+		// we create a provider
+		at.FC{af.Provider{
+			ZipCode:   "10707",
+			StoreData: true,
+			Confirm:   true,
+		}, "provider"},
+
+		at.FC{af.Appointments{
+			N:        10,
+			Start:    af.TS("2022-10-01T12:00:00Z"),
+			Duration: 30,
+			Slots:    5,
+			Properties: map[string]interface{}{
+				"vaccine": "moderna",
+			},
+		}, "appointments"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+	mediator := fixtures["mediator"].(*crypto.Actor)
+
+	successor, err := crypto.MakeActor("mediator")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp, err := client.Appointments.AddMediatorKeyData(&services.MediatorKeyData{
+		Signing:     successor.SigningKey.PublicKey,
+		Encryption:  successor.EncryptionKey.PublicKey,
+		Predecessor: crypto.Hash(mediator.SigningKey.PublicKey),
+	}); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	if resp, err := client.Appointments.RotateMediatorKey(successor); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	if resp, err := client.Appointments.RevokeMediatorKey(&services.RevokeMediatorKeyParams{
+		Timestamp: time.Now(),
+		ID:        crypto.Hash(mediator.SigningKey.PublicKey),
+		Reason:    "rotated",
+	}); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	// the revoked key cannot be used anymore
+	if resp, err := client.Appointments.GetProviderKeys(&services.GetProviderKeysParams{
+		Timestamp: time.Now(),
+	}, mediator); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 403 {
+		t.Fatalf("expected a 403 status code, got %d instead", resp.StatusCode)
+	}
+
+	resp, err := client.Appointments.GetAppointmentsByZipCode(&services.GetAppointmentsByZipCodeParams{
+		ZipCode: "10707",
+		Radius:  20,
+		From:    af.TS("2022-10-01T00:00:00Z"),
+		To:      af.TS("2022-10-02T00:00:00Z"),
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := resp.JSON()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list, ok := result["result"].([]interface{})
+
+	if !ok || len(list) != 1 {
+		t.Fatalf("expected one provider")
+	}
+
+	providerAppointments := &services.ProviderAppointments{}
+
+	if data, err := json.Marshal(list[0]); err != nil {
+		t.Fatal(err)
+	} else if err := json.Unmarshal(data, providerAppointments); err != nil {
+		t.Fatal(err)
+	}
+
+	keyChain := providerAppointments.KeyChain
+
+	if keyChain == nil || keyChain.Mediator == nil || keyChain.Provider == nil {
+		t.Fatalf("expected a complete key chain")
+	}
+
+	mkd, err := keyChain.Mediator.KeyData()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(mkd.Signing, successor.SigningKey.PublicKey) {
+		t.Fatalf("expected the successor key in the key chain")
+	}
+
+	// the provider key must verify against the successor key
+	if ok, err := crypto.VerifyWithBytes([]byte(keyChain.Provider.Data), keyChain.Provider.Signature, mkd.Signing); err != nil {
+		t.Fatal(err)
+	} else if !ok {
+		t.Fatalf("expected a valid provider key signature")
+	}
+
+}
@@ -0,0 +1,167 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/databases"
+)
+
+// suspended providers are hidden from users and cannot receive new bookings,
+// but they can still log in and manage their existing appointments
+func (c *Appointments) suspendProvider(context services.Context, params *services.ProviderStatusSignedParams) services.Response {
+	return c.setProviderStatus(context, "suspendProvider", params)
+}
+
+func (c *Appointments) reactivateProvider(context services.Context, params *services.ProviderStatusSignedParams) services.Response {
+	return c.setProviderStatus(context, "reactivateProvider", params)
+}
+
+// revocation is permanent: the provider key is removed from the system, all
+// appointments are deleted (re-enabling the tokens of users that booked them)
+// and the provider cannot be confirmed again
+func (c *Appointments) revokeProvider(context services.Context, params *services.ProviderStatusSignedParams) services.Response {
+	return c.setProviderStatus(context, "revokeProvider", params)
+}
+
+func (c *Appointments) setProviderStatus(context services.Context, method string, params *services.ProviderStatusSignedParams) services.Response {
+
+	resp, _ := c.isMediator(context, &services.SignedParams{
+		JSON:      params.JSON,
+		Signature: params.Signature,
+		PublicKey: params.PublicKey,
+		Timestamp: params.Data.Timestamp,
+	})
+
+	if resp != nil {
+		return resp
+	}
+
+	providerID := params.Data.ID
+	providerStatus := c.backend.ProviderStatus()
+
+	status, err := providerStatus.Status(providerID)
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if status == services.ProviderRevoked {
+		return context.Error(410, "provider has been revoked", nil)
+	}
+
+	if params.Data.Status == services.ProviderActive && status != services.ProviderSuspended {
+		return context.Error(400, "provider is not suspended", nil)
+	}
+
+	keys := c.backend.Keys("providers")
+
+	providerKey, err := keys.Get(providerID)
+
+	if err == databases.NotFound {
+		return context.NotFound()
+	} else if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if err := c.audit(method, params.JSON, params.Signature, params.PublicKey); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if params.Data.Status == services.ProviderRevoked {
+		if err := c.logKeyEvent("provider", "revoke", providerID, providerKey); err != nil {
+			services.Log.Error(err)
+			return context.InternalError()
+		}
+		if err := c.removeProvider(providerID); err != nil {
+			services.Log.Error(err)
+			return context.InternalError()
+		}
+	}
+
+	if err := providerStatus.Set(providerID, params); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	return context.Acknowledge()
+}
+
+// deletes all appointments and the public data of a provider and removes its
+// key from the system
+func (c *Appointments) removeProvider(providerID []byte) error {
+
+	allDates, err := c.backend.AppointmentDatesByID(providerID).GetAll()
+
+	if err != nil {
+		return err
+	}
+
+	for id := range allDates {
+		if _, err := c.deleteAppointment(providerID, []byte(id)); err != nil {
+			return err
+		}
+	}
+
+	if err := c.removeDelegations(providerID); err != nil {
+		return err
+	}
+
+	if err := c.backend.PublicProviderData().Del(providerID); err != nil && err != databases.NotFound {
+		return err
+	}
+
+	if err := c.backend.Keys("providers").Del(providerID); err != nil && err != databases.NotFound {
+		return err
+	}
+
+	return nil
+}
+
+// removes all delegations of a provider, e.g. because they were signed by a
+// key that is no longer valid
+func (c *Appointments) removeDelegations(providerID []byte) error {
+
+	delegations := c.backend.Delegations(providerID)
+
+	allDelegations, err := delegations.GetAll()
+
+	if err != nil {
+		return err
+	}
+
+	for _, delegation := range allDelegations {
+		id := crypto.Hash(delegation.Data.Signing)
+		if err := c.logDelegationEvent("revoke", id, delegation); err != nil {
+			return err
+		}
+		if err := c.backend.DelegateProviders().Del(id); err != nil && err != databases.NotFound {
+			return err
+		}
+		if err := delegations.Del(id); err != nil && err != databases.NotFound {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,182 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers_test
+
+import (
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/definitions"
+	"github.com/kiebitz-oss/services/helpers"
+	at "github.com/kiebitz-oss/services/testing"
+	af "github.com/kiebitz-oss/services/testing/fixtures"
+	"testing"
+	"time"
+)
+
+func searchProviders(t *testing.T, client *helpers.Client) int {
+
+	resp, err := client.Appointments.GetAppointmentsByZipCode(&services.GetAppointmentsByZipCodeParams{
+		ZipCode: "10707",
+		Radius:  20,
+		From:    af.TS("2022-10-01T00:00:00Z"),
+		To:      af.TS("2022-10-02T00:00:00Z"),
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result, err := resp.JSON(); err != nil {
+		t.Fatal(err)
+	} else if list, ok := result["result"].([]interface{}); !ok {
+		t.Fatalf("expected a list of providers")
+	} else {
+		return len(list)
+	}
+
+	return 0
+}
+
+func TestProviderStatus(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+
+		// we create a mediator
+		at.FC{af.Mediator{}, "mediator"},
+
+		// we create a provider
+		at.FC{af.Provider{
+			ZipCode:   "10707",
+			StoreData: true,
+			Confirm:   true,
+		}, "provider"},
+
+		at.FC{af.Appointments{
+			N:        10,
+			Start:    af.TS("2022-10-01T12:00:00Z"),
+			Duration: 30,
+			Slots:    5,
+			Properties: map[string]interface{}{
+				"vaccine": "moderna",
+			},
+		}, "appointments"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+	mediator := fixtures["mediator"].(*crypto.Actor)
+	provider := fixtures["provider"].(*helpers.Provider)
+
+	providerID := crypto.Hash(provider.Actor.SigningKey.PublicKey)
+
+	if n := searchProviders(t, client); n != 1 {
+		t.Fatalf("expected one provider, got %d", n)
+	}
+
+	// reactivating an active provider does not work
+	if resp, err := client.Appointments.ReactivateProvider(&services.ProviderStatusParams{
+		Timestamp: time.Now(),
+		ID:        providerID,
+		Status:    services.ProviderActive,
+		Reason:    "test",
+	}, mediator); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 400 {
+		t.Fatalf("expected a 400 status code, got %d instead", resp.StatusCode)
+	}
+
+	if resp, err := client.Appointments.SuspendProvider(&services.ProviderStatusParams{
+		Timestamp: time.Now(),
+		ID:        providerID,
+		Status:    services.ProviderSuspended,
+		Reason:    "complaints about no-shows",
+	}, mediator); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	if n := searchProviders(t, client); n != 0 {
+		t.Fatalf("expected no providers, got %d", n)
+	}
+
+	if resp, err := client.Appointments.ReactivateProvider(&services.ProviderStatusParams{
+		Timestamp: time.Now(),
+		ID:        providerID,
+		Status:    services.ProviderActive,
+		Reason:    "complaints resolved",
+	}, mediator); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	if n := searchProviders(t, client); n != 1 {
+		t.Fatalf("expected one provider, got %d", n)
+	}
+
+	if resp, err := client.Appointments.RevokeProvider(&services.ProviderStatusParams{
+		Timestamp: time.Now(),
+		ID:        providerID,
+		Status:    services.ProviderRevoked,
+		Reason:    "fraud",
+	}, mediator); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	if n := searchProviders(t, client); n != 0 {
+		t.Fatalf("expected no providers, got %d", n)
+	}
+
+	// the provider key has been removed
+	if resp, err := client.Appointments.GetProviderAppointments(&services.GetProviderAppointmentsParams{
+		Timestamp: time.Now(),
+		From:      af.TS("2022-10-01T00:00:00Z"),
+		To:        af.TS("2022-10-02T00:00:00Z"),
+	}, provider); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 403 {
+		t.Fatalf("expected a 403 status code, got %d instead", resp.StatusCode)
+	}
+
+	// revoked providers cannot be confirmed again
+	if resp, err := client.Appointments.ConfirmProvider(provider, mediator); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 410 {
+		t.Fatalf("expected a 410 status code, got %d instead", resp.StatusCode)
+	}
+
+}
@@ -24,29 +24,57 @@ import (
 	"github.com/kiebitz-oss/services/databases"
 )
 
+// returns the status of the data most recently submitted by the provider,
+// together with the confirmed data or the (encrypted) reason for a rejection
 func (c *Appointments) checkProviderData(context services.Context, params *services.CheckProviderDataSignedParams) services.Response {
 
-	resp, _ := c.isProvider(context, &services.SignedParams{
-		JSON:      params.JSON,
-		Signature: params.Signature,
-		PublicKey: params.PublicKey,
-		Timestamp: params.Data.Timestamp,
-	})
+	// providers whose data has not been confirmed (yet) have no valid key, so
+	// like in storeProviderData we only verify the signature
+	if ok, err := crypto.VerifyWithBytes([]byte(params.JSON), params.Signature, params.PublicKey); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else if !ok {
+		return context.Error(400, "invalid signature", nil)
+	}
 
-	if resp != nil {
+	if resp := c.replays.check(context, []byte(params.JSON), params.PublicKey, params.Data.Timestamp); resp != nil {
 		return resp
 	}
 
-	hash := crypto.Hash(params.PublicKey)
-	encryptedProviderData := c.backend.ConfirmedProviderData()
+	// the provider "ID" is the hash of its original signing key
+	hash, err := c.providerID(params.PublicKey)
 
-	if providerData, err := encryptedProviderData.Get(hash); err != nil {
-		if err == databases.NotFound {
-			return context.NotFound()
-		}
+	if err != nil {
 		services.Log.Error(err)
 		return context.InternalError()
-	} else {
-		return context.Result(providerData)
 	}
+
+	status := &services.ProviderDataStatus{}
+
+	if confirmedData, err := c.backend.ConfirmedProviderData().Get(hash); err == nil {
+		status.Status = services.ProviderDataConfirmed
+		status.ConfirmedData = confirmedData
+	} else if err != databases.NotFound {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if _, err := c.backend.UnverifiedProviderData().Get(hash); err == nil {
+		status.Status = services.ProviderDataPending
+	} else if err != databases.NotFound {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else if rejection, err := c.backend.ProviderRejections().Get(hash); err == nil {
+		status.Status = services.ProviderDataRejected
+		status.Rejection = rejection
+	} else if err != databases.NotFound {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if status.Status == "" {
+		return context.NotFound()
+	}
+
+	return context.Result(status)
 }
@@ -0,0 +1,179 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"bytes"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/databases"
+	"time"
+)
+
+// Adds a delegation certificate that allows another signing key (e.g. of a
+// staff member) to act on behalf of the provider. Adding a certificate for a
+// key that already has one replaces the existing certificate.
+func (c *Appointments) addProviderDelegation(context services.Context, params *services.AddProviderDelegationSignedParams) services.Response {
+
+	resp, providerKey := c.isProvider(context, &services.SignedParams{
+		JSON:      params.JSON,
+		Signature: params.Signature,
+		PublicKey: params.PublicKey,
+		Timestamp: params.Data.Timestamp,
+	})
+
+	if resp != nil {
+		return resp
+	}
+
+	signedDelegation := params.Data.SignedDelegation
+
+	// the certificate needs to be signed by the provider making the request
+	if !bytes.Equal(signedDelegation.PublicKey, params.PublicKey) {
+		return context.Error(400, "delegation not signed by provider", nil)
+	}
+
+	if ok, err := crypto.VerifyWithBytes([]byte(signedDelegation.JSON), signedDelegation.Signature, signedDelegation.PublicKey); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else if !ok {
+		return context.Error(400, "invalid delegation signature", nil)
+	}
+
+	if len(signedDelegation.Data.Scopes) == 0 {
+		return context.Error(400, "no scopes given", nil)
+	}
+
+	if !signedDelegation.Data.ValidUntil.After(time.Now()) {
+		return context.Error(400, "delegation already expired", nil)
+	}
+
+	providerKeys, err := c.backend.Keys("providers").GetAll()
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	// provider keys cannot be delegates
+	if existingKey, err := findActorKey(providerKeys, signedDelegation.Data.Signing); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else if existingKey != nil {
+		return context.Error(409, "key already in use", nil)
+	}
+
+	id := crypto.Hash(signedDelegation.Data.Signing)
+	delegateProviders := c.backend.DelegateProviders()
+
+	// a key can only be a delegate of a single provider
+	if providerID, err := delegateProviders.Get(id); err != nil {
+		if err != databases.NotFound {
+			services.Log.Error(err)
+			return context.InternalError()
+		}
+	} else if !bytes.Equal(providerID, providerKey.ID) {
+		return context.Error(409, "key already in use", nil)
+	}
+
+	if err := c.logDelegationEvent("add", id, signedDelegation); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if err := c.backend.Delegations(providerKey.ID).Set(id, signedDelegation); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if err := delegateProviders.Set(id, providerKey.ID); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	return context.Acknowledge()
+}
+
+// returns all delegation certificates of the provider, including expired ones
+func (c *Appointments) getProviderDelegations(context services.Context, params *services.GetProviderDelegationsSignedParams) services.Response {
+
+	resp, providerKey := c.isProvider(context, &services.SignedParams{
+		JSON:      params.JSON,
+		Signature: params.Signature,
+		PublicKey: params.PublicKey,
+		Timestamp: params.Data.Timestamp,
+	})
+
+	if resp != nil {
+		return resp
+	}
+
+	delegations, err := c.backend.Delegations(providerKey.ID).GetAll()
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	return context.Result(delegations)
+}
+
+// revokes the delegation certificate with the given ID, which is the hash of
+// the delegated signing key
+func (c *Appointments) revokeProviderDelegation(context services.Context, params *services.RevokeProviderDelegationSignedParams) services.Response {
+
+	resp, providerKey := c.isProvider(context, &services.SignedParams{
+		JSON:      params.JSON,
+		Signature: params.Signature,
+		PublicKey: params.PublicKey,
+		Timestamp: params.Data.Timestamp,
+	})
+
+	if resp != nil {
+		return resp
+	}
+
+	delegations := c.backend.Delegations(providerKey.ID)
+
+	delegation, err := delegations.Get(params.Data.ID)
+
+	if err == databases.NotFound {
+		return context.NotFound()
+	} else if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if err := c.logDelegationEvent("revoke", params.Data.ID, delegation); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if err := c.backend.DelegateProviders().Del(params.Data.ID); err != nil && err != databases.NotFound {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if err := delegations.Del(params.Data.ID); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	return context.Acknowledge()
+}
@@ -0,0 +1,308 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/definitions"
+	"github.com/kiebitz-oss/services/helpers"
+	at "github.com/kiebitz-oss/services/testing"
+	af "github.com/kiebitz-oss/services/testing/fixtures"
+	"testing"
+	"time"
+)
+
+func TestProviderDelegations(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+
+		// we create a mediator
+		at.FC{af.Mediator{}, "mediator"},
+
+		// we create a provider
+		at.FC{af.Provider{
+			ZipCode:   "10707",
+			StoreData: true,
+			Confirm:   true,
+		}, "provider"},
+
+		at.FC{af.Appointments{
+			N:        10,
+			Start:    af.TS("2022-10-01T12:00:00Z"),
+			Duration: 30,
+			Slots:    5,
+			Properties: map[string]interface{}{
+				"vaccine": "moderna",
+			},
+		}, "appointments"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+	provider := fixtures["provider"].(*helpers.Provider)
+	appointments := fixtures["appointments"].([]*services.SignedAppointment)
+
+	staffActor, err := crypto.MakeActor("staff")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// delegates use the same client methods as providers
+	staff := &helpers.Provider{
+		Actor:     staffActor,
+		QueueData: provider.QueueData,
+	}
+
+	// the staff member is not a delegate yet
+	if statusCode, _ := getProviderAppointments(t, client, staff); statusCode != 403 {
+		t.Fatalf("expected a 403 status code, got %d instead", statusCode)
+	}
+
+	if resp, err := client.Appointments.AddProviderDelegation(&services.DelegationData{
+		Signing:    staffActor.SigningKey.PublicKey,
+		Name:       "front desk",
+		Scopes:     []string{services.DelegationScopeReadBookings},
+		ValidUntil: time.Now().Add(-time.Hour),
+	}, provider); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 400 {
+		t.Fatalf("expected a 400 status code for an expired delegation, got %d instead", resp.StatusCode)
+	}
+
+	if resp, err := client.Appointments.AddProviderDelegation(&services.DelegationData{
+		Signing:    staffActor.SigningKey.PublicKey,
+		Name:       "front desk",
+		Scopes:     []string{services.DelegationScopeReadBookings},
+		ValidUntil: time.Now().Add(24 * time.Hour),
+	}, provider); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	if statusCode, list := getProviderAppointments(t, client, staff); statusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", statusCode)
+	} else if len(list) != 10 {
+		t.Fatalf("expected 10 appointments, got %d", len(list))
+	}
+
+	// the delegation does not include the publish scope
+	if resp, err := client.Appointments.DeleteAppointments(&services.DeleteAppointmentsParams{
+		Timestamp: time.Now(),
+		IDs:       [][]byte{appointments[0].Data.ID},
+	}, staff); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 403 {
+		t.Fatalf("expected a 403 status code, got %d instead", resp.StatusCode)
+	}
+
+	// delegates cannot manage delegations
+	if resp, err := client.Appointments.GetProviderDelegations(&services.GetProviderDelegationsParams{
+		Timestamp: time.Now(),
+	}, staff); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 403 {
+		t.Fatalf("expected a 403 status code, got %d instead", resp.StatusCode)
+	}
+
+	if resp, err := client.Appointments.GetProviderDelegations(&services.GetProviderDelegationsParams{
+		Timestamp: time.Now(),
+	}, provider); err != nil {
+		t.Fatal(err)
+	} else if result, err := resp.JSON(); err != nil {
+		t.Fatal(err)
+	} else if list, ok := result["result"].([]interface{}); !ok || len(list) != 1 {
+		t.Fatalf("expected one delegation")
+	}
+
+	if resp, err := client.Appointments.RevokeProviderDelegation(&services.RevokeProviderDelegationParams{
+		Timestamp: time.Now(),
+		ID:        crypto.Hash(staffActor.SigningKey.PublicKey),
+	}, provider); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	if statusCode, _ := getProviderAppointments(t, client, staff); statusCode != 403 {
+		t.Fatalf("expected a 403 status code, got %d instead", statusCode)
+	}
+
+}
+
+func TestDelegatePublishedAppointments(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+
+		// we create a mediator
+		at.FC{af.Mediator{}, "mediator"},
+
+		// we create a provider
+		at.FC{af.Provider{
+			ZipCode:   "10707",
+			StoreData: true,
+			Confirm:   true,
+		}, "provider"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+	provider := fixtures["provider"].(*helpers.Provider)
+
+	staffActor, err := crypto.MakeActor("staff")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	staff := &helpers.Provider{
+		Actor:     staffActor,
+		QueueData: provider.QueueData,
+	}
+
+	if resp, err := client.Appointments.AddProviderDelegation(&services.DelegationData{
+		Signing:    staffActor.SigningKey.PublicKey,
+		Name:       "front desk",
+		Scopes:     []string{services.DelegationScopePublish},
+		ValidUntil: time.Now().Add(24 * time.Hour),
+	}, provider); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	// the staff member signs the appointment with its own key
+	appointment, err := services.MakeAppointment(af.TS("2022-10-01T12:00:00Z"), 5, 30)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	appointment.PublicKey = provider.Actor.EncryptionKey.PublicKey
+
+	signedAppointment, err := appointment.Sign(staffActor.SigningKey)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp, err := client.Appointments.PublishAppointments(&services.PublishAppointmentsParams{
+		Timestamp:    time.Now(),
+		Appointments: []*services.SignedAppointment{signedAppointment},
+	}, staff); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	resp, err := client.Appointments.GetAppointmentsByZipCode(&services.GetAppointmentsByZipCodeParams{
+		ZipCode: "10707",
+		Radius:  20,
+		From:    af.TS("2022-10-01T00:00:00Z"),
+		To:      af.TS("2022-10-02T00:00:00Z"),
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := resp.Bytes()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := &struct {
+		Result []*services.ProviderAppointments `json:"result"`
+	}{}
+
+	if err := json.Unmarshal(data, result); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Result) != 1 || len(result.Result[0].Appointments) != 1 {
+		t.Fatalf("expected one provider with one appointment")
+	}
+
+	keyChain := result.Result[0].KeyChain
+	userAppointment := result.Result[0].Appointments[0]
+
+	// users can verify the appointment via the delegation of the provider
+	if len(keyChain.Delegations) != 1 {
+		t.Fatalf("expected one delegation in the key chain, got %d", len(keyChain.Delegations))
+	}
+
+	delegation := keyChain.Delegations[0]
+	delegationData := &services.DelegationData{}
+
+	if err := json.Unmarshal([]byte(delegation.JSON), delegationData); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(delegation.PublicKey, provider.Actor.SigningKey.PublicKey) {
+		t.Fatalf("expected the delegation to be signed by the provider")
+	}
+
+	if ok, err := crypto.VerifyWithBytes([]byte(delegation.JSON), delegation.Signature, delegation.PublicKey); err != nil || !ok {
+		t.Fatalf("invalid delegation signature")
+	}
+
+	if !bytes.Equal(delegationData.Signing, userAppointment.PublicKey) {
+		t.Fatalf("expected the delegation to cover the appointment key")
+	}
+
+	if ok, err := crypto.VerifyWithBytes([]byte(userAppointment.JSON), userAppointment.Signature, delegationData.Signing); err != nil || !ok {
+		t.Fatalf("invalid appointment signature")
+	}
+
+}
@@ -0,0 +1,150 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/databases"
+	"time"
+)
+
+// deletes a single appointment of the given provider, re-enables the tokens of
+// all its bookings and records a tombstone and a change log entry for it.
+// Returns false if the appointment does not exist.
+func (c *Appointments) deleteAppointment(providerID, id []byte) (bool, error) {
+
+	appointmentDatesByID := c.backend.AppointmentDatesByID(providerID)
+
+	date, err := appointmentDatesByID.Get(id)
+
+	if err == databases.NotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	appointmentsByDate := c.backend.AppointmentsByDate(providerID, date)
+
+	if appointment, err := appointmentsByDate.Get(id); err != nil && err != databases.NotFound {
+		return false, err
+	} else if err == nil {
+
+		usedTokens := c.backend.UsedTokens()
+
+		// we re-enable the tokens of all bookings so that users can book
+		// another appointment
+		for _, booking := range appointment.Bookings {
+			if err := usedTokens.Del(booking.Token); err != nil {
+				return false, err
+			}
+		}
+
+		if err := appointmentsByDate.Del(id); err != nil {
+			return false, err
+		}
+
+		c.addProviderAppointmentStats(providerID, appointment, -1)
+	}
+
+	if err := appointmentDatesByID.Del(id); err != nil {
+		return false, err
+	}
+
+	if err := c.backend.AppointmentTombstones(providerID).Add(id, time.Now()); err != nil {
+		return false, err
+	}
+
+	if _, err := c.backend.AppointmentChanges(providerID).Record(id, true); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (c *Appointments) deleteAppointments(context services.Context, params *services.DeleteAppointmentsSignedParams) services.Response {
+
+	resp, providerKey := c.isProviderOrDelegate(context, &services.SignedParams{
+		JSON:      params.JSON,
+		Signature: params.Signature,
+		PublicKey: params.PublicKey,
+		Timestamp: params.Data.Timestamp,
+	}, services.DelegationScopePublish)
+
+	if resp != nil {
+		return resp
+	}
+
+	// the provider "ID" is the hash of its original signing key
+	hash := providerKey.ID
+
+	ids := params.Data.IDs
+
+	if params.Data.From != nil {
+
+		allDates, err := c.backend.AppointmentDatesByID(hash).GetAll()
+
+		if err != nil {
+			services.Log.Error(err)
+			return context.InternalError()
+		}
+
+		from, to := *params.Data.From, *params.Data.To
+
+		for id, dateStr := range allDates {
+
+			date, err := time.Parse("2006-01-02", string(dateStr))
+
+			if err != nil {
+				services.Log.Error(err)
+				continue
+			}
+
+			// we skip days that lie completely outside of the range (with a
+			// margin of one day as dates use the local time of the appointment)
+			if !date.Add(48*time.Hour).After(from) || date.Add(-24*time.Hour).After(to) {
+				continue
+			}
+
+			// on the remaining days we compare the exact appointment time
+			appointment, err := c.backend.AppointmentsByDate(hash, string(dateStr)).Get([]byte(id))
+
+			if err == databases.NotFound {
+				continue
+			} else if err != nil {
+				services.Log.Error(err)
+				return context.InternalError()
+			}
+
+			if appointment.Data.Timestamp.Before(from) || appointment.Data.Timestamp.After(to) {
+				continue
+			}
+
+			ids = append(ids, []byte(id))
+		}
+	}
+
+	for _, id := range ids {
+		if _, err := c.deleteAppointment(hash, id); err != nil {
+			services.Log.Error(err)
+			return context.InternalError()
+		}
+	}
+
+	return context.Acknowledge()
+}
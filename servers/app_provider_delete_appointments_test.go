@@ -0,0 +1,230 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers_test
+
+import (
+	"encoding/json"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/definitions"
+	"github.com/kiebitz-oss/services/helpers"
+	at "github.com/kiebitz-oss/services/testing"
+	af "github.com/kiebitz-oss/services/testing/fixtures"
+	"testing"
+	"time"
+)
+
+func TestDeleteAppointments(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+
+		// we create a mediator
+		at.FC{af.Mediator{}, "mediator"},
+
+		// we create a provider
+		at.FC{af.Provider{
+			ZipCode:   "10707",
+			StoreData: true,
+			Confirm:   true,
+		}, "provider"},
+
+		at.FC{af.Appointments{
+			N:        10,
+			Start:    af.TS("2022-10-01T12:00:00Z"),
+			Duration: 30,
+			Slots:    5,
+			Properties: map[string]interface{}{
+				"vaccine": "moderna",
+			},
+		}, "appointments"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+	provider := fixtures["provider"].(*helpers.Provider)
+	appointments := fixtures["appointments"].([]*services.SignedAppointment)
+
+	since := time.Now()
+
+	resp, err := client.Appointments.DeleteAppointments(&services.DeleteAppointmentsParams{
+		Timestamp: time.Now(),
+		IDs: [][]byte{
+			appointments[0].Data.ID,
+			appointments[1].Data.ID,
+			appointments[2].Data.ID,
+		},
+	}, provider)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	resp, err = client.Appointments.GetProviderAppointments(&services.GetProviderAppointmentsParams{
+		Timestamp: time.Now(),
+		From:      af.TS("2022-10-01T00:00:00Z"),
+		To:        af.TS("2022-10-02T00:00:00Z"),
+	}, provider)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := resp.Bytes()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := &struct {
+		Result []*services.SignedAppointment `json:"result"`
+	}{}
+
+	if err := json.Unmarshal(data, result); err != nil {
+		t.Fatal(err)
+	}
+
+	// each remaining appointment should be returned exactly once
+	if len(result.Result) != 7 {
+		t.Fatalf("expected 7 appointments, got %d", len(result.Result))
+	}
+
+	seen := map[string]bool{}
+
+	for _, signedAppointment := range result.Result {
+		appointment := &services.Appointment{}
+		if err := json.Unmarshal([]byte(signedAppointment.JSON), appointment); err != nil {
+			t.Fatal(err)
+		}
+		id := string(appointment.ID)
+		if seen[id] {
+			t.Fatalf("appointment returned more than once")
+		}
+		seen[id] = true
+	}
+
+	for _, appointment := range appointments[:3] {
+		if seen[string(appointment.Data.ID)] {
+			t.Fatalf("deleted appointment was returned")
+		}
+	}
+
+	resp, err = client.Appointments.GetDeletedAppointments(&services.GetDeletedAppointmentsParams{
+		Timestamp:    time.Now(),
+		UpdatedSince: &since,
+	}, provider)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result, err := resp.JSON(); err != nil {
+		t.Fatal(err)
+	} else if list, ok := result["result"].([]interface{}); !ok {
+		t.Fatalf("expected a list of tombstones")
+	} else if len(list) != 3 {
+		t.Fatalf("expected 3 tombstones, got %d", len(list))
+	}
+
+}
+
+func TestDeleteAppointmentsByRange(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+
+		// we create a mediator
+		at.FC{af.Mediator{}, "mediator"},
+
+		// we create a provider
+		at.FC{af.Provider{
+			ZipCode:   "10707",
+			StoreData: true,
+			Confirm:   true,
+		}, "provider"},
+
+		// appointments from 12:00 to 16:30, every 30 minutes
+		at.FC{af.Appointments{
+			N:        10,
+			Start:    af.TS("2022-10-01T12:00:00Z"),
+			Duration: 30,
+			Slots:    5,
+			Properties: map[string]interface{}{
+				"vaccine": "moderna",
+			},
+		}, "appointments"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+	provider := fixtures["provider"].(*helpers.Provider)
+
+	// the range starts and ends within the day of the appointments, so only
+	// the appointments at 13:00 and 13:30 lie within it
+	from := af.TS("2022-10-01T12:45:00Z")
+	to := af.TS("2022-10-01T13:45:00Z")
+
+	if resp, err := client.Appointments.DeleteAppointments(&services.DeleteAppointmentsParams{
+		Timestamp: time.Now(),
+		From:      &from,
+		To:        &to,
+	}, provider); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	if statusCode, list := getProviderAppointments(t, client, provider); statusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", statusCode)
+	} else if len(list) != 8 {
+		t.Fatalf("expected 8 appointments, got %d", len(list))
+	}
+
+}
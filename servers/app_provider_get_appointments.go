@@ -20,74 +20,95 @@ package servers
 
 import (
 	"github.com/kiebitz-oss/services"
-	"github.com/kiebitz-oss/services/crypto"
+	"sort"
 	"time"
 )
 
 func (c *Appointments) getProviderAppointments(context services.Context, params *services.GetProviderAppointmentsSignedParams) services.Response {
 
-	resp, providerKey := c.isProvider(context, &services.SignedParams{
+	resp, providerKey := c.isProviderOrDelegate(context, &services.SignedParams{
 		JSON:      params.JSON,
 		Signature: params.Signature,
 		PublicKey: params.PublicKey,
 		Timestamp: params.Data.Timestamp,
-	})
+	}, services.DelegationScopeReadBookings)
 
 	if resp != nil {
 		return resp
 	}
 
-	pkd, err := providerKey.ProviderKeyData()
+	// the provider "ID" is the hash of its original signing key
+	hash := providerKey.ID
+
+	signedAppointments, err := c.providerAppointments(hash, params.Data)
 
 	if err != nil {
 		services.Log.Error(err)
 		return context.InternalError()
 	}
 
-	// the provider "ID" is the hash of the signing key
-	hash := crypto.Hash(pkd.Signing)
+	return context.Result(signedAppointments)
+}
+
+// returns the appointments of the given provider that match the given parameters
+func (c *Appointments) providerAppointments(providerID []byte, params *services.GetProviderAppointmentsParams) ([]*services.SignedAppointment, error) {
 
 	// appointments are stored in a provider-specific key
-	appointmentDatesByID := c.backend.AppointmentDatesByID(hash)
+	appointmentDatesByID := c.backend.AppointmentDatesByID(providerID)
 	allDates, err := appointmentDatesByID.GetAll()
 	if err != nil {
-		services.Log.Error(err)
-		return context.InternalError()
+		return nil, err
 	}
 
-	signedAppointments := make([]*services.SignedAppointment, 0)
+	// the map contains one entry per appointment, so we need to deduplicate
+	// the dates (otherwise we'd return each appointment multiple times)
+	uniqueDates := map[string]bool{}
 
 	for _, dateStr := range allDates {
+		uniqueDates[string(dateStr)] = true
+	}
 
-		date, err := time.Parse("2006-01-02", string(dateStr))
+	dates := make([]string, 0, len(uniqueDates))
+
+	for dateStr := range uniqueDates {
+		dates = append(dates, dateStr)
+	}
+
+	// we return the appointments in order of their dates
+	sort.Strings(dates)
+
+	signedAppointments := make([]*services.SignedAppointment, 0)
+
+	for _, dateStr := range dates {
+
+		date, err := time.Parse("2006-01-02", dateStr)
 
 		if err != nil {
 			services.Log.Error(err)
 			continue
 		}
 
-		if date.Before(params.Data.From) || date.After(params.Data.To) {
+		if date.Before(params.From) || date.After(params.To) {
 			continue
 		}
 
-		appointmentsByDate := c.backend.AppointmentsByDate(hash, string(dateStr))
+		appointmentsByDate := c.backend.AppointmentsByDate(providerID, dateStr)
 
 		allAppointments, err := appointmentsByDate.GetAll()
 
 		if err != nil {
-			services.Log.Error(err)
-			return context.InternalError()
+			return nil, err
 		}
 
 		for _, appointment := range allAppointments {
 			// if the updatedSince parameter is given we only return appointments that have
 			// been updated since the given time
-			if params.Data.UpdatedSince != nil && (params.Data.UpdatedSince.After(appointment.UpdatedAt) || params.Data.UpdatedSince.Equal(appointment.UpdatedAt)) {
+			if params.UpdatedSince != nil && (params.UpdatedSince.After(appointment.UpdatedAt) || params.UpdatedSince.Equal(appointment.UpdatedAt)) {
 				continue
 			}
 			signedAppointments = append(signedAppointments, appointment)
 		}
 	}
 
-	return context.Result(signedAppointments)
+	return signedAppointments, nil
 }
@@ -0,0 +1,60 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/ical"
+)
+
+// Returns the appointments of the provider as an iCalendar file. Since the
+// booking data is encrypted for the provider the calendar only contains the
+// number of bookings, use the CLI to produce a calendar with booking details.
+func (c *Appointments) getProviderAppointmentsCalendar(context services.Context, params *services.GetProviderAppointmentsSignedParams) services.Response {
+
+	resp, providerKey := c.isProviderOrDelegate(context, &services.SignedParams{
+		JSON:      params.JSON,
+		Signature: params.Signature,
+		PublicKey: params.PublicKey,
+		Timestamp: params.Data.Timestamp,
+	}, services.DelegationScopeReadBookings)
+
+	if resp != nil {
+		return resp
+	}
+
+	// the provider "ID" is the hash of its original signing key
+	hash := providerKey.ID
+
+	signedAppointments, err := c.providerAppointments(hash, params.Data)
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	calendar, err := ical.MakeAppointmentsCalendar(signedAppointments, nil)
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	return context.Result(string(calendar.Encode()))
+}
@@ -0,0 +1,126 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers_test
+
+import (
+	"encoding/json"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/definitions"
+	"github.com/kiebitz-oss/services/helpers"
+	"github.com/kiebitz-oss/services/ical"
+	at "github.com/kiebitz-oss/services/testing"
+	af "github.com/kiebitz-oss/services/testing/fixtures"
+	"testing"
+	"time"
+)
+
+func TestGetProviderAppointmentsCalendar(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+
+		// we create a mediator
+		at.FC{af.Mediator{}, "mediator"},
+
+		// we create a provider
+		at.FC{af.Provider{
+			ZipCode:   "10707",
+			StoreData: true,
+			Confirm:   true,
+		}, "provider"},
+
+		// all appointments are on the same date
+		at.FC{af.Appointments{
+			N:        5,
+			Start:    af.TS("2022-10-01T12:00:00Z"),
+			Duration: 30,
+			Slots:    5,
+			Properties: map[string]interface{}{
+				"vaccine": "moderna",
+			},
+		}, "appointments"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+	provider := fixtures["provider"].(*helpers.Provider)
+
+	resp, err := client.Appointments.GetProviderAppointmentsCalendar(&services.GetProviderAppointmentsParams{
+		Timestamp: time.Now(),
+		From:      af.TS("2022-10-01T00:00:00Z"),
+		To:        af.TS("2022-10-02T00:00:00Z"),
+	}, provider)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	data, err := resp.Bytes()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := &struct {
+		Result string `json:"result"`
+	}{}
+
+	if err := json.Unmarshal(data, result); err != nil {
+		t.Fatal(err)
+	}
+
+	calendar, err := ical.Decode([]byte(result.Result))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// each appointment should appear exactly once
+	if len(calendar.Events) != 5 {
+		t.Fatalf("expected 5 events, got %d", len(calendar.Events))
+	}
+
+	uids := map[string]bool{}
+
+	for _, event := range calendar.Events {
+		if uids[event.UID] {
+			t.Fatalf("duplicate event %s", event.UID)
+		}
+		uids[event.UID] = true
+	}
+
+}
@@ -0,0 +1,60 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"github.com/kiebitz-oss/services"
+)
+
+func (c *Appointments) getDeletedAppointments(context services.Context, params *services.GetDeletedAppointmentsSignedParams) services.Response {
+
+	resp, providerKey := c.isProviderOrDelegate(context, &services.SignedParams{
+		JSON:      params.JSON,
+		Signature: params.Signature,
+		PublicKey: params.PublicKey,
+		Timestamp: params.Data.Timestamp,
+	}, services.DelegationScopeReadBookings)
+
+	if resp != nil {
+		return resp
+	}
+
+	// the provider "ID" is the hash of its original signing key
+	hash := providerKey.ID
+
+	allTombstones, err := c.backend.AppointmentTombstones(hash).GetAll()
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	tombstones := make([]*services.AppointmentTombstone, 0)
+
+	for _, tombstone := range allTombstones {
+		// if the updatedSince parameter is given we only return appointments that have
+		// been deleted since the given time
+		if params.Data.UpdatedSince != nil && !tombstone.DeletedAt.After(*params.Data.UpdatedSince) {
+			continue
+		}
+		tombstones = append(tombstones, tombstone)
+	}
+
+	return context.Result(tombstones)
+}
@@ -0,0 +1,117 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"encoding/hex"
+	"github.com/kiebitz-oss/services"
+	"time"
+)
+
+// Provider statistics are stored under a provider-scoped meter ID. Since
+// getStats only accepts a fixed list of IDs they can only be retrieved by the
+// provider itself via getProviderStats.
+func providerStatsID(providerID []byte) string {
+	return "provider-" + hex.EncodeToString(providerID)
+}
+
+// returns the number of open and booked slots of the given appointment
+func appointmentSlotStats(appointment *services.SignedAppointment) (int64, int64) {
+
+	bookedSlots := int64(len(appointment.Bookings))
+	openSlots := int64(len(appointment.Data.SlotData)) - bookedSlots
+
+	if openSlots < 0 {
+		openSlots = 0
+	}
+
+	return openSlots, bookedSlots
+}
+
+// adds (sign = 1) or removes (sign = -1) the open and booked slots of the
+// given appointment to or from the provider statistics. Callers remove the
+// previous version of an appointment before adding the new one, so that each
+// appointment is counted exactly once.
+func (c *Appointments) addProviderAppointmentStats(providerID []byte, appointment *services.SignedAppointment, sign int64) {
+
+	openSlots, bookedSlots := appointmentSlotStats(appointment)
+
+	c.addProviderStats(providerID, appointment.Data.Timestamp, "open", sign*openSlots)
+	c.addProviderStats(providerID, appointment.Data.Timestamp, "booked", sign*bookedSlots)
+}
+
+// adds the given (possibly negative) value to a provider statistic. Values are
+// recorded in the time windows of the given appointment time, so that the
+// statistics describe the utilization of the provider over time.
+func (c *Appointments) addProviderStats(providerID []byte, t time.Time, name string, value int64) {
+
+	if c.meter == nil || value == 0 {
+		return
+	}
+
+	id := providerStatsID(providerID)
+	ts := t.UTC().UnixNano()
+
+	for _, twt := range tws {
+
+		// generate the time window
+		tw := twt(ts)
+
+		if err := c.meter.Add(id, name, map[string]string{}, tw, value); err != nil {
+			services.Log.Error(err)
+		}
+	}
+}
+
+func (c *Appointments) getProviderStats(context services.Context, params *services.GetProviderStatsSignedParams) services.Response {
+
+	resp, providerKey := c.isProvider(context, &services.SignedParams{
+		JSON:      params.JSON,
+		Signature: params.Signature,
+		PublicKey: params.PublicKey,
+		Timestamp: params.Data.Timestamp,
+	})
+
+	if resp != nil {
+		return resp
+	}
+
+	if c.meter == nil {
+		return context.InternalError()
+	}
+
+	// the provider "ID" is the hash of its original signing key
+	hash := providerKey.ID
+
+	values, err := c.statsValues(&services.GetStatsParams{
+		ID:     providerStatsID(hash),
+		Type:   params.Data.Type,
+		Metric: params.Data.Metric,
+		From:   params.Data.From,
+		To:     params.Data.To,
+		N:      params.Data.N,
+	})
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	return context.Result(values)
+}
@@ -0,0 +1,251 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers_test
+
+import (
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/definitions"
+	"github.com/kiebitz-oss/services/helpers"
+	at "github.com/kiebitz-oss/services/testing"
+	af "github.com/kiebitz-oss/services/testing/fixtures"
+	"testing"
+	"time"
+)
+
+// returns the value of the given metric for the day of the appointments
+func providerDayStat(t *testing.T, client *helpers.Client, provider *helpers.Provider, metric string) float64 {
+
+	from := af.TS("2022-10-01T00:00:00Z")
+	to := af.TS("2022-10-01T23:59:59Z")
+
+	resp, err := client.Appointments.GetProviderStats(&services.GetProviderStatsParams{
+		Timestamp: time.Now(),
+		Type:      "day",
+		Metric:    metric,
+		From:      &from,
+		To:        &to,
+	}, provider)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	result, err := resp.JSON()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list, ok := result["result"].([]interface{})
+
+	if !ok {
+		t.Fatalf("expected a list of values")
+	}
+
+	var value float64
+
+	for _, item := range list {
+		value += item.(map[string]interface{})["value"].(float64)
+	}
+
+	return value
+}
+
+func TestGetProviderStats(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+
+		// we create a mediator
+		at.FC{af.Mediator{}, "mediator"},
+
+		// we create a provider
+		at.FC{af.Provider{
+			ZipCode:   "10707",
+			StoreData: true,
+			Confirm:   true,
+		}, "provider"},
+
+		at.FC{af.Appointments{
+			N:        10,
+			Start:    af.TS("2022-10-01T12:00:00Z"),
+			Duration: 30,
+			Slots:    5,
+			Properties: map[string]interface{}{
+				"vaccine": "moderna",
+			},
+		}, "appointments"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+	provider := fixtures["provider"].(*helpers.Provider)
+	appointments := fixtures["appointments"].([]*services.SignedAppointment)
+
+	if value := providerDayStat(t, client, provider, "open"); value != 50 {
+		t.Fatalf("expected 50 open slots, got %v", value)
+	}
+
+	// publishing an appointment again does not count its slots twice
+	if resp, err := client.Appointments.PublishAppointments(&services.PublishAppointmentsParams{
+		Timestamp:    time.Now(),
+		Appointments: appointments[:2],
+	}, provider); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	if value := providerDayStat(t, client, provider, "open"); value != 50 {
+		t.Fatalf("expected 50 open slots, got %v", value)
+	}
+
+	// deleted appointments no longer count
+	if resp, err := client.Appointments.DeleteAppointments(&services.DeleteAppointmentsParams{
+		Timestamp: time.Now(),
+		IDs:       [][]byte{appointments[0].Data.ID, appointments[1].Data.ID},
+	}, provider); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	if value := providerDayStat(t, client, provider, "open"); value != 40 {
+		t.Fatalf("expected 40 open slots, got %v", value)
+	}
+
+	if value := providerDayStat(t, client, provider, "booked"); value != 0 {
+		t.Fatalf("expected no booked slots, got %v", value)
+	}
+
+}
+
+func TestMarkNoShow(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+
+		// we create a mediator
+		at.FC{af.Mediator{}, "mediator"},
+
+		// we create a provider
+		at.FC{af.Provider{
+			ZipCode:   "10707",
+			StoreData: true,
+			Confirm:   true,
+		}, "provider"},
+
+		at.FC{af.Appointments{
+			N:        1,
+			Start:    af.TS("2022-10-01T12:00:00Z"),
+			Duration: 30,
+			Slots:    5,
+			Properties: map[string]interface{}{
+				"vaccine": "moderna",
+			},
+		}, "appointments"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+	provider := fixtures["provider"].(*helpers.Provider)
+	appointments := fixtures["appointments"].([]*services.SignedAppointment)
+
+	params := &services.MarkNoShowParams{
+		Timestamp: time.Now(),
+		ID:        appointments[0].Data.ID,
+		SlotID:    appointments[0].Data.SlotData[0].ID,
+	}
+
+	// the slot has not been booked
+	if resp, err := client.Appointments.MarkNoShow(params, provider); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 404 {
+		t.Fatalf("expected a 404 status code, got %d instead", resp.StatusCode)
+	}
+
+	staffActor, err := crypto.MakeActor("staff")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	staff := &helpers.Provider{
+		Actor:     staffActor,
+		QueueData: provider.QueueData,
+	}
+
+	if resp, err := client.Appointments.AddProviderDelegation(&services.DelegationData{
+		Signing:    staffActor.SigningKey.PublicKey,
+		Name:       "front desk",
+		Scopes:     []string{services.DelegationScopeReadBookings},
+		ValidUntil: time.Now().Add(24 * time.Hour),
+	}, provider); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	// marking no-shows changes the statistics and requires the publish scope
+	params.Timestamp = time.Now()
+
+	if resp, err := client.Appointments.MarkNoShow(params, staff); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 403 {
+		t.Fatalf("expected a 403 status code, got %d instead", resp.StatusCode)
+	}
+
+	if value := providerDayStat(t, client, provider, "noShows"); value != 0 {
+		t.Fatalf("expected no no-shows, got %v", value)
+	}
+
+}
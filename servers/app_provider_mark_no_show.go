@@ -0,0 +1,95 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"bytes"
+	"encoding/hex"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/databases"
+)
+
+// marks a booked slot as not attended, which is only used for the provider
+// statistics. Since this changes the statistics it requires the publish scope.
+func (c *Appointments) markNoShow(context services.Context, params *services.MarkNoShowSignedParams) services.Response {
+
+	resp, providerKey := c.isProviderOrDelegate(context, &services.SignedParams{
+		JSON:      params.JSON,
+		Signature: params.Signature,
+		PublicKey: params.PublicKey,
+		Timestamp: params.Data.Timestamp,
+	}, services.DelegationScopePublish)
+
+	if resp != nil {
+		return resp
+	}
+
+	// the provider "ID" is the hash of its original signing key
+	hash := providerKey.ID
+
+	date, err := c.backend.AppointmentDatesByID(hash).Get(params.Data.ID)
+
+	if err == databases.NotFound {
+		return context.NotFound()
+	} else if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	appointment, err := c.backend.AppointmentsByDate(hash, date).Get(params.Data.ID)
+
+	if err == databases.NotFound {
+		return context.NotFound()
+	} else if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	found := false
+	for _, booking := range appointment.Bookings {
+		if bytes.Equal(booking.ID, params.Data.SlotID) {
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		return context.NotFound()
+	}
+
+	if c.meter != nil {
+
+		id := providerStatsID(hash)
+		uid := hex.EncodeToString(params.Data.SlotID)
+		ts := appointment.Data.Timestamp.UTC().UnixNano()
+
+		for _, twt := range tws {
+
+			// generate the time window of the appointment
+			tw := twt(ts)
+
+			// we count each slot only once, even if it is reported repeatedly
+			if err := c.meter.AddOnce(id, "noShows", uid, map[string]string{}, tw, 1); err != nil {
+				services.Log.Error(err)
+			}
+		}
+	}
+
+	return context.Acknowledge()
+}
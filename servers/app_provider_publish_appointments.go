@@ -22,27 +22,22 @@ import (
 	"bytes"
 	"encoding/hex"
 	"github.com/kiebitz-oss/services"
-	"github.com/kiebitz-oss/services/crypto"
 	"time"
 )
 
 func (c *Appointments) publishAppointments(context services.Context, params *services.PublishAppointmentsSignedParams) services.Response {
 
-	resp, providerKey := c.isProvider(context, &services.SignedParams{
+	resp, providerKey := c.isProviderOrDelegate(context, &services.SignedParams{
 		JSON:      params.JSON,
 		Signature: params.Signature,
 		PublicKey: params.PublicKey,
 		Timestamp: params.Data.Timestamp,
-	})
+	}, services.DelegationScopePublish)
 
 	if resp != nil {
 		return resp
 	}
 
-	if expired(params.Data.Timestamp) {
-		return context.Error(410, "signature expired", nil)
-	}
-
 	pkd, err := providerKey.ProviderKeyData()
 
 	if err != nil {
@@ -50,12 +45,14 @@ func (c *Appointments) publishAppointments(context services.Context, params *ser
 		return context.InternalError()
 	}
 
-	// the provider "ID" is the hash of the signing key
-	hash := crypto.Hash(pkd.Signing)
+	// the provider "ID" is the hash of its original signing key
+	hash := providerKey.ID
 	hexUID := hex.EncodeToString(hash)
 
 	// appointments are stored in a provider-specific key
 	appointmentDatesByID := c.backend.AppointmentDatesByID(hash)
+	appointmentTombstones := c.backend.AppointmentTombstones(hash)
+	appointmentChanges := c.backend.AppointmentChanges(hash)
 	usedTokens := c.backend.UsedTokens()
 
 	// to do: fix statistics generation
@@ -80,6 +77,8 @@ func (c *Appointments) publishAppointments(context services.Context, params *ser
 				services.Log.Error(err)
 				return context.InternalError()
 			} else {
+				// the previous version no longer counts for the statistics
+				c.addProviderAppointmentStats(hash, existingAppointment, -1)
 				bookings := make([]*services.Booking, 0)
 				for _, existingSlotData := range existingAppointment.Data.SlotData {
 					found := false
@@ -124,12 +123,25 @@ func (c *Appointments) publishAppointments(context services.Context, params *ser
 			return context.InternalError()
 		}
 
+		// if the appointment was deleted before we remove its tombstone
+		if err := appointmentTombstones.Del(appointment.Data.ID); err != nil {
+			services.Log.Error(err)
+			return context.InternalError()
+		}
+
 		appointment.UpdatedAt = time.Now()
 
 		if err := appointmentsByDate.Set(appointment); err != nil {
 			services.Log.Error(err)
 			return context.InternalError()
 		}
+
+		if _, err := appointmentChanges.Record(appointment.Data.ID, false); err != nil {
+			services.Log.Error(err)
+			return context.InternalError()
+		}
+
+		c.addProviderAppointmentStats(hash, appointment, 1)
 	}
 
 	if c.meter != nil {
@@ -0,0 +1,123 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"bytes"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"reflect"
+)
+
+// Replaces the key of the calling provider with a new key. The new key data is
+// signed with the current key, and the new signing key proves its possession by
+// signing the signed key data. The provider keeps its ID, so its appointments
+// and bookings remain available under the new key.
+func (c *Appointments) rotateProviderKey(context services.Context, params *services.RotateProviderKeySignedParams) services.Response {
+
+	resp, providerKey := c.isProvider(context, &services.SignedParams{
+		JSON:      params.JSON,
+		Signature: params.Signature,
+		PublicKey: params.PublicKey,
+		Timestamp: params.Data.Timestamp,
+	})
+
+	if resp != nil {
+		return resp
+	}
+
+	signedKeyData := params.Data.SignedKeyData
+
+	// the new key data needs to be signed by the current key
+	if !bytes.Equal(signedKeyData.PublicKey, params.PublicKey) {
+		return context.Error(400, "key data not signed by current key", nil)
+	}
+
+	if ok, err := crypto.VerifyWithBytes([]byte(signedKeyData.JSON), signedKeyData.Signature, signedKeyData.PublicKey); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else if !ok {
+		return context.Error(400, "invalid key data signature", nil)
+	}
+
+	if ok, err := crypto.VerifyWithBytes([]byte(signedKeyData.JSON), params.Data.Proof, signedKeyData.Data.Signing); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else if !ok {
+		return context.Error(400, "invalid proof", nil)
+	}
+
+	pkd, err := providerKey.ProviderKeyData()
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	// the queue data has been verified by a mediator and cannot be changed
+	if !reflect.DeepEqual(pkd.QueueData, signedKeyData.Data.QueueData) {
+		return context.Error(400, "queue data does not match", nil)
+	}
+
+	keys := c.backend.Keys("providers")
+
+	providerKeys, err := keys.GetAll()
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	// the new key must not be in use already
+	if existingKey, err := findActorKey(providerKeys, signedKeyData.Data.Signing); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else if existingKey != nil {
+		return context.Error(409, "key already in use", nil)
+	}
+
+	// we keep the previous key so that the new key can be traced back to the
+	// key that has been signed by a mediator
+	newKey := &services.ActorKey{
+		Data:        signedKeyData.JSON,
+		Signature:   signedKeyData.Signature,
+		PublicKey:   signedKeyData.PublicKey,
+		Predecessor: providerKey,
+	}
+
+	// the key is logged before it is stored, so that every key in use is
+	// contained in the log
+	if err := c.logKeyEvent("provider", "rotate", providerKey.ID, newKey); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	// delegations need to be issued again with the new key
+	if err := c.removeDelegations(providerKey.ID); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if err := keys.Set(providerKey.ID, newKey); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	return context.Acknowledge()
+}
@@ -0,0 +1,212 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers_test
+
+import (
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/definitions"
+	"github.com/kiebitz-oss/services/helpers"
+	at "github.com/kiebitz-oss/services/testing"
+	af "github.com/kiebitz-oss/services/testing/fixtures"
+	"testing"
+	"time"
+)
+
+func getProviderAppointments(t *testing.T, client *helpers.Client, provider *helpers.Provider) (int, []interface{}) {
+
+	resp, err := client.Appointments.GetProviderAppointments(&services.GetProviderAppointmentsParams{
+		Timestamp: time.Now(),
+		From:      af.TS("2022-10-01T00:00:00Z"),
+		To:        af.TS("2022-10-02T00:00:00Z"),
+	}, provider)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != 200 {
+		return resp.StatusCode, nil
+	}
+
+	if result, err := resp.JSON(); err != nil {
+		t.Fatal(err)
+	} else if list, ok := result["result"].([]interface{}); !ok {
+		t.Fatalf("expected a list of appointments")
+	} else {
+		// each appointment should be returned exactly once
+		seen := map[string]bool{}
+		for _, item := range list {
+			if appointment, ok := item.(map[string]interface{}); !ok {
+				t.Fatalf("expected an appointment")
+			} else if data, _ := appointment["data"].(string); seen[data] {
+				t.Fatalf("appointment returned more than once")
+			} else {
+				seen[data] = true
+			}
+		}
+		return resp.StatusCode, list
+	}
+
+	return 0, nil
+}
+
+func TestRotateProviderKey(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+
+		// we create a mediator
+		at.FC{af.Mediator{}, "mediator"},
+
+		// we create a provider
+		at.FC{af.Provider{
+			ZipCode:   "10707",
+			StoreData: true,
+			Confirm:   true,
+		}, "provider"},
+
+		at.FC{af.Appointments{
+			N:        10,
+			Start:    af.TS("2022-10-01T12:00:00Z"),
+			Duration: 30,
+			Slots:    5,
+			Properties: map[string]interface{}{
+				"vaccine": "moderna",
+			},
+		}, "appointments"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+	mediator := fixtures["mediator"].(*crypto.Actor)
+	provider := fixtures["provider"].(*helpers.Provider)
+
+	oldProvider := *provider
+
+	staffActor, err := crypto.MakeActor("staff")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	staff := &helpers.Provider{
+		Actor:     staffActor,
+		QueueData: provider.QueueData,
+	}
+
+	delegation := &services.DelegationData{
+		Signing:    staffActor.SigningKey.PublicKey,
+		Name:       "front desk",
+		Scopes:     []string{services.DelegationScopeReadBookings},
+		ValidUntil: time.Now().Add(24 * time.Hour),
+	}
+
+	addDelegation := func() {
+		if resp, err := client.Appointments.AddProviderDelegation(delegation, provider); err != nil {
+			t.Fatal(err)
+		} else if resp.StatusCode != 200 {
+			t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+		}
+		if statusCode, _ := getProviderAppointments(t, client, staff); statusCode != 200 {
+			t.Fatalf("expected a 200 status code, got %d instead", statusCode)
+		}
+	}
+
+	addDelegation()
+
+	newActor, err := crypto.MakeActor("provider")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp, err := client.Appointments.RotateProviderKey(provider, newActor); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	// delegations need to be issued again with the new key
+	if statusCode, _ := getProviderAppointments(t, client, staff); statusCode != 403 {
+		t.Fatalf("expected a 403 status code, got %d instead", statusCode)
+	}
+
+	addDelegation()
+
+	// the old key cannot be used anymore
+	if statusCode, _ := getProviderAppointments(t, client, &oldProvider); statusCode != 403 {
+		t.Fatalf("expected a 403 status code, got %d instead", statusCode)
+	}
+
+	// the appointments are still available under the new key
+	if statusCode, list := getProviderAppointments(t, client, provider); statusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", statusCode)
+	} else if len(list) != 10 {
+		t.Fatalf("expected 10 appointments, got %d", len(list))
+	}
+
+	// the provider is still visible to users
+	if n := searchProviders(t, client); n != 1 {
+		t.Fatalf("expected one provider, got %d", n)
+	}
+
+	// a mediator can replace the key if the provider lost it
+	rotatedProvider := *provider
+
+	if provider.Actor, err = crypto.MakeActor("provider"); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp, err := client.Appointments.ReplaceProviderKey(crypto.Hash(oldProvider.Actor.SigningKey.PublicKey), provider, mediator); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	if statusCode, _ := getProviderAppointments(t, client, &rotatedProvider); statusCode != 403 {
+		t.Fatalf("expected a 403 status code, got %d instead", statusCode)
+	}
+
+	// the delegations of the replaced key are removed
+	if statusCode, _ := getProviderAppointments(t, client, staff); statusCode != 403 {
+		t.Fatalf("expected a 403 status code, got %d instead", statusCode)
+	}
+
+	if statusCode, list := getProviderAppointments(t, client, provider); statusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", statusCode)
+	} else if len(list) != 10 {
+		t.Fatalf("expected 10 appointments, got %d", len(list))
+	}
+
+}
@@ -37,19 +37,22 @@ func (c *Appointments) storeProviderData(context services.Context, params *servi
 		return context.Error(400, "invalid signature", nil)
 	}
 
-	if expired(params.Data.Timestamp) {
-		return context.Error(410, "signature expired", nil)
+	if resp := c.replays.check(context, []byte(params.JSON), params.PublicKey, params.Data.Timestamp); resp != nil {
+		return resp
 	}
 
-	// to do: add one-time use check
+	hash, err := c.providerID(params.PublicKey)
 
-	hash := crypto.Hash(params.PublicKey)
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
 
 	verifiedProviderData := c.backend.VerifiedProviderData()
 	providerData := c.backend.UnverifiedProviderData()
-	codes := c.backend.Codes("provider")
 
 	existingData := false
+	baseVersion := int64(0)
 	if result, err := verifiedProviderData.Get(hash); err != nil {
 		if err != databases.NotFound {
 			services.Log.Error(err)
@@ -57,46 +60,58 @@ func (c *Appointments) storeProviderData(context services.Context, params *servi
 		}
 	} else if result != nil {
 		existingData = true
+		// the data of a verified provider is stored as an update request,
+		// the verified data remains unchanged until a mediator approves it
+		baseVersion = verifiedVersion(result)
 	}
 
-	if (!existingData) && c.settings.ProviderCodesEnabled {
-		notAuthorized := context.Error(401, "not authorized", nil)
-		if params.Data.Code == nil {
-			return notAuthorized
+	var invitation *services.Invitation
+
+	if !existingData {
+		if c.settings.ProviderCodesEnabled {
+			if resp := c.checkCode(context, "provider", params.Data.Code); resp != nil {
+				return resp
+			}
 		}
-		if ok, err := codes.Has(params.Data.Code); err != nil {
-			services.Log.Error()
-			return context.InternalError()
-		} else if !ok {
-			return notAuthorized
+		// invitations are bound to a provider identity, which we enforce even
+		// if provider codes are not required
+		if params.Data.Code != nil {
+			var resp services.Response
+			if invitation, resp = c.useInvitation(context, params, hash); resp != nil {
+				return resp
+			}
 		}
 	}
 
 	if err := providerData.Set(hash, &services.RawProviderData{
 		EncryptedData: params.Data.EncryptedData,
+		BaseVersion:   baseVersion,
+		Invitation:    invitation,
 	}); err != nil {
 		services.Log.Error(err)
 		return context.InternalError()
 	}
 
-	// we delete the provider code
-	if c.settings.ProviderCodesEnabled {
-		score, err := codes.Score(params.Data.Code)
-		if err != nil && err != databases.NotFound {
-			services.Log.Error(err)
-			return context.InternalError()
-		}
+	if err := c.enqueueProviderData(hash); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
 
-		score += 1
+	// resubmitted data replaces rejected data
+	if err := c.backend.RejectedProviderData().Del(hash); err != nil && err != databases.NotFound {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
 
-		if score > c.settings.ProviderCodesReuseLimit {
-			if err := codes.Del(params.Data.Code); err != nil {
-				services.Log.Error(err)
-				return context.InternalError()
-			}
-		} else if err := codes.AddToScore(params.Data.Code, score); err != nil {
-			services.Log.Error(err)
-			return context.InternalError()
+	if err := c.backend.ProviderRejections().Del(hash); err != nil && err != databases.NotFound {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	// we delete the provider code
+	if c.settings.ProviderCodesEnabled {
+		if resp := c.consumeCode(context, "provider", params.Data.Code, c.settings.ProviderCodesReuseLimit); resp != nil {
+			return resp
 		}
 	}
 
@@ -0,0 +1,141 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"bytes"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/databases"
+)
+
+// Returns all appointments that were created, modified or deleted after the
+// given sequence number. Clients apply upserts and deletions in order and pass
+// the returned sequence number and epoch in their next request, which allows
+// them to keep an exact local replica of their appointments. If the changes the
+// client needs are no longer in the log (because it was trimmed or expired),
+// the client has to fetch all appointments again instead.
+func (c *Appointments) syncProviderAppointments(context services.Context, params *services.SyncProviderAppointmentsSignedParams) services.Response {
+
+	resp, providerKey := c.isProviderOrDelegate(context, &services.SignedParams{
+		JSON:      params.JSON,
+		Signature: params.Signature,
+		PublicKey: params.PublicKey,
+		Timestamp: params.Data.Timestamp,
+	}, services.DelegationScopeReadBookings)
+
+	if resp != nil {
+		return resp
+	}
+
+	// the provider "ID" is the hash of its original signing key
+	hash := providerKey.ID
+
+	appointmentChanges := c.backend.AppointmentChanges(hash)
+
+	epoch, err := appointmentChanges.Epoch()
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	latestSeq, err := appointmentChanges.Seq()
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	sync := &services.AppointmentsSync{
+		Epoch:     epoch,
+		Upserts:   make([]*services.SignedAppointment, 0),
+		Deletions: make([][]byte, 0),
+	}
+
+	since := params.Data.Since
+
+	// the client's sequence number belongs to another log, is ahead of the
+	// log or refers to changes that have been trimmed from it already
+	if (since > 0 && !bytes.Equal(params.Data.Epoch, epoch)) || since > latestSeq || since < latestSeq-maxAppointmentChanges {
+		sync.Seq = latestSeq
+		sync.ResyncRequired = true
+		return context.Result(sync)
+	}
+
+	changes, err := appointmentChanges.Since(since, params.Data.Limit)
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if len(changes) > 0 {
+		sync.Seq = changes[len(changes)-1].Seq
+	} else if since+params.Data.Limit < latestSeq {
+		// there may be gaps in the log if recording a change failed
+		sync.Seq = since + params.Data.Limit
+	} else {
+		sync.Seq = latestSeq
+	}
+
+	sync.More = sync.Seq < latestSeq
+
+	// we only return the latest state of each appointment
+	latestChanges := make(map[string]*services.AppointmentChange)
+	ids := make([]string, 0, len(changes))
+
+	for _, change := range changes {
+		if _, ok := latestChanges[string(change.ID)]; !ok {
+			ids = append(ids, string(change.ID))
+		}
+		latestChanges[string(change.ID)] = change
+	}
+
+	appointmentDatesByID := c.backend.AppointmentDatesByID(hash)
+
+	for _, id := range ids {
+
+		if latestChanges[id].Deleted {
+			sync.Deletions = append(sync.Deletions, []byte(id))
+			continue
+		}
+
+		date, err := appointmentDatesByID.Get([]byte(id))
+
+		if err == databases.NotFound {
+			// the appointment has been deleted after the last change we
+			// return, the client will receive the deletion with the next sync
+			continue
+		} else if err != nil {
+			services.Log.Error(err)
+			return context.InternalError()
+		}
+
+		if appointment, err := c.backend.AppointmentsByDate(hash, date).Get([]byte(id)); err == databases.NotFound {
+			continue
+		} else if err != nil {
+			services.Log.Error(err)
+			return context.InternalError()
+		} else {
+			sync.Upserts = append(sync.Upserts, appointment)
+		}
+	}
+
+	return context.Result(sync)
+}
@@ -0,0 +1,178 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers_test
+
+import (
+	"encoding/base64"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/definitions"
+	"github.com/kiebitz-oss/services/helpers"
+	at "github.com/kiebitz-oss/services/testing"
+	af "github.com/kiebitz-oss/services/testing/fixtures"
+	"testing"
+	"time"
+)
+
+func TestSyncProviderAppointments(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+
+		// we create a mediator
+		at.FC{af.Mediator{}, "mediator"},
+
+		// we create a provider
+		at.FC{af.Provider{
+			ZipCode:   "10707",
+			StoreData: true,
+			Confirm:   true,
+		}, "provider"},
+
+		at.FC{af.Appointments{
+			N:        10,
+			Start:    af.TS("2022-10-01T12:00:00Z"),
+			Duration: 30,
+			Slots:    5,
+			Properties: map[string]interface{}{
+				"vaccine": "moderna",
+			},
+		}, "appointments"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+	provider := fixtures["provider"].(*helpers.Provider)
+	appointments := fixtures["appointments"].([]*services.SignedAppointment)
+
+	sync := func(since int64, epoch []byte, limit int64) map[string]interface{} {
+
+		resp, err := client.Appointments.SyncProviderAppointments(&services.SyncProviderAppointmentsParams{
+			Timestamp: time.Now(),
+			Since:     since,
+			Epoch:     epoch,
+			Limit:     limit,
+		}, provider)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode != 200 {
+			t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+		}
+
+		if result, err := resp.JSON(); err != nil {
+			t.Fatal(err)
+		} else if mapResult, ok := result["result"].(map[string]interface{}); !ok {
+			t.Fatalf("expected a map result")
+		} else {
+			return mapResult
+		}
+
+		return nil
+	}
+
+	result := sync(0, nil, 1000)
+
+	if upserts, ok := result["upserts"].([]interface{}); !ok || len(upserts) != 10 {
+		t.Fatalf("expected 10 upserts")
+	}
+
+	seq := int64(result["seq"].(float64))
+
+	if seq != 10 {
+		t.Fatalf("expected sequence number 10, got %d", seq)
+	}
+
+	epoch, err := base64.StdEncoding.DecodeString(result["epoch"].(string))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the changes are returned in pages
+	result = sync(0, nil, 4)
+
+	if upserts, ok := result["upserts"].([]interface{}); !ok || len(upserts) != 4 {
+		t.Fatalf("expected 4 upserts")
+	}
+
+	if result["seq"].(float64) != 4 || result["more"] != true {
+		t.Fatalf("expected sequence number 4 and more changes")
+	}
+
+	// a sequence number from another epoch requires a resync
+	result = sync(seq, []byte("12345678901234567890123456789012"), 1000)
+
+	if result["resyncRequired"] != true || result["seq"].(float64) != 10 {
+		t.Fatalf("expected a resync to be required")
+	}
+
+	// so does a sequence number that is ahead of the log
+	result = sync(seq+1, epoch, 1000)
+
+	if result["resyncRequired"] != true {
+		t.Fatalf("expected a resync to be required")
+	}
+
+	resp, err := client.Appointments.DeleteAppointments(&services.DeleteAppointmentsParams{
+		Timestamp: time.Now(),
+		IDs: [][]byte{
+			appointments[0].Data.ID,
+			appointments[1].Data.ID,
+		},
+	}, provider)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	result = sync(seq, epoch, 1000)
+
+	if result["resyncRequired"] != false {
+		t.Fatalf("expected no resync to be required")
+	}
+
+	if upserts, ok := result["upserts"].([]interface{}); !ok || len(upserts) != 0 {
+		t.Fatalf("expected no upserts")
+	}
+
+	if deletions, ok := result["deletions"].([]interface{}); !ok || len(deletions) != 2 {
+		t.Fatalf("expected 2 deletions")
+	}
+
+}
@@ -21,8 +21,113 @@ package servers
 import (
 	"github.com/kiebitz-oss/services"
 	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/databases"
+	"time"
 )
 
+// checks that the code exists and that its batch (if any) is still valid,
+// codes without a batch never expire
+func (c *Appointments) checkCode(context services.Context, actor string, code []byte) services.Response {
+
+	notAuthorized := context.Error(401, "not authorized", nil)
+
+	if code == nil {
+		return notAuthorized
+	}
+
+	if ok, err := c.backend.Codes(actor).Has(code); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else if !ok {
+		return notAuthorized
+	}
+
+	batch, err := c.backend.CodeBatches(actor).BatchOf(code)
+
+	if err == databases.NotFound {
+		return nil
+	} else if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if batch.RevokedAt != nil {
+		return context.Error(403, "code revoked", nil)
+	}
+
+	if batch.ExpiresAt != nil && time.Now().After(*batch.ExpiresAt) {
+		return context.Error(410, "code expired", nil)
+	}
+
+	return nil
+}
+
+// increases the usage count of the code and deletes it when it has reached
+// the reuse limit
+func (c *Appointments) consumeCode(context services.Context, actor string, code []byte, reuseLimit int64) services.Response {
+
+	codes := c.backend.Codes(actor)
+
+	score, err := codes.Score(code)
+	if err != nil && err != databases.NotFound {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	score += 1
+
+	if score == 1 {
+		// the code is used for the first time
+		if err := c.backend.CodeBatches(actor).Redeem(code); err != nil {
+			services.Log.Error(err)
+			return context.InternalError()
+		}
+	}
+
+	if score > reuseLimit {
+		if err := codes.Del(code); err != nil {
+			services.Log.Error(err)
+			return context.InternalError()
+		}
+	} else if err := codes.AddToScore(code, score); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	return nil
+}
+
+// creates the batch if it does not exist yet, codes cannot be added to
+// revoked batches
+func (c *Appointments) codeBatch(context services.Context, actor string, data *services.CodeBatchData) services.Response {
+
+	batches := c.backend.CodeBatches(actor)
+
+	if batch, err := batches.Get(data.ID); err == nil {
+		if batch.RevokedAt != nil {
+			return context.Error(400, "batch revoked", nil)
+		}
+		return nil
+	} else if err != databases.NotFound {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if err := batches.Set(&services.CodeBatch{
+		ID:        data.ID,
+		Actor:     actor,
+		Label:     data.Label,
+		IssuedBy:  data.IssuedBy,
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: data.ExpiresAt,
+	}); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	return nil
+}
+
 func (c *Appointments) addCodes(context services.Context, params *services.AddCodesParams) services.Response {
 	rootKey := c.settings.Key("root")
 	if rootKey == nil {
@@ -38,15 +143,34 @@ func (c *Appointments) addCodes(context services.Context, params *services.AddCo
 		services.Log.Error(err)
 		return context.InternalError()
 	}
-	if expired(params.Data.Timestamp) {
-		return context.Error(410, "signature expired", nil)
+	if resp := c.replays.check(context, []byte(params.JSON), rootKey.PublicKey, params.Data.Timestamp); resp != nil {
+		return resp
+	}
+	if err := c.auditRoot("addCodes", params.JSON, params.Signature); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+	batch := params.Data.Batch
+	if batch != nil {
+		if resp := c.codeBatch(context, params.Data.Actor, batch); resp != nil {
+			return resp
+		}
 	}
 	codes := c.backend.Codes(params.Data.Actor)
+	batches := c.backend.CodeBatches(params.Data.Actor)
 	for _, code := range params.Data.Codes {
 		if err := codes.Add(code); err != nil {
 			services.Log.Error(err)
 			return context.InternalError()
 		}
+		if batch == nil {
+			continue
+		}
+		if err := batches.AddCode(batch.ID, code); err != nil {
+			services.Log.Error(err)
+			return context.InternalError()
+		}
 	}
+
 	return context.Acknowledge()
 }
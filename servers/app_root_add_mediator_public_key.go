@@ -21,6 +21,7 @@ package servers
 import (
 	"github.com/kiebitz-oss/services"
 	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/databases"
 )
 
 // { keys }, keyPair
@@ -36,6 +37,16 @@ func (c *Appointments) addMediatorPublicKeys(context services.Context, params *s
 		return resp
 	}
 
+	// a successor key can only replace an existing key
+	if predecessor := params.Data.SignedKeyData.Data.Predecessor; predecessor != nil {
+		if _, err := c.backend.Keys("mediators").Get(predecessor); err == databases.NotFound {
+			return context.Error(400, "predecessor key not found", nil)
+		} else if err != nil {
+			services.Log.Error(err)
+			return context.InternalError()
+		}
+	}
+
 	mediatorKey := &services.ActorKey{
 		Data:      params.Data.SignedKeyData.JSON,
 		Signature: params.Data.SignedKeyData.Signature,
@@ -46,6 +57,16 @@ func (c *Appointments) addMediatorPublicKeys(context services.Context, params *s
 
 	keys := c.backend.Keys("mediators")
 
+	if err := c.auditRoot("addMediatorPublicKeys", params.JSON, params.Signature); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if err := c.logKeyEvent("mediator", "add", hash, mediatorKey); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
 	if err := keys.Set(hash, mediatorKey); err != nil {
 		services.Log.Error(err)
 		return context.InternalError()
@@ -0,0 +1,98 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/databases"
+	"sort"
+	"time"
+)
+
+// codes of a revoked batch cannot be used anymore, existing tokens and
+// provider data are not affected
+func (c *Appointments) revokeCodeBatch(context services.Context, params *services.RevokeCodeBatchSignedParams) services.Response {
+
+	if resp := c.isRoot(context, &services.SignedParams{
+		JSON:      params.JSON,
+		Signature: params.Signature,
+		PublicKey: params.PublicKey,
+		Timestamp: params.Data.Timestamp,
+	}); resp != nil {
+		return resp
+	}
+
+	batches := c.backend.CodeBatches(params.Data.Actor)
+
+	batch, err := batches.Get(params.Data.ID)
+
+	if err == databases.NotFound {
+		return context.NotFound()
+	} else if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if batch.RevokedAt != nil {
+		return context.Error(400, "batch already revoked", nil)
+	}
+
+	revokedAt := time.Now().UTC()
+	batch.RevokedAt = &revokedAt
+	batch.RevocationReason = params.Data.Reason
+
+	if err := c.auditRoot("revokeCodeBatch", params.JSON, params.Signature); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if err := batches.Set(batch); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	return context.Acknowledge()
+}
+
+// returns all code batches of the given actor together with the number of
+// codes and redeemed codes, ordered by creation time
+func (c *Appointments) getCodeBatches(context services.Context, params *services.GetCodeBatchesSignedParams) services.Response {
+
+	if resp := c.isRoot(context, &services.SignedParams{
+		JSON:      params.JSON,
+		Signature: params.Signature,
+		PublicKey: params.PublicKey,
+		Timestamp: params.Data.Timestamp,
+	}); resp != nil {
+		return resp
+	}
+
+	batches, err := c.backend.CodeBatches(params.Data.Actor).GetAll()
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	sort.Slice(batches, func(i, j int) bool {
+		return batches[i].CreatedAt.Before(batches[j].CreatedAt)
+	})
+
+	return context.Result(batches)
+}
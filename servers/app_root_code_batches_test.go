@@ -0,0 +1,188 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers_test
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/definitions"
+	"github.com/kiebitz-oss/services/helpers"
+	at "github.com/kiebitz-oss/services/testing"
+	af "github.com/kiebitz-oss/services/testing/fixtures"
+	"testing"
+	"time"
+)
+
+func addCodeBatch(t *testing.T, client *helpers.Client, label string, expiresAt time.Time, n int) ([]byte, []string) {
+
+	id, err := crypto.RandomBytes(32)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	codes := make([]string, n)
+
+	for i := range codes {
+		if code, err := crypto.RandomBytes(16); err != nil {
+			t.Fatal(err)
+		} else {
+			codes[i] = hex.EncodeToString(code)
+		}
+	}
+
+	if resp, err := client.Appointments.AddCodes(map[string]interface{}{
+		"timestamp": time.Now(),
+		"actor":     "user",
+		"codes":     codes,
+		"batch": &services.CodeBatchData{
+			ID:        id,
+			Label:     label,
+			IssuedBy:  "test",
+			ExpiresAt: &expiresAt,
+		},
+	}); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	return id, codes
+}
+
+func getTokenWithCode(t *testing.T, client *helpers.Client, code string) int {
+
+	user, err := crypto.MakeActor("user")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := crypto.RandomBytes(32)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := client.Appointments.GetToken(map[string]interface{}{
+		"hash":      hash,
+		"code":      code,
+		"publicKey": user.SigningKey.PublicKey,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resp.StatusCode
+}
+
+func TestCodeBatches(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+	settings := fixtures["settings"].(*services.Settings)
+
+	settings.Appointments.UserCodesEnabled = true
+
+	_, expiredCodes := addCodeBatch(t, client, "expired", time.Now().Add(-time.Hour), 1)
+	batchID, codes := addCodeBatch(t, client, "valid", time.Now().Add(time.Hour), 3)
+
+	if status := getTokenWithCode(t, client, expiredCodes[0]); status != 410 {
+		t.Fatalf("expected a 410 status code, got %d instead", status)
+	}
+
+	if status := getTokenWithCode(t, client, codes[0]); status != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", status)
+	}
+
+	if resp, err := client.Appointments.RevokeCodeBatch(&services.RevokeCodeBatchParams{
+		Timestamp: time.Now(),
+		Actor:     "user",
+		ID:        batchID,
+		Reason:    "distributed to the wrong people",
+	}); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	if status := getTokenWithCode(t, client, codes[1]); status != 403 {
+		t.Fatalf("expected a 403 status code, got %d instead", status)
+	}
+
+	resp, err := client.Appointments.GetCodeBatches(&services.GetCodeBatchesParams{
+		Timestamp: time.Now(),
+		Actor:     "user",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	bytes, err := resp.Bytes()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := &struct {
+		Result []*services.CodeBatch `json:"result"`
+	}{}
+
+	if err := json.Unmarshal(bytes, result); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Result) != 2 {
+		t.Fatalf("expected two batches, got %d instead", len(result.Result))
+	}
+
+	// batches are ordered by creation time
+	batch := result.Result[1]
+
+	if batch.Label != "valid" || batch.Codes != 3 || batch.Redeemed != 1 || batch.RevokedAt == nil {
+		t.Fatalf("unexpected batch: %+v", batch)
+	}
+
+}
@@ -0,0 +1,63 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"github.com/kiebitz-oss/services"
+	"time"
+)
+
+// records an authorized privileged call in the audit log; it is called
+// before the call makes any changes so that no change goes unrecorded
+func (c *Appointments) audit(method, data string, signature, publicKey []byte) error {
+	return c.backend.AuditLog().Append(&services.AuditLogEntry{
+		Timestamp: time.Now().UTC(),
+		Method:    method,
+		Data:      data,
+		Signature: signature,
+		PublicKey: publicKey,
+	})
+}
+
+// records an authorized privileged call signed with the root key
+func (c *Appointments) auditRoot(method, data string, signature []byte) error {
+	return c.audit(method, data, signature, c.settings.Key("root").PublicKey)
+}
+
+// { from, limit }, keyPair
+func (c *Appointments) getAuditLog(context services.Context, params *services.GetAuditLogSignedParams) services.Response {
+
+	if resp := c.isRoot(context, &services.SignedParams{
+		JSON:      params.JSON,
+		Signature: params.Signature,
+		PublicKey: params.PublicKey,
+		Timestamp: params.Data.Timestamp,
+	}); resp != nil {
+		return resp
+	}
+
+	entries, err := c.backend.AuditLog().GetRange(params.Data.From, params.Data.Limit)
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	return context.Result(entries)
+}
@@ -0,0 +1,184 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers_test
+
+import (
+	"encoding/json"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/definitions"
+	"github.com/kiebitz-oss/services/helpers"
+	at "github.com/kiebitz-oss/services/testing"
+	af "github.com/kiebitz-oss/services/testing/fixtures"
+	"testing"
+	"time"
+)
+
+func TestGetAuditLog(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+
+		// we create a mediator
+		at.FC{af.Mediator{}, "mediator"},
+
+		// we create a provider
+		at.FC{af.Provider{
+			ZipCode:   "10707",
+			StoreData: true,
+			Confirm:   true,
+		}, "provider"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+	settings := fixtures["settings"].(*services.Settings)
+	rootKey := settings.Admin.Signing.Key("root").PublicKey
+
+	resp, err := client.Appointments.GetAuditLog(&services.GetAuditLogParams{
+		Timestamp: time.Now(),
+		From:      1,
+		Limit:     100,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	bytes, err := resp.Bytes()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := &struct {
+		Result []*services.AuditLogEntry `json:"result"`
+	}{}
+
+	if err := json.Unmarshal(bytes, result); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := result.Result
+	methods := map[string]bool{}
+
+	for _, entry := range entries {
+		methods[entry.Method] = true
+	}
+
+	for _, method := range []string{"addMediatorPublicKeys", "confirmProvider"} {
+		if !methods[method] {
+			t.Fatalf("expected an audit log entry for %s", method)
+		}
+	}
+
+	signers := services.AuditLogSigners(entries, rootKey)
+
+	// the root key and the key of the mediator
+	if len(signers) != 2 {
+		t.Fatalf("expected 2 signers, got %d", len(signers))
+	}
+
+	if err := services.VerifyAuditLog(entries, signers); err != nil {
+		t.Fatal(err)
+	}
+
+	// mediator entries are rejected if the mediator key isn't trusted
+	if err := services.VerifyAuditLog(entries, [][]byte{rootKey}); err == nil {
+		t.Fatalf("expected an unknown signer")
+	}
+
+	head := *entries[len(entries)-1]
+
+	if err := services.VerifyAuditLogHead(entries, head.Index, head.Hash); err != nil {
+		t.Fatal(err)
+	}
+
+	// a truncated log no longer contains the pinned head
+	if err := services.VerifyAuditLogHead(entries[:len(entries)-1], head.Index, head.Hash); err == nil {
+		t.Fatalf("expected the pinned head to be missing")
+	}
+
+	// changing an entry breaks the chain
+	entries[0].Method = "addCodes"
+
+	if err := services.VerifyAuditLog(entries, signers); err == nil {
+		t.Fatalf("expected the chain to be broken")
+	}
+
+	// the audit log survives a database reset
+	if resp, err := client.Appointments.ResetDB(); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	resp, err = client.Appointments.GetAuditLog(&services.GetAuditLogParams{
+		Timestamp: time.Now(),
+		From:      1,
+		Limit:     100,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes, err = resp.Bytes(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := json.Unmarshal(bytes, result); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Result) != len(entries)+1 {
+		t.Fatalf("expected %d entries after the reset, got %d", len(entries)+1, len(result.Result))
+	}
+
+	if last := result.Result[len(result.Result)-1]; last.Method != "resetDB" {
+		t.Fatalf("expected the last entry to be for resetDB, got %s", last.Method)
+	}
+
+	if err := services.VerifyAuditLog(result.Result, services.AuditLogSigners(result.Result, rootKey)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the head pinned before the reset is still contained in the log
+	if err := services.VerifyAuditLogHead(result.Result, head.Index, head.Hash); err != nil {
+		t.Fatal(err)
+	}
+
+}
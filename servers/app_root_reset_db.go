@@ -34,12 +34,24 @@ func (a *Appointments) resetDB(context services.Context, params *services.ResetD
 	}
 
 	if !a.test {
-		context.Error(400, "not a test system, will not reset database...", nil)
+		return context.Error(400, "not a test system, will not reset database...", nil)
 	}
 
 	services.Log.Warning("Database reset requested!")
 
-	if err := a.db.Reset(); err != nil {
+	// the audit log is append-only, so it survives the reset
+	if err := a.db.ResetExcept(auditLogTable); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	// the key log was reset, so we log the system keys again
+	if err := a.logSystemKeys(); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if err := a.auditRoot("resetDB", params.JSON, params.Signature); err != nil {
 		services.Log.Error(err)
 		return context.InternalError()
 	}
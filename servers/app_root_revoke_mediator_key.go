@@ -0,0 +1,65 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/databases"
+)
+
+// revoked mediator keys are no longer returned as part of key chains and
+// cannot be used for authentication anymore. Providers confirmed with a
+// revoked key need to be re-signed by a successor key (see rotateMediatorKey).
+func (c *Appointments) revokeMediatorKey(context services.Context, params *services.RevokeMediatorKeySignedParams) services.Response {
+
+	if resp := c.isRoot(context, &services.SignedParams{
+		JSON:      params.JSON,
+		Signature: params.Signature,
+		PublicKey: params.PublicKey,
+		Timestamp: params.Data.Timestamp,
+	}); resp != nil {
+		return resp
+	}
+
+	mediatorKey, err := c.backend.Keys("mediators").Get(params.Data.ID)
+
+	if err == databases.NotFound {
+		return context.NotFound()
+	} else if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if err := c.auditRoot("revokeMediatorKey", params.JSON, params.Signature); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if err := c.logKeyEvent("mediator", "revoke", params.Data.ID, mediatorKey); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if err := c.backend.MediatorKeyRevocations().Set(params.Data.ID, params); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	return context.Acknowledge()
+}
@@ -38,8 +38,12 @@ func (c *Appointments) uploadDistances(context services.Context, params *service
 		services.Log.Error(err)
 		return context.InternalError()
 	}
-	if expired(params.Data.Timestamp) {
-		return context.Error(410, "signature expired", nil)
+	if resp := c.replays.check(context, []byte(params.JSON), rootKey.PublicKey, params.Data.Timestamp); resp != nil {
+		return resp
+	}
+	if err := c.auditRoot("uploadDistances", params.JSON, params.Signature); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
 	}
 	for _, distance := range params.Data.Distances {
 		neighborsFrom := c.backend.Neighbors(params.Data.Type, distance.From)
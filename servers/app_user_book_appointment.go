@@ -31,6 +31,15 @@ func (c *Appointments) isActiveProvider(context services.Context, id []byte) ser
 		if err == databases.NotFound {
 			return context.Error(404, "provider not found", nil)
 		}
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if status, err := c.backend.ProviderStatus().Status(id); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else if status != services.ProviderActive {
+		return context.Error(404, "provider not found", nil)
 	}
 
 	return nil
@@ -38,11 +47,13 @@ func (c *Appointments) isActiveProvider(context services.Context, id []byte) ser
 
 func (c *Appointments) bookAppointment(context services.Context, params *services.BookAppointmentSignedParams) services.Response {
 
+	tokenData, token := userToken(params.Data.SignedTokenData, params.Data.BlindToken)
+
 	if resp := c.isUser(context, &services.SignedParams{
 		JSON:      params.JSON,
 		Signature: params.Signature,
 		PublicKey: params.PublicKey,
-		ExtraData: params.Data.SignedTokenData,
+		ExtraData: tokenData,
 		Timestamp: params.Data.Timestamp,
 	}); resp != nil {
 		return resp
@@ -51,7 +62,6 @@ func (c *Appointments) bookAppointment(context services.Context, params *service
 	var result interface{}
 
 	usedTokens := c.backend.UsedTokens()
-	token := params.Data.SignedTokenData.Data.Token
 
 	if ok, err := usedTokens.Has(token); err != nil {
 		services.Log.Error(err)
@@ -129,6 +139,15 @@ func (c *Appointments) bookAppointment(context services.Context, params *service
 				return context.InternalError()
 			}
 
+			// we record the change so that the provider can sync it
+			if _, err := c.backend.AppointmentChanges(params.Data.ProviderID).Record(params.Data.ID, false); err != nil {
+				services.Log.Error(err)
+				return context.InternalError()
+			}
+
+			c.addProviderStats(params.Data.ProviderID, signedAppointment.Data.Timestamp, "open", -1)
+			c.addProviderStats(params.Data.ProviderID, signedAppointment.Data.Timestamp, "booked", 1)
+
 		}
 
 	}
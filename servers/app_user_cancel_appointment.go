@@ -26,11 +26,13 @@ import (
 
 func (c *Appointments) cancelAppointment(context services.Context, params *services.CancelAppointmentSignedParams) services.Response {
 
+	tokenData, token := userToken(params.Data.SignedTokenData, params.Data.BlindToken)
+
 	if resp := c.isUser(context, &services.SignedParams{
 		JSON:      params.JSON,
 		Signature: params.Signature,
 		PublicKey: params.PublicKey,
-		ExtraData: params.Data.SignedTokenData,
+		ExtraData: tokenData,
 		Timestamp: params.Data.Timestamp,
 	}); resp != nil {
 		return resp
@@ -51,8 +53,6 @@ func (c *Appointments) cancelAppointment(context services.Context, params *servi
 		} else {
 			newBookings := make([]*services.Booking, 0)
 
-			token := params.Data.SignedTokenData.Data.Token
-
 			found := false
 			for _, booking := range signedAppointment.Bookings {
 				if bytes.Equal(booking.Token, token) && bytes.Equal(booking.ID, params.Data.SlotID) {
@@ -84,6 +84,16 @@ func (c *Appointments) cancelAppointment(context services.Context, params *servi
 				return context.InternalError()
 			}
 
+			// we record the change so that the provider can sync it
+			if _, err := c.backend.AppointmentChanges(params.Data.ProviderID).Record(params.Data.ID, false); err != nil {
+				services.Log.Error(err)
+				return context.InternalError()
+			}
+
+			c.addProviderStats(params.Data.ProviderID, signedAppointment.Data.Timestamp, "open", 1)
+			c.addProviderStats(params.Data.ProviderID, signedAppointment.Data.Timestamp, "booked", -1)
+			c.addProviderStats(params.Data.ProviderID, signedAppointment.Data.Timestamp, "cancelled", 1)
+
 		}
 
 	}
@@ -0,0 +1,69 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+)
+
+// signs a blinded token with the blind token key. As we only see the blinded
+// data we cannot link the token to later bookings or cancellations.
+func (c *Appointments) getBlindToken(context services.Context, params *services.GetBlindTokenParams) services.Response {
+
+	blindTokenKey := c.settings.Key("blind-token")
+
+	if blindTokenKey == nil {
+		return context.Error(400, "blind tokens not supported", nil)
+	}
+
+	// blind tokens can't be limited per user, so without codes or challenges
+	// anyone could get an unlimited number of them
+	if !c.settings.UserCodesEnabled && !c.settings.TokenChallengeEnabled {
+		return context.Error(400, "blind tokens require user codes or token challenges", nil)
+	}
+
+	if resp := c.checkUserCode(context, params.Code); resp != nil {
+		return resp
+	}
+
+	if resp := c.checkTokenChallenge(context, params.Challenge, params.BlindedToken); resp != nil {
+		return resp
+	}
+
+	signature, err := blindTokenKey.BlindSign(params.BlindedToken)
+
+	if err == crypto.ErrOutOfRange {
+		return context.Error(400, "invalid blinded token", nil)
+	} else if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	if resp := c.consumeUserCode(context, params.Code); resp != nil {
+		return resp
+	}
+
+	c.addTokenStats()
+
+	return context.Result(&services.BlindTokenSignature{
+		Signature: signature,
+	})
+
+}
@@ -0,0 +1,185 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers_test
+
+import (
+	"encoding/json"
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/definitions"
+	"github.com/kiebitz-oss/services/forms"
+	"github.com/kiebitz-oss/services/helpers"
+	at "github.com/kiebitz-oss/services/testing"
+	af "github.com/kiebitz-oss/services/testing/fixtures"
+	"testing"
+)
+
+func TestGetBlindToken(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+	settings := fixtures["settings"].(*services.Settings)
+
+	resp, err := client.Appointments.GetKeys()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := &services.Keys{}
+
+	if err := resp.CoerceResult(keys, &forms.KeysForm); err != nil {
+		t.Fatal(err)
+	}
+
+	if keys.BlindTokenKey == nil {
+		t.Fatalf("expected a blind token key")
+	}
+
+	user, err := crypto.MakeActor("user")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serial, err := crypto.RandomBytes(32)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokenData, err := json.Marshal(&services.BlindTokenData{
+		Serial:    serial,
+		PublicKey: user.SigningKey.PublicKey,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blindedToken, blindingFactor, err := crypto.Blind(tokenData, keys.BlindTokenKey)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// without user codes or challenges no blind tokens are issued
+	if resp, err := client.Appointments.GetBlindToken(&services.GetBlindTokenParams{
+		BlindedToken: blindedToken,
+	}); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 400 {
+		t.Fatalf("expected a 400 status code, got %d instead", resp.StatusCode)
+	}
+
+	settings.Appointments.TokenChallengeEnabled = true
+
+	resp, err = client.Appointments.GetBlindToken(&services.GetBlindTokenParams{
+		BlindedToken: blindedToken,
+		Challenge:    solveTokenChallenge(t, client, blindedToken),
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	blindTokenSignature := &services.BlindTokenSignature{}
+
+	if err := resp.CoerceResult(blindTokenSignature, &forms.BlindTokenSignatureForm); err != nil {
+		t.Fatal(err)
+	}
+
+	signature, err := crypto.Unblind(tokenData, blindTokenSignature.Signature, blindingFactor, keys.BlindTokenKey)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := crypto.VerifyBlindSignature(tokenData, signature, keys.BlindTokenKey); err != nil {
+		t.Fatal(err)
+	} else if !ok {
+		t.Fatalf("expected a valid token signature")
+	}
+
+	// values outside of the RSA modulus are refused
+	outOfRange := make([]byte, len(blindedToken))
+
+	for i := range outOfRange {
+		outOfRange[i] = 0xff
+	}
+
+	if resp, err := client.Appointments.GetBlindToken(&services.GetBlindTokenParams{
+		BlindedToken: outOfRange,
+		Challenge:    solveTokenChallenge(t, client, outOfRange),
+	}); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 400 {
+		t.Fatalf("expected a 400 status code, got %d instead", resp.StatusCode)
+	}
+
+}
+
+// gets a token challenge and solves it for the given binding
+func solveTokenChallenge(t *testing.T, client *helpers.Client, binding []byte) *services.TokenChallengeSolution {
+
+	resp, err := client.Appointments.GetTokenChallenge()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	challenge := &services.SignedTokenChallenge{}
+
+	if err := resp.CoerceResult(challenge, &forms.SignedTokenChallengeForm); err != nil {
+		t.Fatal(err)
+	}
+
+	data := append(append([]byte{}, challenge.Data.Nonce...), binding...)
+
+	return &services.TokenChallengeSolution{
+		Challenge: challenge,
+		Solution:  crypto.SolveHashcash(data, int(challenge.Data.Difficulty)),
+	}
+}
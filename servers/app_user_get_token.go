@@ -25,6 +25,7 @@ import (
 	"github.com/kiebitz-oss/services"
 	"github.com/kiebitz-oss/services/crypto"
 	"github.com/kiebitz-oss/services/databases"
+	"time"
 )
 
 // Generates an HMAC based priority token and associated data structure.
@@ -55,12 +56,29 @@ func (c *Appointments) priorityToken() (*services.PriorityToken, string, []byte,
 	}
 }
 
+// checks that a valid user code was given if user codes are enabled
+func (c *Appointments) checkUserCode(context services.Context, code []byte) services.Response {
+
+	if !c.settings.UserCodesEnabled {
+		return nil
+	}
+
+	return c.checkCode(context, "user", code)
+}
+
+func (c *Appointments) consumeUserCode(context services.Context, code []byte) services.Response {
+
+	if !c.settings.UserCodesEnabled {
+		return nil
+	}
+
+	return c.consumeCode(context, "user", code, c.settings.UserCodesReuseLimit)
+}
+
 //{hash, code, publicKey}
 // get a token for a given queue
 func (c *Appointments) getToken(context services.Context, params *services.GetTokenParams) services.Response {
 
-	codes := c.backend.Codes("user")
-
 	tokenKey := c.settings.Key("token")
 	if tokenKey == nil {
 		services.Log.Error("token key missing")
@@ -69,16 +87,22 @@ func (c *Appointments) getToken(context services.Context, params *services.GetTo
 
 	var signedData *crypto.SignedStringData
 
-	if c.settings.UserCodesEnabled {
-		notAuthorized := context.Error(401, "not authorized", nil)
-		if params.Code == nil {
-			return notAuthorized
-		}
-		if ok, err := codes.Has(params.Code); err != nil {
-			services.Log.Error()
+	if resp := c.checkUserCode(context, params.Code); resp != nil {
+		return resp
+	}
+
+	if resp := c.checkTokenChallenge(context, params.Challenge, params.Hash); resp != nil {
+		return resp
+	}
+
+	// we limit the number of tokens that can be requested for the same hash
+	if c.settings.TokenIssuanceLimit > 0 {
+		window := time.Duration(c.settings.TokenIssuanceWindowHours) * time.Hour
+		if n, err := c.backend.TokenIssuance(params.Hash).Incr(window); err != nil {
+			services.Log.Error(err)
 			return context.InternalError()
-		} else if !ok {
-			return notAuthorized
+		} else if n > c.settings.TokenIssuanceLimit {
+			return context.Error(429, "too many tokens requested", nil)
 		}
 	}
 
@@ -94,6 +118,11 @@ func (c *Appointments) getToken(context services.Context, params *services.GetTo
 			PublicKey: params.PublicKey,
 		}
 
+		if c.settings.TokenValidityDays > 0 {
+			expiresAt := time.Now().Add(time.Duration(c.settings.TokenValidityDays) * 24 * time.Hour)
+			tokenData.ExpiresAt = &expiresAt
+		}
+
 		td, err := json.Marshal(tokenData)
 
 		if err != nil {
@@ -108,26 +137,12 @@ func (c *Appointments) getToken(context services.Context, params *services.GetTo
 	}
 
 	// if this is a new token we delete the user code
-	if c.settings.UserCodesEnabled {
-		score, err := codes.Score(params.Code)
-		if err != nil && err != databases.NotFound {
-			services.Log.Error(err)
-			return context.InternalError()
-		}
-
-		score += 1
-
-		if score > c.settings.UserCodesReuseLimit {
-			if err := codes.Del(params.Code); err != nil {
-				services.Log.Error(err)
-				return context.InternalError()
-			}
-		} else if err := codes.AddToScore(params.Code, score); err != nil {
-			services.Log.Error(err)
-			return context.InternalError()
-		}
+	if resp := c.consumeUserCode(context, params.Code); resp != nil {
+		return resp
 	}
 
+	c.addTokenStats()
+
 	return context.Result(signedData)
 
 }
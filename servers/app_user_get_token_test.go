@@ -0,0 +1,118 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers_test
+
+import (
+	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/definitions"
+	"github.com/kiebitz-oss/services/forms"
+	"github.com/kiebitz-oss/services/helpers"
+	at "github.com/kiebitz-oss/services/testing"
+	af "github.com/kiebitz-oss/services/testing/fixtures"
+	"testing"
+	"time"
+)
+
+func TestGetToken(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+	settings := fixtures["settings"].(*services.Settings)
+
+	user, err := crypto.MakeActor("user")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := crypto.RandomBytes(32)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params := &services.GetTokenParams{
+		Hash:      hash,
+		PublicKey: user.SigningKey.PublicKey,
+	}
+
+	var tokens [][]byte
+
+	for i := int64(0); i < settings.Appointments.TokenIssuanceLimit; i++ {
+
+		resp, err := client.Appointments.GetToken(params)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode != 200 {
+			t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+		}
+
+		signedTokenData := &services.SignedTokenData{}
+
+		if err := resp.CoerceResult(signedTokenData, &forms.SignedTokenDataForm); err != nil {
+			t.Fatal(err)
+		}
+
+		if signedTokenData.Data.ExpiresAt == nil || signedTokenData.Data.ExpiresAt.Before(time.Now()) {
+			t.Fatalf("expected the token to expire in the future")
+		}
+
+		tokens = append(tokens, signedTokenData.Data.Token)
+	}
+
+	// further tokens for the same hash are refused
+	if resp, err := client.Appointments.GetToken(params); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 429 {
+		t.Fatalf("expected a 429 status code, got %d instead", resp.StatusCode)
+	}
+
+	if resp, err := client.Appointments.RevokeTokens(&services.RevokeTokensParams{
+		Timestamp: time.Now(),
+		Tokens:    tokens,
+		Reason:    "issued to a bot",
+	}); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+}
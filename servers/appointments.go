@@ -23,7 +23,9 @@ import (
 	"github.com/kiebitz-oss/services"
 	"github.com/kiebitz-oss/services/api"
 	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/databases"
 	"github.com/kiebitz-oss/services/forms"
+	"time"
 )
 
 // time windows for statistics generation
@@ -42,7 +44,10 @@ type Appointments struct {
 	backend  *AppointmentsBackend
 	meter    services.Meter
 	settings *services.AppointmentsSettings
+	replays  *replayGuard
 	test     bool
+	// key for authenticating token challenges (derived from the secret)
+	tokenChallengeKey []byte
 }
 
 func MakeAppointments(settings *services.Settings) (*Appointments, error) {
@@ -52,6 +57,7 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 		backend:  &AppointmentsBackend{db: settings.DatabaseObj},
 		meter:    settings.MeterObj,
 		settings: settings.Appointments,
+		replays:  makeReplayGuard(settings.DatabaseObj, settings.Appointments.SignatureValiditySeconds, settings.Appointments.ClockSkewSeconds),
 		test:     settings.Test,
 	}
 
@@ -85,6 +91,58 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 					Method: api.GET,
 				},
 			},
+			{
+				Name:        "getKeyLogHead", // unauthenticated
+				Description: "Returns the signed head of the key log, a Merkle tree of all changes to the published keys.",
+				Form:        &forms.GetKeyLogHeadForm,
+				Handler:     appointments.getKeyLogHead,
+				ReturnType: &api.ReturnType{
+					Validators: forms.GetKeyLogHeadRVV,
+				},
+				REST: &api.REST{
+					Path:   "keys/log/head",
+					Method: api.GET,
+				},
+			},
+			{
+				Name:        "getKeyLogEntries", // unauthenticated
+				Description: "Returns entries of the key log.",
+				Form:        &forms.GetKeyLogEntriesForm,
+				Handler:     appointments.getKeyLogEntries,
+				ReturnType: &api.ReturnType{
+					Validators: forms.GetKeyLogEntriesRVV,
+				},
+				REST: &api.REST{
+					Path:   "keys/log",
+					Method: api.GET,
+				},
+			},
+			{
+				Name:        "getKeyLogInclusionProof", // unauthenticated
+				Description: "Returns a proof that an entry is part of the key log.",
+				Form:        &forms.GetKeyLogInclusionProofForm,
+				Handler:     appointments.getKeyLogInclusionProof,
+				ReturnType: &api.ReturnType{
+					Validators: forms.GetKeyLogInclusionProofRVV,
+				},
+				REST: &api.REST{
+					Path:   "keys/log/inclusion",
+					Method: api.GET,
+				},
+			},
+			{
+				Name:        "getKeyLogConsistencyProof", // unauthenticated
+				Description: "Returns a proof that an earlier version of the key log is a prefix of a later one.",
+				Form:        &forms.GetKeyLogConsistencyProofForm,
+				Handler:     appointments.getKeyLogConsistencyProof,
+				ReturnType: &api.ReturnType{
+					Validators: forms.GetKeyLogConsistencyProofRVV,
+				},
+				REST: &api.REST{
+					Path:   "keys/log/consistency",
+					Method: api.GET,
+				},
+			},
 			{
 				Name:        "getAppointmentsByZipCode", // unauthenticated
 				Description: "Returns available appointments for a given zip code area.",
@@ -124,6 +182,32 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 					Method: api.POST,
 				},
 			},
+			{
+				Name:        "getTokenChallenge", // unauthenticated
+				Description: "Returns a proof-of-work challenge that needs to be solved to get a token (if enabled).",
+				Form:        &forms.GetTokenChallengeForm,
+				Handler:     appointments.getTokenChallenge,
+				ReturnType: &api.ReturnType{
+					Validators: forms.GetTokenChallengeRVV,
+				},
+				REST: &api.REST{
+					Path:   "token/challenge",
+					Method: api.GET,
+				},
+			},
+			{
+				Name:        "getBlindToken", // unauthenticated
+				Description: "Signs a blinded token that allows users to book appointments without the server being able to link the booking to the token request.",
+				Form:        &forms.GetBlindTokenForm,
+				Handler:     appointments.getBlindToken,
+				ReturnType: &api.ReturnType{
+					Validators: forms.GetBlindTokenRVV,
+				},
+				REST: &api.REST{
+					Path:   "token/blind",
+					Method: api.POST,
+				},
+			},
 			{
 				Name:        "addMediatorPublicKeys", // authenticted (root)
 				Description: "Adds the public key data and associated information of a mediator to the system.",
@@ -137,6 +221,71 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 					Method: api.POST,
 				},
 			},
+			{
+				Name:        "revokeMediatorKey", // authenticated (root)
+				Description: "Revokes a mediator key.",
+				Form:        &forms.RevokeMediatorKeyForm,
+				Handler:     appointments.revokeMediatorKey,
+				ReturnType: &api.ReturnType{
+					Validators: forms.IsAcknowledgeRVV,
+				},
+				REST: &api.REST{
+					Path:   "mediators/revoke",
+					Method: api.POST,
+				},
+			},
+			{
+				Name:        "revokeTokens", // authenticated (root)
+				Description: "Revokes user tokens, which cannot be used for bookings anymore.",
+				Form:        &forms.RevokeTokensForm,
+				Handler:     appointments.revokeTokens,
+				ReturnType: &api.ReturnType{
+					Validators: forms.IsAcknowledgeRVV,
+				},
+				REST: &api.REST{
+					Path:   "tokens/revoke",
+					Method: api.POST,
+				},
+			},
+			{
+				Name:        "issueInvitation", // authenticated (root or mediator)
+				Description: "Issues a provider code that is bound to the key or metadata of a specific provider.",
+				Form:        &forms.IssueInvitationForm,
+				Handler:     appointments.issueInvitation,
+				ReturnType: &api.ReturnType{
+					Validators: forms.IsAcknowledgeRVV,
+				},
+				REST: &api.REST{
+					Path:   "invitations",
+					Method: api.POST,
+				},
+			},
+			{
+				Name:        "revokeCodeBatch", // authenticated (root)
+				Description: "Revokes a batch of signup codes, which cannot be used anymore.",
+				Form:        &forms.RevokeCodeBatchForm,
+				Handler:     appointments.revokeCodeBatch,
+				ReturnType: &api.ReturnType{
+					Validators: forms.IsAcknowledgeRVV,
+				},
+				REST: &api.REST{
+					Path:   "codes/batches/revoke",
+					Method: api.POST,
+				},
+			},
+			{
+				Name:        "getCodeBatches", // authenticated (root)
+				Description: "Returns the batches of signup codes together with the number of redeemed codes.",
+				Form:        &forms.GetCodeBatchesForm,
+				Handler:     appointments.getCodeBatches,
+				ReturnType: &api.ReturnType{
+					Validators: forms.GetCodeBatchesRVV,
+				},
+				REST: &api.REST{
+					Path:   "codes/batches",
+					Method: api.POST,
+				},
+			},
 			{
 				Name:        "addCodes", // authenticated (root)
 				Description: "Adds signup codes to the system.",
@@ -176,6 +325,19 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 					Method: api.DELETE,
 				},
 			},
+			{
+				Name:        "getAuditLog", // authenticated (root)
+				Description: "Returns entries of the audit log of privileged actions.",
+				Form:        &forms.GetAuditLogForm,
+				Handler:     appointments.getAuditLog,
+				ReturnType: &api.ReturnType{
+					Validators: forms.GetAuditLogRVV,
+				},
+				REST: &api.REST{
+					Path:   "audit",
+					Method: api.POST,
+				},
+			},
 			{
 				Name:        "confirmProvider", // authenticated (mediator)
 				Description: "Confirms a provider by adding its public key data and associated information to the system.",
@@ -195,13 +357,91 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 				Form:        &forms.GetPendingProviderDataForm,
 				Handler:     appointments.getPendingProviderData,
 				ReturnType: &api.ReturnType{
-					Validators: forms.GetProviderDataRVV,
+					Validators: forms.GetPendingProviderDataRVV,
 				},
 				REST: &api.REST{
 					Path:   "providers/pending",
 					Method: api.POST,
 				},
 			},
+			{
+				Name:        "rejectProvider", // authenticated (mediator)
+				Description: "Rejects the data of a provider that has not been verified yet.",
+				Form:        &forms.RejectProviderForm,
+				Handler:     appointments.rejectProvider,
+				ReturnType: &api.ReturnType{
+					Validators: forms.IsAcknowledgeRVV,
+				},
+				REST: &api.REST{
+					Path:   "providers/reject",
+					Method: api.POST,
+				},
+			},
+			{
+				Name:        "rejectProviderDataUpdate", // authenticated (mediator)
+				Description: "Rejects a pending update of the data of a verified provider.",
+				Form:        &forms.RejectProviderDataUpdateForm,
+				Handler:     appointments.rejectProviderDataUpdate,
+				ReturnType: &api.ReturnType{
+					Validators: forms.IsAcknowledgeRVV,
+				},
+				REST: &api.REST{
+					Path:   "providers/pending/reject",
+					Method: api.POST,
+				},
+			},
+			{
+				Name:        "getProviderDataVersions", // authenticated (mediator)
+				Description: "Returns all verified versions of the data of a provider and all rejected updates.",
+				Form:        &forms.GetProviderDataVersionsForm,
+				Handler:     appointments.getProviderDataVersions,
+				ReturnType: &api.ReturnType{
+					Validators: forms.GetProviderDataVersionsRVV,
+				},
+				REST: &api.REST{
+					Path:   "providers/data/versions",
+					Method: api.POST,
+				},
+			},
+			{
+				Name:        "claimProviderData", // authenticated (mediator)
+				Description: "Claims pending provider data for verification by the mediator.",
+				Form:        &forms.ClaimProviderDataForm,
+				Handler:     appointments.claimProviderData,
+				ReturnType: &api.ReturnType{
+					Validators: forms.ClaimProviderDataRVV,
+				},
+				REST: &api.REST{
+					Path:   "providers/pending/claim",
+					Method: api.POST,
+				},
+			},
+			{
+				Name:        "releaseProviderData", // authenticated (mediator)
+				Description: "Releases a claim on pending provider data.",
+				Form:        &forms.ReleaseProviderDataForm,
+				Handler:     appointments.releaseProviderData,
+				ReturnType: &api.ReturnType{
+					Validators: forms.IsAcknowledgeRVV,
+				},
+				REST: &api.REST{
+					Path:   "providers/pending/release",
+					Method: api.POST,
+				},
+			},
+			{
+				Name:        "getPendingProviderApprovals", // authenticated (mediator)
+				Description: "Returns a list of provider keys waiting for approval by further mediators.",
+				Form:        &forms.GetPendingProviderApprovalsForm,
+				Handler:     appointments.getPendingProviderApprovals,
+				ReturnType: &api.ReturnType{
+					Validators: forms.GetPendingProviderApprovalsRVV,
+				},
+				REST: &api.REST{
+					Path:   "providers/approvals",
+					Method: api.POST,
+				},
+			},
 			{
 				Name:        "getVerifiedProviderData", // authenticated (mediator)
 				Description: "Returns a list of confirmed provider data.",
@@ -215,6 +455,84 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 					Method: api.POST,
 				},
 			},
+			{
+				Name:        "getProviderKeys", // authenticated (mediator)
+				Description: "Returns the provider keys confirmed by the given mediator key or its predecessor.",
+				Form:        &forms.GetProviderKeysForm,
+				Handler:     appointments.getProviderKeys,
+				ReturnType: &api.ReturnType{
+					Validators: forms.GetProviderKeysRVV,
+				},
+				REST: &api.REST{
+					Path:   "providers/keys",
+					Method: api.POST,
+				},
+			},
+			{
+				Name:        "rotateMediatorKey", // authenticated (mediator)
+				Description: "Re-signs the provider keys confirmed by the predecessor of the given mediator key.",
+				Form:        &forms.RotateMediatorKeyForm,
+				Handler:     appointments.rotateMediatorKey,
+				ReturnType: &api.ReturnType{
+					Validators: forms.IsAcknowledgeRVV,
+				},
+				REST: &api.REST{
+					Path:   "mediators/rotate",
+					Method: api.POST,
+				},
+			},
+			{
+				Name:        "replaceProviderKey", // authenticated (mediator)
+				Description: "Replaces the key of a provider with a new key signed by the mediator, keeping the provider ID.",
+				Form:        &forms.ReplaceProviderKeyForm,
+				Handler:     appointments.replaceProviderKey,
+				ReturnType: &api.ReturnType{
+					Validators: forms.IsAcknowledgeRVV,
+				},
+				REST: &api.REST{
+					Path:   "providers/replace",
+					Method: api.POST,
+				},
+			},
+			{
+				Name:        "suspendProvider", // authenticated (mediator)
+				Description: "Suspends a provider, hiding it and its appointments from users.",
+				Form:        &forms.SuspendProviderForm,
+				Handler:     appointments.suspendProvider,
+				ReturnType: &api.ReturnType{
+					Validators: forms.IsAcknowledgeRVV,
+				},
+				REST: &api.REST{
+					Path:   "providers/suspend",
+					Method: api.POST,
+				},
+			},
+			{
+				Name:        "reactivateProvider", // authenticated (mediator)
+				Description: "Reactivates a suspended provider.",
+				Form:        &forms.ReactivateProviderForm,
+				Handler:     appointments.reactivateProvider,
+				ReturnType: &api.ReturnType{
+					Validators: forms.IsAcknowledgeRVV,
+				},
+				REST: &api.REST{
+					Path:   "providers/reactivate",
+					Method: api.POST,
+				},
+			},
+			{
+				Name:        "revokeProvider", // authenticated (mediator)
+				Description: "Permanently revokes a provider, removing its key and deleting all of its appointments.",
+				Form:        &forms.RevokeProviderForm,
+				Handler:     appointments.revokeProvider,
+				ReturnType: &api.ReturnType{
+					Validators: forms.IsAcknowledgeRVV,
+				},
+				REST: &api.REST{
+					Path:   "providers/revoke",
+					Method: api.POST,
+				},
+			},
 			{
 				Name:        "getProviderAppointments", // authenticated (provider)
 				Description: "Returns a list of appointments for the given provider.",
@@ -228,6 +546,19 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 					Method: api.POST,
 				},
 			},
+			{
+				Name:        "getProviderAppointmentsCalendar", // authenticated (provider)
+				Description: "Returns the appointments of the given provider as an iCalendar (RFC 5545) file.",
+				Form:        &forms.GetProviderAppointmentsForm,
+				Handler:     appointments.getProviderAppointmentsCalendar,
+				ReturnType: &api.ReturnType{
+					Validators: forms.GetProviderAppointmentsCalendarRVV,
+				},
+				REST: &api.REST{
+					Path:   "appointments/ics",
+					Method: api.POST,
+				},
+			},
 			{
 				Name:        "publishAppointments", // authenticated (provider)
 				Description: "Publishes new or modified appointments to the system.",
@@ -241,6 +572,123 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 					Method: api.POST,
 				},
 			},
+			{
+				Name:        "deleteAppointments", // authenticated (provider)
+				Description: "Deletes appointments by ID or by date range and re-enables the tokens of associated bookings.",
+				Form:        &forms.DeleteAppointmentsForm,
+				Handler:     appointments.deleteAppointments,
+				ReturnType: &api.ReturnType{
+					Validators: forms.IsAcknowledgeRVV,
+				},
+				REST: &api.REST{
+					Path:   "appointments/delete",
+					Method: api.POST,
+				},
+			},
+			{
+				Name:        "getDeletedAppointments", // authenticated (provider)
+				Description: "Returns a list of tombstones for appointments that have been deleted.",
+				Form:        &forms.GetDeletedAppointmentsForm,
+				Handler:     appointments.getDeletedAppointments,
+				ReturnType: &api.ReturnType{
+					Validators: forms.GetDeletedAppointmentsRVV,
+				},
+				REST: &api.REST{
+					Path:   "appointments/deleted",
+					Method: api.POST,
+				},
+			},
+			{
+				Name:        "syncProviderAppointments", // authenticated (provider)
+				Description: "Returns all changes to the appointments of the given provider since a given sequence number.",
+				Form:        &forms.SyncProviderAppointmentsForm,
+				Handler:     appointments.syncProviderAppointments,
+				ReturnType: &api.ReturnType{
+					Validators: forms.SyncProviderAppointmentsRVV,
+				},
+				REST: &api.REST{
+					Path:   "appointments/sync",
+					Method: api.POST,
+				},
+			},
+			{
+				Name:        "getProviderStats", // authenticated (provider)
+				Description: "Returns utilization statistics of the given provider.",
+				Form:        &forms.GetProviderStatsForm,
+				Handler:     appointments.getProviderStats,
+				ReturnType: &api.ReturnType{
+					Validators: forms.GetStatsRVV,
+				},
+				REST: &api.REST{
+					Path:   "providers/stats",
+					Method: api.POST,
+				},
+			},
+			{
+				Name:        "markNoShow", // authenticated (provider)
+				Description: "Marks a booked slot as not attended.",
+				Form:        &forms.MarkNoShowForm,
+				Handler:     appointments.markNoShow,
+				ReturnType: &api.ReturnType{
+					Validators: forms.IsAcknowledgeRVV,
+				},
+				REST: &api.REST{
+					Path:   "appointments/noShow",
+					Method: api.POST,
+				},
+			},
+			{
+				Name:        "rotateProviderKey", // authenticated (provider)
+				Description: "Replaces the key of the provider with a new key signed by the current one, keeping the provider ID.",
+				Form:        &forms.RotateProviderKeyForm,
+				Handler:     appointments.rotateProviderKey,
+				ReturnType: &api.ReturnType{
+					Validators: forms.IsAcknowledgeRVV,
+				},
+				REST: &api.REST{
+					Path:   "providers/rotate",
+					Method: api.POST,
+				},
+			},
+			{
+				Name:        "addProviderDelegation", // authenticated (provider)
+				Description: "Adds a delegation certificate that allows another key to act on behalf of the provider.",
+				Form:        &forms.AddProviderDelegationForm,
+				Handler:     appointments.addProviderDelegation,
+				ReturnType: &api.ReturnType{
+					Validators: forms.IsAcknowledgeRVV,
+				},
+				REST: &api.REST{
+					Path:   "providers/delegations",
+					Method: api.POST,
+				},
+			},
+			{
+				Name:        "getProviderDelegations", // authenticated (provider)
+				Description: "Returns all delegation certificates of the provider.",
+				Form:        &forms.GetProviderDelegationsForm,
+				Handler:     appointments.getProviderDelegations,
+				ReturnType: &api.ReturnType{
+					Validators: forms.GetProviderDelegationsRVV,
+				},
+				REST: &api.REST{
+					Path:   "providers/delegations/list",
+					Method: api.POST,
+				},
+			},
+			{
+				Name:        "revokeProviderDelegation", // authenticated (provider)
+				Description: "Revokes a delegation certificate of the provider.",
+				Form:        &forms.RevokeProviderDelegationForm,
+				Handler:     appointments.revokeProviderDelegation,
+				ReturnType: &api.ReturnType{
+					Validators: forms.IsAcknowledgeRVV,
+				},
+				REST: &api.REST{
+					Path:   "providers/delegations/revoke",
+					Method: api.POST,
+				},
+			},
 			{
 				Name:        "storeProviderData", // authenticated (provider)
 				Description: "Stores provider data for verification.",
@@ -298,6 +746,18 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 
 	var err error
 
+	// blind signatures need the private key (see crypto.Key.BlindSign)
+	if blindTokenKey := settings.Appointments.Key("blind-token"); blindTokenKey != nil && blindTokenKey.Signer != nil {
+		return nil, crypto.ErrBlindSigner
+	}
+
+	// we refuse to start if challenges are enabled without a proper secret
+	if len(settings.Appointments.Secret) > 0 || settings.Appointments.TokenChallengeEnabled {
+		if appointments.tokenChallengeKey, err = deriveTokenChallengeKey(settings.Appointments.Secret); err != nil {
+			return nil, err
+		}
+	}
+
 	if appointments.Server, err = MakeServer("appointments", settings.Appointments.HTTP, settings.Appointments.JSONRPC, settings.Appointments.REST, api); err != nil {
 		return nil, err
 	}
@@ -305,6 +765,15 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 	return appointments, nil
 }
 
+// logs the system keys before starting the server, so that clients can check
+// the keys we return against the key log (they only change with the settings)
+func (c *Appointments) Start() error {
+	if err := c.logSystemKeys(); err != nil {
+		return err
+	}
+	return c.Server.Start()
+}
+
 // Method Handlers
 
 func (c *Appointments) Key(key string) *crypto.Key {
@@ -315,22 +784,58 @@ func (c *Appointments) getKeysData() (*services.Keys, error) {
 
 	providerDataKey := c.settings.Key("provider")
 
-	return &services.Keys{
+	keys := &services.Keys{
 		ProviderData: providerDataKey.PublicKey,
 		RootKey:      c.settings.Key("root").PublicKey,
 		TokenKey:     c.settings.Key("token").PublicKey,
-	}, nil
+	}
+
+	if blindTokenKey := c.settings.Key("blind-token"); blindTokenKey != nil {
+		keys.BlindTokenKey = blindTokenKey.PublicKey
+	}
+
+	if logKey := c.settings.Key("log"); logKey != nil {
+		keys.LogKey = logKey.PublicKey
+	}
+
+	return keys, nil
 
 }
 
 func (c *Appointments) getActorKeys() (*services.KeyLists, error) {
 
-	mediatorKeys, err := c.backend.Keys("mediators").GetAll()
+	allMediatorKeys, err := c.backend.Keys("mediators").GetAll()
+
+	if err != nil {
+		return nil, err
+	}
+
+	revocations, err := c.backend.MediatorKeyRevocations().GetAll()
 
 	if err != nil {
 		return nil, err
 	}
 
+	now := time.Now()
+	mediatorKeys := make([]*services.ActorKey, 0, len(allMediatorKeys))
+
+	// we only return mediator keys that are valid and have not been revoked
+	for _, mediatorKey := range allMediatorKeys {
+
+		if _, ok := revocations[string(mediatorKey.ID)]; ok {
+			continue
+		}
+
+		if mkd, err := mediatorKey.MediatorKeyData(); err != nil {
+			services.Log.Error(err)
+			continue
+		} else if !mkd.IsValidAt(now) {
+			continue
+		}
+
+		mediatorKeys = append(mediatorKeys, mediatorKey)
+	}
+
 	providerKeys, err := c.backend.Keys("providers").GetAll()
 
 	if err != nil {
@@ -345,8 +850,65 @@ func (c *Appointments) getActorKeys() (*services.KeyLists, error) {
 
 // authentication helpers
 
+// returns the token data presented by the user as well as the token that is
+// used to prevent double spending. Users need to present exactly one token.
+func userToken(signedTokenData *services.SignedTokenData, blindToken *services.BlindToken) (interface{}, []byte) {
+	switch {
+	case signedTokenData != nil && blindToken != nil:
+		return nil, nil
+	case signedTokenData != nil:
+		return signedTokenData, signedTokenData.Data.Token
+	case blindToken != nil:
+		return blindToken, blindToken.Data.Serial
+	}
+	return nil, nil
+}
+
 func (c *Appointments) isUser(context services.Context, params *services.SignedParams) services.Response {
 
+	var publicKey, token []byte
+
+	switch tokenData := params.ExtraData.(type) {
+	case *services.SignedTokenData:
+		if resp := c.isValidSignedToken(context, tokenData); resp != nil {
+			return resp
+		}
+		publicKey, token = tokenData.Data.PublicKey, tokenData.Data.Token
+	case *services.BlindToken:
+		if resp := c.isValidBlindToken(context, tokenData); resp != nil {
+			return resp
+		}
+		publicKey, token = tokenData.Data.PublicKey, tokenData.Data.Serial
+	default:
+		return context.Error(400, "exactly one token required", nil)
+	}
+
+	// then we ensure the public key matches the key from the token data
+	if !bytes.Equal(publicKey, params.PublicKey) {
+		return context.Error(400, "invalid key", nil)
+	}
+
+	// then we verify the data was signed with the same key
+	if ok, err := crypto.VerifyWithBytes([]byte(params.JSON), params.Signature, params.PublicKey); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else if !ok {
+		return context.Error(400, "invalid signature", nil)
+	}
+
+	if revoked, err := c.backend.RevokedTokens().Has(token); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else if revoked {
+		return context.Error(403, "token revoked", nil)
+	}
+
+	return c.replays.check(context, []byte(params.JSON), params.PublicKey, params.Timestamp)
+
+}
+
+func (c *Appointments) isValidSignedToken(context services.Context, signedTokenData *services.SignedTokenData) services.Response {
+
 	tokenKey := c.settings.Key("token")
 
 	if tokenKey == nil {
@@ -354,14 +916,12 @@ func (c *Appointments) isUser(context services.Context, params *services.SignedP
 		return context.InternalError()
 	}
 
-	signedTokenData := params.ExtraData.(*services.SignedTokenData)
-
 	signedData := &crypto.SignedStringData{
 		Data:      signedTokenData.JSON,
 		Signature: signedTokenData.Signature,
 	}
 
-	// first we verify the signed token against the token key
+	// we verify the signed token against the token key
 	if ok, err := tokenKey.VerifyString(signedData); err != nil {
 		services.Log.Error(err)
 		return context.InternalError()
@@ -369,29 +929,37 @@ func (c *Appointments) isUser(context services.Context, params *services.SignedP
 		return context.Error(400, "invalid token", nil)
 	}
 
-	// then we ensure the public key matches the key from the signed token data
-	if !bytes.Equal(signedTokenData.Data.PublicKey, params.PublicKey) {
-		return context.Error(400, "invalid key", nil)
+	if expiresAt := signedTokenData.Data.ExpiresAt; expiresAt != nil && time.Now().After(*expiresAt) {
+		return context.Error(410, "token expired", nil)
 	}
 
-	// then we verify the data was signed with the same key
-	if ok, err := crypto.VerifyWithBytes([]byte(params.JSON), params.Signature, params.PublicKey); err != nil {
+	return nil
+}
+
+// Blind tokens carry no server-generated data, so they cannot expire on their
+// own. To invalidate all outstanding blind tokens the blind token key needs to
+// be rotated.
+func (c *Appointments) isValidBlindToken(context services.Context, blindToken *services.BlindToken) services.Response {
+
+	blindTokenKey := c.settings.Key("blind-token")
+
+	if blindTokenKey == nil {
+		return context.Error(400, "blind tokens not supported", nil)
+	}
+
+	// we verify the unblinded signature against the blind token key
+	if ok, err := blindTokenKey.VerifyBlind([]byte(blindToken.JSON), blindToken.Signature); err != nil {
 		services.Log.Error(err)
 		return context.InternalError()
 	} else if !ok {
-		return context.Error(400, "invalid signature", nil)
-	}
-
-	if expired(params.Timestamp) {
-		return context.Error(410, "signature expired", nil)
+		return context.Error(400, "invalid token", nil)
 	}
 
 	return nil
-
 }
 
 func (c *Appointments) isRoot(context services.Context, params *services.SignedParams) services.Response {
-	return isRoot(context, []byte(params.JSON), params.Signature, params.Timestamp, c.settings.Keys)
+	return isRoot(context, []byte(params.JSON), params.Signature, params.Timestamp, c.settings.Keys, c.replays)
 }
 
 func (c *Appointments) isMediator(context services.Context, params *services.SignedParams) (services.Response, *services.ActorKey) {
@@ -405,8 +973,8 @@ func (c *Appointments) isMediator(context services.Context, params *services.Sig
 
 	if resp, key := c.isValidActorSignature(context, []byte(params.JSON), params.Signature, params.PublicKey, keys.Mediators); resp != nil {
 		return resp, nil
-	} else if expired(params.Timestamp) {
-		return context.Error(410, "signature expired", nil), nil
+	} else if resp := c.replays.check(context, []byte(params.JSON), params.PublicKey, params.Timestamp); resp != nil {
+		return resp, nil
 	} else {
 		return nil, key
 	}
@@ -423,13 +991,102 @@ func (c *Appointments) isProvider(context services.Context, params *services.Sig
 
 	if resp, key := c.isValidActorSignature(context, []byte(params.JSON), params.Signature, params.PublicKey, keys.Providers); resp != nil {
 		return resp, nil
-	} else if expired(params.Timestamp) {
-		return context.Error(410, "signature expired", nil), nil
+	} else if resp := c.replays.check(context, []byte(params.JSON), params.PublicKey, params.Timestamp); resp != nil {
+		return resp, nil
 	} else {
 		return nil, key
 	}
 }
 
+// accepts signatures by the provider as well as by delegated keys with the
+// given scope. The key of the provider is returned in both cases, so delegates
+// act with the identity of the provider.
+func (c *Appointments) isProviderOrDelegate(context services.Context, params *services.SignedParams, scope string) (services.Response, *services.ActorKey) {
+
+	keys, err := c.getActorKeys()
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError(), nil
+	}
+
+	if providerKey, err := findActorKey(keys.Providers, params.PublicKey); err != nil {
+		services.Log.Error(err)
+		return context.InternalError(), nil
+	} else if providerKey == nil {
+		return c.isDelegate(context, params, scope, keys.Providers)
+	}
+
+	if resp, key := c.isValidActorSignature(context, []byte(params.JSON), params.Signature, params.PublicKey, keys.Providers); resp != nil {
+		return resp, nil
+	} else if resp := c.replays.check(context, []byte(params.JSON), params.PublicKey, params.Timestamp); resp != nil {
+		return resp, nil
+	} else {
+		return nil, key
+	}
+}
+
+func (c *Appointments) isDelegate(context services.Context, params *services.SignedParams, scope string, providerKeys []*services.ActorKey) (services.Response, *services.ActorKey) {
+
+	notAuthorized := context.Error(403, "not authorized", nil)
+
+	// delegations are stored under the hash of the delegated signing key
+	id := crypto.Hash(params.PublicKey)
+
+	providerID, err := c.backend.DelegateProviders().Get(id)
+
+	if err == databases.NotFound {
+		return notAuthorized, nil
+	} else if err != nil {
+		services.Log.Error(err)
+		return context.InternalError(), nil
+	}
+
+	delegation, err := c.backend.Delegations(providerID).Get(id)
+
+	if err == databases.NotFound {
+		return notAuthorized, nil
+	} else if err != nil {
+		services.Log.Error(err)
+		return context.InternalError(), nil
+	}
+
+	if !delegation.Data.HasScope(scope) || time.Now().After(delegation.Data.ValidUntil) {
+		return notAuthorized, nil
+	}
+
+	providerKey, err := findActorKey(providerKeys, providerID)
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError(), nil
+	} else if providerKey == nil {
+		// the provider has been revoked
+		return notAuthorized, nil
+	}
+
+	// the delegation must have been signed by the current provider key
+	if pkd, err := providerKey.KeyData(); err != nil {
+		services.Log.Error(err)
+		return context.InternalError(), nil
+	} else if !bytes.Equal(delegation.PublicKey, pkd.Signing) {
+		return notAuthorized, nil
+	}
+
+	if ok, err := crypto.VerifyWithBytes([]byte(params.JSON), params.Signature, params.PublicKey); err != nil {
+		services.Log.Error(err)
+		return context.InternalError(), nil
+	} else if !ok {
+		return context.Error(401, "invalid signature", nil), nil
+	}
+
+	if resp := c.replays.check(context, []byte(params.JSON), params.PublicKey, params.Timestamp); resp != nil {
+		return resp, nil
+	}
+
+	return nil, providerKey
+}
+
 func (c *Appointments) isValidActorSignature(context services.Context, data, signature, publicKey []byte, keyList []*services.ActorKey) (services.Response, *services.ActorKey) {
 
 	actorKey, err := findActorKey(keyList, publicKey)
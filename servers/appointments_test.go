@@ -20,11 +20,13 @@ package servers_test
 
 import (
 	"github.com/kiebitz-oss/services"
+	"github.com/kiebitz-oss/services/crypto"
 	"github.com/kiebitz-oss/services/definitions"
 	"github.com/kiebitz-oss/services/helpers"
 	at "github.com/kiebitz-oss/services/testing"
 	af "github.com/kiebitz-oss/services/testing/fixtures"
 	"testing"
+	"time"
 )
 
 func TestAppointmentsApi(t *testing.T) {
@@ -66,3 +68,65 @@ func TestAppointmentsApi(t *testing.T) {
 	}
 
 }
+
+func TestReplayedRequests(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+
+		// we create a mediator
+		at.FC{af.Mediator{}, "mediator"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+	mediator := fixtures["mediator"].(*crypto.Actor)
+
+	params := &services.GetPendingProviderApprovalsParams{
+		Timestamp: time.Now(),
+	}
+
+	if resp, err := client.Appointments.GetPendingProviderApprovals(params, mediator); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	// the same signed request is only accepted once
+	if resp, err := client.Appointments.GetPendingProviderApprovals(params, mediator); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 409 {
+		t.Fatalf("expected a 409 status code, got %d instead", resp.StatusCode)
+	}
+
+	params.Timestamp = time.Now().Add(-time.Hour)
+
+	if resp, err := client.Appointments.GetPendingProviderApprovals(params, mediator); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 410 {
+		t.Fatalf("expected a 410 status code, got %d instead", resp.StatusCode)
+	}
+
+	params.Timestamp = time.Now().Add(time.Hour)
+
+	if resp, err := client.Appointments.GetPendingProviderApprovals(params, mediator); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 400 {
+		t.Fatalf("expected a 400 status code, got %d instead", resp.StatusCode)
+	}
+
+}
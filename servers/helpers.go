@@ -23,6 +23,7 @@ import (
 	"encoding/base64"
 	"github.com/kiebitz-oss/services"
 	"github.com/kiebitz-oss/services/crypto"
+	"github.com/kiebitz-oss/services/databases"
 	"time"
 )
 
@@ -57,7 +58,94 @@ func findActorKey(keys []*services.ActorKey, publicKeyOrID []byte) (*services.Ac
 	return nil, nil
 }
 
-func isRoot(context services.Context, data, signature []byte, timestamp time.Time, keys []*crypto.Key) services.Response {
+// returns the stable ID of the provider with the given signing key. This is
+// the hash of the original signing key of the provider, which remains the same
+// when the provider rotates its key. For providers that have not been
+// confirmed yet the ID is the hash of the given key.
+func (c *Appointments) providerID(signingKey []byte) ([]byte, error) {
+
+	providerKeys, err := c.backend.Keys("providers").GetAll()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if providerKey, err := findActorKey(providerKeys, signingKey); err != nil {
+		return nil, err
+	} else if providerKey != nil {
+		return providerKey.ID, nil
+	}
+
+	return crypto.Hash(signingKey), nil
+}
+
+// returns the key chain for the given provider key, or nil if the mediator
+// key that signed it is not valid anymore
+func makeKeyChain(keys *services.KeyLists, providerKey *services.ActorKey) (*services.KeyChain, error) {
+
+	// after a key rotation the provider key is signed by its predecessor, only
+	// the original key has been signed by a mediator
+	originKey := providerKey.Origin()
+
+	mediatorKey, err := findActorKey(keys.Mediators, originKey.PublicKey)
+
+	if err != nil || mediatorKey == nil {
+		return nil, err
+	}
+
+	keyChain := &services.KeyChain{
+		Provider: providerKey,
+		Mediator: mediatorKey,
+	}
+
+	// we add the keys of all mediators that approved the provider
+	for _, approval := range originKey.Approvals {
+		if approvalKey, err := findActorKey(keys.Mediators, approval.PublicKey); err != nil {
+			return nil, err
+		} else if approvalKey != nil {
+			keyChain.Mediators = append(keyChain.Mediators, approvalKey)
+		}
+	}
+
+	return keyChain, nil
+}
+
+// adds the delegations of all delegate keys that signed some of the given
+// appointments to the key chain, so that users can verify these appointments
+// (delegate key -> provider key -> mediator key -> root key)
+func (c *Appointments) addDelegations(keyChain *services.KeyChain, providerID []byte, appointments []*services.SignedAppointment) error {
+
+	providerKeyData, err := keyChain.Provider.KeyData()
+
+	if err != nil {
+		return err
+	}
+
+	delegations := c.backend.Delegations(providerID)
+	added := map[string]bool{}
+
+	for _, appointment := range appointments {
+
+		if bytes.Equal(appointment.PublicKey, providerKeyData.Signing) || added[string(appointment.PublicKey)] {
+			continue
+		}
+
+		added[string(appointment.PublicKey)] = true
+
+		if delegation, err := delegations.Get(crypto.Hash(appointment.PublicKey)); err == databases.NotFound {
+			// e.g. appointments signed with a previous provider key
+			continue
+		} else if err != nil {
+			return err
+		} else {
+			keyChain.Delegations = append(keyChain.Delegations, delegation)
+		}
+	}
+
+	return nil
+}
+
+func isRoot(context services.Context, data, signature []byte, timestamp time.Time, keys []*crypto.Key, replays *replayGuard) services.Response {
 	rootKey := services.Key(keys, "root")
 	if rootKey == nil {
 		services.Log.Error("root key missing")
@@ -72,12 +160,56 @@ func isRoot(context services.Context, data, signature []byte, timestamp time.Tim
 		services.Log.Error(err)
 		return context.InternalError()
 	}
-	if expired(timestamp) {
-		return context.Error(410, "signature expired", nil)
+	return replays.check(context, data, rootKey.PublicKey, timestamp)
+}
+
+// Signed requests are only accepted within a validity window after their
+// timestamp (plus some tolerance for clock skew between client and server),
+// and only once. Each accepted request is recorded until it expires.
+type replayGuard struct {
+	db       services.Database
+	validity time.Duration
+	skew     time.Duration
+}
+
+func makeReplayGuard(db services.Database, validitySeconds, skewSeconds int64) *replayGuard {
+	if validitySeconds <= 0 {
+		validitySeconds = 60
+	}
+	return &replayGuard{
+		db:       db,
+		validity: time.Duration(validitySeconds) * time.Second,
+		skew:     time.Duration(skewSeconds) * time.Second,
 	}
-	return nil
 }
 
-func expired(timestamp time.Time) bool {
-	return time.Now().Add(-time.Minute).After(timestamp)
+func (r *replayGuard) check(context services.Context, data, publicKey []byte, timestamp time.Time) services.Response {
+
+	now := time.Now()
+
+	if timestamp.After(now.Add(r.skew)) {
+		return context.Error(400, "signature timestamp lies in the future", nil)
+	}
+
+	expiresAt := timestamp.Add(r.validity + r.skew)
+
+	if now.After(expiresAt) {
+		return context.Error(410, "signature expired", nil)
+	}
+
+	// ECDSA signatures are malleable, so we identify requests by the signed
+	// data and the key instead of by the signature
+	id := crypto.Hash(append(append([]byte{}, publicKey...), data...))
+	seen := r.db.Value("signatures", id)
+
+	// we record the request and its expiry in a single step, so a failure
+	// can't leave a record behind that never expires
+	if ok, err := seen.SetIfNotExists([]byte("1"), expiresAt.Sub(now)+time.Second); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else if !ok {
+		return context.Error(409, "signature already used", nil)
+	}
+
+	return nil
 }
@@ -28,6 +28,7 @@ type Storage struct {
 	*Server
 	settings *services.StorageSettings
 	db       services.Database
+	replays  *replayGuard
 	test     bool
 }
 
@@ -36,6 +37,7 @@ func MakeStorage(settings *services.Settings) (*Storage, error) {
 	storage := &Storage{
 		db:       settings.DatabaseObj,
 		settings: settings.Storage,
+		replays:  makeReplayGuard(settings.DatabaseObj, settings.Storage.SignatureValiditySeconds, settings.Storage.ClockSkewSeconds),
 		test:     settings.Test,
 	}
 
@@ -90,5 +92,5 @@ func MakeStorage(settings *services.Settings) (*Storage, error) {
 }
 
 func (c *Storage) isRoot(context services.Context, params *services.SignedParams) services.Response {
-	return isRoot(context, []byte(params.JSON), params.Signature, params.Timestamp, c.settings.Keys)
+	return isRoot(context, []byte(params.JSON), params.Signature, params.Timestamp, c.settings.Keys, c.replays)
 }
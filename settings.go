@@ -32,21 +32,39 @@ type StorageSettings struct {
 	HTTP            *HTTPServerSettings    `json:"http,omitempty"`
 	JSONRPC         *JSONRPCServerSettings `json:"jsonrpc,omitempty"`
 	REST            *RESTServerSettings    `json:"rest,omitempty"`
+	// signed requests are accepted during the validity window and only once
+	SignatureValiditySeconds int64 `json:"signature_validity_seconds"`
+	ClockSkewSeconds         int64 `json:"clock_skew_seconds"`
 }
 
 type AppointmentsSettings struct {
-	DataTTLDays             int64                  `json:"data_ttl_days,omitempty"`
-	HTTP                    *HTTPServerSettings    `json:"http,omitempty"`
-	REST                    *RESTServerSettings    `json:"rest,omitempty"`
-	JSONRPC                 *JSONRPCServerSettings `json:"jsonrpc,omitempty"`
-	Keys                    []*crypto.Key          `json:"keys,omitempty"`
-	Secret                  []byte                 `json:"secret,omitempty"`
-	ProviderCodesEnabled    bool                   `json:"provider_codes_enabled,omitempty"`
-	UserCodesEnabled        bool                   `json:"user_codes_enabled,omitempty"`
-	UserCodesReuseLimit     int64                  `json:"user_codes_reuse_limit"`
-	ProviderCodesReuseLimit int64                  `json:"provider_codes_reuse_limit"`
-	ResponseMaxProvider     int64                  `json:"response_max_provider"`
-	ResponseMaxAppointment  int64                  `json:"response_max_appointment"`
+	DataTTLDays               int64                  `json:"data_ttl_days,omitempty"`
+	HTTP                      *HTTPServerSettings    `json:"http,omitempty"`
+	REST                      *RESTServerSettings    `json:"rest,omitempty"`
+	JSONRPC                   *JSONRPCServerSettings `json:"jsonrpc,omitempty"`
+	Keys                      []*crypto.Key          `json:"keys,omitempty"`
+	Secret                    []byte                 `json:"secret,omitempty"`
+	ProviderCodesEnabled      bool                   `json:"provider_codes_enabled,omitempty"`
+	UserCodesEnabled          bool                   `json:"user_codes_enabled,omitempty"`
+	UserCodesReuseLimit       int64                  `json:"user_codes_reuse_limit"`
+	ProviderCodesReuseLimit   int64                  `json:"provider_codes_reuse_limit"`
+	ResponseMaxProvider       int64                  `json:"response_max_provider"`
+	ResponseMaxAppointment    int64                  `json:"response_max_appointment"`
+	ProviderApprovalsRequired int64                  `json:"provider_approvals_required"`
+	ProviderClaimLeaseMinutes int64                  `json:"provider_claim_lease_minutes"`
+	// signed requests are accepted during the validity window and only once
+	SignatureValiditySeconds int64 `json:"signature_validity_seconds"`
+	ClockSkewSeconds         int64 `json:"clock_skew_seconds"`
+	TokenValidityDays        int64 `json:"token_validity_days"`
+	// at most this many tokens are issued per hash during the window (0 = unlimited)
+	TokenIssuanceLimit       int64 `json:"token_issuance_limit"`
+	TokenIssuanceWindowHours int64 `json:"token_issuance_window_hours"`
+	// if enabled users need to solve a proof-of-work challenge to get a token
+	TokenChallengeEnabled         bool  `json:"token_challenge_enabled,omitempty"`
+	TokenChallengeDifficulty      int64 `json:"token_challenge_difficulty"`
+	TokenChallengeMaxDifficulty   int64 `json:"token_challenge_max_difficulty"`
+	TokenChallengeRate            int64 `json:"token_challenge_rate"`
+	TokenChallengeValiditySeconds int64 `json:"token_challenge_validity_seconds"`
 }
 
 func (a *AppointmentsSettings) Key(name string) *crypto.Key {
@@ -25,6 +25,9 @@ import (
 )
 
 type Mediator struct {
+	// key types of the mediator keys (default: 'ecdsa' & 'ecdh')
+	SigningKeyType    string
+	EncryptionKeyType string
 }
 
 // Creates a new mediator and
@@ -36,7 +39,7 @@ func (c Mediator) Setup(fixtures map[string]interface{}) (interface{}, error) {
 		return nil, fmt.Errorf("client missing")
 	}
 
-	mediator, err := crypto.MakeActor("mediator")
+	mediator, err := crypto.MakeActorWithKeyTypes("mediator", keyType(c.SigningKeyType, "ecdsa"), keyType(c.EncryptionKeyType, "ecdh"))
 
 	if err != nil {
 		return nil, err
@@ -53,6 +56,13 @@ func (c Mediator) Setup(fixtures map[string]interface{}) (interface{}, error) {
 
 }
 
+func keyType(keyType, defaultType string) string {
+	if keyType == "" {
+		return defaultType
+	}
+	return keyType
+}
+
 func (c Mediator) Teardown(fixture interface{}) error {
 	return nil
 }
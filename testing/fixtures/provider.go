@@ -34,6 +34,9 @@ type Provider struct {
 	Accessible  bool
 	Confirm     bool
 	StoreData   bool
+	// key types of the provider keys (default: 'ecdsa' & 'ecdh')
+	SigningKeyType    string
+	EncryptionKeyType string
 }
 
 // Creates a new provider and
@@ -51,7 +54,7 @@ func (c Provider) Setup(fixtures map[string]interface{}) (interface{}, error) {
 		return nil, fmt.Errorf("mediator missing")
 	}
 
-	actor, err := crypto.MakeActor("provider")
+	actor, err := crypto.MakeActorWithKeyTypes("provider", keyType(c.SigningKeyType, "ecdsa"), keyType(c.EncryptionKeyType, "ecdh"))
 
 	if err != nil {
 		return nil, err